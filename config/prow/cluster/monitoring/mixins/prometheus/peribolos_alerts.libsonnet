@@ -0,0 +1,50 @@
+{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'peribolos-drift',
+        rules: [
+          {
+            alert: 'PeribolosUnmanagedMembership',
+            expr: |||
+              sum by (org) (peribolos_drift_changes{kind=~"org-member|team-member|repo-collaborator", action=~"update|delete"}) > 0
+            |||,
+            'for': '15m',
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              message: 'Someone granted access to the {{ $labels.org }} GitHub org outside of the org config, e.g. made someone an admin by hand. See the drift issue or the peribolos_drift_changes metric.',
+            },
+          },
+          {
+            alert: 'PeribolosDrift',
+            expr: |||
+              sum by (org, kind) (peribolos_drift_changes) > 0
+            |||,
+            'for': '6h',
+            labels: {
+              severity: 'high',
+            },
+            annotations: {
+              message: 'The {{ $labels.kind }} settings of the {{ $labels.org }} GitHub org have differed from the org config for 6 hours.',
+            },
+          },
+          {
+            alert: 'PeribolosDriftCheckFailing',
+            expr: |||
+              time() - max by (org) (peribolos_drift_last_check_timestamp_seconds) > 3 * 3600
+            |||,
+            'for': '5m',
+            labels: {
+              severity: 'high',
+            },
+            annotations: {
+              message: 'Peribolos has not compared the {{ $labels.org }} GitHub org with the org config for 3 hours.',
+            },
+          }
+        ],
+      },
+    ],
+  },
+}
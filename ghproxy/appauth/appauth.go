@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package appauth authenticates the unauthenticated requests of clients as a
+// GitHub App, using the installation token of the org of each request.
+package appauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/ghproxy/ghcache"
+	"k8s.io/test-infra/prow/github"
+)
+
+// OrgHeader selects the org whose installation token authenticates a
+// request. It is required for requests whose org isn't part of their path,
+// like GraphQL queries, unless a default org is configured.
+const OrgHeader = "X-PROW-GITHUB-ORG"
+
+var tokenErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "ghproxy_app_installation_token_errors",
+	Help: "How many requests failed because no installation token could be minted for their org.",
+}, []string{"org"})
+
+func init() {
+	prometheus.MustRegister(tokenErrors)
+}
+
+// New returns a RoundTripper that authenticates requests without an
+// Authorization header with the installation token of the app for their org.
+// The requests of each installation share a cache partition and their token
+// budget is identified as "<slug> - <org>", like for Prow's GitHub client.
+func New(delegate http.RoundTripper, slug string, tokenFor github.GitHubAppTokenGenerator, defaultOrg string) http.RoundTripper {
+	return &appAuthTransport{
+		delegate:   delegate,
+		slug:       slug,
+		tokenFor:   tokenFor,
+		defaultOrg: defaultOrg,
+	}
+}
+
+type appAuthTransport struct {
+	delegate   http.RoundTripper
+	slug       string
+	tokenFor   github.GitHubAppTokenGenerator
+	defaultOrg string
+}
+
+func (t *appAuthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if r.Header.Get("Authorization") != "" {
+		// Clients with their own credentials can't choose another partition.
+		r.Header.Del(ghcache.CachePartitionHeader)
+		return t.delegate.RoundTrip(r)
+	}
+
+	org := orgOf(r)
+	if org == "" {
+		org = t.defaultOrg
+	}
+	if org == "" {
+		return nil, fmt.Errorf("failed to determine the org of %s %s to authenticate it, it must be set in the %s header", r.Method, r.URL.Path, OrgHeader)
+	}
+	token, err := t.tokenFor(org)
+	if err != nil {
+		tokenErrors.WithLabelValues(org).Inc()
+		logrus.WithField("org", org).WithError(err).Error("Failed to get installation token.")
+		return nil, err
+	}
+
+	budget := t.slug + " - " + org
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(ghcache.TokenBudgetIdentifierHeader, budget)
+	r.Header.Set(ghcache.CachePartitionHeader, budget)
+	return t.delegate.RoundTrip(r)
+}
+
+// orgOf returns the org of the request from the OrgHeader or from its path,
+// or an empty string if it can't tell.
+func orgOf(r *http.Request) string {
+	if org := r.Header.Get(OrgHeader); org != "" {
+		return org
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) >= 2 && (parts[0] == "repos" || parts[0] == "orgs") {
+		return parts[1]
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appauth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/test-infra/ghproxy/ghcache"
+)
+
+type fakeTransport struct {
+	header http.Header
+}
+
+func (f *fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.header = r.Header
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	tokenFor := func(org string) (string, error) {
+		if org == "not-installed" {
+			return "", errors.New("the github app is not installed in organization not-installed")
+		}
+		return "token-" + org, nil
+	}
+	testCases := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		defaultOrg string
+		expected   map[string]string
+		expectErr  bool
+	}{
+		{
+			name: "org from repo path",
+			path: "/repos/org/repo/pulls/1",
+			expected: map[string]string{
+				"Authorization":                     "Bearer token-org",
+				ghcache.TokenBudgetIdentifierHeader: "my-app - org",
+				ghcache.CachePartitionHeader:        "my-app - org",
+			},
+		},
+		{
+			name: "org from org path",
+			path: "/orgs/other/members",
+			expected: map[string]string{
+				"Authorization":                     "Bearer token-other",
+				ghcache.TokenBudgetIdentifierHeader: "my-app - other",
+				ghcache.CachePartitionHeader:        "my-app - other",
+			},
+		},
+		{
+			name:       "org header takes precedence",
+			path:       "/graphql",
+			header:     map[string]string{OrgHeader: "org"},
+			defaultOrg: "default",
+			expected: map[string]string{
+				"Authorization":                     "Bearer token-org",
+				ghcache.TokenBudgetIdentifierHeader: "my-app - org",
+				ghcache.CachePartitionHeader:        "my-app - org",
+			},
+		},
+		{
+			name:       "default org",
+			path:       "/graphql",
+			defaultOrg: "default",
+			expected: map[string]string{
+				"Authorization":                     "Bearer token-default",
+				ghcache.TokenBudgetIdentifierHeader: "my-app - default",
+				ghcache.CachePartitionHeader:        "my-app - default",
+			},
+		},
+		{
+			name:      "unknown org",
+			path:      "/graphql",
+			expectErr: true,
+		},
+		{
+			name:      "app not installed",
+			path:      "/repos/not-installed/repo",
+			expectErr: true,
+		},
+		{
+			name:   "client credentials are kept",
+			path:   "/repos/org/repo",
+			header: map[string]string{"Authorization": "Bearer client", ghcache.CachePartitionHeader: "my-app - org"},
+			expected: map[string]string{
+				"Authorization": "Bearer client",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegate := &fakeTransport{}
+			transport := New(delegate, "my-app", tokenFor, tc.defaultOrg)
+			req, err := http.NewRequest(http.MethodGet, "http://ghproxy"+tc.path, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			_, err = transport.RoundTrip(req)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if tc.expectErr {
+				return
+			}
+			got := map[string]string{}
+			for _, k := range []string{"Authorization", ghcache.TokenBudgetIdentifierHeader, ghcache.CachePartitionHeader} {
+				if v := delegate.header.Get(k); v != "" {
+					got[k] = v
+				}
+			}
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected headers (-want +got):\n%s", diff)
+			}
+			if req.Header.Get("Authorization") != tc.header["Authorization"] {
+				t.Error("expected the original request not to be modified")
+			}
+		})
+	}
+}
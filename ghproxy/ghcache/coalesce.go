@@ -22,10 +22,10 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/gregjones/httpcache"
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/test-infra/ghproxy/ghmetrics"
@@ -38,6 +38,12 @@ type requestCoalescer struct {
 	keys map[string]*responseWaiter
 
 	delegate http.RoundTripper
+	// graphql handles GraphQL queries if set.
+	graphql *graphQLCache
+	// invalidator tracks which cached responses may be served without
+	// revalidation if set, cache is the cache of the partition.
+	invalidator *Invalidator
+	cache       httpcache.Cache
 
 	hasher ghmetrics.Hasher
 }
@@ -48,6 +54,8 @@ type responseWaiter struct {
 	waiting bool
 	resp    []byte
 	err     error
+	// cost is the GraphQL cost of the response, see graphQLCache.
+	cost int
 }
 
 // RoundTrip coalesces concurrent GET requests for the same URI by blocking
@@ -58,23 +66,39 @@ type responseWaiter struct {
 // acquired before responseWaiter lock if both locks are to be held and we
 // never hold multiple responseWaiter locks.
 func (r *requestCoalescer) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Only coalesce GET requests
+	// Only coalesce GET requests, GraphQL queries are handled separately.
 	if req.Method != http.MethodGet {
-		resp, err := r.delegate.RoundTrip(req)
-		if strings.HasPrefix(req.URL.Path, "graphql") || strings.HasPrefix(req.URL.Path, "/graphql") {
-			var tokenBudgetName string
-			if val := req.Header.Get(TokenBudgetIdentifierHeader); val != "" {
-				tokenBudgetName = val
-			} else {
-				tokenBudgetName = r.hasher.Hash(req)
+		if !isGraphQL(req) {
+			resp, err := r.delegate.RoundTrip(req)
+			if r.invalidator != nil && succeeded(resp, err) {
+				r.invalidator.wrote(req.URL.Path)
 			}
+			return resp, err
+		}
+		var tokenBudgetName string
+		if val := req.Header.Get(TokenBudgetIdentifierHeader); val != "" {
+			tokenBudgetName = val
+		} else {
+			tokenBudgetName = r.hasher.Hash(req)
+		}
+		if r.graphql == nil {
+			resp, err := r.delegate.RoundTrip(req)
 			collectMetrics(ModeNoStore, req, resp, tokenBudgetName)
+			return resp, err
 		}
+		resp, mode, err := r.graphql.RoundTrip(req)
+		collectMetrics(mode, req, resp, tokenBudgetName)
 		return resp, err
 	}
 
 	var cacheMode = ModeError
 	resp, err := func() (*http.Response, error) {
+		if r.invalidator != nil {
+			if resp := r.invalidator.cachedResponse(r, req); resp != nil {
+				cacheMode = ModeCached
+				return resp, nil
+			}
+		}
 		key := req.URL.String()
 		r.Lock()
 		waiter, ok := r.keys[key]
@@ -117,6 +141,7 @@ func (r *requestCoalescer) RoundTrip(req *http.Request) (*http.Response, error)
 		r.keys[key] = waiter
 		r.Unlock()
 
+		start := time.Now()
 		resp, err := r.delegate.RoundTrip(req)
 		// Real response received. Remove this responseWaiter from the map THEN
 		// wake any requesters that were waiting on this response.
@@ -141,6 +166,9 @@ func (r *requestCoalescer) RoundTrip(req *http.Request) (*http.Response, error)
 			return nil, err
 		}
 		cacheMode = cacheResponseMode(resp.Header)
+		if r.invalidator != nil {
+			r.invalidator.validated(r, req, start, resp, cacheMode)
+		}
 		return resp, nil
 	}()
 
@@ -21,12 +21,13 @@ limitations under the License.
 // with a conditional request to upstream regardless of cache entry freshness
 // because conditional requests for unchanged resources don't cost any API
 // tokens!!! See: https://developer.github.com/v3/#conditional-requests
+// Cache hits for resources that webhooks tell didn't change since they were
+// last revalidated are served without contacting upstream at all.
 //
 // It also provides request coalescing and prometheus instrumentation.
 package ghcache
 
 import (
-	"context"
 	"crypto/sha256"
 	"fmt"
 	"net/http"
@@ -42,7 +43,6 @@ import (
 	"github.com/peterbourgon/diskv"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/semaphore"
 	"k8s.io/test-infra/ghproxy/ghmetrics"
 )
 
@@ -60,6 +60,7 @@ const (
 	// free (no API tokens used).
 	ModeCoalesced   CacheResponseMode = "COALESCED"   // coalesced request, this is a copied response
 	ModeRevalidated CacheResponseMode = "REVALIDATED" // cached value revalidated and returned
+	ModeCached      CacheResponseMode = "CACHED"      // cached value returned without contacting upstream
 
 	// cacheEntryCreationDateHeader contains the creation date of the cache entry
 	cacheEntryCreationDateHeader = "X-PROW-REQUEST-DATE"
@@ -76,6 +77,8 @@ func CacheModeIsFree(mode CacheResponseMode) bool {
 		return true
 	case ModeRevalidated:
 		return true
+	case ModeCached:
+		return true
 	case ModeError:
 		// In this case we did not successfully communicate with the GH API, so no
 		// token is used, but we also don't return a response, so ModeError won't
@@ -127,29 +130,6 @@ func cacheResponseMode(headers http.Header) CacheResponseMode {
 	return ModeMiss
 }
 
-func newThrottlingTransport(maxConcurrency int, delegate http.RoundTripper) http.RoundTripper {
-	return &throttlingTransport{sem: semaphore.NewWeighted(int64(maxConcurrency)), delegate: delegate}
-}
-
-// throttlingTransport throttles outbound concurrency from the proxy
-type throttlingTransport struct {
-	sem      *semaphore.Weighted
-	delegate http.RoundTripper
-}
-
-func (c *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	pendingOutboundConnectionsGauge.Inc()
-	if err := c.sem.Acquire(context.Background(), 1); err != nil {
-		logrus.WithField("cache-key", req.URL.String()).WithError(err).Error("Internal error acquiring semaphore.")
-		return nil, err
-	}
-	defer c.sem.Release(1)
-	pendingOutboundConnectionsGauge.Dec()
-	outboundConcurrencyGauge.Inc()
-	defer outboundConcurrencyGauge.Dec()
-	return c.delegate.RoundTrip(req)
-}
-
 // upstreamTransport changes response headers from upstream before they
 // reach the cache layer in order to force the caching policy we require.
 //
@@ -200,7 +180,7 @@ func (u upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 
 	apiVersion := "v3"
-	if strings.HasPrefix(req.URL.Path, "graphql") || strings.HasPrefix(req.URL.Path, "/graphql") {
+	if isGraphQL(req) {
 		resp.Header.Set("Cache-Control", "no-store")
 		apiVersion = "v4"
 	}
@@ -226,7 +206,7 @@ const LogMessageWithDiskPartitionFields = "Not using a partitioned cache because
 // NewDiskCache creates a GitHub cache RoundTripper that is backed by a disk
 // cache.
 // It supports a partitioned cache.
-func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxConcurrency int, legacyDisablePartitioningByAuthHeader bool) http.RoundTripper {
+func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxConcurrency int, classes []RequestClass, legacyDisablePartitioningByAuthHeader bool, graphQLCacheTTL time.Duration, invalidator *Invalidator) http.RoundTripper {
 	if legacyDisablePartitioningByAuthHeader {
 		diskCache := diskcache.NewWithDiskv(
 			diskv.New(diskv.Options{
@@ -242,6 +222,9 @@ func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxC
 				return diskCache
 			},
 			maxConcurrency,
+			classes,
+			graphQLCacheTTL,
+			invalidator,
 		)
 	}
 	return NewFromCache(delegate,
@@ -254,32 +237,46 @@ func NewDiskCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxC
 				}))
 		},
 		maxConcurrency,
+		classes,
+		graphQLCacheTTL,
+		invalidator,
 	)
 }
 
 // NewMemCache creates a GitHub cache RoundTripper that is backed by a memory
 // cache.
 // It supports a partitioned cache.
-func NewMemCache(delegate http.RoundTripper, maxConcurrency int) http.RoundTripper {
+func NewMemCache(delegate http.RoundTripper, maxConcurrency int, classes []RequestClass, graphQLCacheTTL time.Duration, invalidator *Invalidator) http.RoundTripper {
 	return NewFromCache(delegate,
 		func(_ string) httpcache.Cache { return httpcache.NewMemoryCache() },
-		maxConcurrency)
+		maxConcurrency, classes, graphQLCacheTTL, invalidator)
 }
 
 // CachePartitionCreator creates a new cache partition using the given key
 type CachePartitionCreator func(partitionKey string) httpcache.Cache
 
 // NewFromCache creates a GitHub cache RoundTripper that is backed by the
-// specified httpcache.Cache implementation.
-func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int) http.RoundTripper {
+// specified httpcache.Cache implementation. Up to maxConcurrency requests
+// of each cache partition, i.e. token, are sent upstream concurrently,
+// scheduled according to the request classes.
+// GraphQL queries are cached in memory for graphQLCacheTTL, they are only
+// coalesced if it is zero. If an invalidator is given, cached responses of
+// resources it knows didn't change are served without revalidation.
+func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int, classes []RequestClass, graphQLCacheTTL time.Duration, invalidator *Invalidator) http.RoundTripper {
 	hasher := ghmetrics.NewCachingHasher()
 	return newPartitioningRoundTripper(func(partitionKey string) http.RoundTripper {
-		cacheTransport := httpcache.NewTransport(cache(partitionKey))
-		cacheTransport.Transport = newThrottlingTransport(maxConcurrency, upstreamTransport{delegate: delegate, hasher: hasher})
+		partitionCache := cache(partitionKey)
+		cacheTransport := httpcache.NewTransport(partitionCache)
+		cacheTransport.Transport = newThrottlingTransport(maxConcurrency, classes, upstreamTransport{delegate: delegate, hasher: hasher})
+		graphql := newGraphQLCache(cacheTransport, graphQLCacheTTL, hasher)
+		graphql.invalidator = invalidator
 		return &requestCoalescer{
-			keys:     make(map[string]*responseWaiter),
-			delegate: cacheTransport,
-			hasher:   hasher,
+			keys:        make(map[string]*responseWaiter),
+			delegate:    cacheTransport,
+			graphql:     graphql,
+			invalidator: invalidator,
+			cache:       partitionCache,
+			hasher:      hasher,
 		}
 	})
 }
@@ -289,7 +286,7 @@ func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxCo
 // Important note: The redis implementation does not support partitioning the cache
 // which means that requests to the same path from different tokens will invalidate
 // each other.
-func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurrency int) http.RoundTripper {
+func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurrency int, classes []RequestClass, graphQLCacheTTL time.Duration, invalidator *Invalidator) http.RoundTripper {
 	conn, err := redis.Dial("tcp", redisAddress)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error connecting to Redis")
@@ -297,5 +294,5 @@ func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurren
 	redisCache := rediscache.NewWithClient(conn)
 	return NewFromCache(delegate,
 		func(_ string) httpcache.Cache { return redisCache },
-		maxConcurrency)
+		maxConcurrency, classes, graphQLCacheTTL, invalidator)
 }
@@ -0,0 +1,248 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// isGraphQL returns true if the request is for the GraphQL API.
+func isGraphQL(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "graphql") || strings.HasPrefix(req.URL.Path, "/graphql")
+}
+
+// graphQLRequest is the body of a GraphQL API request.
+type graphQLRequest struct {
+	Query         string          `json:"query"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+	OperationName string          `json:"operationName,omitempty"`
+}
+
+// graphQLResponse holds the parts of a GraphQL API response ghcache cares
+// about.
+type graphQLResponse struct {
+	Data struct {
+		RateLimit *struct {
+			Cost int `json:"cost"`
+		} `json:"rateLimit"`
+	} `json:"data"`
+	Errors []json.RawMessage `json:"errors"`
+}
+
+type graphQLEntry struct {
+	resp    []byte
+	cost    int
+	expires time.Time
+}
+
+// graphQLCache caches the responses to GraphQL queries for a short time and
+// coalesces concurrent identical queries. Unlike REST responses, GraphQL
+// responses can't be revalidated for free, so cached responses are returned
+// as is until they expire. Mutations are never cached or coalesced.
+type graphQLCache struct {
+	sync.Mutex
+	entries map[string]*graphQLEntry
+	keys    map[string]*responseWaiter
+
+	// ttl is how long responses are cached, they are only coalesced if zero.
+	ttl time.Duration
+	now func() time.Time
+
+	// invalidator is told about mutations if set.
+	invalidator *Invalidator
+
+	delegate http.RoundTripper
+	hasher   ghmetrics.Hasher
+}
+
+func newGraphQLCache(delegate http.RoundTripper, ttl time.Duration, hasher ghmetrics.Hasher) *graphQLCache {
+	return &graphQLCache{
+		entries:  make(map[string]*graphQLEntry),
+		keys:     make(map[string]*responseWaiter),
+		ttl:      ttl,
+		now:      time.Now,
+		delegate: delegate,
+		hasher:   hasher,
+	}
+}
+
+// graphQLCacheKey returns the key identifying identical queries, ignoring
+// differences in whitespace and in the order of variables.
+func graphQLCacheKey(q graphQLRequest) (string, error) {
+	var variables interface{}
+	if len(q.Variables) > 0 {
+		if err := json.Unmarshal(q.Variables, &variables); err != nil {
+			return "", err
+		}
+	}
+	// Maps are marshalled with sorted keys.
+	canonical, err := json.Marshal(variables)
+	if err != nil {
+		return "", err
+	}
+	key := strings.Join([]string{strings.Join(strings.Fields(q.Query), " "), string(canonical), q.OperationName}, "\x00")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key))), nil
+}
+
+func isMutation(query string) bool {
+	return strings.HasPrefix(strings.TrimSpace(query), "mutation")
+}
+
+// RoundTrip answers GraphQL queries from the cache if possible and reports
+// how the request was fulfilled.
+func (g *graphQLCache) RoundTrip(req *http.Request) (*http.Response, CacheResponseMode, error) {
+	tokenBudgetName := req.Header.Get(TokenBudgetIdentifierHeader)
+	if tokenBudgetName == "" {
+		tokenBudgetName = g.hasher.Hash(req)
+	}
+	userAgent := req.Header.Get("User-Agent")
+
+	var q graphQLRequest
+	var key string
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, ModeError, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := json.Unmarshal(body, &q); err == nil && !isMutation(q.Query) {
+			key, _ = graphQLCacheKey(q)
+		}
+	}
+	if key == "" {
+		resp, cost, _, err := g.roundTrip(req)
+		if g.invalidator != nil && isMutation(q.Query) && succeeded(resp, err) {
+			g.invalidator.mutation()
+		}
+		if err != nil {
+			return nil, ModeError, err
+		}
+		ghmetrics.CollectGraphQLCostMetrics(tokenBudgetName, userAgent, string(ModeNoStore), cost)
+		return resp, ModeNoStore, nil
+	}
+	log := logrus.WithField("cache-key", key)
+
+	g.Lock()
+	if entry, ok := g.entries[key]; ok && g.now().Before(entry.expires) {
+		g.Unlock()
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.resp)), req)
+		if err != nil {
+			log.WithError(err).Error("Error loading cached GraphQL response.")
+			return nil, ModeError, err
+		}
+		ghmetrics.CollectGraphQLCostMetrics(tokenBudgetName, userAgent, string(ModeCached), entry.cost)
+		return resp, ModeCached, nil
+	}
+	if waiter, ok := g.keys[key]; ok {
+		// Identical query in flight. Wait for its response, see
+		// requestCoalescer.RoundTrip.
+		waiter.L.Lock()
+		g.Unlock()
+		waiter.waiting = true
+		waiter.Wait()
+		waiter.L.Unlock()
+		if waiter.err != nil {
+			return nil, ModeError, waiter.err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(waiter.resp)), req)
+		if err != nil {
+			log.WithError(err).Error("Error loading coalesced GraphQL response.")
+			return nil, ModeError, err
+		}
+		ghmetrics.CollectGraphQLCostMetrics(tokenBudgetName, userAgent, string(ModeCoalesced), waiter.cost)
+		return resp, ModeCoalesced, nil
+	}
+	waiter := &responseWaiter{Cond: sync.NewCond(&sync.Mutex{})}
+	g.keys[key] = waiter
+	g.Unlock()
+
+	resp, cost, cacheable, err := g.roundTrip(req)
+	var dump []byte
+	if err == nil {
+		dump, err = httputil.DumpResponse(resp, true)
+	}
+	mode := ModeNoStore
+	g.Lock()
+	delete(g.keys, key)
+	if err == nil && g.ttl > 0 && cacheable {
+		now := g.now()
+		for k, entry := range g.entries {
+			if !now.Before(entry.expires) {
+				delete(g.entries, k)
+			}
+		}
+		g.entries[key] = &graphQLEntry{resp: dump, cost: cost, expires: now.Add(g.ttl)}
+		mode = ModeMiss
+	}
+	g.Unlock()
+
+	waiter.L.Lock()
+	if waiter.waiting {
+		waiter.resp, waiter.cost, waiter.err = dump, cost, err
+		waiter.Broadcast()
+	}
+	waiter.L.Unlock()
+
+	if err != nil {
+		log.WithError(err).Warn("Error from cache transport layer.")
+		return nil, ModeError, err
+	}
+	ghmetrics.CollectGraphQLCostMetrics(tokenBudgetName, userAgent, string(mode), cost)
+	return resp, mode, nil
+}
+
+// roundTrip sends the request upstream and returns the response along with
+// the cost of the query reported in its rateLimit field, which is zero if the
+// query didn't ask for it. Only successful responses without errors may be
+// cached.
+func (g *graphQLCache) roundTrip(req *http.Request) (*http.Response, int, bool, error) {
+	resp, err := g.delegate.RoundTrip(req)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var parsed graphQLResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return resp, 0, false, nil
+	}
+	var cost int
+	if parsed.Data.RateLimit != nil {
+		cost = parsed.Data.RateLimit.Cost
+	}
+	return resp, cost, resp.StatusCode == http.StatusOK && len(parsed.Errors) == 0, nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// graphQLDelegate is a fake upstream that counts the requests it receives
+// and answers with the configured body. It waits to respond until signaled
+// if block is set.
+type graphQLDelegate struct {
+	lock  sync.Mutex
+	hits  int
+	body  string
+	block chan struct{}
+}
+
+func (d *graphQLDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.lock.Lock()
+	d.hits++
+	d.lock.Unlock()
+	if d.block != nil {
+		<-d.block
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(d.body)),
+	}, nil
+}
+
+func graphQLRequestFor(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/graphql", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	return req
+}
+
+func TestGraphQLCacheKey(t *testing.T) {
+	key := func(q graphQLRequest) string {
+		k, err := graphQLCacheKey(q)
+		if err != nil {
+			t.Fatalf("Failed to get cache key: %v", err)
+		}
+		return k
+	}
+	base := key(graphQLRequest{Query: "query { viewer { login } }", Variables: []byte(`{"a": 1, "b": "x"}`)})
+	if same := key(graphQLRequest{Query: "query {\n  viewer {\n    login\n  }\n}", Variables: []byte(`{"b":"x","a":1}`)}); same != base {
+		t.Error("Expected queries differing only in whitespace and variable order to share a cache key.")
+	}
+	if other := key(graphQLRequest{Query: "query { viewer { login } }", Variables: []byte(`{"a": 2, "b": "x"}`)}); other == base {
+		t.Error("Expected queries with different variables to have different cache keys.")
+	}
+}
+
+func TestGraphQLCache(t *testing.T) {
+	const query = `{"query": "query { rateLimit { cost } viewer { login } }"}`
+	testCases := []struct {
+		name         string
+		ttl          time.Duration
+		requests     []string
+		body         string
+		advance      time.Duration
+		expectedHits int
+		expected     []CacheResponseMode
+	}{
+		{
+			name:         "cached within TTL",
+			ttl:          time.Minute,
+			requests:     []string{query, query},
+			body:         `{"data": {"rateLimit": {"cost": 1}, "viewer": {"login": "bot"}}}`,
+			expectedHits: 1,
+			expected:     []CacheResponseMode{ModeMiss, ModeCached},
+		},
+		{
+			name:         "expired",
+			ttl:          time.Minute,
+			requests:     []string{query, query},
+			body:         `{"data": {"rateLimit": {"cost": 1}, "viewer": {"login": "bot"}}}`,
+			advance:      2 * time.Minute,
+			expectedHits: 2,
+			expected:     []CacheResponseMode{ModeMiss, ModeMiss},
+		},
+		{
+			name:         "caching disabled",
+			requests:     []string{query, query},
+			body:         `{"data": {"rateLimit": {"cost": 1}, "viewer": {"login": "bot"}}}`,
+			expectedHits: 2,
+			expected:     []CacheResponseMode{ModeNoStore, ModeNoStore},
+		},
+		{
+			name:         "errors are not cached",
+			ttl:          time.Minute,
+			requests:     []string{query, query},
+			body:         `{"data": null, "errors": [{"message": "boom"}]}`,
+			expectedHits: 2,
+			expected:     []CacheResponseMode{ModeNoStore, ModeNoStore},
+		},
+		{
+			name: "mutations are not cached",
+			ttl:  time.Minute,
+			requests: []string{
+				`{"query": "mutation($input: AddCommentInput!) { addComment(input: $input) { clientMutationId } }"}`,
+				`{"query": "mutation($input: AddCommentInput!) { addComment(input: $input) { clientMutationId } }"}`,
+			},
+			body:         `{"data": {"addComment": {"clientMutationId": null}}}`,
+			expectedHits: 2,
+			expected:     []CacheResponseMode{ModeNoStore, ModeNoStore},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegate := &graphQLDelegate{body: tc.body}
+			cache := newGraphQLCache(delegate, tc.ttl, ghmetrics.NewCachingHasher())
+			now := time.Now()
+			cache.now = func() time.Time { return now }
+
+			for i, body := range tc.requests {
+				resp, mode, err := cache.RoundTrip(graphQLRequestFor(t, body))
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if mode != tc.expected[i] {
+					t.Errorf("Expected mode %s for request %d, got %s", tc.expected[i], i, mode)
+				}
+				got, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("Failed to read response: %v", err)
+				}
+				if string(got) != tc.body {
+					t.Errorf("Expected response %q for request %d, got %q", tc.body, i, string(got))
+				}
+				now = now.Add(tc.advance)
+			}
+			if delegate.hits != tc.expectedHits {
+				t.Errorf("Expected %d upstream requests, got %d", tc.expectedHits, delegate.hits)
+			}
+		})
+	}
+}
+
+func TestGraphQLCacheCoalescing(t *testing.T) {
+	const query = `{"query": "query { viewer { login } }"}`
+	delegate := &graphQLDelegate{body: `{"data": {"viewer": {"login": "bot"}}}`, block: make(chan struct{})}
+	cache := newGraphQLCache(delegate, 0, ghmetrics.NewCachingHasher())
+
+	modes := make(chan CacheResponseMode, 3)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, mode, err := cache.RoundTrip(graphQLRequestFor(t, query))
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			modes <- mode
+		}()
+	}
+	// Wait for the later requests to wait for the first one before responding.
+	for {
+		cache.Lock()
+		waiter := cache.keys[graphQLKeyFor(t, query)]
+		cache.Unlock()
+		if waiter != nil {
+			waiter.L.Lock()
+			waiting := waiter.waiting
+			waiter.L.Unlock()
+			if waiting {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(delegate.block)
+	wg.Wait()
+	close(modes)
+
+	counts := map[CacheResponseMode]int{}
+	for mode := range modes {
+		counts[mode]++
+	}
+	if delegate.hits != 1 {
+		t.Errorf("Expected a single upstream request, got %d", delegate.hits)
+	}
+	if counts[ModeCoalesced] != 2 || counts[ModeNoStore] != 1 {
+		t.Errorf("Expected one uncached and two coalesced responses, got %v", counts)
+	}
+}
+
+func graphQLKeyFor(t *testing.T, body string) string {
+	var q graphQLRequest
+	if err := json.Unmarshal([]byte(body), &q); err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	key, err := graphQLCacheKey(q)
+	if err != nil {
+		t.Fatalf("Failed to get cache key: %v", err)
+	}
+	return key
+}
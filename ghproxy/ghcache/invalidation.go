@@ -0,0 +1,401 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	invalidationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ghcache_invalidations",
+		Help: "How many times cached resources were invalidated, by cause: the webhook event, a write or a GraphQL mutation.",
+	}, []string{"cause"})
+	prefetchCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ghcache_prefetched_requests",
+		Help: "How many cached responses were refreshed after their resource changed.",
+	})
+)
+
+// maxPrefetches is how many cached responses are refreshed concurrently.
+// Refreshes beyond it are skipped, the responses are revalidated when they
+// are next requested instead.
+const maxPrefetches = 10
+
+func init() {
+	prometheus.MustRegister(invalidationsCounter)
+	prometheus.MustRegister(prefetchCounter)
+}
+
+// Invalidator tracks the changes to GitHub resources announced by webhooks
+// and by the writes sent through the cache, so that cached responses for
+// resources that didn't change since they were last validated can be served
+// without revalidating them upstream.
+//
+// Only the pull requests, issues, labels and statuses of the repos whose
+// webhooks are received are tracked. Any other change to a repo invalidates
+// all of its resources.
+type Invalidator struct {
+	lock sync.Mutex
+	// repos are the orgs and org/repos, in lower case, whose webhooks are
+	// received.
+	repos        map[string]bool
+	maxStaleness time.Duration
+	prefetch     bool
+	// prefetching holds a token for each refresh in flight.
+	prefetching chan struct{}
+
+	// changed holds when resources last changed, keyed by their repo followed
+	// by the resource. The repo alone is the key of changes to all of them.
+	changed map[string]time.Time
+	// mutated is when a GraphQL mutation, which could change anything, was
+	// last sent.
+	mutated     time.Time
+	validations map[validationKey]validation
+	lastPrune   time.Time
+	now         func() time.Time
+}
+
+type validationKey struct {
+	partition *requestCoalescer
+	url       string
+}
+
+// validation records when a cached response was last known to be up to date.
+type validation struct {
+	at             time.Time
+	etag           string
+	repo, resource string
+	req            *http.Request
+}
+
+// NewInvalidator returns an Invalidator for the given orgs and org/repos,
+// serving their untouched cached responses without revalidation for up to
+// maxStaleness. If prefetch is true, the cached responses of pull requests,
+// issues, labels and statuses are refreshed as soon as they change.
+func NewInvalidator(repos []string, maxStaleness time.Duration, prefetch bool) *Invalidator {
+	i := &Invalidator{
+		repos:        map[string]bool{},
+		maxStaleness: maxStaleness,
+		prefetch:     prefetch,
+		prefetching:  make(chan struct{}, maxPrefetches),
+		changed:      map[string]time.Time{},
+		validations:  map[validationKey]validation{},
+		now:          time.Now,
+	}
+	for _, repo := range repos {
+		i.repos[strings.ToLower(repo)] = true
+	}
+	return i
+}
+
+// resourceOf returns the repo of a GitHub API path and the resource of the
+// repo it is part of. The resource is empty if its changes aren't tracked.
+func resourceOf(path string) (string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	// Skip the base path of GitHub Enterprise, e.g. /api/v3.
+	for len(parts) > 0 && parts[0] != "repos" {
+		parts = parts[1:]
+	}
+	if len(parts) < 3 {
+		return "", ""
+	}
+	repo, rest := strings.ToLower(parts[1]+"/"+parts[2]), parts[3:]
+	if len(rest) == 0 {
+		return repo, ""
+	}
+	switch rest[0] {
+	case "issues", "pulls":
+		// Issues and pull requests share their numbers.
+		if len(rest) == 1 {
+			return repo, "/issues"
+		}
+		if _, err := strconv.Atoi(rest[1]); err == nil {
+			return repo, "#" + rest[1]
+		}
+	case "labels":
+		return repo, "/labels"
+	case "statuses":
+		return repo, "/statuses"
+	case "commits":
+		if len(rest) == 3 {
+			switch rest[2] {
+			case "status", "statuses", "check-runs", "check-suites":
+				return repo, "/statuses"
+			}
+		}
+	}
+	return repo, ""
+}
+
+func (i *Invalidator) covers(repo string) bool {
+	return i.repos[repo] || i.repos[strings.SplitN(repo, "/", 2)[0]]
+}
+
+// isFresh returns true if the resource of a validated response didn't change
+// since. The lock must be held.
+func (i *Invalidator) isFresh(v validation, now time.Time) bool {
+	return now.Sub(v.at) < i.maxStaleness && v.at.After(i.mutated) && v.at.After(i.changed[v.repo]) && v.at.After(i.changed[v.repo+v.resource])
+}
+
+// cachedResponse returns the cached response to a GET request of the
+// partition if its resource didn't change since it was validated, or nil.
+func (i *Invalidator) cachedResponse(partition *requestCoalescer, req *http.Request) *http.Response {
+	repo, resource := resourceOf(req.URL.Path)
+	if resource == "" || !i.covers(repo) {
+		return nil
+	}
+	i.lock.Lock()
+	v, ok := i.validations[validationKey{partition: partition, url: req.URL.String()}]
+	fresh := ok && i.isFresh(v, i.now())
+	i.lock.Unlock()
+	if !fresh {
+		return nil
+	}
+	resp, err := httpcache.CachedResponse(partition.cache, req)
+	if err != nil || resp == nil {
+		return nil
+	}
+	// The cache only stores responses once they are read to the end, it may
+	// still hold an older one. It must also match the varied headers.
+	if resp.Header.Get("ETag") != v.etag || !varyMatches(resp, req) {
+		resp.Body.Close()
+		return nil
+	}
+	return resp
+}
+
+// varyMatches returns true if the request has the values of the headers the
+// cached response varies by, like httpcache does.
+func varyMatches(cachedResp *http.Response, req *http.Request) bool {
+	for _, vary := range cachedResp.Header["Vary"] {
+		for _, header := range strings.Split(vary, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header != "" && req.Header.Get(header) != cachedResp.Header.Get("X-Varied-"+header) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validated records the response to a GET request of the partition that was
+// sent upstream at the given time.
+func (i *Invalidator) validated(partition *requestCoalescer, req *http.Request, at time.Time, resp *http.Response, mode CacheResponseMode) {
+	repo, resource := resourceOf(req.URL.Path)
+	if resource == "" || !i.covers(repo) {
+		return
+	}
+	key := validationKey{partition: partition, url: req.URL.String()}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	etag := resp.Header.Get("ETag")
+	if mode == ModeNoStore || resp.StatusCode != http.StatusOK || etag == "" {
+		delete(i.validations, key)
+		return
+	}
+	i.validations[key] = validation{
+		at:       at,
+		etag:     etag,
+		repo:     repo,
+		resource: resource,
+		req:      req.Clone(context.Background()),
+	}
+	i.prune()
+}
+
+// prune forgets the changes and validations that are too old to matter. The
+// lock must be held.
+func (i *Invalidator) prune() {
+	now := i.now()
+	if now.Sub(i.lastPrune) < i.maxStaleness {
+		return
+	}
+	i.lastPrune = now
+	for key, v := range i.validations {
+		if now.Sub(v.at) >= i.maxStaleness {
+			delete(i.validations, key)
+		}
+	}
+	// Changes before the oldest validation that may still be fresh can't
+	// invalidate anything.
+	for key, at := range i.changed {
+		if now.Sub(at) >= i.maxStaleness {
+			delete(i.changed, key)
+		}
+	}
+}
+
+// wrote invalidates the resource of a successful write request to the given
+// path. The write may have changed the resources in unexpected ways, e.g.
+// renaming a label renames it on all issues, so the whole repo is invalidated
+// unless it wrote a pull request, an issue or a status.
+func (i *Invalidator) wrote(path string) {
+	repo, resource := resourceOf(path)
+	if repo == "" {
+		return
+	}
+	switch {
+	case strings.HasPrefix(resource, "#"):
+		i.invalidate("write", repo, resource, "/issues")
+	case resource == "/issues", resource == "/statuses":
+		i.invalidate("write", repo, resource)
+	default:
+		i.invalidate("write", repo)
+	}
+}
+
+// succeeded returns true if a request sent upstream got a successful
+// response. Failed writes and mutations didn't change anything.
+func succeeded(resp *http.Response, err error) bool {
+	return err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// mutation invalidates all resources after a GraphQL mutation, as it can't
+// tell what it changed.
+func (i *Invalidator) mutation() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.mutated = i.now()
+	invalidationsCounter.WithLabelValues("graphql_mutation").Inc()
+}
+
+// invalidate records that the resources of the repo changed, or all of them
+// if none is given, and prefetches their cached responses if configured.
+func (i *Invalidator) invalidate(cause, repo string, resources ...string) {
+	i.lock.Lock()
+	now := i.now()
+	invalidationsCounter.WithLabelValues(cause).Inc()
+	if len(resources) == 0 {
+		i.changed[repo] = now
+		i.lock.Unlock()
+		return
+	}
+	changed := map[string]bool{}
+	for _, resource := range resources {
+		i.changed[repo+resource] = now
+		changed[resource] = true
+	}
+	var refresh []validationKey
+	if i.prefetch {
+		for key, v := range i.validations {
+			if v.repo == repo && changed[v.resource] && now.Sub(v.at) < i.maxStaleness {
+				refresh = append(refresh, key)
+			}
+		}
+	}
+	reqs := make([]*http.Request, 0, len(refresh))
+	for _, key := range refresh {
+		reqs = append(reqs, i.validations[key].req)
+		delete(i.validations, key)
+	}
+	i.lock.Unlock()
+
+	for n, key := range refresh {
+		select {
+		case i.prefetching <- struct{}{}:
+			go func(partition *requestCoalescer, req *http.Request) {
+				defer func() { <-i.prefetching }()
+				i.refresh(partition, req)
+			}(key.partition, reqs[n])
+		default:
+			logrus.WithField("cache-key", reqs[n].URL.String()).Debug("Too many prefetches in flight, skipping.")
+		}
+	}
+}
+
+// refresh sends a request that was recently answered from the cache again,
+// so that its response is up to date when it is next requested.
+func (i *Invalidator) refresh(partition *requestCoalescer, req *http.Request) {
+	prefetchCounter.Inc()
+	resp, err := partition.RoundTrip(req.Clone(context.Background()))
+	if err != nil {
+		logrus.WithField("cache-key", req.URL.String()).WithError(err).Debug("Failed to prefetch response.")
+		return
+	}
+	// The cache only stores responses that are read to the end.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// webhookEvent holds the parts of GitHub webhook payloads that identify the
+// changed resources.
+type webhookEvent struct {
+	Action string `json:"action"`
+	Number int    `json:"number"`
+	Repo   struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Issue struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	PullRequest struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+}
+
+// HandleEvent invalidates the cached resources changed by a GitHub webhook
+// event of the given type.
+func (i *Invalidator) HandleEvent(eventType string, payload []byte) error {
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return err
+	}
+	repo := strings.ToLower(event.Repo.FullName)
+	if repo == "" || eventType == "ping" {
+		// Org level events don't change any tracked resource.
+		return nil
+	}
+	switch eventType {
+	case "issues", "issue_comment", "pull_request", "pull_request_review", "pull_request_review_comment":
+		number := event.Number
+		for _, n := range []int{event.Issue.Number, event.PullRequest.Number} {
+			if number == 0 {
+				number = n
+			}
+		}
+		if number == 0 {
+			i.invalidate(eventType, repo)
+			return nil
+		}
+		i.invalidate(eventType, repo, "#"+strconv.Itoa(number), "/issues")
+	case "label":
+		// Editing or deleting a label changes it on all issues.
+		if event.Action == "created" {
+			i.invalidate(eventType, repo, "/labels")
+		} else {
+			i.invalidate(eventType, repo)
+		}
+	case "status", "check_run", "check_suite":
+		i.invalidate(eventType, repo, "/statuses")
+	default:
+		i.invalidate(eventType, repo)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gregjones/httpcache"
+)
+
+func TestResourceOf(t *testing.T) {
+	testCases := []struct {
+		path             string
+		expectedRepo     string
+		expectedResource string
+	}{
+		{path: "/repos/Org/Repo/pulls/12", expectedRepo: "org/repo", expectedResource: "#12"},
+		{path: "/repos/org/repo/pulls/12/files", expectedRepo: "org/repo", expectedResource: "#12"},
+		{path: "/repos/org/repo/issues/12/labels", expectedRepo: "org/repo", expectedResource: "#12"},
+		{path: "/api/v3/repos/org/repo/issues/12", expectedRepo: "org/repo", expectedResource: "#12"},
+		{path: "/repos/org/repo/issues", expectedRepo: "org/repo", expectedResource: "/issues"},
+		{path: "/repos/org/repo/issues/comments/42", expectedRepo: "org/repo"},
+		{path: "/repos/org/repo/labels/bug", expectedRepo: "org/repo", expectedResource: "/labels"},
+		{path: "/repos/org/repo/commits/abcdef/status", expectedRepo: "org/repo", expectedResource: "/statuses"},
+		{path: "/repos/org/repo/statuses/abcdef", expectedRepo: "org/repo", expectedResource: "/statuses"},
+		{path: "/repos/org/repo/commits/abcdef", expectedRepo: "org/repo"},
+		{path: "/repos/org/repo", expectedRepo: "org/repo"},
+		{path: "/orgs/org/members"},
+		{path: "/graphql"},
+	}
+	for _, tc := range testCases {
+		repo, resource := resourceOf(tc.path)
+		if repo != tc.expectedRepo || resource != tc.expectedResource {
+			t.Errorf("expected %q to be resource %q of repo %q, got %q of %q", tc.path, tc.expectedResource, tc.expectedRepo, resource, repo)
+		}
+	}
+}
+
+// etagDelegate is a fake upstream that answers with the current version of
+// each path as its ETag and body, or with 304 if it is already known.
+type etagDelegate struct {
+	lock       sync.Mutex
+	hits       int
+	versions   map[string]string
+	failWrites bool
+}
+
+func (d *etagDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.hits++
+	if d.failWrites && req.Method != http.MethodGet {
+		return &http.Response{StatusCode: http.StatusUnprocessableEntity, Header: http.Header{}, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	}
+	version := d.versions[req.URL.Path]
+	if version == "" {
+		version = "v1"
+	}
+	header := http.Header{}
+	header.Set("ETag", version)
+	if req.Header.Get("If-None-Match") == version {
+		return &http.Response{StatusCode: http.StatusNotModified, Header: header, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewBufferString(version))}, nil
+}
+
+func (d *etagDelegate) getHits() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.hits
+}
+
+func doRequest(t *testing.T, transport http.RoundTripper, method, path string) (string, CacheResponseMode) {
+	req, err := http.NewRequest(method, "http://localhost"+path, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return string(body), CacheResponseMode(resp.Header.Get(CacheModeHeader))
+}
+
+func TestInvalidation(t *testing.T) {
+	const pr = "/repos/org/repo/pulls/1"
+	delegate := &etagDelegate{}
+	invalidator := NewInvalidator([]string{"org", "other/covered"}, time.Minute, false)
+	transport := NewFromCache(delegate, func(string) httpcache.Cache { return httpcache.NewMemoryCache() }, 1, nil, 0, invalidator)
+	// Each case starts with a validated response, the first one is cached.
+	doRequest(t, transport, http.MethodGet, pr)
+
+	testCases := []struct {
+		name           string
+		event          string
+		payload        string
+		write          string
+		failWrite      bool
+		mutation       bool
+		path           string
+		expectUpstream bool
+	}{
+		{
+			name: "untouched resource",
+			path: pr,
+		},
+		{
+			name:           "repo whose webhooks are not received",
+			path:           "/repos/other/repo/pulls/1",
+			expectUpstream: true,
+		},
+		{
+			name:           "untracked resource",
+			path:           "/repos/org/repo/commits/abcdef",
+			expectUpstream: true,
+		},
+		{
+			name:           "pull request changed",
+			event:          "issue_comment",
+			payload:        `{"action": "created", "issue": {"number": 1}, "repository": {"full_name": "Org/Repo"}}`,
+			path:           pr,
+			expectUpstream: true,
+		},
+		{
+			name:    "other pull request changed",
+			event:   "pull_request",
+			payload: `{"action": "labeled", "number": 2, "repository": {"full_name": "org/repo"}}`,
+			path:    pr,
+		},
+		{
+			name:    "statuses changed",
+			event:   "status",
+			payload: `{"sha": "abcdef", "repository": {"full_name": "org/repo"}}`,
+			path:    pr,
+		},
+		{
+			name:           "repo changed",
+			event:          "push",
+			payload:        `{"ref": "refs/heads/master", "repository": {"full_name": "org/repo"}}`,
+			path:           pr,
+			expectUpstream: true,
+		},
+		{
+			name:           "pull request written",
+			write:          "/repos/org/repo/issues/1/labels",
+			path:           pr,
+			expectUpstream: true,
+		},
+		{
+			name:      "pull request write failed",
+			write:     "/repos/org/repo/issues/1/labels",
+			failWrite: true,
+			path:      pr,
+		},
+		{
+			name:  "non-mutation GraphQL query",
+			write: "/graphql",
+			path:  pr,
+		},
+		{
+			name:           "GraphQL mutation",
+			write:          "/graphql",
+			mutation:       true,
+			path:           pr,
+			expectUpstream: true,
+		},
+		{
+			name:      "GraphQL mutation failed",
+			write:     "/graphql",
+			mutation:  true,
+			failWrite: true,
+			path:      pr,
+		},
+		{
+			name:  "other pull request written",
+			write: "/repos/org/repo/issues/2/labels",
+			path:  pr,
+		},
+		{
+			name:           "repo written",
+			write:          "/repos/org/repo/labels/bug",
+			path:           pr,
+			expectUpstream: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.event != "" {
+				if err := invalidator.HandleEvent(tc.event, []byte(tc.payload)); err != nil {
+					t.Fatalf("failed to handle event: %v", err)
+				}
+			}
+			delegate.lock.Lock()
+			delegate.failWrites = tc.failWrite
+			delegate.lock.Unlock()
+			switch {
+			case tc.write == "/graphql":
+				query := `{"query": "query { viewer { login } }"}`
+				if tc.mutation {
+					query = `{"query": "mutation { addStar(input: {starrableId: \"1\"}) { clientMutationId } }"}`
+				}
+				req := graphQLRequestFor(t, query)
+				resp, err := transport.RoundTrip(req)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				resp.Body.Close()
+			case tc.write != "":
+				doRequest(t, transport, http.MethodPost, tc.write)
+			}
+			hits := delegate.getHits()
+			_, mode := doRequest(t, transport, http.MethodGet, tc.path)
+			if upstream := delegate.getHits() > hits; upstream != tc.expectUpstream {
+				t.Errorf("expected request to be sent upstream: %t, got %t", tc.expectUpstream, upstream)
+			}
+			if !tc.expectUpstream && mode != ModeCached {
+				t.Errorf("expected mode %s, got %s", ModeCached, mode)
+			}
+		})
+	}
+}
+
+func TestInvalidationMaxStaleness(t *testing.T) {
+	const pr = "/repos/org/repo/pulls/1"
+	delegate := &etagDelegate{}
+	invalidator := NewInvalidator([]string{"org"}, time.Minute, false)
+	now := time.Now()
+	invalidator.now = func() time.Time { return now }
+	transport := NewFromCache(delegate, func(string) httpcache.Cache { return httpcache.NewMemoryCache() }, 1, nil, 0, invalidator)
+
+	doRequest(t, transport, http.MethodGet, pr)
+	if _, mode := doRequest(t, transport, http.MethodGet, pr); mode != ModeCached {
+		t.Errorf("expected mode %s, got %s", ModeCached, mode)
+	}
+	now = now.Add(2 * time.Minute)
+	hits := delegate.getHits()
+	doRequest(t, transport, http.MethodGet, pr)
+	if delegate.getHits() == hits {
+		t.Error("expected the cached response to be revalidated once it is too old")
+	}
+}
+
+func TestInvalidationPrefetch(t *testing.T) {
+	const pr = "/repos/org/repo/pulls/1"
+	delegate := &etagDelegate{versions: map[string]string{}}
+	invalidator := NewInvalidator([]string{"org/repo"}, time.Minute, true)
+	cache := httpcache.NewMemoryCache()
+	transport := NewFromCache(delegate, func(string) httpcache.Cache { return cache }, 1, nil, 0, invalidator)
+
+	doRequest(t, transport, http.MethodGet, pr)
+	delegate.lock.Lock()
+	delegate.versions[pr] = "v2"
+	delegate.lock.Unlock()
+	if err := invalidator.HandleEvent("pull_request", []byte(`{"action": "synchronize", "number": 1, "repository": {"full_name": "org/repo"}}`)); err != nil {
+		t.Fatalf("failed to handle event: %v", err)
+	}
+
+	// Wait for the prefetched response to be cached.
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if cached, ok := cache.Get("http://localhost" + pr); ok && bytes.HasSuffix(cached, []byte("v2")) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("timed out waiting for the response to be prefetched")
+		}
+	}
+	body, mode := doRequest(t, transport, http.MethodGet, pr)
+	if mode != ModeCached || body != "v2" {
+		t.Errorf("expected the prefetched response v2 to be cached, got %q with mode %s", body, mode)
+	}
+	if hits := delegate.getHits(); hits != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", hits)
+	}
+}
+
+// blockingDelegate answers like etagDelegate once the block channel, if any,
+// is closed.
+type blockingDelegate struct {
+	etagDelegate
+	block chan struct{}
+}
+
+func (d *blockingDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.lock.Lock()
+	block := d.block
+	d.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+	return d.etagDelegate.RoundTrip(req)
+}
+
+func TestInvalidationPrefetchIsBounded(t *testing.T) {
+	const requests = maxPrefetches * 2
+	delegate := &blockingDelegate{}
+	invalidator := NewInvalidator([]string{"org/repo"}, time.Minute, true)
+	transport := NewFromCache(delegate, func(string) httpcache.Cache { return httpcache.NewMemoryCache() }, requests, nil, 0, invalidator)
+
+	var changed []string
+	for n := 0; n < requests; n++ {
+		doRequest(t, transport, http.MethodGet, "/repos/org/repo/pulls/"+strconv.Itoa(n))
+		changed = append(changed, "#"+strconv.Itoa(n))
+	}
+	block := make(chan struct{})
+	defer close(block)
+	delegate.lock.Lock()
+	delegate.block = block
+	delegate.lock.Unlock()
+	hits := delegate.getHits()
+
+	invalidator.invalidate("test", "org/repo", changed...)
+	inFlight := func() int {
+		return len(invalidator.prefetching)
+	}
+	for start := time.Now(); inFlight() < maxPrefetches; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("timed out waiting for the prefetches to start")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := inFlight(); n != maxPrefetches {
+		t.Errorf("expected %d prefetches in flight, got %d", maxPrefetches, n)
+	}
+	if delegate.getHits() != hits {
+		t.Error("expected the prefetches to be blocked")
+	}
+}
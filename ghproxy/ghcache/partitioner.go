@@ -44,9 +44,20 @@ type partitioningRoundTripper struct {
 	roundTrippers       map[string]http.RoundTripper
 }
 
+// CachePartitionHeader overrides the Authorization header as the key of the
+// cache partition of a request. ghproxy sets it for requests it authenticates
+// itself, so that their cache survives the rotation of their tokens, and
+// removes it from the requests it receives, so that clients can't read from
+// the cache partitions of others.
+const CachePartitionHeader = "X-PROW-GHCACHE-PARTITION"
+
 func getCachePartition(r *http.Request) string {
+	key := r.Header.Get("Authorization")
+	if partition := r.Header.Get(CachePartitionHeader); partition != "" {
+		key = partition
+	}
 	// Hash the key to make sure we dont leak it into the directory layout
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(r.Header.Get("Authorization"))))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
 }
 
 func (prt *partitioningRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
@@ -66,6 +66,9 @@ func TestPartitioningRoundTripper(t *testing.T) {
 		{Header: http.Header(map[string][]string{"Authorization": {"b"}})},
 		{Header: http.Header(map[string][]string{"Authorization": {"c"}})},
 		{Header: http.Header(map[string][]string{"Authorization": {"c"}})},
+		// The partition header takes precedence over rotating tokens.
+		{Header: http.Header(map[string][]string{"Authorization": {"d"}, http.CanonicalHeaderKey(CachePartitionHeader): {"c"}})},
+		{Header: http.Header(map[string][]string{"Authorization": {"e"}, http.CanonicalHeaderKey(CachePartitionHeader): {"c"}})},
 	}
 
 	// Do these in parallel to verify thread safety
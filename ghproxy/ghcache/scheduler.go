@@ -0,0 +1,330 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RequestClassHeader selects the request class of a request, overriding
+	// the class of its user agent.
+	RequestClassHeader = "X-PROW-GHPROXY-REQUEST-CLASS"
+
+	// DefaultRequestClass is the class of requests that match no other class.
+	// It has priority 0 and may use all of the concurrency unless configured.
+	DefaultRequestClass = "default"
+)
+
+// RequestClass configures how a class of requests is scheduled when they
+// compete for the concurrent requests to GitHub. Requests are scheduled per
+// token, so only the requests of clients sharing a token compete.
+type RequestClass struct {
+	// Name identifies the class, e.g. in the RequestClassHeader and metrics.
+	Name string `json:"name"`
+	// Priority orders the classes of waiting requests, the waiting requests
+	// of the class with the highest priority are sent first.
+	Priority int `json:"priority,omitempty"`
+	// MaxConcurrencyPerToken is the share of the concurrent requests of a
+	// token the class may use. Defaults to all of them.
+	MaxConcurrencyPerToken int `json:"max_concurrency_per_token,omitempty"`
+	// MinRemainingTokens defers requests of the class while fewer API tokens
+	// remain for the token until the rate limit resets, leaving them to more
+	// important classes.
+	MinRemainingTokens int `json:"min_remaining_tokens,omitempty"`
+	// UserAgents lists the user agents of the clients in the class, without
+	// version. Prow components are identified by their name, e.g. "hook" also
+	// matches "hook.lgtm".
+	UserAgents []string `json:"user_agents,omitempty"`
+}
+
+// ValidateRequestClasses validates the request classes for the given total
+// concurrency.
+func ValidateRequestClasses(classes []RequestClass, maxConcurrency int) error {
+	names := map[string]bool{}
+	userAgents := map[string]string{}
+	for _, class := range classes {
+		if class.Name == "" {
+			return errors.New("request class has no name")
+		}
+		if names[class.Name] {
+			return fmt.Errorf("request class %q is configured more than once", class.Name)
+		}
+		names[class.Name] = true
+		if class.MaxConcurrencyPerToken < 0 || class.MaxConcurrencyPerToken > maxConcurrency {
+			return fmt.Errorf("request class %q has invalid max_concurrency_per_token %d, must be between 0 and the concurrency %d", class.Name, class.MaxConcurrencyPerToken, maxConcurrency)
+		}
+		if class.MinRemainingTokens < 0 {
+			return fmt.Errorf("request class %q has negative min_remaining_tokens %d", class.Name, class.MinRemainingTokens)
+		}
+		for _, userAgent := range class.UserAgents {
+			if other, ok := userAgents[userAgent]; ok {
+				return fmt.Errorf("user agent %q belongs to both request class %q and %q", userAgent, other, class.Name)
+			}
+			userAgents[userAgent] = class.Name
+		}
+	}
+	return nil
+}
+
+var (
+	classPendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ghcache_class_pending_requests",
+		Help: "How many requests of each request class are waiting to be sent to GitHub servers.",
+	}, []string{"class"})
+	classConcurrencyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ghcache_class_concurrent_requests",
+		Help: "How many requests of each request class are in flight to GitHub servers.",
+	}, []string{"class"})
+	classWaitHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ghcache_class_wait_seconds",
+		Help:    "How long requests of each request class waited to be sent to GitHub servers.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{"class"})
+	classDeferredCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ghcache_class_deferred_requests",
+		Help: "How many requests of each request class were deferred because of a low token budget.",
+	}, []string{"class"})
+)
+
+func init() {
+	prometheus.MustRegister(classPendingGauge)
+	prometheus.MustRegister(classConcurrencyGauge)
+	prometheus.MustRegister(classWaitHistogram)
+	prometheus.MustRegister(classDeferredCounter)
+}
+
+// tokenBudget is the last known rate limit of the token for the REST or the
+// GraphQL API.
+type tokenBudget struct {
+	remaining int
+	reset     time.Time
+}
+
+type classState struct {
+	RequestClass
+	inFlight int
+	queue    []*ticket
+}
+
+// ticket is a request waiting to be sent upstream.
+type ticket struct {
+	graphql  bool
+	deferred bool
+	granted  chan struct{}
+}
+
+// throttlingTransport throttles outbound concurrency from the proxy. Requests
+// waiting for one of the concurrent requests are sent by priority of their
+// class, within the concurrency share of the class.
+type throttlingTransport struct {
+	lock      sync.Mutex
+	capacity  int
+	inFlight  int
+	classes   map[string]*classState
+	userAgent map[string]string
+	// budgets are indexed by whether they are for the GraphQL API.
+	budgets map[bool]tokenBudget
+	// timer wakes deferred requests once the rate limit resets.
+	timer *time.Timer
+	now   func() time.Time
+
+	delegate http.RoundTripper
+}
+
+func newThrottlingTransport(maxConcurrency int, classes []RequestClass, delegate http.RoundTripper) *throttlingTransport {
+	t := &throttlingTransport{
+		capacity:  maxConcurrency,
+		classes:   map[string]*classState{},
+		userAgent: map[string]string{},
+		budgets:   map[bool]tokenBudget{},
+		now:       time.Now,
+		delegate:  delegate,
+	}
+	for _, class := range append([]RequestClass{{Name: DefaultRequestClass}}, classes...) {
+		if class.MaxConcurrencyPerToken == 0 {
+			class.MaxConcurrencyPerToken = maxConcurrency
+		}
+		t.classes[class.Name] = &classState{RequestClass: class}
+		for _, userAgent := range class.UserAgents {
+			t.userAgent[userAgent] = class.Name
+		}
+	}
+	return t
+}
+
+// classOf returns the request class of the request.
+func (t *throttlingTransport) classOf(req *http.Request) *classState {
+	if class, ok := t.classes[req.Header.Get(RequestClassHeader)]; ok {
+		return class
+	}
+	userAgent := req.Header.Get("User-Agent")
+	if i := strings.Index(userAgent, "/"); i >= 0 {
+		userAgent = userAgent[:i]
+	}
+	for {
+		if name, ok := t.userAgent[userAgent]; ok {
+			return t.classes[name]
+		}
+		i := strings.LastIndex(userAgent, ".")
+		if i < 0 {
+			break
+		}
+		userAgent = userAgent[:i]
+	}
+	return t.classes[DefaultRequestClass]
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	class := t.classOf(req)
+	tk := &ticket{graphql: isGraphQL(req), granted: make(chan struct{})}
+	start := t.now()
+
+	pendingOutboundConnectionsGauge.Inc()
+	classPendingGauge.WithLabelValues(class.Name).Inc()
+	t.lock.Lock()
+	class.queue = append(class.queue, tk)
+	t.dispatch()
+	t.lock.Unlock()
+
+	select {
+	case <-tk.granted:
+	case <-req.Context().Done():
+		t.lock.Lock()
+		select {
+		case <-tk.granted:
+			// Granted concurrently, give the slot to the next request.
+			t.release(class)
+		default:
+			class.remove(tk)
+		}
+		t.lock.Unlock()
+		pendingOutboundConnectionsGauge.Dec()
+		classPendingGauge.WithLabelValues(class.Name).Dec()
+		logrus.WithField("cache-key", req.URL.String()).WithError(req.Context().Err()).Warn("Request cancelled while waiting to be sent upstream.")
+		return nil, req.Context().Err()
+	}
+	pendingOutboundConnectionsGauge.Dec()
+	classPendingGauge.WithLabelValues(class.Name).Dec()
+	classWaitHistogram.WithLabelValues(class.Name).Observe(t.now().Sub(start).Seconds())
+
+	outboundConcurrencyGauge.Inc()
+	classConcurrencyGauge.WithLabelValues(class.Name).Inc()
+	resp, err := t.delegate.RoundTrip(req)
+	outboundConcurrencyGauge.Dec()
+	classConcurrencyGauge.WithLabelValues(class.Name).Dec()
+
+	t.lock.Lock()
+	if err == nil {
+		t.updateBudget(tk.graphql, resp.Header)
+	}
+	t.release(class)
+	t.lock.Unlock()
+	return resp, err
+}
+
+// updateBudget records the rate limit reported by a response. The lock must
+// be held.
+func (t *throttlingTransport) updateBudget(graphql bool, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	t.budgets[graphql] = tokenBudget{remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// release frees the slot of a finished request of the class. The lock must
+// be held.
+func (t *throttlingTransport) release(class *classState) {
+	t.inFlight--
+	class.inFlight--
+	t.dispatch()
+}
+
+func (c *classState) remove(tk *ticket) {
+	for i := range c.queue {
+		if c.queue[i] == tk {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// isDeferred returns true if requests of the class for the given API should
+// wait for the rate limit to reset.
+func (t *throttlingTransport) isDeferred(class *classState, graphql bool, now time.Time) bool {
+	budget, ok := t.budgets[graphql]
+	return ok && class.MinRemainingTokens > 0 && budget.remaining < class.MinRemainingTokens && now.Before(budget.reset)
+}
+
+// dispatch sends waiting requests while there are free slots, highest
+// priority first. The lock must be held.
+func (t *throttlingTransport) dispatch() {
+	now := t.now()
+	var wakeAt time.Time
+	for t.inFlight < t.capacity {
+		var next *classState
+		var nextTicket *ticket
+		for _, class := range t.classes {
+			if class.inFlight >= class.MaxConcurrencyPerToken || (next != nil && class.Priority <= next.Priority) {
+				continue
+			}
+			for _, tk := range class.queue {
+				if t.isDeferred(class, tk.graphql, now) {
+					if !tk.deferred {
+						tk.deferred = true
+						classDeferredCounter.WithLabelValues(class.Name).Inc()
+					}
+					if reset := t.budgets[tk.graphql].reset; wakeAt.IsZero() || reset.Before(wakeAt) {
+						wakeAt = reset
+					}
+					continue
+				}
+				next, nextTicket = class, tk
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		next.remove(nextTicket)
+		next.inFlight++
+		t.inFlight++
+		close(nextTicket.granted)
+	}
+	if !wakeAt.IsZero() && t.timer == nil {
+		t.timer = time.AfterFunc(wakeAt.Sub(now), func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			t.timer = nil
+			t.dispatch()
+		})
+	}
+}
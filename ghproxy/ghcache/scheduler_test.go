@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testClasses = []RequestClass{
+	{Name: "hook", Priority: 10, UserAgents: []string{"hook", "tide"}},
+	{Name: "bulk", MaxConcurrencyPerToken: 1, MinRemainingTokens: 100, UserAgents: []string{"peribolos", "label_sync"}},
+}
+
+func TestValidateRequestClasses(t *testing.T) {
+	testCases := []struct {
+		name      string
+		classes   []RequestClass
+		expectErr bool
+	}{
+		{
+			name:    "valid",
+			classes: testClasses,
+		},
+		{
+			name:      "duplicate class",
+			classes:   []RequestClass{{Name: "hook"}, {Name: "hook"}},
+			expectErr: true,
+		},
+		{
+			name:      "concurrency above total",
+			classes:   []RequestClass{{Name: "bulk", MaxConcurrencyPerToken: 26}},
+			expectErr: true,
+		},
+		{
+			name:      "user agent in two classes",
+			classes:   []RequestClass{{Name: "hook", UserAgents: []string{"hook"}}, {Name: "bulk", UserAgents: []string{"hook"}}},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateRequestClasses(tc.classes, 25); (err != nil) != tc.expectErr {
+				t.Errorf("expected error %t, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	transport := newThrottlingTransport(25, testClasses, nil)
+	testCases := []struct {
+		userAgent string
+		header    string
+		expected  string
+	}{
+		{userAgent: "hook/v20210301-abcdef", expected: "hook"},
+		{userAgent: "hook.lgtm/v20210301-abcdef", expected: "hook"},
+		{userAgent: "peribolos/v20210301-abcdef", expected: "bulk"},
+		{userAgent: "peribolos/v20210301-abcdef", header: "hook", expected: "hook"},
+		{userAgent: "peribolos/v20210301-abcdef", header: "unknown", expected: "bulk"},
+		{userAgent: "curl/7.64.1", expected: DefaultRequestClass},
+	}
+	for _, tc := range testCases {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/repos/org/repo", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("User-Agent", tc.userAgent)
+		if tc.header != "" {
+			req.Header.Set(RequestClassHeader, tc.header)
+		}
+		if got := transport.classOf(req).Name; got != tc.expected {
+			t.Errorf("expected class %q for user agent %q and header %q, got %q", tc.expected, tc.userAgent, tc.header, got)
+		}
+	}
+}
+
+func isGranted(tk *ticket) bool {
+	select {
+	case <-tk.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue adds a waiting request of the class and dispatches requests.
+func enqueue(transport *throttlingTransport, class string) *ticket {
+	tk := &ticket{granted: make(chan struct{})}
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	transport.classes[class].queue = append(transport.classes[class].queue, tk)
+	transport.dispatch()
+	return tk
+}
+
+func TestDispatchPriority(t *testing.T) {
+	transport := newThrottlingTransport(1, testClasses, nil)
+	first := enqueue(transport, DefaultRequestClass)
+	if !isGranted(first) {
+		t.Fatal("expected the first request to be sent immediately")
+	}
+	low := enqueue(transport, DefaultRequestClass)
+	high := enqueue(transport, "hook")
+	if isGranted(low) || isGranted(high) {
+		t.Fatal("expected requests to wait while all concurrent requests are in flight")
+	}
+
+	transport.lock.Lock()
+	transport.release(transport.classes[DefaultRequestClass])
+	transport.lock.Unlock()
+	if !isGranted(high) || isGranted(low) {
+		t.Error("expected the request of the class with the highest priority to be sent first")
+	}
+
+	transport.lock.Lock()
+	transport.release(transport.classes["hook"])
+	transport.lock.Unlock()
+	if !isGranted(low) {
+		t.Error("expected the request of the lower priority class to be sent once no other is waiting")
+	}
+}
+
+func TestDispatchConcurrencyShare(t *testing.T) {
+	transport := newThrottlingTransport(3, testClasses, nil)
+	first := enqueue(transport, "bulk")
+	second := enqueue(transport, "bulk")
+	hook := enqueue(transport, "hook")
+	if !isGranted(first) || isGranted(second) {
+		t.Error("expected only one request of the bulk class to be in flight")
+	}
+	if !isGranted(hook) {
+		t.Error("expected the request of another class to use the remaining concurrency")
+	}
+}
+
+func TestDispatchDeferred(t *testing.T) {
+	now := time.Now()
+	transport := newThrottlingTransport(3, testClasses, nil)
+	transport.now = func() time.Time { return now }
+	transport.budgets[false] = tokenBudget{remaining: 50, reset: now.Add(time.Hour)}
+
+	bulk := enqueue(transport, "bulk")
+	hook := enqueue(transport, "hook")
+	if isGranted(bulk) {
+		t.Error("expected the bulk request to be deferred until the rate limit resets")
+	}
+	if !isGranted(hook) {
+		t.Error("expected the hook request to be sent despite the low token budget")
+	}
+	transport.lock.Lock()
+	if transport.timer == nil {
+		t.Error("expected a timer to wake deferred requests")
+	} else {
+		transport.timer.Stop()
+		transport.timer = nil
+	}
+	now = now.Add(2 * time.Hour)
+	transport.dispatch()
+	transport.lock.Unlock()
+	if !isGranted(bulk) {
+		t.Error("expected the bulk request to be sent once the rate limit reset")
+	}
+}
+
+type budgetDelegate struct {
+	remaining int
+	reset     time.Time
+}
+
+func (d budgetDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(d.reset.Unix(), 10))
+	return &http.Response{StatusCode: http.StatusOK, Header: header}, nil
+}
+
+func TestRoundTripUpdatesBudget(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	transport := newThrottlingTransport(1, testClasses, budgetDelegate{remaining: 42, reset: reset})
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/repos/org/repo", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := tokenBudget{remaining: 42, reset: reset}
+	if got := transport.budgets[false]; got.remaining != expected.remaining || !got.reset.Equal(expected.reset) {
+		t.Errorf("expected budget %+v, got %+v", expected, got)
+	}
+	if transport.inFlight != 0 {
+		t.Errorf("expected no requests in flight, got %d", transport.inFlight)
+	}
+}
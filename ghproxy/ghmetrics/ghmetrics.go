@@ -90,6 +90,17 @@ var cacheEntryAge = prometheus.NewHistogramVec(
 	[]string{"token_hash", "path", "user_agent"},
 )
 
+// graphQLCost provides the 'github_graphql_cost' counter that keeps track of
+// the GraphQL rate limit points spent on queries, or saved by the cache, as
+// reported by their rateLimit field.
+var graphQLCost = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "github_graphql_cost",
+		Help: "GraphQL rate limit cost of queries by cache response mode.",
+	},
+	[]string{"token_hash", "user_agent", "mode"},
+)
+
 var muxTokenUsage, muxRequestMetrics sync.Mutex
 var lastGitHubResponse time.Time
 
@@ -100,6 +111,7 @@ func init() {
 	prometheus.MustRegister(cacheCounter)
 	prometheus.MustRegister(timeoutDuration)
 	prometheus.MustRegister(cacheEntryAge)
+	prometheus.MustRegister(graphQLCost)
 }
 
 // CollectGitHubTokenMetrics publishes the rate limits of the github api to
@@ -175,3 +187,10 @@ func CollectCacheEntryAgeMetrics(age float64, path, userAgent, tokenHash string)
 func CollectRequestTimeoutMetrics(tokenHash, path, userAgent string, reqStartTime, responseTime time.Time) {
 	timeoutDuration.With(prometheus.Labels{"token_hash": tokenHash, "path": simplifier.Simplify(path), "user_agent": userAgentWithoutVersion(userAgent)}).Observe(float64(responseTime.Sub(reqStartTime).Seconds()))
 }
+
+// CollectGraphQLCostMetrics publishes the cost of a GraphQL query to
+// 'github_graphql_cost' on prometheus. Only queries fulfilled upstream cost
+// rate limit points, the cost of the others was saved.
+func CollectGraphQLCostMetrics(tokenHash, userAgent, mode string, cost int) {
+	graphQLCost.With(prometheus.Labels{"token_hash": tokenHash, "user_agent": userAgentWithoutVersion(userAgent), "mode": mode}).Add(float64(cost))
+}
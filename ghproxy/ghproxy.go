@@ -17,24 +17,33 @@ limitations under the License.
 package main
 
 import (
+	"crypto/rsa"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 
+	"k8s.io/test-infra/ghproxy/appauth"
 	"k8s.io/test-infra/ghproxy/apptokenequalizer"
 	"k8s.io/test-infra/ghproxy/ghcache"
 	"k8s.io/test-infra/greenhouse/diskutil"
 	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/config/secret"
 	"k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/metrics"
@@ -64,7 +73,8 @@ func init() {
 
 // GitHub reverse proxy HTTP cache RoundTripper stack:
 //  v -   <Client(s)>
-//  v ^ reverse proxy
+//  v ^ reverse proxy (and webhooks to invalidate the cache, optional)
+//  v ^ appauth: Authenticate requests without credentials as a GitHub app (optional)
 //  v ^ ghcache: downstreamTransport (coalescing, instrumentation)
 //  v ^ ghcache: httpcache layer
 //  v ^ ghcache: upstreamTransport (cache-control, instrumentation)
@@ -83,7 +93,19 @@ type options struct {
 	upstream       string
 	upstreamParsed *url.URL
 
-	maxConcurrency int
+	maxConcurrency       int
+	requestClassesConfig string
+	requestClasses       []ghcache.RequestClass
+	graphQLCacheTTL      time.Duration
+
+	appID             string
+	appPrivateKeyPath string
+	appDefaultOrg     string
+
+	hmacSecretFile      string
+	webhookRepos        flagutil.Strings
+	webhookMaxStaleness time.Duration
+	webhookPrefetch     bool
 
 	// pushGateway fields are used to configure pushing prometheus metrics.
 	pushGateway         string
@@ -111,6 +133,33 @@ func (o *options) validate() error {
 		return fmt.Errorf("failed to parse upstream URL: %v", err)
 	}
 	o.upstreamParsed = upstreamURL
+
+	if o.requestClassesConfig != "" {
+		b, err := ioutil.ReadFile(o.requestClassesConfig)
+		if err != nil {
+			return fmt.Errorf("failed to read request classes config: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(b, &o.requestClasses); err != nil {
+			return fmt.Errorf("failed to parse request classes config: %v", err)
+		}
+	}
+	if err := ghcache.ValidateRequestClasses(o.requestClasses, o.maxConcurrency); err != nil {
+		return fmt.Errorf("invalid request classes config: %v", err)
+	}
+
+	if (o.appID == "") != (o.appPrivateKeyPath == "") {
+		return errors.New("--github-app-id and --github-app-private-key-path must be specified together")
+	}
+	if o.appDefaultOrg != "" && o.appID == "" {
+		return errors.New("--github-app-default-org requires --github-app-id")
+	}
+
+	if (o.hmacSecretFile == "") != (len(o.webhookRepos.Strings()) == 0) {
+		return errors.New("--hmac-secret-file and --webhook-repos must be specified together to receive webhooks")
+	}
+	if o.hmacSecretFile != "" && o.webhookMaxStaleness <= 0 {
+		return errors.New("--webhook-max-staleness must be positive")
+	}
 	return nil
 }
 
@@ -122,11 +171,20 @@ func flagOptions() *options {
 	flag.StringVar(&o.redisAddress, "redis-address", "", "Redis address if using a redis cache e.g. localhost:6379.")
 	flag.IntVar(&o.port, "port", 8888, "Port to listen on.")
 	flag.StringVar(&o.upstream, "upstream", "https://api.github.com", "Scheme, host, and base path of reverse proxy upstream.")
-	flag.IntVar(&o.maxConcurrency, "concurrency", 25, "Maximum number of concurrent in-flight requests to GitHub.")
+	flag.IntVar(&o.maxConcurrency, "concurrency", 25, "Maximum number of concurrent in-flight requests to GitHub per token.")
+	flag.StringVar(&o.requestClassesConfig, "request-classes-config", "", "Path to a YAML list of request classes, scheduling the concurrent requests of each token to GitHub by priority of their clients.")
+	flag.DurationVar(&o.graphQLCacheTTL, "graphql-cache-ttl", 0, "How long to serve identical GraphQL queries from memory without asking GitHub. Identical concurrent queries are always coalesced.")
 	flag.StringVar(&o.pushGateway, "push-gateway", "", "If specified, push prometheus metrics to this endpoint.")
 	flag.DurationVar(&o.pushGatewayInterval, "push-gateway-interval", time.Minute, "Interval at which prometheus metrics are pushed.")
 	flag.StringVar(&o.logLevel, "log-level", "debug", fmt.Sprintf("Log level is one of %v.", logrus.AllLevels))
 	flag.BoolVar(&o.serveMetrics, "serve-metrics", false, "If true, it serves prometheus metrics")
+	flag.StringVar(&o.appID, "github-app-id", "", "ID of a GitHub app. If set, requests without an Authorization header are authenticated with the installation token of the app for their org.")
+	flag.StringVar(&o.appPrivateKeyPath, "github-app-private-key-path", "", "Path to the private key of the GitHub app set with --github-app-id.")
+	flag.StringVar(&o.appDefaultOrg, "github-app-default-org", "", "Org whose installation token authenticates requests that don't identify their org by their path or the X-PROW-GITHUB-ORG header.")
+	flag.StringVar(&o.hmacSecretFile, "hmac-secret-file", "", "Path to the file containing the GitHub HMAC secret. If set, webhooks sent to /hook invalidate the cached responses of the resources they change.")
+	flag.Var(&o.webhookRepos, "webhook-repos", "Org or org/repo whose webhooks are sent to ghproxy, their cached responses are served without revalidation until their resource changes. Can be passed multiple times.")
+	flag.DurationVar(&o.webhookMaxStaleness, "webhook-max-staleness", 5*time.Minute, "How long cached responses may be served without revalidation, in case webhooks are lost or GitHub changes resources without sending any.")
+	flag.BoolVar(&o.webhookPrefetch, "webhook-prefetch", false, "If true, the cached responses of pull requests, issues, labels and statuses requested recently are refreshed as soon as a webhook announces their change.")
 	o.instrumentationOptions.AddFlags(flag.CommandLine)
 	return o
 }
@@ -144,16 +202,28 @@ func main() {
 		logrus.Warningf("The deprecated `--legacy-disable-disk-cache-partitions-by-auth-header` flags value is `true`. If you are a bigger Prow setup, you should copy your existing cache directory to the directory mentioned in the `%s` messages to warm up the partitioned-by-auth-header cache, then set the flag to false. If you are a smaller Prow setup or just started using ghproxy you can just unconditionally set it to `false`.", ghcache.LogMessageWithDiskPartitionFields)
 	}
 
+	var invalidator *ghcache.Invalidator
+	if o.hmacSecretFile != "" {
+		invalidator = ghcache.NewInvalidator(o.webhookRepos.Strings(), o.webhookMaxStaleness, o.webhookPrefetch)
+	}
+
 	var cache http.RoundTripper
 	if o.redisAddress != "" {
-		cache = ghcache.NewRedisCache(apptokenequalizer.New(http.DefaultTransport), o.redisAddress, o.maxConcurrency)
+		cache = ghcache.NewRedisCache(apptokenequalizer.New(http.DefaultTransport), o.redisAddress, o.maxConcurrency, o.requestClasses, o.graphQLCacheTTL, invalidator)
 	} else if o.dir == "" {
-		cache = ghcache.NewMemCache(apptokenequalizer.New(http.DefaultTransport), o.maxConcurrency)
+		cache = ghcache.NewMemCache(apptokenequalizer.New(http.DefaultTransport), o.maxConcurrency, o.requestClasses, o.graphQLCacheTTL, invalidator)
 	} else {
-		cache = ghcache.NewDiskCache(apptokenequalizer.New(http.DefaultTransport), o.dir, o.sizeGB, o.maxConcurrency, o.diskCacheDisableAuthHeaderPartitioning)
+		cache = ghcache.NewDiskCache(apptokenequalizer.New(http.DefaultTransport), o.dir, o.sizeGB, o.maxConcurrency, o.requestClasses, o.diskCacheDisableAuthHeaderPartitioning, o.graphQLCacheTTL, invalidator)
 		go diskMonitor(o.pushGatewayInterval, o.dir)
 	}
 
+	if o.appID != "" {
+		var err error
+		if cache, err = appAuth(o, cache); err != nil {
+			logrus.WithError(err).Fatal("Error setting up GitHub app authentication.")
+		}
+	}
+
 	pjutil.ServePProf(o.instrumentationOptions.PProfPort)
 	defer interrupts.WaitForGracefulShutdown()
 	metrics.ExposeMetrics("ghproxy", config.PushGateway{
@@ -164,8 +234,16 @@ func main() {
 		ServeMetrics: o.serveMetrics,
 	}, o.instrumentationOptions.MetricsPort)
 
-	proxy := newReverseProxy(o.upstreamParsed, cache, 30*time.Second)
-	server := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: proxy}
+	mux := http.NewServeMux()
+	mux.Handle("/", newReverseProxy(o.upstreamParsed, cache, 30*time.Second))
+	if invalidator != nil {
+		secretAgent := &secret.Agent{}
+		if err := secretAgent.Start([]string{o.hmacSecretFile}); err != nil {
+			logrus.WithError(err).Fatal("Error starting secrets agent.")
+		}
+		mux.Handle("/hook", webhookHandler(invalidator, secretAgent.GetTokenGenerator(o.hmacSecretFile)))
+	}
+	server := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux}
 
 	health := pjutil.NewHealthOnPort(o.instrumentationOptions.HealthPort)
 	health.ServeReady()
@@ -173,6 +251,62 @@ func main() {
 	interrupts.ListenAndServe(server, 30*time.Second)
 }
 
+// appAuth wraps the cache to authenticate unauthenticated requests as the
+// GitHub app, minting and refreshing its installation tokens as needed.
+func appAuth(o *options, cache http.RoundTripper) (http.RoundTripper, error) {
+	secretAgent := &secret.Agent{}
+	if err := secretAgent.Start([]string{o.appPrivateKeyPath}); err != nil {
+		return nil, fmt.Errorf("failed to load the private key of the app: %v", err)
+	}
+	privateKey, err := appPrivateKey(secretAgent.GetTokenGenerator(o.appPrivateKeyPath))
+	if err != nil {
+		return nil, err
+	}
+	tokenFor, client := github.NewAppsAuthClientWithFields(logrus.Fields{"component": "appauth"}, secretAgent.Censor, o.appID, privateKey, strings.TrimSuffix(o.upstream, "/")+"/graphql", o.upstream)
+	app, err := client.GetApp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the app: %v", err)
+	}
+	return appauth.New(cache, app.Slug, tokenFor, o.appDefaultOrg), nil
+}
+
+// appPrivateKey returns a generator of the private key of the app, which is
+// reloaded when the secret changes. If the changed secret can't be parsed, the
+// error is logged and the last valid key keeps being used.
+func appPrivateKey(secret func() []byte) (func() *rsa.PrivateKey, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(secret())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the private key of the app: %v", err)
+	}
+	var lock sync.Mutex
+	return func() *rsa.PrivateKey {
+		lock.Lock()
+		defer lock.Unlock()
+		reloaded, err := jwt.ParseRSAPrivateKeyFromPEM(secret())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to parse the private key of the app, using the last valid key.")
+			return key
+		}
+		key = reloaded
+		return key
+	}, nil
+}
+
+// webhookHandler invalidates the cache with the GitHub webhooks it receives,
+// either from GitHub or forwarded by hook as an external plugin.
+func webhookHandler(invalidator *ghcache.Invalidator, hmacTokenGenerator func() []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventType, eventGUID, payload, ok, _ := github.ValidateWebhook(w, r, hmacTokenGenerator)
+		if !ok {
+			return
+		}
+		fmt.Fprint(w, "Event received. Have a nice day.")
+		if err := invalidator.HandleEvent(eventType, payload); err != nil {
+			logrus.WithFields(logrus.Fields{"event-type": eventType, github.EventGUID: eventGUID}).WithError(err).Error("Error handling event.")
+		}
+	}
+}
+
 func newReverseProxy(upstreamURL *url.URL, transport http.RoundTripper, timeout time.Duration) http.Handler {
 	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
 	// Wrap the director to change the upstream request 'Host' header to the
@@ -181,6 +315,9 @@ func newReverseProxy(upstreamURL *url.URL, transport http.RoundTripper, timeout
 	proxy.Director = func(req *http.Request) {
 		director(req)
 		req.Host = req.URL.Host
+		// Clients can't choose the cache partition of their requests, only
+		// ghproxy itself sets it.
+		req.Header.Del(ghcache.CachePartitionHeader)
 	}
 	proxy.Transport = transport
 
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/ghproxy/ghcache"
+)
+
+type headerRecorder struct {
+	header http.Header
+}
+
+func (r *headerRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.header = req.Header.Clone()
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}}, nil
+}
+
+func TestReverseProxyRemovesCachePartitionHeader(t *testing.T) {
+	upstream, err := url.Parse("https://api.github.com")
+	if err != nil {
+		t.Fatalf("failed to parse upstream: %v", err)
+	}
+	transport := &headerRecorder{}
+	proxy := newReverseProxy(upstream, transport, time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/repos/org/repo", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(ghcache.CachePartitionHeader, "someone else")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	if transport.header == nil {
+		t.Fatal("request did not reach the transport")
+	}
+	if partition := transport.header.Get(ghcache.CachePartitionHeader); partition != "" {
+		t.Errorf("expected the cache partition header to be removed, got %q", partition)
+	}
+	if auth := transport.header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("expected the Authorization header to be kept, got %q", auth)
+	}
+}
+
+func TestAppPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	valid := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if _, err := appPrivateKey(func() []byte { return []byte("not a key") }); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+
+	secret := valid
+	privateKey, err := appPrivateKey(func() []byte { return secret })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := privateKey(); got == nil || !got.Equal(key) {
+		t.Errorf("expected the parsed key, got %v", got)
+	}
+	secret = []byte("not a key")
+	if got := privateKey(); got == nil || !got.Equal(key) {
+		t.Errorf("expected the last valid key after an invalid update, got %v", got)
+	}
+}
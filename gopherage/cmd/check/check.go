@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package check
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov/policy"
+	"k8s.io/test-infra/gopherage/pkg/util"
+)
+
+type flags struct {
+	policyFile  string
+	baseline    string
+	sourceDir   string
+	outputFile  string
+	summaryFile string
+}
+
+// MakeCommand returns a `check` command.
+func MakeCommand() *cobra.Command {
+	flags := &flags{}
+	cmd := &cobra.Command{
+		Use:   "check [profile]",
+		Short: "Check a coverage profile against the thresholds of a policy file.",
+		Long: `Check a coverage profile against the thresholds of a policy file, and produce the
+results in junit xml format and as a markdown summary.
+
+The policy sets minimum coverage ratios overall, per package and per file, minimum coverage
+ratios of every function, and how much coverage may drop compared to a baseline profile:
+
+  overall: 0.6
+  default:
+    min: 0.5
+    allowed_regression: 0.01
+  rules:
+  - package: k8s.io/test-infra/prow/...
+    min: 0.7
+    function_min: 0.3
+  - path: "k8s.io/test-infra/**/zz_generated*.go"
+    min: 0
+
+Package rules apply to the coverage of matching packages, path rules to each matching file.
+The last matching rule wins. Checking functions needs the sources, found in --source-dir
+using its go.mod. Exits with 1 if any check fails.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(flags, cmd, args)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.policyFile, "policy", "p", "", "policy file")
+	cmd.Flags().StringVarP(&flags.baseline, "baseline", "b", "", "baseline profile to check for regressions against, e.g. of the base branch")
+	cmd.Flags().StringVar(&flags.sourceDir, "source-dir", ".", "root directory of the module the profile covers")
+	cmd.Flags().StringVarP(&flags.outputFile, "output", "o", "-", "junit xml output file")
+	cmd.Flags().StringVar(&flags.summaryFile, "summary", "", "markdown summary output file, not written if empty")
+	return cmd
+}
+
+func run(flags *flags, cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Expected exactly one argument: coverage file path")
+		cmd.Usage()
+		os.Exit(2)
+	}
+	if flags.policyFile == "" {
+		fmt.Fprintln(os.Stderr, "--policy is required")
+		cmd.Usage()
+		os.Exit(2)
+	}
+
+	p, err := policy.Load(flags.policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load policy: %v.", err)
+		os.Exit(1)
+	}
+
+	profiles, err := util.LoadProfile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse profile file: %v.", err)
+		os.Exit(1)
+	}
+
+	var baseline []*cover.Profile
+	if flags.baseline != "" {
+		baseline, err = util.LoadProfile(flags.baseline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse baseline profile file: %v.", err)
+			os.Exit(1)
+		}
+	}
+
+	report, err := p.Check(profiles, baseline, sourceReader(flags.sourceDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check profile: %v.", err)
+		os.Exit(1)
+	}
+
+	text, err := report.JUnit()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to produce xml from results: %v.", err)
+		os.Exit(1)
+	}
+	if err := writeOutput(flags.outputFile, text); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write xml: %v.", err)
+		os.Exit(1)
+	}
+	if flags.summaryFile != "" {
+		if err := writeOutput(flags.summaryFile, []byte(report.Markdown())); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write summary: %v.", err)
+			os.Exit(1)
+		}
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		for _, result := range failed {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", result.Kind, result.Name, strings.Join(result.Failures, "; "))
+		}
+		os.Exit(1)
+	}
+}
+
+func writeOutput(destination string, content []byte) error {
+	if destination == "-" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	return ioutil.WriteFile(destination, content, 0644)
+}
+
+// sourceReader finds the files of profiles in dir. File names starting with
+// the module path of dir's go.mod are relative to dir, other relative names
+// are looked up in dir as if it was a GOPATH src directory.
+func sourceReader(dir string) policy.SourceReader {
+	module := util.ModulePath(filepath.Join(dir, "go.mod"))
+	return func(fileName string) ([]byte, error) {
+		if filepath.IsAbs(fileName) {
+			return ioutil.ReadFile(fileName)
+		}
+		if module != "" && strings.HasPrefix(fileName, module+"/") {
+			return ioutil.ReadFile(filepath.Join(dir, strings.TrimPrefix(fileName, module+"/")))
+		}
+		return ioutil.ReadFile(filepath.Join(dir, fileName))
+	}
+}
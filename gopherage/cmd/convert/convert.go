@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov/convert"
+	"k8s.io/test-infra/gopherage/pkg/util"
+)
+
+type flags struct {
+	from       string
+	to         string
+	outputFile string
+}
+
+// MakeCommand returns a `convert` command.
+func MakeCommand() *cobra.Command {
+	flags := &flags{}
+	cmd := &cobra.Command{
+		Use:   "convert [file]",
+		Short: "Convert coverage files between the Go, LCOV, Cobertura and JSON formats.",
+		Long: `Convert coverage files between the Go coverage format and the LCOV, Cobertura XML and JSON
+formats, so that the coverage of other languages can be merged, aggregated, filtered and
+displayed like Go coverage.
+
+LCOV and Cobertura only know line coverage, so converting them to Go profiles produces one
+block of one statement per line, and converting Go profiles to them produces the coverage of
+every line with statements. The JSON format holds Go profiles as they are.
+
+Unless --from is set, the input format is guessed from the file extension: .info and .lcov are
+LCOV, .xml is Cobertura, .json is JSON and anything else is Go.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(flags, cmd, args)
+		},
+	}
+	cmd.Flags().StringVar(&flags.from, "from", "", "input format: go, lcov, cobertura or json")
+	cmd.Flags().StringVar(&flags.to, "to", "", "output format: go, lcov, cobertura or json")
+	cmd.Flags().StringVarP(&flags.outputFile, "output", "o", "-", "output file")
+	return cmd
+}
+
+func run(flags *flags, cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Expected exactly one argument: coverage file path")
+		cmd.Usage()
+		os.Exit(2)
+	}
+	if flags.to == "" {
+		fmt.Fprintln(os.Stderr, "--to is required")
+		cmd.Usage()
+		os.Exit(2)
+	}
+	to, err := convert.ParseFormat(flags.to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --to: %v\n", err)
+		os.Exit(2)
+	}
+	from := formatOf(args[0])
+	if flags.from != "" {
+		if from, err = convert.ParseFormat(flags.from); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --from: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	profiles, err := read(from, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s coverage: %v.", from, err)
+		os.Exit(1)
+	}
+	if err := write(to, flags.outputFile, profiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s coverage: %v.", to, err)
+		os.Exit(1)
+	}
+}
+
+// formatOf guesses the format of a file from its extension
+func formatOf(fileName string) convert.Format {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".info", ".lcov":
+		return convert.LCOV
+	case ".xml":
+		return convert.Cobertura
+	case ".json":
+		return convert.JSON
+	}
+	return convert.Go
+}
+
+func read(format convert.Format, origin string) ([]*cover.Profile, error) {
+	if format == convert.Go {
+		return util.LoadProfile(origin)
+	}
+	var r io.Reader = os.Stdin
+	if origin != "-" {
+		f, err := os.Open(origin)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	switch format {
+	case convert.LCOV:
+		return convert.ReadLCOV(r)
+	case convert.Cobertura:
+		return convert.ReadCobertura(r)
+	default:
+		return convert.ReadJSON(r)
+	}
+}
+
+func write(format convert.Format, destination string, profiles []*cover.Profile) error {
+	if format == convert.Go {
+		return util.DumpProfile(destination, profiles)
+	}
+	var w io.Writer = os.Stdout
+	if destination != "-" {
+		f, err := os.Create(destination)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case convert.LCOV:
+		return convert.WriteLCOV(w, profiles)
+	case convert.Cobertura:
+		return convert.WriteCobertura(w, profiles)
+	default:
+		return convert.WriteJSON(w, profiles)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/test-infra/gopherage/pkg/cov/patch"
+	"k8s.io/test-infra/gopherage/pkg/util"
+)
+
+type flags struct {
+	diffFile   string
+	base       string
+	head       string
+	repoDir    string
+	modulePath string
+	format     string
+	outputFile string
+	threshold  float32
+}
+
+// MakeCommand returns a `patch` command.
+func MakeCommand() *cobra.Command {
+	flags := &flags{}
+	cmd := &cobra.Command{
+		Use:   "patch [profile]",
+		Short: "Calculate the coverage of the lines changed by a diff.",
+		Long: `Calculate the coverage of the lines added or changed by a unified diff, per file and
+overall, and list the changed lines which aren't covered.
+
+The diff is either read from --diff, or produced by running git diff in --repo-dir for the changes
+of --head since it forked from --base, like GitHub shows the changes of a PR. The file names in the profile are matched to the paths in the diff by stripping the
+module path of the go.mod in --repo-dir, or --module if it is set.
+
+Produces a markdown table suitable for PR comments, or json with --format=json. Exits with 1 if
+the coverage of the changed statements is below --threshold.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(flags, cmd, args)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.diffFile, "diff", "d", "", "unified diff file, or - for stdin")
+	cmd.Flags().StringVar(&flags.base, "base", "", "git ref to diff from, if --diff is not set")
+	cmd.Flags().StringVar(&flags.head, "head", "HEAD", "git ref to diff to")
+	cmd.Flags().StringVar(&flags.repoDir, "repo-dir", ".", "root directory of the repository the profile covers")
+	cmd.Flags().StringVar(&flags.modulePath, "module", "", "module path to strip from the file names in the profile, instead of the one in the go.mod of --repo-dir")
+	cmd.Flags().StringVar(&flags.format, "format", "markdown", "output format, markdown or json")
+	cmd.Flags().StringVarP(&flags.outputFile, "output", "o", "-", "output file")
+	cmd.Flags().Float32VarP(&flags.threshold, "threshold", "t", 0, "minimum coverage of the changed statements")
+	return cmd
+}
+
+func run(flags *flags, cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Expected exactly one argument: coverage file path")
+		cmd.Usage()
+		os.Exit(2)
+	}
+	if (flags.diffFile == "") == (flags.base == "") {
+		fmt.Fprintln(os.Stderr, "Exactly one of --diff and --base is required")
+		cmd.Usage()
+		os.Exit(2)
+	}
+	if flags.format != "markdown" && flags.format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, expected markdown or json\n", flags.format)
+		cmd.Usage()
+		os.Exit(2)
+	}
+	if flags.threshold < 0 || flags.threshold > 1 {
+		fmt.Fprintln(os.Stderr, "coverage threshold must be a float number between 0 to 1, inclusive")
+		os.Exit(1)
+	}
+
+	profiles, err := util.LoadProfile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse profile file: %v.", err)
+		os.Exit(1)
+	}
+
+	diff, err := readDiff(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read diff: %v.", err)
+		os.Exit(1)
+	}
+	changes, err := patch.ParseDiff(diff)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse diff: %v.", err)
+		os.Exit(1)
+	}
+
+	modulePath := flags.modulePath
+	if modulePath == "" {
+		modulePath = util.ModulePath(filepath.Join(flags.repoDir, "go.mod"))
+	}
+	report := patch.Calculate(profiles, changes, modulePath)
+
+	var output []byte
+	if flags.format == "json" {
+		output, err = json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to produce json: %v.", err)
+			os.Exit(1)
+		}
+	} else {
+		output = []byte(report.Markdown())
+	}
+	if err := writeOutput(flags.outputFile, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v.", err)
+		os.Exit(1)
+	}
+
+	if report.Ratio() < flags.threshold {
+		fmt.Fprintf(os.Stderr, "Patch coverage %.1f%% is below the threshold of %.1f%%\n", report.Ratio()*100, flags.threshold*100)
+		os.Exit(1)
+	}
+}
+
+// readDiff reads the diff file, or runs git diff between the refs
+func readDiff(flags *flags) (io.Reader, error) {
+	if flags.diffFile == "-" {
+		return os.Stdin, nil
+	}
+	if flags.diffFile != "" {
+		b, err := ioutil.ReadFile(flags.diffFile)
+		return bytes.NewReader(b), err
+	}
+	git := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "-U0", "--src-prefix=a/", "--dst-prefix=b/", flags.base+"..."+flags.head)
+	git.Dir = flags.repoDir
+	git.Stderr = os.Stderr
+	b, err := git.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %v", err)
+	}
+	return bytes.NewReader(b), nil
+}
+
+func writeOutput(destination string, content []byte) error {
+	if destination == "-" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	return ioutil.WriteFile(destination, content, 0644)
+}
@@ -21,11 +21,14 @@ import (
 
 	"github.com/spf13/cobra"
 	"k8s.io/test-infra/gopherage/cmd/aggregate"
+	"k8s.io/test-infra/gopherage/cmd/check"
+	"k8s.io/test-infra/gopherage/cmd/convert"
 	"k8s.io/test-infra/gopherage/cmd/diff"
 	"k8s.io/test-infra/gopherage/cmd/filter"
 	"k8s.io/test-infra/gopherage/cmd/html"
 	"k8s.io/test-infra/gopherage/cmd/junit"
 	"k8s.io/test-infra/gopherage/cmd/merge"
+	"k8s.io/test-infra/gopherage/cmd/patch"
 )
 
 var rootCommand = &cobra.Command{
@@ -35,11 +38,14 @@ var rootCommand = &cobra.Command{
 
 func run() error {
 	rootCommand.AddCommand(aggregate.MakeCommand())
+	rootCommand.AddCommand(check.MakeCommand())
+	rootCommand.AddCommand(convert.MakeCommand())
 	rootCommand.AddCommand(diff.MakeCommand())
 	rootCommand.AddCommand(filter.MakeCommand())
 	rootCommand.AddCommand(html.MakeCommand())
 	rootCommand.AddCommand(junit.MakeCommand())
 	rootCommand.AddCommand(merge.MakeCommand())
+	rootCommand.AddCommand(patch.MakeCommand())
 	return rootCommand.Execute()
 }
 
@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/tools/cover"
+)
+
+// coberturaCoverage is the root of a Cobertura report. Only the attributes
+// needed to read and write line coverage are declared.
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      string             `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity string           `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	FileName   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity string          `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	// Hits is a string since some tools write counts too large for an int
+	Hits   string `xml:"hits,attr"`
+	Branch bool   `xml:"branch,attr"`
+}
+
+// ReadCobertura reads a Cobertura XML report. File names are the "filename"
+// attributes of the classes, which are relative to the report's sources.
+// Only line coverage is read; classes of the same file, e.g. nested
+// classes, are combined.
+func ReadCobertura(r io.Reader) ([]*cover.Profile, error) {
+	var report coberturaCoverage
+	if err := xml.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to parse cobertura xml: %v", err)
+	}
+	files := map[string]map[int]int{}
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			if class.FileName == "" {
+				return nil, fmt.Errorf("class %q in package %q has no filename", class.Name, pkg.Name)
+			}
+			hits := files[class.FileName]
+			if hits == nil {
+				hits = map[int]int{}
+				files[class.FileName] = hits
+			}
+			for _, line := range class.Lines {
+				count, err := strconv.ParseFloat(line.Hits, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: malformed hits: %v", class.FileName, line.Number, err)
+				}
+				if existing, ok := hits[line.Number]; !ok || int(count) > existing {
+					hits[line.Number] = int(count)
+				}
+			}
+		}
+	}
+
+	var profiles []*cover.Profile
+	for name, hits := range files {
+		profiles = append(profiles, fromLines(name, hits))
+	}
+	return sortProfiles(profiles), nil
+}
+
+// WriteCobertura writes the profiles as a Cobertura XML report with the line
+// coverage of every file. Files are grouped into packages by directory, and
+// every file is a class named after it.
+func WriteCobertura(w io.Writer, profiles []*cover.Profile) error {
+	report := coberturaCoverage{
+		BranchRate: "0",
+		Complexity: "0",
+		Version:    "gopherage",
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		Sources:    []string{"."},
+	}
+	packages := map[string]*coberturaPackage{}
+	// covered and valid lines per package
+	covered, valid := map[string]int{}, map[string]int{}
+	for _, profile := range profiles {
+		dir := path.Dir(profile.FileName)
+		pkg, ok := packages[dir]
+		if !ok {
+			pkg = &coberturaPackage{Name: dir, BranchRate: "0", Complexity: "0"}
+			packages[dir] = pkg
+		}
+		hits := toLines(profile)
+		class := coberturaClass{
+			Name:       path.Base(profile.FileName),
+			FileName:   profile.FileName,
+			BranchRate: "0",
+			Complexity: "0",
+		}
+		classCovered := 0
+		for _, line := range sortedLines(hits) {
+			class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: strconv.Itoa(hits[line])})
+			if hits[line] > 0 {
+				classCovered++
+			}
+		}
+		class.LineRate = lineRate(classCovered, len(hits))
+		pkg.Classes = append(pkg.Classes, class)
+		covered[dir] += classCovered
+		valid[dir] += len(hits)
+		report.LinesCovered += classCovered
+		report.LinesValid += len(hits)
+	}
+
+	var dirs []string
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		pkg := packages[dir]
+		pkg.LineRate = lineRate(covered[dir], valid[dir])
+		report.Packages = append(report.Packages, *pkg)
+	}
+	report.LineRate = lineRate(report.LinesCovered, report.LinesValid)
+
+	if _, err := io.WriteString(w, xml.Header+`<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`+"\n"); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to write cobertura xml: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// lineRate formats the ratio of covered lines, 1 if there are none
+func lineRate(covered, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestWriteCobertura(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteCobertura(&b, goProfiles); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`line-rate="0.6000" branch-rate="0" lines-covered="3" lines-valid="5"`,
+		`<package name="example.com/foo" line-rate="0.5000"`,
+		`<class name="a.go" filename="example.com/foo/a.go" line-rate="0.5000"`,
+		`<line number="5" hits="0" branch="false"></line>`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %s in the xml:\n%s", expected, b.String())
+		}
+	}
+
+	profiles, err := ReadCobertura(&b)
+	if err != nil {
+		t.Fatalf("failed to read cobertura back: %v", err)
+	}
+	if !reflect.DeepEqual(profiles, lineProfiles) {
+		t.Errorf("expected profiles %+v, got %+v", lineProfiles, profiles)
+	}
+}
+
+func TestReadCobertura(t *testing.T) {
+	// as written by coverage.py, with a second class in the same file
+	report := `<?xml version="1.0" ?>
+<coverage version="5.5" timestamp="1617181920000" lines-valid="4" lines-covered="3" line-rate="0.75" branches-covered="0" branches-valid="0" branch-rate="0" complexity="0">
+	<sources>
+		<source>/src/repo</source>
+	</sources>
+	<packages>
+		<package name="app" line-rate="0.75" branch-rate="0" complexity="0">
+			<classes>
+				<class name="main.py" filename="app/main.py" complexity="0" line-rate="0.75" branch-rate="0">
+					<methods/>
+					<lines>
+						<line number="1" hits="1"/>
+						<line number="2" hits="0"/>
+						<line number="4" hits="2" branch="true" condition-coverage="50% (1/2)"/>
+					</lines>
+				</class>
+				<class name="main.py$Inner" filename="app/main.py" complexity="0" line-rate="1" branch-rate="0">
+					<methods>
+						<method name="f" signature="()" line-rate="1" branch-rate="0">
+							<lines><line number="6" hits="3"/></lines>
+						</method>
+					</methods>
+					<lines>
+						<line number="6" hits="3"/>
+					</lines>
+				</class>
+			</classes>
+		</package>
+	</packages>
+</coverage>
+`
+	profiles, err := ReadCobertura(strings.NewReader(report))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*cover.Profile{fromLines("app/main.py", map[int]int{1: 1, 2: 0, 4: 2, 6: 3})}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("expected profiles %+v, got %+v", expected, profiles)
+	}
+
+	for _, malformed := range []string{
+		"<coverage",
+		`<coverage><packages><package><classes><class name="a"/></classes></package></packages></coverage>`,
+		`<coverage><packages><package><classes><class filename="a"><lines><line number="1" hits="x"/></lines></class></classes></package></packages></coverage>`,
+	} {
+		if _, err := ReadCobertura(strings.NewReader(malformed)); err == nil {
+			t.Errorf("expected an error reading %q", malformed)
+		}
+	}
+}
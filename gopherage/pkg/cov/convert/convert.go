@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package convert converts Go coverage profiles to and from the coverage
+// formats of other languages' tools, so their coverage can be merged,
+// aggregated and displayed like Go coverage.
+package convert
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// Format is a coverage file format.
+type Format string
+
+// Supported formats
+const (
+	// Go is the text format of `go test -coverprofile`.
+	Go Format = "go"
+	// LCOV is the tracefile format of lcov and e.g. istanbul and coverage.py.
+	LCOV Format = "lcov"
+	// Cobertura is the XML format of Cobertura, e.g. produced by coverage.py
+	// and istanbul.
+	Cobertura Format = "cobertura"
+	// JSON is the JSON serialization of Go profiles.
+	JSON Format = "json"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case Go, LCOV, Cobertura, JSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected one of %s, %s, %s or %s", name, Go, LCOV, Cobertura, JSON)
+}
+
+// fromLines returns a profile of line-based coverage, with one block of one
+// statement per line since other formats don't know about Go statements. A
+// block spans from the first to the second column of its line.
+func fromLines(fileName string, hits map[int]int) *cover.Profile {
+	var lines []int
+	for line := range hits {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	profile := &cover.Profile{FileName: fileName, Mode: "count"}
+	for _, line := range lines {
+		profile.Blocks = append(profile.Blocks, cover.ProfileBlock{
+			StartLine: line,
+			StartCol:  1,
+			EndLine:   line,
+			EndCol:    2,
+			NumStmt:   1,
+			Count:     hits[line],
+		})
+	}
+	return profile
+}
+
+// toLines returns the hit count of every line with statements in the profile.
+// A line counts as hit as often as the most often run block on it, so lines
+// with any statement run count as covered like in line-based tools.
+func toLines(profile *cover.Profile) map[int]int {
+	hits := map[int]int{}
+	for _, block := range profile.Blocks {
+		if block.NumStmt == 0 {
+			continue
+		}
+		for line := block.StartLine; line <= block.EndLine; line++ {
+			if count, ok := hits[line]; !ok || block.Count > count {
+				hits[line] = block.Count
+			}
+		}
+	}
+	return hits
+}
+
+// sortedLines returns the lines of toLines in order
+func sortedLines(hits map[int]int) []int {
+	var lines []int
+	for line := range hits {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// sortProfiles sorts profiles by file name like cover.ParseProfiles does
+func sortProfiles(profiles []*cover.Profile) []*cover.Profile {
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].FileName < profiles[j].FileName
+	})
+	return profiles
+}
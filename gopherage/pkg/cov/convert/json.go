@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/tools/cover"
+)
+
+// jsonProfiles is the JSON serialization of profiles, for tools which would
+// rather not parse the Go text format.
+type jsonProfiles struct {
+	Mode  string     `json:"mode"`
+	Files []jsonFile `json:"files"`
+}
+
+type jsonFile struct {
+	Name   string      `json:"name"`
+	Blocks []jsonBlock `json:"blocks"`
+}
+
+type jsonBlock struct {
+	StartLine int `json:"start_line"`
+	StartCol  int `json:"start_col"`
+	EndLine   int `json:"end_line"`
+	EndCol    int `json:"end_col"`
+	NumStmt   int `json:"statements"`
+	Count     int `json:"count"`
+}
+
+// ReadJSON reads profiles written by WriteJSON.
+func ReadJSON(r io.Reader) ([]*cover.Profile, error) {
+	var profiles jsonProfiles
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse json: %v", err)
+	}
+	switch profiles.Mode {
+	case "set", "count", "atomic":
+	default:
+		return nil, fmt.Errorf("unknown mode %q", profiles.Mode)
+	}
+	var result []*cover.Profile
+	for _, file := range profiles.Files {
+		profile := &cover.Profile{FileName: file.Name, Mode: profiles.Mode}
+		for _, block := range file.Blocks {
+			profile.Blocks = append(profile.Blocks, cover.ProfileBlock(block))
+		}
+		result = append(result, profile)
+	}
+	return sortProfiles(result), nil
+}
+
+// WriteJSON writes the profiles as JSON.
+func WriteJSON(w io.Writer, profiles []*cover.Profile) error {
+	result := jsonProfiles{Mode: "set", Files: []jsonFile{}}
+	for _, profile := range profiles {
+		result.Mode = profile.Mode
+		file := jsonFile{Name: profile.FileName, Blocks: []jsonBlock{}}
+		for _, block := range profile.Blocks {
+			file.Blocks = append(file.Blocks, jsonBlock(block))
+		}
+		result.Files = append(result.Files, file)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSON(&b, goProfiles); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(b.String(), `"statements": 2`) {
+		t.Errorf("expected the number of statements in the json:\n%s", b.String())
+	}
+	profiles, err := ReadJSON(&b)
+	if err != nil {
+		t.Fatalf("failed to read json back: %v", err)
+	}
+	if !reflect.DeepEqual(profiles, goProfiles) {
+		t.Errorf("expected profiles %+v, got %+v", goProfiles, profiles)
+	}
+
+	for _, malformed := range []string{
+		`{"mode": "count", "files": [{"name": "a.go", "lines": []}]}`,
+		`{"mode": "sometimes", "files": []}`,
+	} {
+		if _, err := ReadJSON(strings.NewReader(malformed)); err == nil {
+			t.Errorf("expected an error reading %q", malformed)
+		}
+	}
+}
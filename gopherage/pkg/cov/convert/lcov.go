@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// ReadLCOV reads an LCOV tracefile. Only the line coverage of the "DA"
+// records is read, functions and branches are ignored. Records of the same
+// file, e.g. of different tests, are added up.
+func ReadLCOV(r io.Reader) ([]*cover.Profile, error) {
+	files := map[string]map[int]int{}
+	var hits map[int]int
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "SF:"):
+			name := strings.TrimPrefix(text, "SF:")
+			if files[name] == nil {
+				files[name] = map[int]int{}
+			}
+			hits = files[name]
+		case strings.HasPrefix(text, "DA:"):
+			if hits == nil {
+				return nil, fmt.Errorf("line %d: DA record outside of a file", lineNumber)
+			}
+			// DA:<line>,<count>[,<checksum>]
+			fields := strings.Split(strings.TrimPrefix(text, "DA:"), ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: malformed DA record: %q", lineNumber, text)
+			}
+			line, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed line number: %v", lineNumber, err)
+			}
+			// some tools write counts beyond int32 as floats, e.g. 1e+10
+			count, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed count: %v", lineNumber, err)
+			}
+			hits[line] += int(count)
+		case text == "end_of_record":
+			hits = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lcov: %v", err)
+	}
+
+	var profiles []*cover.Profile
+	for name, hits := range files {
+		profiles = append(profiles, fromLines(name, hits))
+	}
+	return sortProfiles(profiles), nil
+}
+
+// WriteLCOV writes the profiles as an LCOV tracefile with the line coverage
+// of every file.
+func WriteLCOV(w io.Writer, profiles []*cover.Profile) error {
+	bw := bufio.NewWriter(w)
+	for _, profile := range profiles {
+		hits := toLines(profile)
+		fmt.Fprintf(bw, "SF:%s\n", profile.FileName)
+		covered := 0
+		for _, line := range sortedLines(hits) {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, hits[line])
+			if hits[line] > 0 {
+				covered++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(hits), covered)
+	}
+	return bw.Flush()
+}
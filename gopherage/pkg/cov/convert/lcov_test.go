@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+// goProfiles have a block spanning two lines, which shares its first line
+// with a block which didn't run, and a block without statements
+var goProfiles = []*cover.Profile{
+	{
+		FileName: "example.com/foo/a.go",
+		Mode:     "count",
+		Blocks: []cover.ProfileBlock{
+			{StartLine: 3, StartCol: 12, EndLine: 4, EndCol: 3, NumStmt: 2, Count: 2},
+			{StartLine: 4, StartCol: 3, EndLine: 6, EndCol: 2, NumStmt: 1, Count: 0},
+			{StartLine: 8, StartCol: 1, EndLine: 8, EndCol: 5, NumStmt: 0, Count: 0},
+		},
+	},
+	{
+		FileName: "example.com/foo/bar/b.go",
+		Mode:     "count",
+		Blocks: []cover.ProfileBlock{
+			{StartLine: 5, StartCol: 2, EndLine: 5, EndCol: 20, NumStmt: 1, Count: 1},
+		},
+	},
+}
+
+// lineProfiles are goProfiles converted to line coverage
+var lineProfiles = []*cover.Profile{
+	fromLines("example.com/foo/a.go", map[int]int{3: 2, 4: 2, 5: 0, 6: 0}),
+	fromLines("example.com/foo/bar/b.go", map[int]int{5: 1}),
+}
+
+func TestWriteLCOV(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteLCOV(&b, goProfiles); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `SF:example.com/foo/a.go
+DA:3,2
+DA:4,2
+DA:5,0
+DA:6,0
+LF:4
+LH:2
+end_of_record
+SF:example.com/foo/bar/b.go
+DA:5,1
+LF:1
+LH:1
+end_of_record
+`
+	if b.String() != expected {
+		t.Errorf("expected lcov:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	profiles, err := ReadLCOV(&b)
+	if err != nil {
+		t.Fatalf("failed to read lcov back: %v", err)
+	}
+	if !reflect.DeepEqual(profiles, lineProfiles) {
+		t.Errorf("expected profiles %+v, got %+v", lineProfiles, profiles)
+	}
+}
+
+func TestReadLCOV(t *testing.T) {
+	// as written by istanbul, with a second test's record of the same file
+	lcov := `TN:
+SF:src/index.ts
+FN:1,main
+FNF:1
+FNH:1
+FNDA:3,main
+DA:1,3
+DA:2,3
+DA:4,0
+BRDA:2,0,0,3
+BRF:1
+BRH:1
+LF:3
+LH:2
+end_of_record
+TN:other
+SF:src/index.ts
+DA:4,1,abcdef
+DA:5,1e+10
+end_of_record
+`
+	profiles, err := ReadLCOV(strings.NewReader(lcov))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*cover.Profile{fromLines("src/index.ts", map[int]int{1: 3, 2: 3, 4: 1, 5: 1e10})}
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("expected profiles %+v, got %+v", expected, profiles)
+	}
+
+	for _, malformed := range []string{"DA:1,1\n", "SF:a\nDA:1\n", "SF:a\nDA:x,1\n", "SF:a\nDA:1,x\n"} {
+		if _, err := ReadLCOV(strings.NewReader(malformed)); err == nil {
+			t.Errorf("expected an error reading %q", malformed)
+		}
+	}
+}
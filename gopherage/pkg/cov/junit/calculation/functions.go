@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package calculation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/cover"
+)
+
+// ProduceFuncCoverage summarizes the profile per function declared in src,
+// the source of the profile's file, like `go tool cover -func`. Functions are
+// named "Func", "Type.Method" or "(*Type).Method".
+func ProduceFuncCoverage(profile *cover.Profile, src []byte) ([]Coverage, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, profile.FileName, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", profile.FileName, err)
+	}
+
+	var covs []Coverage
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+		cov := Coverage{Name: funcName(fn)}
+		for _, blk := range profile.Blocks {
+			if blk.StartLine > end.Line || (blk.StartLine == end.Line && blk.StartCol >= end.Column) {
+				// blocks are sorted, the rest are past the function
+				break
+			}
+			if blk.EndLine < start.Line || (blk.EndLine == start.Line && blk.EndCol <= start.Column) {
+				continue
+			}
+			cov.NumAllStmts += blk.NumStmt
+			if blk.Count > 0 {
+				cov.NumCoveredStmts += blk.NumStmt
+			}
+		}
+		covs = append(covs, cov)
+	}
+	return covs, nil
+}
+
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		return fmt.Sprintf("(*%s).%s", types.ExprString(star.X), fn.Name.Name)
+	}
+	return fmt.Sprintf("%s.%s", types.ExprString(recv), fn.Name.Name)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package calculation
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+const funcSource = `package foo
+
+func covered() int {
+	return 1
+}
+
+type T struct{}
+
+func (t *T) partly(b bool) int {
+	if b {
+		return 1
+	}
+	return 2
+}
+
+func (T) uncovered() {
+	println()
+}
+`
+
+func TestProduceFuncCoverage(t *testing.T) {
+	profile := &cover.Profile{FileName: "example.com/foo/foo.go", Mode: "count", Blocks: []cover.ProfileBlock{
+		{StartLine: 3, StartCol: 20, EndLine: 5, EndCol: 2, NumStmt: 1, Count: 3},
+		{StartLine: 9, StartCol: 32, EndLine: 10, EndCol: 6, NumStmt: 1, Count: 1},
+		{StartLine: 10, StartCol: 6, EndLine: 12, EndCol: 3, NumStmt: 1},
+		{StartLine: 13, StartCol: 2, EndLine: 13, EndCol: 10, NumStmt: 1, Count: 1},
+		{StartLine: 16, StartCol: 22, EndLine: 18, EndCol: 2, NumStmt: 1},
+	}}
+	covs, err := ProduceFuncCoverage(profile, []byte(funcSource))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Coverage{
+		{Name: "covered", NumCoveredStmts: 1, NumAllStmts: 1},
+		{Name: "(*T).partly", NumCoveredStmts: 2, NumAllStmts: 3},
+		{Name: "T.uncovered", NumCoveredStmts: 0, NumAllStmts: 1},
+	}
+	if !reflect.DeepEqual(covs, expected) {
+		t.Fatalf("function coverage does not match expectation: expected = %v; actual = %v", expected, covs)
+	}
+
+	if _, err := ProduceFuncCoverage(profile, []byte("not go")); err == nil {
+		t.Fatal("expected invalid source to fail to parse")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package patch calculates how much of the lines added or changed by a diff
+// is covered by a coverage profile.
+package patch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Changes maps the paths of the files in the new version of a diff to the
+// sorted numbers of the lines added or changed in them.
+type Changes map[string][]int
+
+// hunkHeader matches e.g. "@@ -12,3 +14,5 @@ func foo() {", where the line
+// counts default to 1 if they are missing
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseDiff parses a unified diff, e.g. the output of `git diff`, and returns
+// the lines it adds. Deleted files and removed lines are ignored, since
+// there is nothing left to cover.
+func ParseDiff(r io.Reader) (Changes, error) {
+	changes := Changes{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	// file is empty for deleted files, header whether a "+++" line was seen
+	var file string
+	var header bool
+	// line is the number of the next line of the new file in the hunk, and
+	// remaining how many lines of the new file the hunk has left
+	var line, remaining int
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		if remaining > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				changes[file] = append(changes[file], line)
+				line++
+				remaining--
+			case strings.HasPrefix(text, " "), text == "":
+				line++
+				remaining--
+			case strings.HasPrefix(text, "-"), strings.HasPrefix(text, `\`):
+				// removed lines and "\ No newline at end of file"
+			default:
+				return nil, fmt.Errorf("line %d: unexpected line in hunk: %q", lineNumber, text)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = newPath(strings.TrimPrefix(text, "+++ "))
+			header = true
+		case strings.HasPrefix(text, "@@ "):
+			if !header {
+				return nil, fmt.Errorf("line %d: hunk without a file", lineNumber)
+			}
+			match := hunkHeader.FindStringSubmatch(text)
+			if match == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header: %q", lineNumber, text)
+			}
+			line, _ = strconv.Atoi(match[1])
+			remaining = 1
+			if match[2] != "" {
+				remaining, _ = strconv.Atoi(match[2])
+			}
+		}
+		// anything else, e.g. removed lines after the last line of the new
+		// file in a hunk or "diff --git" headers, doesn't add lines
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %v", err)
+	}
+	for name, lines := range changes {
+		sort.Ints(lines)
+		changes[name] = lines
+	}
+	return changes, nil
+}
+
+// newPath returns the path of a "+++" header, without the "b/" prefix git
+// adds by default, or an empty string if the file was deleted
+func newPath(header string) string {
+	// a tab separates the timestamp added by diff -u
+	if i := strings.Index(header, "\t"); i >= 0 {
+		header = header[:i]
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(header); err == nil {
+		header = unquoted
+	}
+	return strings.TrimPrefix(header, "b/")
+}
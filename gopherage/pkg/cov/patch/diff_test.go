@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	testCases := []struct {
+		name        string
+		diff        string
+		expected    Changes
+		expectError bool
+	}{
+		{
+			name: "git diff with context",
+			diff: `diff --git a/foo/foo.go b/foo/foo.go
+index 1111111..2222222 100644
+--- a/foo/foo.go
++++ b/foo/foo.go
+@@ -10,5 +10,7 @@ func foo() {
+ 	a()
+ 	b()
+-	c()
++	d()
++	e()
++	f()
+ 
+ 	g()
+@@ -30 +32 @@ func bar() {
+-	x()
++	y()
+`,
+			expected: Changes{"foo/foo.go": {12, 13, 14, 32}},
+		},
+		{
+			name: "new, deleted and renamed files without context",
+			diff: `diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package foo
+-
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package foo
++--- not a header
+\ No newline at end of file
+diff --git a/a.go b/b.go
+similarity index 90%
+rename from a.go
+rename to b.go
+--- a/a.go
++++ b/b.go
+@@ -3,2 +2,0 @@
+-// removed
+--- removed, not a header
+@@ -7,0 +6 @@
++// added
+`,
+			expected: Changes{"new.go": {1, 2}, "b.go": {6}},
+		},
+		{
+			name:     "plain diff -u",
+			diff:     "--- foo.go\t2021-01-01 00:00:00\n+++ foo.go\t2021-01-02 00:00:00\n@@ -1 +1 @@\n-a\n+b\n",
+			expected: Changes{"foo.go": {1}},
+		},
+		{
+			name:        "hunk without file",
+			diff:        "@@ -1 +1 @@\n-a\n+b\n",
+			expectError: true,
+		},
+		{
+			name:        "truncated hunk",
+			diff:        "+++ b/foo.go\n@@ -1,3 +1,3 @@\n a\n?\n",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changes, err := ParseDiff(strings.NewReader(tc.diff))
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tc.expected) {
+				t.Errorf("expected changes %v, got %v", tc.expected, changes)
+			}
+		})
+	}
+}
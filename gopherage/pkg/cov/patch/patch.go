@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// LineRange is an inclusive range of line numbers.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// FileCoverage is the coverage of the changed lines of one file.
+type FileCoverage struct {
+	// Name is the path of the file in the diff.
+	Name string `json:"name"`
+	// Covered and Total count the statements of the blocks which overlap
+	// changed lines.
+	Covered int `json:"covered"`
+	Total   int `json:"total"`
+	// Uncovered are the changed lines only overlapped by blocks which
+	// weren't run, merged into ranges of consecutive lines.
+	Uncovered []LineRange `json:"uncovered,omitempty"`
+}
+
+// Ratio returns the ratio of covered statements, or 1 if the changed lines
+// have no statements.
+func (f FileCoverage) Ratio() float32 {
+	if f.Total == 0 {
+		return 1
+	}
+	return float32(f.Covered) / float32(f.Total)
+}
+
+// Report is the patch coverage of a diff.
+type Report struct {
+	// Files are the changed files with statements in the profiles, sorted by
+	// name.
+	Files []FileCoverage `json:"files"`
+	// Unprofiled are changed non-test Go files missing from the profiles,
+	// e.g. because the tests of their packages weren't run.
+	Unprofiled []string `json:"unprofiled,omitempty"`
+}
+
+// Covered returns the number of covered statements in all files.
+func (r *Report) Covered() int {
+	covered := 0
+	for _, f := range r.Files {
+		covered += f.Covered
+	}
+	return covered
+}
+
+// Total returns the number of statements in all files.
+func (r *Report) Total() int {
+	total := 0
+	for _, f := range r.Files {
+		total += f.Total
+	}
+	return total
+}
+
+// Ratio returns the ratio of covered statements in all files, or 1 if the
+// diff changes no statements.
+func (r *Report) Ratio() float32 {
+	total := r.Total()
+	if total == 0 {
+		return 1
+	}
+	return float32(r.Covered()) / float32(total)
+}
+
+// Calculate maps the changed lines to the blocks of the profiles. The file
+// names of the profiles are import paths, e.g.
+// "k8s.io/test-infra/gopherage/main.go", so modulePath is stripped from them
+// to match the paths in the diff, which are relative to the repository root.
+func Calculate(profiles []*cover.Profile, changes Changes, modulePath string) *Report {
+	byPath := map[string]*cover.Profile{}
+	for _, profile := range profiles {
+		byPath[relativePath(profile.FileName, modulePath)] = profile
+	}
+
+	var names []string
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &Report{}
+	for _, name := range names {
+		profile, ok := byPath[name]
+		if !ok {
+			if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				report.Unprofiled = append(report.Unprofiled, name)
+			}
+			continue
+		}
+		if f := fileCoverage(name, profile, changes[name]); f.Total > 0 {
+			report.Files = append(report.Files, f)
+		}
+	}
+	return report
+}
+
+func relativePath(fileName, modulePath string) string {
+	if modulePath == "" {
+		return fileName
+	}
+	return strings.TrimPrefix(fileName, strings.TrimSuffix(modulePath, "/")+"/")
+}
+
+// fileCoverage counts the statements of the blocks overlapping the sorted
+// changed lines. Blocks of merged profiles may appear more than once, so
+// blocks are identified by their position and count as covered if any of
+// their copies ran.
+func fileCoverage(name string, profile *cover.Profile, lines []int) FileCoverage {
+	type position struct{ startLine, startCol, endLine, endCol int }
+	blocks := map[position]cover.ProfileBlock{}
+	for _, block := range profile.Blocks {
+		pos := position{block.StartLine, block.StartCol, block.EndLine, block.EndCol}
+		if existing, ok := blocks[pos]; ok && existing.Count > 0 {
+			continue
+		}
+		blocks[pos] = block
+	}
+
+	f := FileCoverage{Name: name}
+	counted := map[position]bool{}
+	for _, line := range lines {
+		// a line is uncovered if it has statements but none of them ran
+		hasStatements, covered := false, false
+		for pos, block := range blocks {
+			if line < block.StartLine || line > block.EndLine || block.NumStmt == 0 {
+				continue
+			}
+			hasStatements = true
+			if block.Count > 0 {
+				covered = true
+			}
+			if !counted[pos] {
+				counted[pos] = true
+				f.Total += block.NumStmt
+				if block.Count > 0 {
+					f.Covered += block.NumStmt
+				}
+			}
+		}
+		if !hasStatements || covered {
+			continue
+		}
+		if n := len(f.Uncovered); n > 0 && f.Uncovered[n-1].End == line-1 {
+			f.Uncovered[n-1].End = line
+		} else {
+			f.Uncovered = append(f.Uncovered, LineRange{Start: line, End: line})
+		}
+	}
+	return f
+}
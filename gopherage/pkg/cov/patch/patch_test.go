@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func TestCalculate(t *testing.T) {
+	profiles := []*cover.Profile{
+		{
+			FileName: "example.com/repo/foo/foo.go",
+			Mode:     "count",
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 3, StartCol: 12, EndLine: 6, EndCol: 2, NumStmt: 3, Count: 1},
+				{StartLine: 8, StartCol: 12, EndLine: 12, EndCol: 2, NumStmt: 4, Count: 0},
+				{StartLine: 14, StartCol: 12, EndLine: 16, EndCol: 2, NumStmt: 2, Count: 0},
+				// the same block in another merged profile, which ran
+				{StartLine: 14, StartCol: 12, EndLine: 16, EndCol: 2, NumStmt: 2, Count: 3},
+				{StartLine: 20, StartCol: 12, EndLine: 22, EndCol: 2, NumStmt: 2, Count: 5},
+			},
+		},
+		{
+			FileName: "example.com/repo/bar/bar.go",
+			Mode:     "count",
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 3, StartCol: 12, EndLine: 5, EndCol: 2, NumStmt: 1, Count: 1},
+			},
+		},
+	}
+	changes := Changes{
+		// lines 1 and 7 have no statements, 9 to 11 are uncovered
+		"foo/foo.go":      {1, 4, 7, 9, 10, 11, 15},
+		"bar/bar.go":      {10},
+		"baz/baz.go":      {1},
+		"baz/baz_test.go": {1},
+		"README.md":       {1},
+	}
+
+	report := Calculate(profiles, changes, "example.com/repo/")
+	expected := &Report{
+		Files: []FileCoverage{
+			{Name: "foo/foo.go", Covered: 5, Total: 9, Uncovered: []LineRange{{Start: 9, End: 11}}},
+		},
+		Unprofiled: []string{"baz/baz.go"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("expected report %+v, got %+v", expected, report)
+	}
+	if report.Covered() != 5 || report.Total() != 9 {
+		t.Errorf("expected 5 of 9 statements to be covered, got %d of %d", report.Covered(), report.Total())
+	}
+
+	markdown := report.Markdown()
+	for _, expected := range []string{"55.6%", "foo/foo.go | 55.6% (5/9) | 9-11", "- baz/baz.go"} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("expected %q in markdown:\n%s", expected, markdown)
+		}
+	}
+}
+
+func TestCalculateNoStatements(t *testing.T) {
+	report := Calculate(nil, Changes{"README.md": {1}}, "")
+	if report.Ratio() != 1 {
+		t.Errorf("expected a diff without statements to be fully covered, got %v", report.Ratio())
+	}
+	if markdown := report.Markdown(); markdown != "" {
+		t.Errorf("expected no markdown, got:\n%s", markdown)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String formats the range like "12" or "12-15".
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%d", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Markdown returns a table of the patch coverage of every file for e.g. PR
+// comments. It returns an empty string if the diff changes no statements
+// and no unprofiled files.
+func (r *Report) Markdown() string {
+	if len(r.Files) == 0 && len(r.Unprofiled) == 0 {
+		return ""
+	}
+	var s strings.Builder
+	fmt.Fprintf(&s, "**Patch coverage: %s** (%d of %d changed statements covered)\n\n", percent(r.Ratio()), r.Covered(), r.Total())
+	if len(r.Files) > 0 {
+		s.WriteString("File | Patch Coverage | Uncovered Lines\n")
+		s.WriteString("---- |:--------------:| ---------------\n")
+		for _, f := range r.Files {
+			var ranges []string
+			for _, lines := range f.Uncovered {
+				ranges = append(ranges, lines.String())
+			}
+			fmt.Fprintf(&s, "%s | %s (%d/%d) | %s\n", f.Name, percent(f.Ratio()), f.Covered, f.Total, strings.Join(ranges, ", "))
+		}
+	}
+	if len(r.Unprofiled) > 0 {
+		s.WriteString("\nChanged files without coverage data:\n")
+		for _, name := range r.Unprofiled {
+			fmt.Fprintf(&s, "- %s\n", name)
+		}
+	}
+	return s.String()
+}
+
+func percent(ratio float32) string {
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"golang.org/x/tools/cover"
+
+	"k8s.io/test-infra/gopherage/pkg/cov/junit/calculation"
+)
+
+// Kinds of checked targets
+const (
+	KindOverall  = "overall"
+	KindPackage  = "package"
+	KindFile     = "file"
+	KindFunction = "function"
+)
+
+// epsilon absorbs float32 rounding when comparing ratios
+const epsilon = 1e-6
+
+// Result is the outcome of checking one target.
+type Result struct {
+	// Kind is one of KindOverall, KindPackage, KindFile or KindFunction.
+	Kind string
+	// Name is the import path of packages, the file name of files and
+	// "{file name}:{function}" for functions.
+	Name     string
+	Coverage float32
+	// Min is the required coverage, zero if there is none.
+	Min float32
+	// Baseline is the coverage in the baseline profile, if it is checked for
+	// regressions.
+	Baseline *float32
+	// Failures explain why the target doesn't meet its bar.
+	Failures []string
+}
+
+// Passed returns true if the target meets its bar.
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Report holds the results of all checks.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the results that didn't pass.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if !result.Passed() {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// SourceReader returns the source of a file named like in coverage profiles.
+type SourceReader func(fileName string) ([]byte, error)
+
+// Check checks the profiles against the policy. Regressions are checked
+// against the baseline profiles if they are not nil. readSource is only
+// called for files whose functions have a minimum coverage.
+func (p *Policy) Check(profiles, baseline []*cover.Profile, readSource SourceReader) (*Report, error) {
+	report := &Report{}
+	covList := calculation.ProduceCovList(profiles)
+	if p.Overall > 0 {
+		report.Results = append(report.Results, check(KindOverall, "OVERALL", covList.Ratio(), Threshold{Min: p.Overall}, nil))
+	}
+
+	// baseline ratios of files and packages, nil without a baseline
+	var baselineFiles, baselinePackages map[string]float32
+	if baseline != nil {
+		baselineList := calculation.ProduceCovList(baseline)
+		baselineFiles = map[string]float32{}
+		for _, cov := range baselineList.Group {
+			baselineFiles[cov.Name] = cov.Ratio()
+		}
+		baselinePackages = map[string]float32{}
+		for name, list := range byPackage(baselineList) {
+			baselinePackages[name] = list.Ratio()
+		}
+	}
+
+	packages := byPackage(covList)
+	var names []string
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list := packages[name]
+		report.Results = append(report.Results, check(KindPackage, name, list.Ratio(), p.packageThreshold(name), lookup(baselinePackages, name)))
+	}
+
+	for _, profile := range profiles {
+		threshold, hasFileRule := p.fileThreshold(profile.FileName)
+		if hasFileRule {
+			cov := summarize(profile)
+			report.Results = append(report.Results, check(KindFile, profile.FileName, cov.Ratio(), threshold, lookup(baselineFiles, profile.FileName)))
+		} else {
+			threshold = p.packageThreshold(path.Dir(profile.FileName))
+		}
+		if threshold.FunctionMin <= 0 {
+			continue
+		}
+		src, err := readSource(profile.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source of %s to check its functions: %v", profile.FileName, err)
+		}
+		funcs, err := calculation.ProduceFuncCoverage(profile, src)
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range funcs {
+			name := fmt.Sprintf("%s:%s", profile.FileName, fn.Name)
+			report.Results = append(report.Results, check(KindFunction, name, fn.Ratio(), Threshold{Min: threshold.FunctionMin}, nil))
+		}
+	}
+	return report, nil
+}
+
+// check checks the coverage of a target against the threshold, and against
+// its baseline if it isn't nil
+func check(kind, name string, ratio float32, threshold Threshold, baseline *float32) Result {
+	result := Result{Kind: kind, Name: name, Coverage: ratio, Min: threshold.Min}
+	if ratio+epsilon < threshold.Min {
+		result.Failures = append(result.Failures, fmt.Sprintf("coverage %s is below the minimum of %s", percent(ratio), percent(threshold.Min)))
+	}
+	if baseline != nil && threshold.AllowedRegression != nil {
+		result.Baseline = baseline
+		if ratio+*threshold.AllowedRegression+epsilon < *baseline {
+			result.Failures = append(result.Failures, fmt.Sprintf("coverage %s dropped from %s by more than the allowed %s",
+				percent(ratio), percent(*baseline), percent(*threshold.AllowedRegression)))
+		}
+	}
+	return result
+}
+
+// byPackage groups the coverage of files by the import path of their package
+func byPackage(covList *calculation.CoverageList) map[string]*calculation.CoverageList {
+	packages := map[string]*calculation.CoverageList{}
+	for _, cov := range covList.Group {
+		name := path.Dir(cov.Name)
+		list, ok := packages[name]
+		if !ok {
+			list = &calculation.CoverageList{Coverage: &calculation.Coverage{Name: name}}
+			packages[name] = list
+		}
+		list.Group = append(list.Group, cov)
+	}
+	return packages
+}
+
+// lookup returns the ratio of name, or nil if it's missing
+func lookup(ratios map[string]float32, name string) *float32 {
+	ratio, ok := ratios[name]
+	if !ok {
+		return nil
+	}
+	return &ratio
+}
+
+func summarize(profile *cover.Profile) calculation.Coverage {
+	return calculation.ProduceCovList([]*cover.Profile{profile}).Group[0]
+}
+
+func percent(ratio float32) string {
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+// profile returns a profile of a file with covered out of total statements,
+// in one block per statement
+func profile(fileName string, covered, total int) *cover.Profile {
+	p := &cover.Profile{FileName: fileName, Mode: "set"}
+	for i := 0; i < total; i++ {
+		block := cover.ProfileBlock{StartLine: i + 3, StartCol: 2, EndLine: i + 3, EndCol: 10, NumStmt: 1}
+		if i < covered {
+			block.Count = 1
+		}
+		p.Blocks = append(p.Blocks, block)
+	}
+	return p
+}
+
+// source declares a function spanning all blocks of profile
+const source = `package foo
+
+func f() {
+	a()
+	a()
+	a()
+	a()
+}
+`
+
+func ratio(f float32) *float32 {
+	return &f
+}
+
+func TestCheck(t *testing.T) {
+	policy := &Policy{
+		Overall: 0.5,
+		Default: Threshold{Min: 0.5, AllowedRegression: ratio(0.1)},
+		Rules: []Rule{
+			{Package: "example.com/strict/...", Threshold: Threshold{Min: 0.9, FunctionMin: 0.5}},
+			{Path: "example.com/strict/**/zz_generated.go"},
+		},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	profiles := []*cover.Profile{
+		profile("example.com/lax/a.go", 8, 10),
+		profile("example.com/lax/b.go", 2, 10),
+		profile("example.com/regressed/a.go", 6, 10),
+		profile("example.com/strict/sub/a.go", 3, 4),
+		profile("example.com/strict/sub/zz_generated.go", 0, 4),
+	}
+	baseline := []*cover.Profile{
+		profile("example.com/lax/a.go", 9, 10),
+		profile("example.com/lax/b.go", 2, 10),
+		profile("example.com/regressed/a.go", 8, 10),
+	}
+	var read []string
+	readSource := func(fileName string) ([]byte, error) {
+		read = append(read, fileName)
+		return []byte(source), nil
+	}
+
+	report, err := policy.Check(profiles, baseline, readSource)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]bool{
+		"OVERALL":                                true,
+		"example.com/lax":                        true,
+		"example.com/regressed":                  false,
+		"example.com/strict/sub":                 false,
+		"example.com/strict/sub/zz_generated.go": true,
+		"example.com/strict/sub/a.go:f":          true,
+	}
+	if len(report.Results) != len(expected) {
+		t.Errorf("expected %d results, got %d: %v", len(expected), len(report.Results), report.Results)
+	}
+	for _, result := range report.Results {
+		passed, ok := expected[result.Name]
+		if !ok {
+			t.Errorf("unexpected result %v", result)
+			continue
+		}
+		if result.Passed() != passed {
+			t.Errorf("expected %s to pass: %v, got failures %v", result.Name, passed, result.Failures)
+		}
+	}
+	if len(read) != 1 || read[0] != "example.com/strict/sub/a.go" {
+		t.Errorf("expected only the source of the file with a function minimum to be read, read %v", read)
+	}
+
+	markdown := report.Markdown()
+	for _, failure := range report.Failed() {
+		if !strings.Contains(markdown, fmt.Sprintf("`%s`", failure.Name)) {
+			t.Errorf("expected failure of %s in the markdown summary:\n%s", failure.Name, markdown)
+		}
+	}
+	xml, err := report.JUnit()
+	if err != nil {
+		t.Fatalf("failed to produce junit: %v", err)
+	}
+	if count := strings.Count(string(xml), "<failure>true</failure>"); count != 2 {
+		t.Errorf("expected 2 failures in the junit xml, got %d:\n%s", count, xml)
+	}
+}
+
+func TestCheckFunctionMin(t *testing.T) {
+	policy := &Policy{Default: Threshold{FunctionMin: 0.5}}
+	readSource := func(string) ([]byte, error) {
+		return []byte(source), nil
+	}
+	report, err := policy.Check([]*cover.Profile{profile("example.com/foo/a.go", 1, 4)}, nil, readSource)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Name != "example.com/foo/a.go:f" {
+		t.Errorf("expected only function f to fail, got %v", failed)
+	}
+
+	_, err = policy.Check([]*cover.Profile{profile("example.com/foo/a.go", 1, 4)}, nil, func(string) ([]byte, error) {
+		return nil, fmt.Errorf("not found")
+	})
+	if err == nil {
+		t.Error("expected missing sources to fail the check")
+	}
+}
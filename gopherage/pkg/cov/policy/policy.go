@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy checks coverage profiles against per-package, per-file and
+// per-function coverage bars set in a policy file.
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Policy sets the coverage bars profiles are checked against.
+type Policy struct {
+	// Overall is the minimum coverage of all profiles together.
+	Overall float32 `json:"overall,omitempty"`
+	// Default applies to all packages not matched by any package rule.
+	Default Threshold `json:"default,omitempty"`
+	// Rules apply to the packages or files they match. If several rules match
+	// the same package or file, the last one wins.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Threshold is the bar for a package or file.
+type Threshold struct {
+	// Min is the minimum ratio of covered statements, from 0 to 1.
+	Min float32 `json:"min,omitempty"`
+	// FunctionMin is the minimum ratio of covered statements of every function.
+	FunctionMin float32 `json:"function_min,omitempty"`
+	// AllowedRegression is how much lower than in the baseline profile the
+	// ratio may be, e.g. 0.01 for one percentage point. Regressions are not
+	// checked if it is unset or there is no baseline.
+	AllowedRegression *float32 `json:"allowed_regression,omitempty"`
+}
+
+// Rule sets the threshold of the packages or the files it matches.
+type Rule struct {
+	// Package is the import path of the packages the rule applies to, a
+	// trailing "/..." matches all packages below it as well.
+	Package string `json:"package,omitempty"`
+	// Path is a glob matched against the file names of the profiles, "*"
+	// doesn't match "/" while "**" does. The rule applies to each matching
+	// file on its own, rather than to its package.
+	Path string `json:"path,omitempty"`
+	Threshold
+
+	path *regexp.Regexp
+}
+
+// Load loads and validates the policy file at path.
+func Load(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %v", err)
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(b, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	return policy, nil
+}
+
+// Validate checks the policy and compiles the globs of its rules.
+func (p *Policy) Validate() error {
+	if err := validateRatio("overall", p.Overall); err != nil {
+		return err
+	}
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default: %v", err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if (rule.Package == "") == (rule.Path == "") {
+			return fmt.Errorf("rule %d: exactly one of package and path must be set", i)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+		if rule.Path != "" {
+			rule.path = globToRegexp(rule.Path)
+		}
+	}
+	return nil
+}
+
+func (t Threshold) validate() error {
+	if err := validateRatio("min", t.Min); err != nil {
+		return err
+	}
+	if err := validateRatio("function_min", t.FunctionMin); err != nil {
+		return err
+	}
+	if t.AllowedRegression != nil {
+		return validateRatio("allowed_regression", *t.AllowedRegression)
+	}
+	return nil
+}
+
+func validateRatio(name string, ratio float32) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("%s must be between 0 and 1, got %v", name, ratio)
+	}
+	return nil
+}
+
+// packageThreshold returns the threshold of the package with the import path
+func (p *Policy) packageThreshold(pkg string) Threshold {
+	threshold := p.Default
+	for _, rule := range p.Rules {
+		if rule.Package != "" && matchPackage(rule.Package, pkg) {
+			threshold = rule.Threshold
+		}
+	}
+	return threshold
+}
+
+// fileThreshold returns the threshold of the file if a rule matches it
+func (p *Policy) fileThreshold(fileName string) (Threshold, bool) {
+	var threshold Threshold
+	var found bool
+	for _, rule := range p.Rules {
+		if rule.path != nil && rule.path.MatchString(fileName) {
+			threshold, found = rule.Threshold, true
+		}
+	}
+	return threshold, found
+}
+
+// matchPackage matches import paths like the go tool does, where a trailing
+// "/..." matches the package and all packages below it.
+func matchPackage(pattern, pkg string) bool {
+	if pattern == "..." {
+		return true
+	}
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+	}
+	return pattern == pkg
+}
+
+// globToRegexp converts a glob where "*" matches anything but "/", "**"
+// matches anything and "?" matches any character but "/".
+func globToRegexp(glob string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      string
+		expectError bool
+	}{
+		{
+			name: "valid",
+			policy: `overall: 0.5
+default:
+  min: 0.6
+  allowed_regression: 0.01
+rules:
+- package: example.com/foo/...
+  min: 0.8
+  function_min: 0.5
+- path: "example.com/**/zz_generated*.go"
+`,
+		},
+		{
+			name:        "unknown field",
+			policy:      "default:\n  minimum: 0.6\n",
+			expectError: true,
+		},
+		{
+			name:        "ratio out of range",
+			policy:      "default:\n  min: 60\n",
+			expectError: true,
+		},
+		{
+			name:        "rule without target",
+			policy:      "rules:\n- min: 0.5\n",
+			expectError: true,
+		},
+		{
+			name:        "rule with package and path",
+			policy:      "rules:\n- package: foo\n  path: foo/*.go\n",
+			expectError: true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "policy.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.policy), 0644); err != nil {
+				t.Fatalf("failed to write policy: %v", err)
+			}
+			policy, err := Load(path)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy.Default.AllowedRegression == nil || *policy.Default.AllowedRegression != 0.01 {
+				t.Errorf("expected the default allowed regression to be 0.01, got %v", policy.Default.AllowedRegression)
+			}
+			if policy.Rules[1].path == nil {
+				t.Error("expected the glob of the path rule to be compiled")
+			}
+		})
+	}
+}
+
+func TestMatchPackage(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		pkg     string
+		match   bool
+	}{
+		{pattern: "example.com/foo", pkg: "example.com/foo", match: true},
+		{pattern: "example.com/foo", pkg: "example.com/foo/bar", match: false},
+		{pattern: "example.com/foo/...", pkg: "example.com/foo", match: true},
+		{pattern: "example.com/foo/...", pkg: "example.com/foo/bar/baz", match: true},
+		{pattern: "example.com/foo/...", pkg: "example.com/foobar", match: false},
+		{pattern: "...", pkg: "example.com/foo", match: true},
+	}
+	for _, tc := range testCases {
+		if match := matchPackage(tc.pattern, tc.pkg); match != tc.match {
+			t.Errorf("expected matchPackage(%q, %q) to be %v", tc.pattern, tc.pkg, tc.match)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	testCases := []struct {
+		glob  string
+		name  string
+		match bool
+	}{
+		{glob: "example.com/foo/*.go", name: "example.com/foo/bar.go", match: true},
+		{glob: "example.com/foo/*.go", name: "example.com/foo/bar/baz.go", match: false},
+		{glob: "example.com/**/zz_*.go", name: "example.com/foo/bar/zz_generated.go", match: true},
+		{glob: "example.com/**/zz_*.go", name: "example.com/foo/bar/generated.go", match: false},
+		{glob: "example.com/foo/ba?.go", name: "example.com/foo/baz.go", match: true},
+		{glob: "example.com/foo/ba?.go", name: "example.com/foo/ba/.go", match: false},
+		{glob: "example.com/foo.go", name: "example.com/fooxgo", match: false},
+	}
+	for _, tc := range testCases {
+		if match := globToRegexp(tc.glob).MatchString(tc.name); match != tc.match {
+			t.Errorf("expected glob %q matching %q to be %v", tc.glob, tc.name, tc.match)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"k8s.io/test-infra/gopherage/pkg/cov/junit"
+)
+
+// JUnit returns the results as junit xml, in the format of `gopherage junit`
+// with the minimum, baseline and failures as additional properties.
+func (r *Report) JUnit() ([]byte, error) {
+	ts := junit.Testsuite{}
+	for _, result := range r.Results {
+		properties := []junit.Property{
+			{Name: "coverage", Value: fmt.Sprintf("%.1f", result.Coverage*100)},
+			{Name: "kind", Value: result.Kind},
+		}
+		if result.Min > 0 {
+			properties = append(properties, junit.Property{Name: "min", Value: fmt.Sprintf("%.1f", result.Min*100)})
+		}
+		if result.Baseline != nil {
+			properties = append(properties, junit.Property{Name: "baseline", Value: fmt.Sprintf("%.1f", *result.Baseline*100)})
+		}
+		if !result.Passed() {
+			properties = append(properties, junit.Property{Name: "failure", Value: strings.Join(result.Failures, "; ")})
+		}
+		ts.Testcases = append(ts.Testcases, junit.TestCase{
+			ClassName:    "go_coverage",
+			Name:         result.Name,
+			Time:         "0",
+			Failure:      !result.Passed(),
+			PropertyList: junit.Properties{PropertyList: properties},
+		})
+	}
+	return xml.MarshalIndent(ts, "", "    ")
+}
+
+// Markdown returns a summary of the results for e.g. PR comments, with all
+// failures and the coverage of all packages.
+func (r *Report) Markdown() string {
+	var s strings.Builder
+	failed := r.Failed()
+	if len(failed) == 0 {
+		fmt.Fprintf(&s, "## Coverage check passed\n\nAll %d checks passed.\n", len(r.Results))
+	} else {
+		fmt.Fprintf(&s, "## Coverage check failed\n\n%d of %d checks failed.\n\n", len(failed), len(r.Results))
+		s.WriteString("| Kind | Name | Coverage | Failure |\n|---|---|---|---|\n")
+		for _, result := range failed {
+			fmt.Fprintf(&s, "| %s | `%s` | %s | %s |\n", result.Kind, result.Name, percent(result.Coverage), strings.Join(result.Failures, "; "))
+		}
+	}
+
+	s.WriteString("\n<details><summary>Coverage by package</summary>\n\n")
+	s.WriteString("| Package | Coverage | Minimum | Baseline | |\n|---|---|---|---|---|\n")
+	for _, result := range r.Results {
+		if result.Kind != KindPackage && result.Kind != KindOverall {
+			continue
+		}
+		min, baseline, status := "", "", ":white_check_mark:"
+		if result.Min > 0 {
+			min = percent(result.Min)
+		}
+		if result.Baseline != nil {
+			baseline = percent(*result.Baseline)
+		}
+		if !result.Passed() {
+			status = ":x:"
+		}
+		fmt.Fprintf(&s, "| `%s` | %s | %s | %s | %s |\n", result.Name, percent(result.Coverage), min, baseline, status)
+	}
+	s.WriteString("\n</details>\n")
+	return s.String()
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package util
 
 import (
+	"bufio"
 	"fmt"
 	"golang.org/x/tools/cover"
 	"io"
 	"io/ioutil"
 	"k8s.io/test-infra/gopherage/pkg/cov"
 	"os"
+	"strings"
 )
 
 // DumpProfile dumps the profile to the given file destination.
@@ -67,3 +69,21 @@ func LoadProfile(origin string) ([]*cover.Profile, error) {
 	}
 	return cover.ParseProfiles(filename)
 }
+
+// ModulePath returns the module path declared in the given go.mod file, or an
+// empty string if there is none.
+func ModulePath(goMod string) string {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskcache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// WriteMode is how entries put into the cache are written to the bucket
+type WriteMode string
+
+const (
+	// WriteThrough writes entries to the bucket before Put returns
+	WriteThrough WriteMode = "through"
+	// WriteBack writes entries to the bucket asynchronously, entries are lost
+	// if they are evicted or greenhouse stops before they are written
+	WriteBack WriteMode = "back"
+)
+
+// writeBackQueueSize is how many entries can wait to be written back before
+// further entries are dropped
+const writeBackQueueSize = 10000
+
+// bucketTimeout is how long a single request to the bucket may take,
+// including copying the entry
+const bucketTimeout = 10 * time.Minute
+
+// Bucket is a blob bucket shared by several caches, local misses fall
+// through to it and populate the disk.
+//
+// Entries are never deleted from the bucket, use the lifecycle policies of
+// the storage provider to expire them.
+type Bucket struct {
+	opener  pkgio.Opener
+	prefix  string
+	mode    WriteMode
+	workers int
+	queue   chan string
+	wg      sync.WaitGroup
+	// lock guards flushed, no entries are queued once it is set
+	lock    sync.Mutex
+	flushed bool
+}
+
+// NewBucket returns a Bucket storing entries under prefix, any path prow/io
+// can open, e.g. gs://bucket/greenhouse, s3://bucket/greenhouse or
+// /mnt/shared. In WriteBack mode, workers goroutines write entries back.
+func NewBucket(opener pkgio.Opener, prefix string, mode WriteMode, workers int) (*Bucket, error) {
+	if mode != WriteThrough && mode != WriteBack {
+		return nil, fmt.Errorf("invalid write mode %q, expected %q or %q", mode, WriteThrough, WriteBack)
+	}
+	if mode == WriteBack && workers < 1 {
+		return nil, fmt.Errorf("write back needs at least one worker, got %d", workers)
+	}
+	return &Bucket{
+		opener:  opener,
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		mode:    mode,
+		workers: workers,
+		queue:   make(chan string, writeBackQueueSize),
+	}, nil
+}
+
+// SetBucket layers the cache over the bucket, write back workers are started
+// right away. Call this before using the cache.
+func (c *Cache) SetBucket(b *Bucket) {
+	c.bucket = b
+	if b.mode != WriteBack {
+		return
+	}
+	for i := 0; i < b.workers; i++ {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for key := range b.queue {
+				c.writeBack(key)
+			}
+		}()
+	}
+}
+
+// Flush stops accepting entries to write back and waits for the queued ones
+// to be written. Entries put afterwards are not written to the bucket.
+func (b *Bucket) Flush() {
+	b.lock.Lock()
+	if !b.flushed {
+		b.flushed = true
+		close(b.queue)
+	}
+	b.lock.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Bucket) path(key string) string {
+	return b.prefix + "/" + key
+}
+
+// exists returns true if the entry at key is in the bucket
+func (b *Bucket) exists(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bucketTimeout)
+	defer cancel()
+	_, err := b.opener.Attributes(ctx, b.path(key))
+	if err != nil {
+		if pkgio.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// write writes the contents of the entry at key to the bucket
+func (b *Bucket) write(key string, contents io.Reader) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bucketTimeout)
+	defer cancel()
+	writer, err := b.opener.Writer(ctx, b.path(key))
+	if err != nil {
+		return fmt.Errorf("failed to open %s for writing: %v", b.path(key), err)
+	}
+	if _, err := io.Copy(writer, contents); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write %s: %v", b.path(key), err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", b.path(key), err)
+	}
+	return nil
+}
+
+// upload writes the local entry at key to the bucket. CAS entries already in
+// the bucket are skipped, they can't have changed.
+func (c *Cache) upload(key string) error {
+	if ClassOf(key) == CAS {
+		exists, err := c.bucket.exists(key)
+		if err != nil {
+			bucketWriteCounter.WithLabelValues("error").Inc()
+			return fmt.Errorf("failed to look up %s: %v", c.bucket.path(key), err)
+		}
+		if exists {
+			bucketWriteCounter.WithLabelValues("skipped").Inc()
+			return nil
+		}
+	}
+	f, err := os.Open(c.KeyToPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// evicted before it was written
+			bucketWriteCounter.WithLabelValues("dropped").Inc()
+			return nil
+		}
+		bucketWriteCounter.WithLabelValues("error").Inc()
+		return err
+	}
+	defer f.Close()
+	if err := c.bucket.write(key, f); err != nil {
+		bucketWriteCounter.WithLabelValues("error").Inc()
+		return err
+	}
+	bucketWriteCounter.WithLabelValues("written").Inc()
+	return nil
+}
+
+// writeToBucket writes or queues the local entry at key to be written,
+// depending on the write mode. The entry is already on disk, so failing to
+// write it to the bucket is only logged.
+func (c *Cache) writeToBucket(key string) {
+	if c.bucket.mode == WriteThrough {
+		if err := c.upload(key); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("Failed to write entry through to the bucket.")
+		}
+		return
+	}
+	c.bucket.lock.Lock()
+	defer c.bucket.lock.Unlock()
+	if c.bucket.flushed {
+		bucketWriteCounter.WithLabelValues("dropped").Inc()
+		return
+	}
+	select {
+	case c.bucket.queue <- key:
+	default:
+		logrus.WithField("key", key).Warn("Write back queue is full, not writing entry to the bucket.")
+		bucketWriteCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (c *Cache) writeBack(key string) {
+	if err := c.upload(key); err != nil {
+		logrus.WithError(err).WithField("key", key).Warn("Failed to write entry back to the bucket.")
+	}
+}
+
+// fetch copies the entry at key from the bucket to the disk, and returns
+// false if it isn't in the bucket either
+func (c *Cache) fetch(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bucketTimeout)
+	defer cancel()
+	reader, err := c.bucket.opener.Reader(ctx, c.bucket.path(key))
+	if err != nil {
+		if pkgio.IsNotExist(err) {
+			bucketReadCounter.WithLabelValues("miss").Inc()
+			return false, nil
+		}
+		bucketReadCounter.WithLabelValues("error").Inc()
+		return false, fmt.Errorf("failed to read %s: %v", c.bucket.path(key), err)
+	}
+	defer pkgio.LogClose(reader)
+	// verify CAS entries, the bucket may be shared with less careful writers
+	hash := ""
+	if ClassOf(key) == CAS {
+		hash = path.Base(key)
+	}
+	if err := c.put(key, reader, hash); err != nil {
+		bucketReadCounter.WithLabelValues("error").Inc()
+		return false, err
+	}
+	bucketReadCounter.WithLabelValues("hit").Inc()
+	return true, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// newTestBucket returns a bucket in a tempdir
+func newTestBucket(t *testing.T, mode WriteMode) (*Bucket, string) {
+	dir, err := ioutil.TempDir("", "bucket-tests")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir for tests! %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	opener, err := pkgio.NewOpener(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("Failed to create opener: %v", err)
+	}
+	bucket, err := NewBucket(opener, dir+"/greenhouse/", mode, 2)
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	return bucket, filepath.Join(dir, "greenhouse")
+}
+
+func getContents(t *testing.T, cache *Cache, key string) []byte {
+	var contents []byte
+	err := cache.Get(key, func(exists bool, reader io.ReadSeeker) error {
+		if !exists {
+			return nil
+		}
+		var err error
+		contents, err = ioutil.ReadAll(reader)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", key, err)
+	}
+	return contents
+}
+
+func TestBucketWriteThrough(t *testing.T) {
+	bucket, bucketDir := newTestBucket(t, WriteThrough)
+	blob := []byte{1, 3, 3, 7}
+	blobKey := "ws/cas/" + hashBytes(blob)
+
+	writer := newTestCache(t)
+	writer.SetBucket(bucket)
+	if err := writer.Put("/"+blobKey, bytes.NewReader(blob), hashBytes(blob)); err != nil {
+		t.Fatalf("Failed to put blob: %v", err)
+	}
+	if err := writer.Put("ws/ac/action", bytes.NewReader([]byte("result")), ""); err != nil {
+		t.Fatalf("Failed to put action result: %v", err)
+	}
+	for _, key := range []string{blobKey, "ws/ac/action"} {
+		if _, err := os.Stat(filepath.Join(bucketDir, key)); err != nil {
+			t.Errorf("Expected %s to be written to the bucket: %v", key, err)
+		}
+	}
+
+	// another cache sharing the bucket finds the entries
+	reader := newTestCache(t)
+	reader.SetBucket(bucket)
+	exists, err := reader.Touch(blobKey)
+	if err != nil || !exists {
+		t.Errorf("Expected blob in the bucket to exist, got %v and %v", exists, err)
+	}
+	if _, err := os.Stat(reader.KeyToPath(blobKey)); !os.IsNotExist(err) {
+		t.Errorf("Expected Touch not to copy the blob to disk, got %v", err)
+	}
+	if contents := getContents(t, reader, blobKey); !bytes.Equal(contents, blob) {
+		t.Errorf("Expected to get the blob from the bucket, got %v", contents)
+	}
+	if contents := getContents(t, reader, "ws/ac/action"); string(contents) != "result" {
+		t.Errorf("Expected to get the action result from the bucket, got %q", contents)
+	}
+	if usage := reader.Usage(CAS); usage != int64(len(blob)) {
+		t.Errorf("Expected the fetched blob to be on disk, got %d bytes", usage)
+	}
+	if contents := getContents(t, reader, "ws/ac/missing"); contents != nil {
+		t.Errorf("Expected a missing entry not to be found, got %q", contents)
+	}
+
+	// corrupted CAS entries in the bucket are ignored
+	corruptKey := "ws/cas/" + hashBytes([]byte("expected"))
+	if err := os.MkdirAll(filepath.Join(bucketDir, "ws/cas"), 0755); err != nil {
+		t.Fatalf("Failed to create bucket dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bucketDir, corruptKey), []byte("actual"), 0644); err != nil {
+		t.Fatalf("Failed to write corrupted blob: %v", err)
+	}
+	if contents := getContents(t, reader, corruptKey); contents != nil {
+		t.Errorf("Expected a corrupted blob not to be found, got %q", contents)
+	}
+}
+
+func TestBucketWriteBack(t *testing.T) {
+	bucket, bucketDir := newTestBucket(t, WriteBack)
+	cache := newTestCache(t)
+	cache.SetBucket(bucket)
+
+	for _, key := range []string{"ws/ac/a", "ws/ac/b"} {
+		if err := cache.Put(key, bytes.NewReader([]byte(key)), ""); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	bucket.Flush()
+	for _, key := range []string{"ws/ac/a", "ws/ac/b"} {
+		contents, err := ioutil.ReadFile(filepath.Join(bucketDir, key))
+		if err != nil || string(contents) != key {
+			t.Errorf("Expected %s to be written back, got %q and %v", key, contents, err)
+		}
+	}
+}
+
+func TestBucketWriteThroughFailure(t *testing.T) {
+	bucket, bucketDir := newTestBucket(t, WriteThrough)
+	// the bucket can't be written under a regular file
+	if err := ioutil.WriteFile(bucketDir, []byte("not a dir"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	cache := newTestCache(t)
+	cache.SetBucket(bucket)
+	if err := cache.Put("ws/ac/action", bytes.NewReader([]byte("result")), ""); err != nil {
+		t.Fatalf("Expected Put to succeed once the entry is on disk, got %v", err)
+	}
+	if contents := getContents(t, cache, "ws/ac/action"); string(contents) != "result" {
+		t.Errorf("Expected to get the action result from disk, got %q", contents)
+	}
+}
+
+func TestBucketPutAfterFlush(t *testing.T) {
+	bucket, bucketDir := newTestBucket(t, WriteBack)
+	cache := newTestCache(t)
+	cache.SetBucket(bucket)
+	bucket.Flush()
+	bucket.Flush()
+	if err := cache.Put("ws/ac/late", bytes.NewReader([]byte("late")), ""); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(bucketDir, "ws/ac/late")); !os.IsNotExist(err) {
+		t.Errorf("Expected an entry put after flushing not to be written back, got %v", err)
+	}
+}
+
+func TestNewBucket(t *testing.T) {
+	if _, err := NewBucket(nil, "/tmp", WriteMode("sideways"), 1); err == nil {
+		t.Error("Expected an invalid write mode to be rejected.")
+	}
+	if _, err := NewBucket(nil, "/tmp", WriteBack, 0); err == nil {
+		t.Error("Expected write back without workers to be rejected.")
+	}
+}
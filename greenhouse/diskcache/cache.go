@@ -20,10 +20,12 @@ package diskcache
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -36,20 +38,57 @@ import (
 // ReadHandler should be implemented by cache users for use with Cache.Get
 type ReadHandler func(exists bool, contents io.ReadSeeker) error
 
+// IndexFile is the file under the disk root the access index is saved to
+const IndexFile = "index.json"
+
+// tempPrefix prefixes the names of files that are not cache entries yet
+const tempPrefix = "temp-"
+
 // Cache implements disk backed cache storage
+//
+// The size and last access of entries are tracked in an in-memory index, so
+// that entries can be evicted in LRU order without scanning the disk, with
+// separate quotas for the action cache and the CAS.
 type Cache struct {
 	diskRoot string
 	logger   *logrus.Entry
+	index    *index
+	bucket   *Bucket
+	now      func() time.Time
 }
 
 // NewCache returns a new Cache given the root directory that should be used
 // on disk for cache storage
+//
+// The index starts out empty, entries already on disk are only indexed by
+// LoadIndex.
 func NewCache(diskRoot string) *Cache {
 	return &Cache{
 		diskRoot: strings.TrimSuffix(diskRoot, string(os.PathListSeparator)),
+		index:    newIndex(),
+		now:      time.Now,
 	}
 }
 
+// SetQuota sets the maximum number of bytes used by entries of the class,
+// the least recently accessed entries are evicted when it is exceeded.
+// Zero means unlimited.
+func (c *Cache) SetQuota(class Class, bytes int64) {
+	c.index.setQuota(class, bytes)
+	c.enforceQuota(class)
+}
+
+// Usage returns the number of bytes used by the indexed entries of the class
+func (c *Cache) Usage(class Class) int64 {
+	return c.index.usage(class)
+}
+
+// cleanKey returns the canonical form of key, so that e.g. "/ws/cas/hash"
+// from an HTTP path and "ws/cas/hash" refer to the same entry
+func cleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
 // KeyToPath converts a cache entry key to a path on disk
 func (c *Cache) KeyToPath(key string) string {
 	return filepath.Join(c.diskRoot, key)
@@ -90,7 +129,21 @@ func removeTemp(path string) {
 // Put copies the content reader until the end into the cache at key
 // if contentSHA256 is not "" then the contents will only be stored in the
 // cache if the content's hex string SHA256 matches
+//
+// If the cache has a bucket, the entry is written to it as well.
 func (c *Cache) Put(key string, content io.Reader, contentSHA256 string) error {
+	key = cleanKey(key)
+	if err := c.put(key, content, contentSHA256); err != nil {
+		return err
+	}
+	if c.bucket != nil {
+		c.writeToBucket(key)
+	}
+	return nil
+}
+
+// put stores the entry on disk only
+func (c *Cache) put(key string, content io.Reader, contentSHA256 string) error {
 	// make sure directory exists
 	path := c.KeyToPath(key)
 	dir := filepath.Dir(path)
@@ -100,14 +153,15 @@ func (c *Cache) Put(key string, content io.Reader, contentSHA256 string) error {
 	}
 
 	// create a temp file to get the content on disk
-	temp, err := ioutil.TempFile(dir, "temp-put")
+	temp, err := ioutil.TempFile(dir, tempPrefix+"put")
 	if err != nil {
 		return fmt.Errorf("failed to create cache entry: %v", err)
 	}
 
 	// fast path copying when not hashing content,s
+	var size int64
 	if contentSHA256 == "" {
-		_, err = io.Copy(temp, content)
+		size, err = io.Copy(temp, content)
 		if err != nil {
 			removeTemp(temp.Name())
 			return fmt.Errorf("failed to copy into cache entry: %v", err)
@@ -115,7 +169,7 @@ func (c *Cache) Put(key string, content io.Reader, contentSHA256 string) error {
 
 	} else {
 		hasher := sha256.New()
-		_, err = io.Copy(io.MultiWriter(temp, hasher), content)
+		size, err = io.Copy(io.MultiWriter(temp, hasher), content)
 		if err != nil {
 			removeTemp(temp.Name())
 			return fmt.Errorf("failed to copy into cache entry: %v", err)
@@ -141,26 +195,94 @@ func (c *Cache) Put(key string, content io.Reader, contentSHA256 string) error {
 		removeTemp(temp.Name())
 		return fmt.Errorf("failed to insert contents into cache: %v", err)
 	}
+	c.index.add(key, size, c.now(), true)
+	c.enforceQuota(ClassOf(key))
 	return nil
 }
 
 // Get provides your readHandler with the contents at key
+//
+// If the cache has a bucket, entries missing on disk are copied from it.
 func (c *Cache) Get(key string, readHandler ReadHandler) error {
+	key = cleanKey(key)
 	path := c.KeyToPath(key)
 	f, err := os.Open(path)
+	if os.IsNotExist(err) && c.bucket != nil {
+		var fetched bool
+		if fetched, err = c.fetch(key); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("Failed to fetch entry from the bucket.")
+		}
+		if fetched {
+			f, err = os.Open(path)
+		} else {
+			err = os.ErrNotExist
+		}
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
+			c.miss(key)
 			return readHandler(false, nil)
 		}
 		return fmt.Errorf("failed to get key: %v", err)
 	}
+	defer f.Close()
+	c.hit(key, f.Stat)
 	return readHandler(true, f)
 }
 
+// Touch marks the entry at key as accessed now so that it isn't evicted soon,
+// and returns false if it doesn't exist.
+//
+// If the cache has a bucket, entries missing on disk exist if they are in the
+// bucket, but are only copied to the disk by Get.
+func (c *Cache) Touch(key string) (bool, error) {
+	key = cleanKey(key)
+	path := c.KeyToPath(key)
+	stat := func() (os.FileInfo, error) { return os.Stat(path) }
+	if _, err := stat(); err != nil {
+		if !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to stat key: %v", err)
+		}
+		if c.bucket != nil {
+			exists, err := c.bucket.exists(key)
+			if err != nil {
+				return false, fmt.Errorf("failed to look up key in the bucket: %v", err)
+			}
+			if exists {
+				return true, nil
+			}
+		}
+		c.miss(key)
+		return false, nil
+	}
+	c.hit(key, stat)
+	return true, nil
+}
+
+// hit records an access of the entry at key, stat is only used to index
+// entries that aren't indexed yet
+func (c *Cache) hit(key string, stat func() (os.FileInfo, error)) {
+	now := c.now()
+	if c.index.touch(key, now) {
+		return
+	}
+	if info, err := stat(); err == nil {
+		c.index.add(key, info.Size(), now, false)
+		c.enforceQuota(ClassOf(key))
+	}
+}
+
+// miss records a lookup of an entry that doesn't exist
+func (c *Cache) miss(key string) {
+	// the entry may have been evicted while it was being replaced
+	c.index.remove(key)
+}
+
 // EntryInfo are returned when getting entries from the cache
 type EntryInfo struct {
 	Path       string
 	LastAccess time.Time
+	Size       int64
 }
 
 // GetEntries walks the cache dir and returns all paths that exist
@@ -175,7 +297,7 @@ func (c *Cache) GetEntries() []EntryInfo {
 			logrus.WithError(err).Error("error getting some entries")
 			return nil
 		}
-		if !f.IsDir() {
+		if !f.IsDir() && path != c.indexPath() {
 			atime := diskutil.GetATime(path, time.Now())
 			entries = append(entries, EntryInfo{
 				Path:       path,
@@ -189,5 +311,124 @@ func (c *Cache) GetEntries() []EntryInfo {
 
 // Delete deletes the file at key
 func (c *Cache) Delete(key string) error {
+	key = cleanKey(key)
+	c.index.remove(key)
 	return os.Remove(c.KeyToPath(key))
 }
+
+// EvictOldest deletes the least recently accessed entry of any class and
+// returns it, or false if there are no indexed entries
+func (c *Cache) EvictOldest() (EntryInfo, bool, error) {
+	e := c.index.popOldest()
+	if e == nil {
+		return EntryInfo{}, false, nil
+	}
+	info := EntryInfo{Path: c.KeyToPath(e.key), LastAccess: e.lastAccess, Size: e.size}
+	return info, true, c.evict(e, "disk")
+}
+
+// enforceQuota evicts entries of the class until it is within its quota
+func (c *Cache) enforceQuota(class Class) {
+	for e := c.index.popOverQuota(class); e != nil; e = c.index.popOverQuota(class) {
+		if err := c.evict(e, "quota"); err != nil {
+			logrus.WithError(err).Errorf("Failed to evict key: %v", e.key)
+		}
+	}
+}
+
+// evict deletes the file of an entry already removed from the index
+func (c *Cache) evict(e *entry, reason string) error {
+	if err := os.Remove(c.KeyToPath(e.key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to evict key: %v", err)
+	}
+	evictedBytesCounter.WithLabelValues(string(e.class), reason).Add(float64(e.size))
+	return nil
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.diskRoot, IndexFile)
+}
+
+// savedIndex is the format of IndexFile
+type savedIndex struct {
+	// LastAccess maps keys to the unix time of their last access
+	LastAccess map[string]int64 `json:"last_access"`
+}
+
+// SaveIndex saves the last access of all indexed entries to IndexFile, so
+// that it survives restarts
+func (c *Cache) SaveIndex() error {
+	saved := savedIndex{LastAccess: map[string]int64{}}
+	for key, lastAccess := range c.index.lastAccesses() {
+		saved.LastAccess[key] = lastAccess.Unix()
+	}
+	temp, err := ioutil.TempFile(c.diskRoot, tempPrefix+"index")
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %v", err)
+	}
+	if err := json.NewEncoder(temp).Encode(saved); err != nil {
+		temp.Close()
+		removeTemp(temp.Name())
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		removeTemp(temp.Name())
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	if err := os.Rename(temp.Name(), c.indexPath()); err != nil {
+		removeTemp(temp.Name())
+		return fmt.Errorf("failed to replace index: %v", err)
+	}
+	return nil
+}
+
+// LoadIndex indexes all entries on disk, using the last accesses saved by
+// SaveIndex, or the atime of entries missing from it. Entries accessed since
+// the cache was created keep their index. Leftovers of puts that didn't
+// finish within staleTempAge are deleted.
+//
+// This scans the whole disk, but can run while the cache is in use.
+func (c *Cache) LoadIndex(staleTempAge time.Duration) error {
+	saved := savedIndex{}
+	if data, err := ioutil.ReadFile(c.indexPath()); err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			logrus.WithError(err).Warn("Ignoring invalid index file, using atimes instead.")
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+
+	now := c.now()
+	var indexed int
+	// like GetEntries we swallow errors, missing some entries is better than
+	// missing all of them
+	_ = filepath.Walk(c.diskRoot, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			logrus.WithError(err).Error("error indexing some entries")
+			return nil
+		}
+		if f.IsDir() || path == c.indexPath() {
+			return nil
+		}
+		if strings.HasPrefix(f.Name(), tempPrefix) {
+			if now.Sub(f.ModTime()) > staleTempAge {
+				removeTemp(path)
+			}
+			return nil
+		}
+		key := c.PathToKey(path)
+		lastAccess, ok := saved.LastAccess[key]
+		if ok {
+			c.index.add(key, f.Size(), time.Unix(lastAccess, 0), false)
+		} else {
+			c.index.add(key, f.Size(), diskutil.GetATime(path, f.ModTime()), false)
+		}
+		indexed++
+		return nil
+	})
+	logrus.WithField("entries", indexed).Info("Indexed cache entries on disk.")
+	for _, class := range classes {
+		c.enforceQuota(class)
+	}
+	return nil
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 )
@@ -207,3 +208,177 @@ func TestCacheStorage(t *testing.T) {
 		t.Fatalf("cache.GetEntries() should be empty after deleting all keys, got: %v", entries)
 	}
 }
+
+// newTestCache returns a cache in a tempdir whose clock advances by a
+// second on every access
+func newTestCache(t *testing.T) *Cache {
+	dir, err := ioutil.TempDir("", "cache-tests")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir for tests! %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cache := NewCache(dir)
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return cache
+}
+
+func putKeys(t *testing.T, cache *Cache, size int, keys ...string) {
+	for _, key := range keys {
+		if err := cache.Put(key, bytes.NewReader(make([]byte, size)), ""); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+}
+
+func existingKeys(cache *Cache) sets.String {
+	keys := sets.NewString()
+	for _, entry := range cache.GetEntries() {
+		keys.Insert(cache.PathToKey(entry.Path))
+	}
+	return keys
+}
+
+func TestTouch(t *testing.T) {
+	cache := newTestCache(t)
+
+	exists, err := cache.Touch("ws/cas/a")
+	if err != nil || exists {
+		t.Fatalf("Expected missing key not to exist, got %v and %v", exists, err)
+	}
+	putKeys(t, cache, 1, "ws/cas/a", "ws/cas/b")
+	exists, err = cache.Touch("ws/cas/a")
+	if err != nil || !exists {
+		t.Fatalf("Expected key to exist, got %v and %v", exists, err)
+	}
+	// b is now the least recently accessed entry
+	entry, evicted, err := cache.EvictOldest()
+	if err != nil || !evicted {
+		t.Fatalf("Expected an entry to be evicted, got %v and %v", evicted, err)
+	}
+	if key := cache.PathToKey(entry.Path); key != "ws/cas/b" {
+		t.Errorf("Expected ws/cas/b to be evicted, got %s", key)
+	}
+	if keys := existingKeys(cache); !keys.Equal(sets.NewString("ws/cas/a")) {
+		t.Errorf("Expected only ws/cas/a to remain, got %v", keys.List())
+	}
+}
+
+// HTTP handlers look entries up by URL path, which must refer to the same
+// entries as the keys indexed from disk
+func TestKeysAreCleaned(t *testing.T) {
+	cache := newTestCache(t)
+	putKeys(t, cache, 10, "/ws/cas/a", "ws/cas/b")
+	if exists, err := cache.Touch("ws/cas/a"); err != nil || !exists {
+		t.Fatalf("Expected ws/cas/a to exist, got %v and %v", exists, err)
+	}
+	if exists, err := cache.Touch("/ws//cas/b"); err != nil || !exists {
+		t.Fatalf("Expected /ws//cas/b to exist, got %v and %v", exists, err)
+	}
+	if usage := cache.Usage(CAS); usage != 20 {
+		t.Errorf("Expected the CAS to use 20 bytes, got %d", usage)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	restarted := NewCache(cache.DiskRoot())
+	if err := restarted.LoadIndex(0); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	// b was accessed after a, under another form of its key
+	if _, err := restarted.Touch("/ws/cas/a"); err != nil {
+		t.Fatalf("Failed to touch key: %v", err)
+	}
+	if usage := restarted.Usage(CAS); usage != 20 {
+		t.Errorf("Expected the CAS to use 20 bytes after a restart, got %d", usage)
+	}
+	entry, evicted, err := restarted.EvictOldest()
+	if err != nil || !evicted {
+		t.Fatalf("Expected an entry to be evicted, got %v and %v", evicted, err)
+	}
+	if key := restarted.PathToKey(entry.Path); key != "ws/cas/b" {
+		t.Errorf("Expected ws/cas/b to be evicted, got %s", key)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	cache := newTestCache(t)
+	cache.SetQuota(ActionCache, 25)
+
+	putKeys(t, cache, 10, "ws/ac/a", "ws/ac/b", "ws/cas/a", "ws/cas/b", "ws/cas/c")
+	err := cache.Get("ws/ac/a", func(exists bool, contents io.ReadSeeker) error {
+		if !exists {
+			t.Error("Expected ws/ac/a to exist.")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+	// the least recently accessed action cache entry is evicted, the CAS
+	// doesn't count against the quota
+	putKeys(t, cache, 10, "ws/ac/c")
+	expected := sets.NewString("ws/ac/a", "ws/ac/c", "ws/cas/a", "ws/cas/b", "ws/cas/c")
+	if keys := existingKeys(cache); !keys.Equal(expected) {
+		t.Errorf("Expected keys %v, got %v", expected.List(), keys.List())
+	}
+	if usage := cache.Usage(ActionCache); usage != 20 {
+		t.Errorf("Expected the action cache to use 20 bytes, got %d", usage)
+	}
+	if usage := cache.Usage(CAS); usage != 30 {
+		t.Errorf("Expected the CAS to use 30 bytes, got %d", usage)
+	}
+
+	// lowering the quota evicts right away
+	cache.SetQuota(CAS, 15)
+	expected = sets.NewString("ws/ac/a", "ws/ac/c", "ws/cas/c")
+	if keys := existingKeys(cache); !keys.Equal(expected) {
+		t.Errorf("Expected keys %v, got %v", expected.List(), keys.List())
+	}
+}
+
+func TestSaveAndLoadIndex(t *testing.T) {
+	cache := newTestCache(t)
+	putKeys(t, cache, 10, "ws/cas/a", "ws/cas/b", "ws/cas/c")
+	if _, err := cache.Touch("ws/cas/a"); err != nil {
+		t.Fatalf("Failed to touch key: %v", err)
+	}
+	if err := cache.SaveIndex(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	// entries that are not in the saved index are indexed as well, and
+	// leftover temp files are deleted
+	putKeys(t, cache, 10, "ws/cas/d")
+	if err := ioutil.WriteFile(cache.KeyToPath("ws/cas/"+tempPrefix+"put1"), []byte{1}, 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+
+	restarted := NewCache(cache.DiskRoot())
+	if err := restarted.LoadIndex(0); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if usage := restarted.Usage(CAS); usage != 40 {
+		t.Errorf("Expected the CAS to use 40 bytes, got %d", usage)
+	}
+	expected := sets.NewString("ws/cas/a", "ws/cas/b", "ws/cas/c", "ws/cas/d")
+	if keys := existingKeys(restarted); !keys.Equal(expected) {
+		t.Errorf("Expected keys %v, got %v", expected.List(), keys.List())
+	}
+	// the saved access order is kept, ws/cas/d has a recent atime
+	for _, expected := range []string{"ws/cas/b", "ws/cas/c", "ws/cas/a", "ws/cas/d"} {
+		entry, evicted, err := restarted.EvictOldest()
+		if err != nil || !evicted {
+			t.Fatalf("Expected an entry to be evicted, got %v and %v", evicted, err)
+		}
+		if key := restarted.PathToKey(entry.Path); key != expected {
+			t.Errorf("Expected %s to be evicted, got %s", expected, key)
+		}
+	}
+	if _, evicted, _ := restarted.EvictOldest(); evicted {
+		t.Error("Expected no entries to be left.")
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskcache
+
+import (
+	"container/heap"
+	"path"
+	"sync"
+	"time"
+)
+
+// Class is the kind of a cache entry, entries of each class are accounted
+// and evicted separately.
+type Class string
+
+const (
+	// ActionCache entries are action results, keyed by {workspace}/ac/{hash}
+	ActionCache Class = "ac"
+	// CAS entries are blobs of the content addressable storage, this is the
+	// class of all entries not in the action cache
+	CAS Class = "cas"
+)
+
+// classes are all entry classes
+var classes = []Class{ActionCache, CAS}
+
+// ClassOf returns the class of the entry at key
+func ClassOf(key string) Class {
+	if path.Base(path.Dir(key)) == string(ActionCache) {
+		return ActionCache
+	}
+	return CAS
+}
+
+// entry is an indexed cache entry
+type entry struct {
+	key        string
+	class      Class
+	size       int64
+	lastAccess time.Time
+	// position in the heap of the class
+	position int
+}
+
+// entryHeap orders entries from least to most recently accessed
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+func (h entryHeap) Less(i, j int) bool {
+	return h[i].lastAccess.Before(h[j].lastAccess)
+}
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].position = i
+	h[j].position = j
+}
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.position = len(*h)
+	*h = append(*h, e)
+}
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// index tracks the size and last access of all entries in memory, so that
+// eviction doesn't need to scan the disk or rely on file atimes
+type index struct {
+	lock    sync.Mutex
+	entries map[string]*entry
+	heaps   map[Class]*entryHeap
+	bytes   map[Class]int64
+	// quotas are the maximum bytes of the classes, zero is unlimited
+	quotas map[Class]int64
+}
+
+func newIndex() *index {
+	idx := &index{
+		entries: map[string]*entry{},
+		heaps:   map[Class]*entryHeap{},
+		bytes:   map[Class]int64{},
+		quotas:  map[Class]int64{},
+	}
+	for _, class := range classes {
+		idx.heaps[class] = &entryHeap{}
+	}
+	return idx
+}
+
+// add indexes the entry at key, if it is already indexed it is only updated
+// if replace is true
+func (idx *index) add(key string, size int64, lastAccess time.Time, replace bool) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if e, ok := idx.entries[key]; ok {
+		if !replace {
+			return
+		}
+		idx.bytes[e.class] += size - e.size
+		e.size = size
+		e.lastAccess = lastAccess
+		heap.Fix(idx.heaps[e.class], e.position)
+		idx.updateMetrics(e.class)
+		return
+	}
+	e := &entry{key: key, class: ClassOf(key), size: size, lastAccess: lastAccess}
+	idx.entries[key] = e
+	heap.Push(idx.heaps[e.class], e)
+	idx.bytes[e.class] += size
+	idx.updateMetrics(e.class)
+}
+
+// touch marks the entry at key as accessed at now, and returns false if it
+// isn't indexed
+func (idx *index) touch(key string, now time.Time) bool {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	e, ok := idx.entries[key]
+	if !ok {
+		return false
+	}
+	if now.After(e.lastAccess) {
+		e.lastAccess = now
+		heap.Fix(idx.heaps[e.class], e.position)
+	}
+	return true
+}
+
+// remove removes the entry at key from the index
+func (idx *index) remove(key string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if e, ok := idx.entries[key]; ok {
+		idx.removeEntry(e)
+	}
+}
+
+func (idx *index) removeEntry(e *entry) {
+	heap.Remove(idx.heaps[e.class], e.position)
+	delete(idx.entries, e.key)
+	idx.bytes[e.class] -= e.size
+	idx.updateMetrics(e.class)
+}
+
+func (idx *index) setQuota(class Class, quota int64) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.quotas[class] = quota
+}
+
+// popOverQuota removes and returns the least recently accessed entry of the
+// class if the class uses more than its quota, or nil if it doesn't
+func (idx *index) popOverQuota(class Class) *entry {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	h := idx.heaps[class]
+	quota := idx.quotas[class]
+	if quota <= 0 || idx.bytes[class] <= quota || h.Len() == 0 {
+		return nil
+	}
+	e := (*h)[0]
+	idx.removeEntry(e)
+	return e
+}
+
+// popOldest removes and returns the least recently accessed entry of any
+// class, or nil if the index is empty
+func (idx *index) popOldest() *entry {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	var oldest *entry
+	for _, class := range classes {
+		h := idx.heaps[class]
+		if h.Len() > 0 && (oldest == nil || (*h)[0].lastAccess.Before(oldest.lastAccess)) {
+			oldest = (*h)[0]
+		}
+	}
+	if oldest != nil {
+		idx.removeEntry(oldest)
+	}
+	return oldest
+}
+
+// usage returns the number of bytes used by entries of the class
+func (idx *index) usage(class Class) int64 {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	return idx.bytes[class]
+}
+
+// lastAccesses returns the last access of all indexed entries
+func (idx *index) lastAccesses() map[string]time.Time {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	accesses := make(map[string]time.Time, len(idx.entries))
+	for key, e := range idx.entries {
+		accesses[key] = e.lastAccess
+	}
+	return accesses
+}
+
+// updateMetrics must be called with the lock held
+func (idx *index) updateMetrics(class Class) {
+	entryBytes.WithLabelValues(string(class)).Set(float64(idx.bytes[class]))
+	entryCount.WithLabelValues(string(class)).Set(float64(idx.heaps[class].Len()))
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskcache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	entryBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bazel_cache_entry_bytes",
+		Help: "Bytes used by the indexed cache entries, by class (ac or cas).",
+	}, []string{"class"})
+	entryCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bazel_cache_entries",
+		Help: "Number of indexed cache entries, by class (ac or cas).",
+	}, []string{"class"})
+	evictedBytesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bazel_cache_evicted_bytes",
+		Help: "Bytes evicted from the cache, by class (ac or cas) and reason (quota or disk).",
+	}, []string{"class", "reason"})
+	bucketReadCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bazel_cache_bucket_reads",
+		Help: "Entries missing on disk read from the bucket, by result (hit, miss or error).",
+	}, []string{"result"})
+	bucketWriteCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bazel_cache_bucket_writes",
+		Help: "Entries written to the bucket, by result (written, skipped if already there, dropped or error).",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(entryBytes)
+	prometheus.MustRegister(entryCount)
+	prometheus.MustRegister(evictedBytesCounter)
+	prometheus.MustRegister(bucketReadCounter)
+	prometheus.MustRegister(bucketWriteCounter)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package main
 
 import (
-	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +27,9 @@ import (
 // monitorDiskAndEvict loops monitoring the disk, evicting cache entries
 // when the disk passes either minPercentBlocksFree until the disk is above
 // evictUntilPercentBlocksFree
+//
+// entries are evicted in LRU order across both the action cache and the CAS,
+// their per class quotas are enforced by the cache itself
 func monitorDiskAndEvict(
 	c *diskcache.Cache,
 	interval time.Duration,
@@ -50,21 +52,13 @@ func monitorDiskAndEvict(
 		// if we are past the threshold, start evicting
 		if blocksFree < minPercentBlocksFree {
 			logger.Warn("Eviction triggered")
-			// get all cache entries and sort by lastaccess
-			// so we can pop entries until we have evicted enough
-			files := c.GetEntries()
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].LastAccess.Before(files[j].LastAccess)
-			})
-			// evict until we pass the safe threshold so we don't thrash at the eviction trigger
+			// evict least recently accessed entries until we pass the safe
+			// threshold so we don't thrash at the eviction trigger
 			for blocksFree < evictUntilPercentBlocksFree {
-				if len(files) < 1 {
+				entry, evicted, err := c.EvictOldest()
+				if !evicted {
 					logger.Fatal("Failed to find entries to evict!")
 				}
-				// pop entry and delete
-				var entry diskcache.EntryInfo
-				entry, files = files[0], files[1:]
-				err = c.Delete(c.PathToKey(entry.Path))
 				if err != nil {
 					logger.WithError(err).Errorf("Error deleting entry at path: %v", entry.Path)
 				} else {
@@ -86,3 +80,14 @@ func monitorDiskAndEvict(
 		}
 	}
 }
+
+// saveIndex loops saving the access index of the cache, so that the LRU order
+// survives restarts
+func saveIndex(c *diskcache.Cache, interval time.Duration) {
+	logger := logrus.WithField("sync-loop", "saveIndex")
+	for range time.Tick(interval) {
+		if err := c.SaveIndex(); err != nil {
+			logger.WithError(err).Error("Failed to save index")
+		}
+	}
+}
@@ -23,15 +23,21 @@ limitations under the License.
 //
 // nursery assumes you are using SHA256
 //
+// if --grpc-port is set, the same cache is also served over the gRPC remote
+// execution API [3], with the instance name mapped to the workspace.
+//
 // [1] https://docs.bazel.build/versions/master/remote-caching.html
 // [2] https://docs.bazel.build/versions/master/remote-caching.html#http-caching-protocol
+// [3] https://github.com/bazelbuild/remote-apis
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -39,15 +45,22 @@ import (
 
 	"k8s.io/test-infra/greenhouse/diskcache"
 	"k8s.io/test-infra/greenhouse/diskutil"
+	"k8s.io/test-infra/greenhouse/reapi"
+	"k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/logrusutil"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 var dir = flag.String("dir", "", "location to store cache entries on disk")
 var host = flag.String("host", "", "host address to listen on")
 var cachePort = flag.Int("cache-port", 8080, "port to listen on for cache requests")
+var grpcPort = flag.Int("grpc-port", 0, "port to listen on for gRPC remote execution API cache requests, disabled if 0")
+var validateActionResults = flag.Bool("validate-action-results", true,
+	"only serve gRPC action results whose outputs are all in the cache")
 var metricsPort = flag.Int("metrics-port", 9090, "port to listen on for prometheus metrics scraping")
 var metricsUpdateInterval = flag.Duration("metrics-update-interval", time.Second*10,
 	"interval between updating disk metrics")
@@ -59,6 +72,21 @@ var evictUntilPercentBlocksFree = flag.Float64("evict-until-percent-blocks-free"
 	"continue evicting from the cache until at least this percent of blocks are free")
 var diskCheckInterval = flag.Duration("disk-check-interval", time.Second*10,
 	"interval between checking disk usage (and potentially evicting entries)")
+var actionCacheQuota = flag.Int64("ac-quota-bytes", 0,
+	"maximum bytes of action cache entries before evicting the least recently used ones, unlimited if 0")
+var casQuota = flag.Int64("cas-quota-bytes", 0,
+	"maximum bytes of CAS entries before evicting the least recently used ones, unlimited if 0")
+var indexSaveInterval = flag.Duration("index-save-interval", time.Minute,
+	"interval between saving the access times of entries to disk")
+
+// shared bucket knobs
+var bucketPath = flag.String("bucket", "",
+	"optional bucket shared by replicas (e.g. gs://bucket/greenhouse) that local misses fall through to and entries are written to")
+var bucketWriteMode = flag.String("bucket-write-mode", string(diskcache.WriteThrough),
+	"how entries are written to --bucket: 'through' before responding, or 'back' asynchronously")
+var bucketWriteWorkers = flag.Int("bucket-write-workers", 10,
+	"number of goroutines writing entries back to --bucket with --bucket-write-mode=back")
+var storage flagutil.StorageClientOptions
 
 // global metrics object, see prometheus.go
 var promMetrics *prometheusMetrics
@@ -68,6 +96,7 @@ func init() {
 
 	logrus.SetOutput(os.Stdout)
 	promMetrics = initMetrics()
+	storage.AddFlags(flag.CommandLine)
 }
 
 func main() {
@@ -77,10 +106,33 @@ func main() {
 	}
 
 	cache := diskcache.NewCache(*dir)
-	go monitorDiskAndEvict(
-		cache, *diskCheckInterval,
-		*minPercentBlocksFree, *evictUntilPercentBlocksFree,
-	)
+	cache.SetQuota(diskcache.ActionCache, *actionCacheQuota)
+	cache.SetQuota(diskcache.CAS, *casQuota)
+	if *bucketPath != "" {
+		opener, err := storage.StorageClient(context.Background())
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to create storage client.")
+		}
+		bucket, err := diskcache.NewBucket(opener, *bucketPath, diskcache.WriteMode(*bucketWriteMode), *bucketWriteWorkers)
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid bucket configuration.")
+		}
+		cache.SetBucket(bucket)
+		// write the queued entries back before exiting
+		interrupts.OnInterrupt(bucket.Flush)
+	}
+	// index the entries on disk while already serving requests, eviction
+	// only starts once all of them are known
+	go func() {
+		if err := cache.LoadIndex(time.Hour); err != nil {
+			logrus.WithError(err).Fatal("Failed to load index.")
+		}
+		go saveIndex(cache, *indexSaveInterval)
+		monitorDiskAndEvict(
+			cache, *diskCheckInterval,
+			*minPercentBlocksFree, *evictUntilPercentBlocksFree,
+		)
+	}()
 
 	go updateMetrics(*metricsUpdateInterval, cache.DiskRoot())
 
@@ -95,14 +147,40 @@ func main() {
 		).Fatal("ListenAndServe returned.")
 	}()
 
+	// listen for gRPC cache requests
+	if *grpcPort != 0 {
+		grpcAddr := fmt.Sprintf("%s:%d", *host, *grpcPort)
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to listen for gRPC requests.")
+		}
+		// leave some room for the rest of the batch requests
+		grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(reapi.MaxBatchTotalSizeBytes + 1024*1024))
+		reapi.NewServer(cache, reapi.Metrics{
+			ActionCacheHits:   promMetrics.ActionCacheHits,
+			ActionCacheMisses: promMetrics.ActionCacheMisses,
+			CASHits:           promMetrics.CASHits,
+			CASMisses:         promMetrics.CASMisses,
+		}, *validateActionResults).Register(grpcServer)
+		go func() {
+			logrus.Infof("gRPC Cache Listening on: %s", grpcAddr)
+			logrus.WithField("mux", "grpc").WithError(
+				grpcServer.Serve(listener),
+			).Fatal("Serve returned.")
+		}()
+	}
+
 	// listen for cache requests
 	cacheMux := http.NewServeMux()
 	cacheMux.Handle("/", cacheHandler(cache))
 	cacheAddr := fmt.Sprintf("%s:%d", *host, *cachePort)
-	logrus.Infof("Cache Listening on: %s", cacheAddr)
-	logrus.WithField("mux", "cache").WithError(
-		http.ListenAndServe(cacheAddr, cacheMux),
-	).Fatal("ListenAndServe returned.")
+	go func() {
+		logrus.Infof("Cache Listening on: %s", cacheAddr)
+		logrus.WithField("mux", "cache").WithError(
+			http.ListenAndServe(cacheAddr, cacheMux),
+		).Fatal("ListenAndServe returned.")
+	}()
+	interrupts.WaitForGracefulShutdown()
 }
 
 // file not found error, used below
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetActionResult implements repb.ActionCacheServer.
+func (s *Server) GetActionResult(ctx context.Context, req *repb.GetActionResultRequest) (*repb.ActionResult, error) {
+	if err := validateInstanceName(req.InstanceName); err != nil {
+		return nil, err
+	}
+	if err := validateDigest(req.ActionDigest); err != nil {
+		return nil, err
+	}
+	log := logrus.WithField("action", req.ActionDigest.Hash)
+
+	result := &repb.ActionResult{}
+	found := true
+	err := s.cache.Get(acKey(req.InstanceName, req.ActionDigest), func(exists bool, contents io.ReadSeeker) error {
+		if !exists {
+			found = false
+			return nil
+		}
+		data, err := ioutil.ReadAll(contents)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, result)
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to read action result.")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if found && s.validateActionResults {
+		missing, err := s.missingOutput(req.InstanceName, result)
+		if err != nil {
+			log.WithError(err).Error("Failed to validate action result.")
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if missing != "" {
+			log.WithField("output", missing).Debug("Ignoring action result with missing output.")
+			found = false
+		}
+	}
+	if !found {
+		s.metrics.ActionCacheMisses.Inc()
+		return nil, status.Errorf(codes.NotFound, "action result %s/%d not found", req.ActionDigest.Hash, req.ActionDigest.SizeBytes)
+	}
+	s.metrics.ActionCacheHits.Inc()
+	return result, nil
+}
+
+// missingOutput returns the name of an output of the action result that is
+// not in the CAS, or an empty string if all of them are.
+func (s *Server) missingOutput(instanceName string, result *repb.ActionResult) (string, error) {
+	outputs := map[string]*repb.Digest{}
+	for _, file := range result.OutputFiles {
+		outputs[file.Path] = file.Digest
+	}
+	if result.StdoutDigest != nil {
+		outputs["stdout"] = result.StdoutDigest
+	}
+	if result.StderrDigest != nil {
+		outputs["stderr"] = result.StderrDigest
+	}
+	for _, dir := range result.OutputDirectories {
+		outputs[dir.Path] = dir.TreeDigest
+		// The files of the directories must be present as well.
+		data, err := s.readBlob(instanceName, dir.TreeDigest)
+		if err == errNotFound {
+			return dir.Path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		tree := &repb.Tree{}
+		if err := proto.Unmarshal(data, tree); err != nil {
+			return "", fmt.Errorf("failed to parse tree of %s: %v", dir.Path, err)
+		}
+		for i, directory := range append([]*repb.Directory{tree.Root}, tree.Children...) {
+			for _, file := range directory.GetFiles() {
+				outputs[fmt.Sprintf("%s/%d/%s", dir.Path, i, file.Name)] = file.Digest
+			}
+		}
+	}
+	for name, digest := range outputs {
+		if err := validateDigest(digest); err != nil {
+			return name, nil
+		}
+		found, err := s.hasBlob(instanceName, digest)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// UpdateActionResult implements repb.ActionCacheServer.
+func (s *Server) UpdateActionResult(ctx context.Context, req *repb.UpdateActionResultRequest) (*repb.ActionResult, error) {
+	if err := validateInstanceName(req.InstanceName); err != nil {
+		return nil, err
+	}
+	if err := validateDigest(req.ActionDigest); err != nil {
+		return nil, err
+	}
+	if req.ActionResult == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing action result")
+	}
+	data, err := proto.Marshal(req.ActionResult)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// Like for the HTTP cache, action results aren't hashed.
+	if err := s.cache.Put(acKey(req.InstanceName, req.ActionDigest), bytes.NewReader(data), ""); err != nil {
+		logrus.WithError(err).WithField("action", req.ActionDigest.Hash).Error("Failed to store action result.")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return req.ActionResult, nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readChunkSize is the size of the chunks blobs are streamed in.
+const readChunkSize = 1024 * 1024
+
+// parseResourceName parses the instance name and digest of the ByteStream
+// resource names of blobs, "{instance_name}/blobs/{hash}/{size}" for reads
+// and "{instance_name}/uploads/{uuid}/blobs/{hash}/{size}" for writes. Any
+// trailing segments are ignored.
+func parseResourceName(name string, upload bool) (string, *repb.Digest, error) {
+	parts := strings.Split(name, "/")
+	invalid := status.Errorf(codes.InvalidArgument, "invalid resource name %q", name)
+	blobs := -1
+	for i, part := range parts {
+		if upload && part == "uploads" && i+2 < len(parts) && parts[i+2] == "blobs" {
+			blobs = i + 2
+			break
+		}
+		if !upload && part == "blobs" {
+			blobs = i
+			break
+		}
+	}
+	if blobs < 0 || blobs+2 >= len(parts) {
+		return "", nil, invalid
+	}
+	instanceEnd := blobs
+	if upload {
+		instanceEnd = blobs - 2
+	}
+	instanceName := strings.Join(parts[:instanceEnd], "/")
+	if err := validateInstanceName(instanceName); err != nil {
+		return "", nil, err
+	}
+	size, err := strconv.ParseInt(parts[blobs+2], 10, 64)
+	if err != nil {
+		return "", nil, invalid
+	}
+	digest := &repb.Digest{Hash: parts[blobs+1], SizeBytes: size}
+	if err := validateDigest(digest); err != nil {
+		return "", nil, err
+	}
+	return instanceName, digest, nil
+}
+
+// Read implements bytestream.ByteStreamServer.
+func (s *Server) Read(req *bytestream.ReadRequest, stream bytestream.ByteStream_ReadServer) error {
+	instanceName, digest, err := parseResourceName(req.ResourceName, false)
+	if err != nil {
+		return err
+	}
+	if req.ReadOffset < 0 || req.ReadOffset > digest.SizeBytes {
+		return status.Errorf(codes.OutOfRange, "read offset %d is out of range for blob of %d bytes", req.ReadOffset, digest.SizeBytes)
+	}
+	if req.ReadLimit < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid read limit %d", req.ReadLimit)
+	}
+	if digest.SizeBytes == 0 && digest.Hash == emptySHA256 {
+		s.metrics.CASHits.Inc()
+		return nil
+	}
+
+	err = s.cache.Get(casKey(instanceName, digest), func(exists bool, contents io.ReadSeeker) error {
+		if !exists {
+			return errNotFound
+		}
+		if _, err := contents.Seek(req.ReadOffset, io.SeekStart); err != nil {
+			return err
+		}
+		var reader io.Reader = contents
+		if req.ReadLimit > 0 {
+			reader = io.LimitReader(contents, req.ReadLimit)
+		}
+		buf := make([]byte, readChunkSize)
+		for {
+			n, err := io.ReadFull(reader, buf)
+			if n > 0 {
+				if sendErr := stream.Send(&bytestream.ReadResponse{Data: buf[:n]}); sendErr != nil {
+					return sendErr
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err == errNotFound {
+		s.metrics.CASMisses.Inc()
+		return status.Errorf(codes.NotFound, "blob %s/%d not found", digest.Hash, digest.SizeBytes)
+	}
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		logrus.WithError(err).WithField("hash", digest.Hash).Error("Failed to read blob.")
+		return status.Error(codes.Internal, err.Error())
+	}
+	s.metrics.CASHits.Inc()
+	return nil
+}
+
+// Write implements bytestream.ByteStreamServer. Writes can't be resumed, a
+// failed write must be retried from the start.
+func (s *Server) Write(stream bytestream.ByteStream_WriteServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	instanceName, digest, err := parseResourceName(req.ResourceName, true)
+	if err != nil {
+		return err
+	}
+	log := logrus.WithField("hash", digest.Hash)
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.cache.Put(casKey(instanceName, digest), reader, digest.Hash)
+		// Unblock the writer if the blob couldn't be stored.
+		reader.CloseWithError(err)
+		done <- err
+	}()
+
+	var written int64
+	for {
+		if req.WriteOffset != written {
+			err = status.Errorf(codes.InvalidArgument, "write offset %d doesn't match the %d bytes written", req.WriteOffset, written)
+			break
+		}
+		if _, err = writer.Write(req.Data); err != nil {
+			break
+		}
+		written += int64(len(req.Data))
+		if written > digest.SizeBytes {
+			err = status.Errorf(codes.InvalidArgument, "blob is larger than %d bytes", digest.SizeBytes)
+			break
+		}
+		if req.FinishWrite {
+			if written != digest.SizeBytes {
+				err = status.Errorf(codes.InvalidArgument, "blob has %d bytes, expected %d", written, digest.SizeBytes)
+			}
+			break
+		}
+		if req, err = stream.Recv(); err != nil {
+			if err == io.EOF {
+				err = status.Error(codes.InvalidArgument, "stream ended before the write was finished")
+			}
+			break
+		}
+	}
+	if err != nil {
+		writer.CloseWithError(err)
+		<-done
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.Internal, err.Error())
+		}
+		return err
+	}
+	writer.Close()
+	if err := <-done; err != nil {
+		log.WithError(err).Warn("Failed to store blob.")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return stream.SendAndClose(&bytestream.WriteResponse{CommittedSize: written})
+}
+
+// QueryWriteStatus implements bytestream.ByteStreamServer. As writes can't be
+// resumed, a blob is either complete or not written at all.
+func (s *Server) QueryWriteStatus(ctx context.Context, req *bytestream.QueryWriteStatusRequest) (*bytestream.QueryWriteStatusResponse, error) {
+	instanceName, digest, err := parseResourceName(req.ResourceName, true)
+	if err != nil {
+		return nil, err
+	}
+	found, err := s.hasBlob(instanceName, digest)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to look up blob: %v", err))
+	}
+	if !found {
+		return &bytestream.QueryWriteStatusResponse{}, nil
+	}
+	return &bytestream.QueryWriteStatusResponse{CommittedSize: digest.SizeBytes, Complete: true}, nil
+}
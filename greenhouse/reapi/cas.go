@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNotFound is returned by readBlob for missing blobs.
+var errNotFound = errors.New("blob not found")
+
+// hasBlob returns true if the blob is in the CAS, and marks it as accessed so
+// that it isn't evicted before the client uses it.
+func (s *Server) hasBlob(instanceName string, digest *repb.Digest) (bool, error) {
+	if digest.SizeBytes == 0 && digest.Hash == emptySHA256 {
+		return true, nil
+	}
+	return s.cache.Touch(casKey(instanceName, digest))
+}
+
+// readBlob returns the contents of a blob, or errNotFound.
+func (s *Server) readBlob(instanceName string, digest *repb.Digest) ([]byte, error) {
+	if digest.SizeBytes == 0 && digest.Hash == emptySHA256 {
+		return []byte{}, nil
+	}
+	var data []byte
+	err := s.cache.Get(casKey(instanceName, digest), func(exists bool, contents io.ReadSeeker) error {
+		if !exists {
+			return errNotFound
+		}
+		var err error
+		data, err = ioutil.ReadAll(contents)
+		return err
+	})
+	return data, err
+}
+
+// FindMissingBlobs implements repb.ContentAddressableStorageServer.
+func (s *Server) FindMissingBlobs(ctx context.Context, req *repb.FindMissingBlobsRequest) (*repb.FindMissingBlobsResponse, error) {
+	if err := validateInstanceName(req.InstanceName); err != nil {
+		return nil, err
+	}
+	resp := &repb.FindMissingBlobsResponse{}
+	for _, digest := range req.BlobDigests {
+		if err := validateDigest(digest); err != nil {
+			return nil, err
+		}
+		found, err := s.hasBlob(req.InstanceName, digest)
+		if err != nil {
+			logrus.WithError(err).WithField("hash", digest.Hash).Error("Failed to look up blob.")
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if !found {
+			resp.MissingBlobDigests = append(resp.MissingBlobDigests, digest)
+		}
+	}
+	return resp, nil
+}
+
+// BatchUpdateBlobs implements repb.ContentAddressableStorageServer.
+func (s *Server) BatchUpdateBlobs(ctx context.Context, req *repb.BatchUpdateBlobsRequest) (*repb.BatchUpdateBlobsResponse, error) {
+	if err := validateInstanceName(req.InstanceName); err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, r := range req.Requests {
+		total += int64(len(r.Data))
+	}
+	if total > MaxBatchTotalSizeBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "total size of the blobs %d exceeds the limit of %d bytes", total, MaxBatchTotalSizeBytes)
+	}
+
+	resp := &repb.BatchUpdateBlobsResponse{}
+	for _, r := range req.Requests {
+		err := validateDigest(r.Digest)
+		if err == nil && int64(len(r.Data)) != r.Digest.SizeBytes {
+			err = status.Errorf(codes.InvalidArgument, "blob has %d bytes, expected %d", len(r.Data), r.Digest.SizeBytes)
+		}
+		if err == nil {
+			if sum := sha256.Sum256(r.Data); hex.EncodeToString(sum[:]) != r.Digest.Hash {
+				err = status.Errorf(codes.InvalidArgument, "blob has hash %x, expected %s", sum, r.Digest.Hash)
+			}
+		}
+		// The blob is verified, failing to store it is the server's fault.
+		if err == nil {
+			if putErr := s.cache.Put(casKey(req.InstanceName, r.Digest), bytes.NewReader(r.Data), ""); putErr != nil {
+				logrus.WithError(putErr).WithField("hash", r.Digest.Hash).Warn("Failed to store blob.")
+				err = status.Error(codes.Internal, putErr.Error())
+			}
+		}
+		resp.Responses = append(resp.Responses, &repb.BatchUpdateBlobsResponse_Response{
+			Digest: r.Digest,
+			Status: status.Convert(err).Proto(),
+		})
+	}
+	return resp, nil
+}
+
+// BatchReadBlobs implements repb.ContentAddressableStorageServer.
+func (s *Server) BatchReadBlobs(ctx context.Context, req *repb.BatchReadBlobsRequest) (*repb.BatchReadBlobsResponse, error) {
+	if err := validateInstanceName(req.InstanceName); err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, digest := range req.Digests {
+		if err := validateDigest(digest); err != nil {
+			return nil, err
+		}
+		total += digest.SizeBytes
+	}
+	if total > MaxBatchTotalSizeBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "total size of the blobs %d exceeds the limit of %d bytes", total, MaxBatchTotalSizeBytes)
+	}
+
+	resp := &repb.BatchReadBlobsResponse{}
+	for _, digest := range req.Digests {
+		data, err := s.readBlob(req.InstanceName, digest)
+		switch {
+		case err == errNotFound:
+			s.metrics.CASMisses.Inc()
+			err = status.Errorf(codes.NotFound, "blob %s/%d not found", digest.Hash, digest.SizeBytes)
+		case err != nil:
+			logrus.WithError(err).WithField("hash", digest.Hash).Error("Failed to read blob.")
+			err = status.Error(codes.Internal, err.Error())
+		default:
+			s.metrics.CASHits.Inc()
+		}
+		resp.Responses = append(resp.Responses, &repb.BatchReadBlobsResponse_Response{
+			Digest: digest,
+			Data:   data,
+			Status: status.Convert(err).Proto(),
+		})
+	}
+	return resp, nil
+}
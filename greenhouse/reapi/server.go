@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reapi implements the cache services of the Bazel Remote Execution
+// API [1] over gRPC, storing entries in the same diskcache.Cache and at the
+// same keys as greenhouse's HTTP cache, so both protocols share a cache.
+//
+// The instance name of requests maps to the workspace, the first path segment
+// of HTTP requests. Only SHA256 digests are supported.
+//
+// [1] https://github.com/bazelbuild/remote-apis
+package reapi
+
+import (
+	"context"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/bazelbuild/remote-apis/build/bazel/semver"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/test-infra/greenhouse/diskcache"
+)
+
+// MaxBatchTotalSizeBytes is the largest total size of the blobs in batch
+// requests, larger blobs must use the ByteStream API. The gRPC server must
+// accept messages somewhat larger than this.
+const MaxBatchTotalSizeBytes = 4 * 1024 * 1024
+
+// emptySHA256 is the hash of the empty blob, which clients don't upload and
+// is always present.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Metrics are the counters of cache hits and misses, shared with the HTTP
+// cache.
+type Metrics struct {
+	ActionCacheHits   prometheus.Counter
+	ActionCacheMisses prometheus.Counter
+	CASHits           prometheus.Counter
+	CASMisses         prometheus.Counter
+}
+
+// Server implements the Capabilities, ContentAddressableStorage, ActionCache
+// and ByteStream services.
+type Server struct {
+	// GetTree is not supported.
+	repb.UnimplementedContentAddressableStorageServer
+
+	cache   *diskcache.Cache
+	metrics Metrics
+	// validateActionResults makes action results whose outputs are missing
+	// from the CAS cache misses.
+	validateActionResults bool
+}
+
+// NewServer returns a Server for the cache. If validateActionResults is
+// true, action results are only returned if all of their outputs are in the
+// CAS, so clients don't fail to download them later.
+func NewServer(cache *diskcache.Cache, metrics Metrics, validateActionResults bool) *Server {
+	return &Server{
+		cache:                 cache,
+		metrics:               metrics,
+		validateActionResults: validateActionResults,
+	}
+}
+
+// Register registers the services of the server with the gRPC server.
+func (s *Server) Register(g *grpc.Server) {
+	repb.RegisterCapabilitiesServer(g, s)
+	repb.RegisterContentAddressableStorageServer(g, s)
+	repb.RegisterActionCacheServer(g, s)
+	bytestream.RegisterByteStreamServer(g, s)
+}
+
+// GetCapabilities implements repb.CapabilitiesServer.
+func (s *Server) GetCapabilities(ctx context.Context, req *repb.GetCapabilitiesRequest) (*repb.ServerCapabilities, error) {
+	return &repb.ServerCapabilities{
+		CacheCapabilities: &repb.CacheCapabilities{
+			DigestFunction: []repb.DigestFunction_Value{repb.DigestFunction_SHA256},
+			ActionCacheUpdateCapabilities: &repb.ActionCacheUpdateCapabilities{
+				UpdateEnabled: true,
+			},
+			MaxBatchTotalSizeBytes:      MaxBatchTotalSizeBytes,
+			SymlinkAbsolutePathStrategy: repb.SymlinkAbsolutePathStrategy_ALLOWED,
+		},
+		LowApiVersion:  &semver.SemVer{Major: 2},
+		HighApiVersion: &semver.SemVer{Major: 2},
+	}, nil
+}
+
+// validateInstanceName makes sure the instance name can't escape the cache
+// directory and can be told apart in ByteStream resource names.
+func validateInstanceName(instanceName string) error {
+	if instanceName == "" {
+		return nil
+	}
+	for _, segment := range strings.Split(instanceName, "/") {
+		switch segment {
+		case "", ".", "..", "blobs", "uploads":
+			return status.Errorf(codes.InvalidArgument, "invalid instance name %q", instanceName)
+		}
+	}
+	return nil
+}
+
+// validateDigest makes sure the digest is a SHA256 digest.
+func validateDigest(digest *repb.Digest) error {
+	if digest == nil {
+		return status.Error(codes.InvalidArgument, "missing digest")
+	}
+	if len(digest.Hash) != 64 || strings.ToLower(digest.Hash) != digest.Hash {
+		return status.Errorf(codes.InvalidArgument, "invalid SHA256 hash %q", digest.Hash)
+	}
+	if _, err := hex.DecodeString(digest.Hash); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid SHA256 hash %q", digest.Hash)
+	}
+	if digest.SizeBytes < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid size %d", digest.SizeBytes)
+	}
+	return nil
+}
+
+// casKey returns the cache key of a blob, the path of the HTTP cache.
+func casKey(instanceName string, digest *repb.Digest) string {
+	return path.Join(instanceName, "cas", digest.Hash)
+}
+
+// acKey returns the cache key of an action result, the path of the HTTP
+// cache.
+func acKey(instanceName string, digest *repb.Digest) string {
+	return path.Join(instanceName, "ac", digest.Hash)
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"k8s.io/test-infra/greenhouse/diskcache"
+)
+
+func digestOf(data []byte) *repb.Digest {
+	sum := sha256.Sum256(data)
+	return &repb.Digest{Hash: hex.EncodeToString(sum[:]), SizeBytes: int64(len(data))}
+}
+
+func newCounter(name string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: name})
+}
+
+// startServer serves a cache in a temporary directory and returns a client
+// connection to it.
+func startServer(t *testing.T, validateActionResults bool) (*grpc.ClientConn, *diskcache.Cache) {
+	dir, err := ioutil.TempDir("", "reapi")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cache := diskcache.NewCache(dir)
+	metrics := Metrics{
+		ActionCacheHits:   newCounter("ac_hits"),
+		ActionCacheMisses: newCounter("ac_misses"),
+		CASHits:           newCounter("cas_hits"),
+		CASMisses:         newCounter("cas_misses"),
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	NewServer(cache, metrics, validateActionResults).Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("Failed to dial server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, cache
+}
+
+func TestCapabilities(t *testing.T) {
+	conn, _ := startServer(t, false)
+	capabilities, err := repb.NewCapabilitiesClient(conn).GetCapabilities(context.Background(), &repb.GetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("Failed to get capabilities: %v", err)
+	}
+	functions := capabilities.CacheCapabilities.DigestFunction
+	if len(functions) != 1 || functions[0] != repb.DigestFunction_SHA256 {
+		t.Errorf("Expected only SHA256 digests to be supported, got %v", functions)
+	}
+	if !capabilities.CacheCapabilities.ActionCacheUpdateCapabilities.UpdateEnabled {
+		t.Error("Expected action cache updates to be enabled.")
+	}
+}
+
+func TestCAS(t *testing.T) {
+	conn, cache := startServer(t, false)
+	cas := repb.NewContentAddressableStorageClient(conn)
+	ctx := context.Background()
+	foo, bar := []byte("foo"), []byte("bar")
+
+	missing, err := cas.FindMissingBlobs(ctx, &repb.FindMissingBlobsRequest{
+		InstanceName: "workspace",
+		BlobDigests:  []*repb.Digest{digestOf(foo), digestOf(nil)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to find missing blobs: %v", err)
+	}
+	if len(missing.MissingBlobDigests) != 1 || !proto.Equal(missing.MissingBlobDigests[0], digestOf(foo)) {
+		t.Errorf("Expected only the non-empty blob to be missing, got %v", missing.MissingBlobDigests)
+	}
+
+	update, err := cas.BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{
+		InstanceName: "workspace",
+		Requests: []*repb.BatchUpdateBlobsRequest_Request{
+			{Digest: digestOf(foo), Data: foo},
+			{Digest: digestOf(bar), Data: foo},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update blobs: %v", err)
+	}
+	if code := codes.Code(update.Responses[0].Status.GetCode()); code != codes.OK {
+		t.Errorf("Expected the valid blob to be stored, got %v", code)
+	}
+	if code := codes.Code(update.Responses[1].Status.GetCode()); code != codes.InvalidArgument {
+		t.Errorf("Expected the blob not matching its digest to be rejected, got %v", code)
+	}
+
+	// The blob is shared with the HTTP cache.
+	if err := cache.Get("/workspace/cas/"+digestOf(foo).Hash, func(exists bool, contents io.ReadSeeker) error {
+		if !exists {
+			return fmt.Errorf("blob not found")
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("Expected the blob to be at the key of the HTTP cache: %v", err)
+	}
+
+	read, err := cas.BatchReadBlobs(ctx, &repb.BatchReadBlobsRequest{
+		InstanceName: "workspace",
+		Digests:      []*repb.Digest{digestOf(foo), digestOf(bar)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to read blobs: %v", err)
+	}
+	if code := codes.Code(read.Responses[0].Status.GetCode()); code != codes.OK || !bytes.Equal(read.Responses[0].Data, foo) {
+		t.Errorf("Expected to read the stored blob, got %v with %q", code, read.Responses[0].Data)
+	}
+	if code := codes.Code(read.Responses[1].Status.GetCode()); code != codes.NotFound {
+		t.Errorf("Expected the missing blob not to be found, got %v", code)
+	}
+
+	if _, err := cas.FindMissingBlobs(ctx, &repb.FindMissingBlobsRequest{
+		InstanceName: "../escape",
+		BlobDigests:  []*repb.Digest{digestOf(foo)},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected an invalid instance name to be rejected, got %v", err)
+	}
+}
+
+func TestCASStorageFailure(t *testing.T) {
+	conn, cache := startServer(t, false)
+	cas := repb.NewContentAddressableStorageClient(conn)
+	foo := []byte("foo")
+
+	// Nothing can be stored once the cache directory is a file
+	if err := os.RemoveAll(cache.DiskRoot()); err != nil {
+		t.Fatalf("Failed to remove cache dir: %v", err)
+	}
+	if err := ioutil.WriteFile(cache.DiskRoot(), nil, 0644); err != nil {
+		t.Fatalf("Failed to replace cache dir: %v", err)
+	}
+	update, err := cas.BatchUpdateBlobs(context.Background(), &repb.BatchUpdateBlobsRequest{
+		InstanceName: "workspace",
+		Requests:     []*repb.BatchUpdateBlobsRequest_Request{{Digest: digestOf(foo), Data: foo}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update blobs: %v", err)
+	}
+	if code := codes.Code(update.Responses[0].Status.GetCode()); code != codes.Internal {
+		t.Errorf("Expected failing to store a valid blob to be an internal error, got %v", code)
+	}
+}
+
+func TestByteStream(t *testing.T) {
+	conn, _ := startServer(t, false)
+	client := bytestream.NewByteStreamClient(conn)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789"), 300000)
+	digest := digestOf(data)
+	resource := fmt.Sprintf("workspace/uploads/some-uuid/blobs/%s/%d", digest.Hash, digest.SizeBytes)
+
+	write := func(chunks [][]byte) error {
+		stream, err := client.Write(ctx)
+		if err != nil {
+			return err
+		}
+		var offset int64
+		for i, chunk := range chunks {
+			req := &bytestream.WriteRequest{WriteOffset: offset, Data: chunk, FinishWrite: i == len(chunks)-1}
+			if i == 0 {
+				req.ResourceName = resource
+			}
+			if err := stream.Send(req); err != nil {
+				break
+			}
+			offset += int64(len(chunk))
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	if err := write([][]byte{data[:1000], data[1000:2000]}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected an incomplete blob to be rejected, got %v", err)
+	}
+	writeStatus, err := client.QueryWriteStatus(ctx, &bytestream.QueryWriteStatusRequest{ResourceName: resource})
+	if err != nil || writeStatus.Complete {
+		t.Errorf("Expected the rejected blob not to be written, got %v and %v", writeStatus, err)
+	}
+	if err := write([][]byte{data[:1000], data[1000:]}); err != nil {
+		t.Fatalf("Failed to write blob: %v", err)
+	}
+	writeStatus, err = client.QueryWriteStatus(ctx, &bytestream.QueryWriteStatusRequest{ResourceName: resource})
+	if err != nil || !writeStatus.Complete || writeStatus.CommittedSize != digest.SizeBytes {
+		t.Errorf("Expected the blob to be written, got %v and %v", writeStatus, err)
+	}
+
+	read := func(name string, offset, limit int64) ([]byte, error) {
+		stream, err := client.Read(ctx, &bytestream.ReadRequest{ResourceName: name, ReadOffset: offset, ReadLimit: limit})
+		if err != nil {
+			return nil, err
+		}
+		var got []byte
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return got, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			got = append(got, resp.Data...)
+		}
+	}
+	name := fmt.Sprintf("workspace/blobs/%s/%d", digest.Hash, digest.SizeBytes)
+	if got, err := read(name, 0, 0); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected to read the blob, got %d bytes and %v", len(got), err)
+	}
+	if got, err := read(name, 10, 5); err != nil || string(got) != "01234" {
+		t.Errorf("Expected to read part of the blob, got %q and %v", got, err)
+	}
+	missing := digestOf([]byte("missing"))
+	if _, err := read(fmt.Sprintf("workspace/blobs/%s/%d", missing.Hash, missing.SizeBytes), 0, 0); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected a missing blob not to be found, got %v", err)
+	}
+}
+
+func TestActionCache(t *testing.T) {
+	output, stdout := []byte("output"), []byte("stdout")
+	result := &repb.ActionResult{
+		OutputFiles:  []*repb.OutputFile{{Path: "out", Digest: digestOf(output)}},
+		StdoutDigest: digestOf(stdout),
+		ExitCode:     0,
+	}
+	action := digestOf([]byte("action"))
+
+	testCases := []struct {
+		name         string
+		validate     bool
+		blobs        [][]byte
+		expectedCode codes.Code
+	}{
+		{
+			name:         "outputs present",
+			validate:     true,
+			blobs:        [][]byte{output, stdout},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "output missing",
+			validate:     true,
+			blobs:        [][]byte{stdout},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "output missing without validation",
+			blobs:        [][]byte{stdout},
+			expectedCode: codes.OK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, _ := startServer(t, tc.validate)
+			ac := repb.NewActionCacheClient(conn)
+			cas := repb.NewContentAddressableStorageClient(conn)
+			ctx := context.Background()
+
+			if _, err := ac.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: action}); status.Code(err) != codes.NotFound {
+				t.Errorf("Expected no action result before the update, got %v", err)
+			}
+			if _, err := ac.UpdateActionResult(ctx, &repb.UpdateActionResultRequest{ActionDigest: action, ActionResult: result}); err != nil {
+				t.Fatalf("Failed to update action result: %v", err)
+			}
+			req := &repb.BatchUpdateBlobsRequest{}
+			for _, blob := range tc.blobs {
+				req.Requests = append(req.Requests, &repb.BatchUpdateBlobsRequest_Request{Digest: digestOf(blob), Data: blob})
+			}
+			if _, err := cas.BatchUpdateBlobs(ctx, req); err != nil {
+				t.Fatalf("Failed to update blobs: %v", err)
+			}
+
+			got, err := ac.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: action})
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if err == nil && !proto.Equal(got, result) {
+				t.Errorf("Expected action result %v, got %v", result, got)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"flag"
@@ -77,7 +78,9 @@ type Label struct {
 	Previously []Label `json:"previously,omitempty"`
 	// DeleteAfter specifies the label is retired and a safe date for deletion
 	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
-	parent      *Label     // Current name for previous labels (used internally)
+	// Protected labels cannot be changed by the labels file of a repo
+	Protected bool   `json:"protected,omitempty"`
+	parent    *Label // Current name for previous labels (used internally)
 }
 
 // Configuration is a list of Repos defining Required Labels to sync into them
@@ -126,6 +129,8 @@ type options struct {
 	cssOutput       string
 	docsTemplate    string
 	docsOutput      string
+	repoLabelsPath  string
+	reportOutput    string
 	tokens          int
 	tokenBurst      int
 }
@@ -143,11 +148,13 @@ func gatherOptions() options {
 	fs.StringVar(&o.orgs, "orgs", "", "Comma separated list of orgs to sync")
 	fs.StringVar(&o.skipRepos, "skip", "", "Comma separated list of org/repos to skip syncing")
 	fs.StringVar(&o.token, "token", "", "Path to github oauth secret")
-	fs.StringVar(&o.action, "action", "sync", "One of: sync, docs")
+	fs.StringVar(&o.action, "action", "sync", "One of: sync, docs, css, report")
 	fs.StringVar(&o.cssTemplate, "css-template", "", "Path to template file for label css")
 	fs.StringVar(&o.cssOutput, "css-output", "", "Path to output file for css")
 	fs.StringVar(&o.docsTemplate, "docs-template", "", "Path to template file for label docs")
 	fs.StringVar(&o.docsOutput, "docs-output", "", "Path to output file for docs")
+	fs.StringVar(&o.repoLabelsPath, "repo-labels-path", "", "Path of the file in each repo declaring extra labels for it, e.g. .github/labels.yaml (unset to ignore)")
+	fs.StringVar(&o.reportOutput, "report-output", "", "Path to output file for the label usage report (stdout if unset)")
 	fs.IntVar(&o.tokens, "tokens", defaultTokens, "Throttle hourly token consumption (0 to disable)")
 	fs.IntVar(&o.tokenBurst, "token-burst", defaultBurst, "Allow consuming a subset of hourly tokens in a short burst")
 	fs.Parse(os.Args[1:])
@@ -667,6 +674,8 @@ type client interface {
 	FindIssues(query, order string, ascending bool) ([]github.Issue, error)
 	GetRepos(org string, isUser bool) ([]github.Repo, error)
 	GetRepoLabels(string, string) ([]github.Label, error)
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
+	Query(ctx context.Context, q interface{}, vars map[string]interface{}) error
 }
 
 func newClient(tokenPath string, tokens, tokenBurst int, dryRun bool, graphqlEndpoint string, hosts ...string) (client, error) {
@@ -730,12 +739,20 @@ func main() {
 		if err := writeCSS(o.cssTemplate, o.cssOutput, *config); err != nil {
 			logrus.WithError(err).Fatalf("failed to write css file using css-template %s to css-output %s", o.cssTemplate, o.cssOutput)
 		}
-	case o.action == "sync":
+	case o.action == "sync", o.action == "report":
 		githubClient, err := newClient(o.token, o.tokens, o.tokenBurst, !o.confirm, o.graphqlEndpoint, o.endpoint.Strings()...)
 		if err != nil {
 			logrus.WithError(err).Fatal("failed to create client")
 		}
 
+		report := UsageReport{}
+		process := func(org string, repos []string) error {
+			if o.action == "report" {
+				return reportOrg(org, githubClient, *config, repos, o.repoLabelsPath, report)
+			}
+			return syncOrg(org, githubClient, *config, repos, o.confirm, o.repoLabelsPath)
+		}
+
 		// there are three ways to configure which repos to sync:
 		//  - a list of org/repo values
 		//  - a list of orgs for which we sync all repos
@@ -746,35 +763,40 @@ func main() {
 				logrus.WithError(err).Fatal("invalid value for --only")
 			}
 			for org := range reposToSync {
-				if err = syncOrg(org, githubClient, *config, reposToSync[org], o.confirm); err != nil {
+				if err = process(org, reposToSync[org]); err != nil {
 					logrus.WithError(err).Fatalf("failed to update %s", org)
 				}
 			}
-			return
-		}
+		} else {
+			skippedRepos := map[string][]string{}
+			if o.skipRepos != "" {
+				reposToSkip, parseError := parseCommaDelimitedList(o.skipRepos)
+				if parseError != nil {
+					logrus.WithError(err).Fatal("invalid value for --skip")
+				}
+				skippedRepos = reposToSkip
+			}
 
-		skippedRepos := map[string][]string{}
-		if o.skipRepos != "" {
-			reposToSkip, parseError := parseCommaDelimitedList(o.skipRepos)
-			if parseError != nil {
-				logrus.WithError(err).Fatal("invalid value for --skip")
+			for _, org := range strings.Split(o.orgs, ",") {
+				org = strings.TrimSpace(org)
+				logger := logrus.WithField("org", org)
+				logger.Info("Reading repos")
+				repos, err := loadRepos(org, githubClient)
+				if err != nil {
+					logger.WithError(err).Fatalf("failed to read repos")
+				}
+				if skipped, exist := skippedRepos[org]; exist {
+					repos = sets.NewString(repos...).Difference(sets.NewString(skipped...)).UnsortedList()
+				}
+				if err = process(org, repos); err != nil {
+					logrus.WithError(err).Fatalf("failed to update %s", org)
+				}
 			}
-			skippedRepos = reposToSkip
 		}
 
-		for _, org := range strings.Split(o.orgs, ",") {
-			org = strings.TrimSpace(org)
-			logger := logrus.WithField("org", org)
-			logger.Info("Reading repos")
-			repos, err := loadRepos(org, githubClient)
-			if err != nil {
-				logger.WithError(err).Fatalf("failed to read repos")
-			}
-			if skipped, exist := skippedRepos[org]; exist {
-				repos = sets.NewString(repos...).Difference(sets.NewString(skipped...)).UnsortedList()
-			}
-			if err = syncOrg(org, githubClient, *config, repos, o.confirm); err != nil {
-				logrus.WithError(err).Fatalf("failed to update %s", org)
+		if o.action == "report" {
+			if err := writeReport(o.reportOutput, report); err != nil {
+				logrus.WithError(err).Fatalf("failed to write report to report-output %s", o.reportOutput)
 			}
 		}
 	default:
@@ -856,7 +878,7 @@ func linkify(text string) string {
 	return strings.ToLower(link)
 }
 
-func syncOrg(org string, githubClient client, config Configuration, repos []string, confirm bool) error {
+func syncOrg(org string, githubClient client, config Configuration, repos []string, confirm bool, repoLabelsPath string) error {
 	logger := logrus.WithField("org", org)
 	logger.Infof("Found %d repos", len(repos))
 	currLabels, err := loadLabels(githubClient, org, repos)
@@ -864,6 +886,12 @@ func syncOrg(org string, githubClient client, config Configuration, repos []stri
 		return err
 	}
 
+	// Repos whose labels file is invalid are still synced with the central labels
+	config, err = withRepoLabels(githubClient, org, config, repos, repoLabelsPath)
+	if err != nil {
+		logger.WithError(err).Warn("Ignoring the labels of some repos")
+	}
+
 	logger.Infof("Syncing labels for %d repos", len(repos))
 	updates, err := syncLabels(config, org, *currLabels)
 	if err != nil {
@@ -878,10 +906,7 @@ func syncOrg(org string, githubClient client, config Configuration, repos []stri
 		return nil
 	}
 
-	if err = updates.DoUpdates(org, githubClient); err != nil {
-		return err
-	}
-	return nil
+	return updates.DoUpdates(org, githubClient)
 }
 
 type labelCSSData struct {
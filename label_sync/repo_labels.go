@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// withRepoLabels returns the configuration with the labels that repos of org
+// declare in the file at path added to their central labels.
+// Repos whose file is invalid keep only their central labels.
+func withRepoLabels(gc client, org string, config Configuration, repos []string, path string) (Configuration, error) {
+	if path == "" {
+		return config, nil
+	}
+	repoConfigs, err := loadRepoConfigs(gc, org, repos, path)
+	merged, mergeErr := config.mergeRepoConfigs(org, repoConfigs)
+	if err == nil {
+		err = mergeErr
+	} else if mergeErr != nil {
+		err = fmt.Errorf("%v, %v", err, mergeErr)
+	}
+	return merged, err
+}
+
+// loadRepoConfigs reads the labels file at path of each repo, leaving out the
+// repos without one.
+func loadRepoConfigs(gc client, org string, repos []string, path string) (map[string]RepoConfig, error) {
+	repoChan := make(chan string, len(repos))
+	for _, repo := range repos {
+		repoChan <- repo
+	}
+	close(repoChan)
+
+	var lock sync.Mutex
+	configs := map[string]RepoConfig{}
+	var loadErrs []error
+
+	wg := sync.WaitGroup{}
+	wg.Add(maxConcurrentWorkers)
+	for i := 0; i < maxConcurrentWorkers; i++ {
+		go func(repositories <-chan string) {
+			defer wg.Done()
+			for repository := range repositories {
+				logger := logrus.WithField("org", org).WithField("repo", repository)
+				var rc RepoConfig
+				data, err := gc.GetFile(org, repository, path, "")
+				if _, notFound := err.(*github.FileNotFound); notFound {
+					continue
+				}
+				if err == nil {
+					err = yaml.Unmarshal(data, &rc)
+				}
+				lock.Lock()
+				if err != nil {
+					logger.WithError(err).Errorf("Failed reading %s", path)
+					loadErrs = append(loadErrs, fmt.Errorf("%s/%s: %v", repository, path, err))
+				} else {
+					logger.Infof("Found %d labels in %s", len(rc.Labels), path)
+					configs[repository] = rc
+				}
+				lock.Unlock()
+			}
+		}(repoChan)
+	}
+	wg.Wait()
+
+	if len(loadErrs) > 0 {
+		return configs, fmt.Errorf("failed to read repo labels: %v", loadErrs)
+	}
+	return configs, nil
+}
+
+// mergeRepoConfigs returns a copy of the configuration in which the labels the
+// repos of org declare themselves are added to those of their central repo config.
+func (c Configuration) mergeRepoConfigs(org string, repoConfigs map[string]RepoConfig) (Configuration, error) {
+	merged := Configuration{Default: c.Default, Repos: map[string]RepoConfig{}}
+	for repo, repoconfig := range c.Repos {
+		merged.Repos[repo] = repoconfig
+	}
+
+	var mergeErrs []error
+	for repo, repoconfig := range repoConfigs {
+		fullName := org + "/" + repo
+		labels, err := mergeLabels(c.Default.Labels, c.Repos[fullName].Labels, repoconfig.Labels)
+		if err != nil {
+			logrus.WithField("org", org).WithField("repo", repo).WithError(err).Error("Ignoring the labels of the repo")
+			mergeErrs = append(mergeErrs, fmt.Errorf("%s: %v", fullName, err))
+			continue
+		}
+		merged.Repos[fullName] = RepoConfig{Labels: labels}
+	}
+
+	if len(mergeErrs) > 0 {
+		return merged, fmt.Errorf("invalid repo labels: %v", mergeErrs)
+	}
+	return merged, nil
+}
+
+// mergeLabels returns the labels of a repo given the default labels, the repo
+// labels of the central config and the labels declared in the repo.
+// A repo may declare new labels, or change the color, description and target of
+// central labels that are not protected. It may neither rename nor retire
+// central labels.
+func mergeLabels(defaults, central, local []Label) ([]Label, error) {
+	if _, err := validate(local, "", make(map[string]string)); err != nil {
+		return nil, err
+	}
+
+	// Central labels by their current and previous lowercase names
+	centralLabels := make(map[string]Label)
+	var index func(labels []Label, current *Label)
+	index = func(labels []Label, current *Label) {
+		for i, l := range labels {
+			first := current
+			if first == nil {
+				first = &labels[i]
+			}
+			centralLabels[strings.ToLower(l.Name)] = *first
+			index(l.Previously, first)
+		}
+	}
+	index(defaults, nil)
+	index(central, nil)
+
+	overridden := sets.NewString()
+	var labels []Label
+	for _, l := range local {
+		if l.Protected {
+			return nil, fmt.Errorf("label %s: only central labels can be protected", l.Name)
+		}
+		for _, previous := range previousNames(l.Previously) {
+			if cur, ok := centralLabels[strings.ToLower(previous)]; ok {
+				return nil, fmt.Errorf("label %s cannot migrate %s, which belongs to central label %s", l.Name, previous, cur.Name)
+			}
+		}
+		name := strings.ToLower(l.Name)
+		cur, ok := centralLabels[name]
+		if !ok {
+			labels = append(labels, l)
+			continue
+		}
+		switch {
+		case cur.Protected:
+			return nil, fmt.Errorf("label %s is protected", cur.Name)
+		case !strings.EqualFold(cur.Name, l.Name):
+			return nil, fmt.Errorf("label %s is a previous name of central label %s", l.Name, cur.Name)
+		case l.DeleteAfter != nil:
+			return nil, fmt.Errorf("central label %s cannot be retired", cur.Name)
+		case len(l.Previously) > 0:
+			return nil, fmt.Errorf("central label %s cannot have other previous names", cur.Name)
+		}
+		// Keep migrating the previous names of the central label
+		l.Name = cur.Name
+		l.Previously = cur.Previously
+		overridden.Insert(name)
+		labels = append(labels, l)
+	}
+
+	var merged []Label
+	for _, l := range central {
+		if !overridden.Has(strings.ToLower(l.Name)) {
+			merged = append(merged, l)
+		}
+	}
+	return append(merged, labels...), nil
+}
+
+// previousNames lists the names in labels and their previous labels
+func previousNames(labels []Label) []string {
+	var names []string
+	for _, l := range labels {
+		names = append(names, l.Name)
+		names = append(names, previousNames(l.Previously)...)
+	}
+	return names
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeClient serves repo files and label usage and records added labels,
+// other calls are not needed
+type fakeClient struct {
+	client
+	files map[string]string
+	usage map[string][]LabelUsage
+
+	lock  sync.Mutex
+	added []string
+}
+
+func (c *fakeClient) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) AddRepoLabel(org, repo, name, description, color string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.added = append(c.added, repo+":"+name)
+	return nil
+}
+
+func (c *fakeClient) GetFile(org, repo, filepath, commit string) ([]byte, error) {
+	if repo == "broken" {
+		return nil, errors.New("injected error")
+	}
+	content, ok := c.files[org+"/"+repo+"/"+filepath]
+	if !ok {
+		return nil, &github.FileNotFound{}
+	}
+	return []byte(content), nil
+}
+
+func TestMergeLabels(t *testing.T) {
+	d := time.Date(2017, 1, 1, 13, 0, 0, 0, time.UTC)
+	defaults := []Label{
+		{Name: "lgtm", Color: "00ff00", Protected: true},
+		{Name: "priority/P0", Color: "ff0000", Previously: []Label{{Name: "P0", Color: "0000ff"}}},
+	}
+	central := []Label{
+		{Name: "area/docs", Color: "cccccc", Target: issueTarget},
+	}
+	var testcases = []struct {
+		name          string
+		local         []Label
+		expected      []Label
+		expectedError bool
+	}{
+		{
+			name:     "No repo labels",
+			expected: central,
+		},
+		{
+			name:  "New repo labels",
+			local: []Label{{Name: "area/ui", Color: "ffffff"}},
+			expected: []Label{
+				{Name: "area/docs", Color: "cccccc", Target: issueTarget},
+				{Name: "area/ui", Color: "ffffff"},
+			},
+		},
+		{
+			name:  "Overriding central repo label",
+			local: []Label{{Name: "area/docs", Color: "aaaaaa", Target: bothTarget}},
+			expected: []Label{
+				{Name: "area/docs", Color: "aaaaaa", Target: bothTarget},
+			},
+		},
+		{
+			name:  "Overriding default label keeps its previous names",
+			local: []Label{{Name: "Priority/P0", Color: "aa0000", Description: "Urgent"}},
+			expected: []Label{
+				{Name: "area/docs", Color: "cccccc", Target: issueTarget},
+				{Name: "priority/P0", Color: "aa0000", Description: "Urgent", Previously: []Label{{Name: "P0", Color: "0000ff"}}},
+			},
+		},
+		{
+			name:          "Overriding protected label",
+			local:         []Label{{Name: "LGTM", Color: "aaaaaa"}},
+			expectedError: true,
+		},
+		{
+			name:          "Declaring previous name of central label",
+			local:         []Label{{Name: "p0", Color: "aaaaaa"}},
+			expectedError: true,
+		},
+		{
+			name:          "Migrating central label",
+			local:         []Label{{Name: "approved", Color: "aaaaaa", Previously: []Label{{Name: "lgtm"}}}},
+			expectedError: true,
+		},
+		{
+			name:          "Retiring central label",
+			local:         []Label{{Name: "area/docs", DeleteAfter: &d}},
+			expectedError: true,
+		},
+		{
+			name:          "Protecting repo label",
+			local:         []Label{{Name: "area/ui", Protected: true}},
+			expectedError: true,
+		},
+		{
+			name:          "Duplicate repo labels",
+			local:         []Label{{Name: "area/ui"}, {Name: "AREA/UI"}},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := mergeLabels(defaults, central, tc.local)
+			if err == nil && tc.expectedError {
+				t.Fatal("failed to raise error")
+			} else if err != nil && !tc.expectedError {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.expectedError && !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected labels:\n%+v\ngot:\n%+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWithRepoLabels(t *testing.T) {
+	config := Configuration{
+		Default: RepoConfig{Labels: []Label{
+			{Name: "lgtm", Color: "00ff00", Protected: true},
+		}},
+		Repos: map[string]RepoConfig{
+			"org/repo1": {Labels: []Label{{Name: "area/docs", Color: "cccccc"}}},
+		},
+	}
+	gc := &fakeClient{files: map[string]string{
+		"org/repo1/.github/labels.yaml": "labels:\n- name: area/ui\n  color: ffffff\n",
+		"org/repo2/.github/labels.yaml": "labels:\n- name: lgtm\n  color: ffffff\n",
+	}}
+
+	merged, err := withRepoLabels(gc, "org", config, []string{"repo1", "repo2", "repo3", "broken"}, ".github/labels.yaml")
+	if err == nil {
+		t.Fatal("expected errors for the protected label in repo2 and for failing to read broken")
+	}
+	for _, expected := range []string{"org/repo2: label lgtm is protected", "broken/.github/labels.yaml: injected error"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q to contain %q", err, expected)
+		}
+	}
+	expected := map[string]RepoConfig{
+		"org/repo1": {Labels: []Label{{Name: "area/docs", Color: "cccccc"}, {Name: "area/ui", Color: "ffffff"}}},
+	}
+	if !reflect.DeepEqual(merged.Repos, expected) {
+		t.Errorf("expected repos:\n%+v\ngot:\n%+v", expected, merged.Repos)
+	}
+	if len(config.Repos["org/repo1"].Labels) != 1 {
+		t.Errorf("expected the central config to be left alone, got %+v", config.Repos)
+	}
+
+	// Repos synced with the merged config get their own labels
+	updates, err := syncLabels(merged, "org", RepoLabels{
+		"repo1": {{Name: "lgtm", Color: "00ff00"}, {Name: "area/docs", Color: "cccccc"}},
+		"repo2": {{Name: "lgtm", Color: "00ff00"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedUpdates := RepoUpdates{
+		"repo1": {{Why: "missing", Wanted: &Label{Name: "area/ui", Color: "ffffff"}}},
+	}
+	if !equalUpdates(updates, expectedUpdates, t) {
+		t.Errorf("expected updates:\n%+v\ngot:\n%+v", expectedUpdates, updates)
+	}
+
+	if unchanged, err := withRepoLabels(gc, "org", config, []string{"repo1"}, ""); err != nil || !reflect.DeepEqual(unchanged, config) {
+		t.Errorf("expected no repo labels to be read without a path, got %+v (error=%v)", unchanged, err)
+	}
+}
+
+func TestSyncOrgIgnoresInvalidRepoLabels(t *testing.T) {
+	config := Configuration{Default: RepoConfig{Labels: []Label{
+		{Name: "lgtm", Color: "00ff00", Protected: true},
+	}}}
+	gc := &fakeClient{files: map[string]string{
+		"org/repo1/.github/labels.yaml": "labels:\n- name: area/ui\n  color: ffffff\n",
+		"org/repo2/.github/labels.yaml": "labels:\n- name: lgtm\n  color: ffffff\n",
+	}}
+
+	if err := syncOrg("org", gc, config, []string{"repo1", "repo2", "broken"}, true, ".github/labels.yaml"); err != nil {
+		t.Fatalf("expected invalid repo labels not to fail the sync, got %v", err)
+	}
+	sort.Strings(gc.added)
+	expected := []string{"broken:lgtm", "repo1:area/ui", "repo1:lgtm", "repo2:lgtm"}
+	if !reflect.DeepEqual(gc.added, expected) {
+		t.Errorf("expected added labels %v, got %v", expected, gc.added)
+	}
+}
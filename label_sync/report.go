@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// LabelUsage counts the issues and PRs, open or closed, a label is applied to in a repo
+type LabelUsage struct {
+	Name string `json:"name"`
+	// Target is the configured target of the label, empty for labels missing from the config
+	Target       LabelTarget `json:"target,omitempty"`
+	Issues       int         `json:"issues"`
+	PullRequests int         `json:"pullRequests"`
+	// Unused is set when no issue or PR has the label
+	Unused bool `json:"unused,omitempty"`
+	// OutsideTarget is set when the label is applied to issues or PRs it does not target
+	OutsideTarget bool `json:"outsideTarget,omitempty"`
+}
+
+// UsageReport holds an org/repo => []LabelUsage mapping
+type UsageReport map[string][]LabelUsage
+
+// See: https://developer.github.com/v4/object/repository/.
+type labelUsageQuery struct {
+	Repository struct {
+		Labels struct {
+			PageInfo struct {
+				HasNextPage githubql.Boolean
+				EndCursor   githubql.String
+			}
+			Nodes []labelUsageNode
+		} `graphql:"labels(first: 100, after: $labelCursor)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+// See: https://developer.github.com/v4/object/label/.
+type labelUsageNode struct {
+	Name   githubql.String
+	Issues struct {
+		TotalCount githubql.Int
+	}
+	PullRequests struct {
+		TotalCount githubql.Int
+	}
+}
+
+// loadUsage counts the issues and PRs of each label of a repo
+func loadUsage(gc client, org, repo string) ([]LabelUsage, error) {
+	vars := map[string]interface{}{
+		"org":         githubql.String(org),
+		"repo":        githubql.String(repo),
+		"labelCursor": (*githubql.String)(nil),
+	}
+	var usage []LabelUsage
+	for {
+		var q labelUsageQuery
+		if err := gc.Query(context.Background(), &q, vars); err != nil {
+			return nil, err
+		}
+		for _, n := range q.Repository.Labels.Nodes {
+			usage = append(usage, LabelUsage{
+				Name:         string(n.Name),
+				Issues:       int(n.Issues.TotalCount),
+				PullRequests: int(n.PullRequests.TotalCount),
+			})
+		}
+		if !q.Repository.Labels.PageInfo.HasNextPage {
+			break
+		}
+		vars["labelCursor"] = githubql.NewString(q.Repository.Labels.PageInfo.EndCursor)
+	}
+	return usage, nil
+}
+
+// classifyUsage sets the target of the labels a repo uses from the config, and
+// flags those which are unused or applied outside of their target.
+func classifyUsage(config Configuration, fullName string, usage []LabelUsage) []LabelUsage {
+	targets := make(map[string]LabelTarget)
+	for _, labels := range [][]Label{config.Default.Labels, config.Repos[fullName].Labels} {
+		for _, l := range labels {
+			targets[strings.ToLower(l.Name)] = l.Target
+		}
+	}
+
+	var classified []LabelUsage
+	for _, u := range usage {
+		u.Target = targets[strings.ToLower(u.Name)]
+		u.Unused = u.Issues == 0 && u.PullRequests == 0
+		u.OutsideTarget = (u.Target == prTarget && u.Issues > 0) || (u.Target == issueTarget && u.PullRequests > 0)
+		classified = append(classified, u)
+	}
+	sort.Slice(classified, func(i, j int) bool { return classified[i].Name < classified[j].Name })
+	return classified
+}
+
+// reportOrg adds the label usage of the repos of org to the report
+func reportOrg(org string, githubClient client, config Configuration, repos []string, repoLabelsPath string, report UsageReport) error {
+	logger := logrus.WithField("org", org)
+	config, err := withRepoLabels(githubClient, org, config, repos, repoLabelsPath)
+	if err != nil {
+		// The usage is still worth reporting, against the central labels
+		logger.WithError(err).Warn("Failed to read the labels of some repos")
+	}
+
+	for _, repo := range repos {
+		logger.WithField("repo", repo).Info("Counting label usage for repo")
+		usage, err := loadUsage(githubClient, org, repo)
+		if err != nil {
+			return fmt.Errorf("failed to count label usage in %s/%s: %v", org, repo, err)
+		}
+		fullName := org + "/" + repo
+		report[fullName] = classifyUsage(config, fullName, usage)
+
+		var unused, outsideTarget int
+		for _, u := range report[fullName] {
+			if u.Unused {
+				unused++
+			}
+			if u.OutsideTarget {
+				outsideTarget++
+			}
+		}
+		logger.WithField("repo", repo).Infof("Found %d labels, %d unused and %d applied outside of their target", len(usage), unused, outsideTarget)
+	}
+	return nil
+}
+
+// writeReport writes the report as yaml to outputPath, or to stdout when unset
+func writeReport(outputPath string, report UsageReport) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if outputPath == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(outputPath, data, 0644)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+)
+
+// Query serves the usage of one label per page
+func (c *fakeClient) Query(ctx context.Context, q interface{}, vars map[string]interface{}) error {
+	query := q.(*labelUsageQuery)
+	usage := c.usage[string(vars["org"].(githubql.String))+"/"+string(vars["repo"].(githubql.String))]
+	page := 0
+	if cursor := vars["labelCursor"].(*githubql.String); cursor != nil {
+		page, _ = strconv.Atoi(string(*cursor))
+	}
+	if page >= len(usage) {
+		return nil
+	}
+	node := labelUsageNode{Name: githubql.String(usage[page].Name)}
+	node.Issues.TotalCount = githubql.Int(usage[page].Issues)
+	node.PullRequests.TotalCount = githubql.Int(usage[page].PullRequests)
+	query.Repository.Labels.Nodes = []labelUsageNode{node}
+	query.Repository.Labels.PageInfo.HasNextPage = githubql.Boolean(page+1 < len(usage))
+	query.Repository.Labels.PageInfo.EndCursor = githubql.String(strconv.Itoa(page + 1))
+	return nil
+}
+
+func TestReportOrg(t *testing.T) {
+	config := Configuration{
+		Default: RepoConfig{Labels: []Label{
+			{Name: "lgtm", Target: prTarget},
+			{Name: "kind/bug", Target: bothTarget},
+		}},
+		Repos: map[string]RepoConfig{
+			"org/repo1": {Labels: []Label{{Name: "area/docs", Target: issueTarget}}},
+		},
+	}
+	gc := &fakeClient{
+		files: map[string]string{
+			"org/repo2/.github/labels.yaml": "labels:\n- name: triage/needed\n  target: issues\n",
+		},
+		usage: map[string][]LabelUsage{
+			"org/repo1": {
+				{Name: "lgtm", PullRequests: 10},
+				{Name: "kind/bug", Issues: 2, PullRequests: 3},
+				{Name: "area/docs", Issues: 1, PullRequests: 1},
+				{Name: "manual", Issues: 4},
+			},
+			"org/repo2": {
+				{Name: "LGTM", Issues: 1},
+				{Name: "kind/bug"},
+				{Name: "triage/needed", PullRequests: 2},
+			},
+		},
+	}
+
+	report := UsageReport{}
+	if err := reportOrg("org", gc, config, []string{"repo1", "repo2"}, ".github/labels.yaml", report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := UsageReport{
+		"org/repo1": {
+			{Name: "area/docs", Target: issueTarget, Issues: 1, PullRequests: 1, OutsideTarget: true},
+			{Name: "kind/bug", Target: bothTarget, Issues: 2, PullRequests: 3},
+			{Name: "lgtm", Target: prTarget, PullRequests: 10},
+			{Name: "manual", Issues: 4},
+		},
+		"org/repo2": {
+			{Name: "LGTM", Target: prTarget, Issues: 1, OutsideTarget: true},
+			{Name: "kind/bug", Target: bothTarget, Unused: true},
+			{Name: "triage/needed", Target: issueTarget, PullRequests: 2, OutsideTarget: true},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected report:\n%+v\ngot:\n%+v", expected, report)
+	}
+}
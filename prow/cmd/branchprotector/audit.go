@@ -0,0 +1,246 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+// tideContext is the status context tide reports on the PRs its queries match.
+const tideContext = "tide"
+
+// FindingKind identifies the kind of protection gap.
+type FindingKind string
+
+const (
+	// DriftFinding is a branch whose protection differs from the config.
+	DriftFinding FindingKind = "drift"
+	// UnproducibleContextFinding is a required context that nothing reports.
+	UnproducibleContextFinding FindingKind = "unproducible-context"
+	// UnprotectedReleaseFinding is an unprotected release branch.
+	UnprotectedReleaseFinding FindingKind = "unprotected-release-branch"
+)
+
+// findingKinds orders the kinds in reports, along with their titles.
+var findingKinds = []struct {
+	kind  FindingKind
+	title string
+}{
+	{kind: DriftFinding, title: "Protection differs from the config"},
+	{kind: UnproducibleContextFinding, title: "Required contexts nothing reports"},
+	{kind: UnprotectedReleaseFinding, title: "Unprotected release branches"},
+}
+
+// Finding is a protection gap of a branch.
+type Finding struct {
+	Kind    FindingKind `json:"kind"`
+	Org     string      `json:"org"`
+	Repo    string      `json:"repo"`
+	Branch  string      `json:"branch"`
+	Context string      `json:"context,omitempty"`
+	Message string      `json:"message"`
+	// Wanted is the protection the config asks for, for drift
+	Wanted             *github.BranchProtectionRequest `json:"wanted,omitempty"`
+	RequiredSignatures *bool                           `json:"required_signatures,omitempty"`
+}
+
+// Audit holds the protection gaps found across orgs.
+type Audit struct {
+	lock     sync.Mutex
+	Findings []Finding `json:"findings"`
+	// releaseBranches identifies the branches which must be protected
+	releaseBranches *regexp.Regexp
+}
+
+func (a *Audit) add(f Finding) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.Findings = append(a.Findings, f)
+}
+
+// sort orders the findings by kind, org, repo, branch and context.
+func (a *Audit) sort() {
+	order := map[FindingKind]int{}
+	for i, k := range findingKinds {
+		order[k.kind] = i
+	}
+	sort.Slice(a.Findings, func(i, j int) bool {
+		fi, fj := a.Findings[i], a.Findings[j]
+		switch {
+		case fi.Kind != fj.Kind:
+			return order[fi.Kind] < order[fj.Kind]
+		case fi.Org != fj.Org:
+			return fi.Org < fj.Org
+		case fi.Repo != fj.Repo:
+			return fi.Repo < fj.Repo
+		case fi.Branch != fj.Branch:
+			return fi.Branch < fj.Branch
+		default:
+			return fi.Context < fj.Context
+		}
+	})
+}
+
+// auditBranches records the updates the protector would make as drift,
+// instead of configuring the branches.
+func (p *protector) auditBranches() {
+	for u := range p.updates {
+		f := Finding{
+			Kind:               DriftFinding,
+			Org:                u.Org,
+			Repo:               u.Repo,
+			Branch:             u.Branch,
+			Wanted:             u.Request,
+			RequiredSignatures: u.RequiredSignatures,
+		}
+		if u.Request == nil {
+			f.Message = "protected, but the config disables protection"
+		} else {
+			f.Message = "protection does not match the config"
+		}
+		p.audit.add(f)
+	}
+	p.done <- p.errors.errs
+}
+
+// auditBranch finds the gaps of a branch which are not about drift. The policy is
+// nil for branches without one, including those excluded from protection.
+func (p *protector) auditBranch(orgName, repoName, branchName string, policy *config.Policy, protected bool) {
+	if !protected && p.audit.releaseBranches != nil && p.audit.releaseBranches.MatchString(branchName) {
+		p.audit.add(Finding{
+			Kind:    UnprotectedReleaseFinding,
+			Org:     orgName,
+			Repo:    repoName,
+			Branch:  branchName,
+			Message: "release branch is not protected",
+		})
+	}
+
+	if policy == nil || policy.Protect == nil || !*policy.Protect || policy.RequiredStatusChecks == nil {
+		return
+	}
+	for _, context := range unproducibleContexts(p.cfg, orgName, repoName, branchName, policy.RequiredStatusChecks.Contexts) {
+		p.audit.add(Finding{
+			Kind:    UnproducibleContextFinding,
+			Org:     orgName,
+			Repo:    repoName,
+			Branch:  branchName,
+			Context: context,
+			Message: fmt.Sprintf("required context %s is not reported by any presubmit that runs automatically, or by tide", context),
+		})
+	}
+}
+
+// unproducibleContexts returns the contexts which neither a presubmit running
+// without a /test command nor tide reports on PRs against the branch.
+// Repos with in-repo config may define presubmits for any context, so none of
+// their contexts are returned.
+func unproducibleContexts(cfg *config.Config, orgName, repoName, branchName string, contexts []string) []string {
+	orgRepo := orgName + "/" + repoName
+	if cfg.InRepoConfigEnabled(orgRepo) {
+		return nil
+	}
+
+	producible := sets.NewString()
+	for _, ps := range cfg.PresubmitsStatic[orgRepo] {
+		if ps.SkipReport || ps.NeedsExplicitTrigger() || !ps.CouldRun(branchName) {
+			continue
+		}
+		producible.Insert(ps.Context)
+	}
+	for _, tq := range cfg.Tide.Queries {
+		if tq.ForRepo(config.OrgRepo{Org: orgName, Repo: repoName}) && tideMergesInto(tq, branchName) {
+			producible.Insert(tideContext)
+			break
+		}
+	}
+
+	var unproducible []string
+	for _, context := range sets.NewString(contexts...).List() {
+		if !producible.Has(context) {
+			unproducible = append(unproducible, context)
+		}
+	}
+	return unproducible
+}
+
+// tideMergesInto determines if the tide query matches PRs against the branch.
+func tideMergesInto(tq config.TideQuery, branch string) bool {
+	if len(tq.IncludedBranches) > 0 && !sets.NewString(tq.IncludedBranches...).Has(branch) {
+		return false
+	}
+	return !sets.NewString(tq.ExcludedBranches...).Has(branch)
+}
+
+// Markdown renders the findings as a report grouped by kind.
+func (a *Audit) Markdown() string {
+	var s strings.Builder
+	s.WriteString("## Branch protection audit\n\n")
+	if len(a.Findings) == 0 {
+		s.WriteString("No gaps found. Every branch in scope is protected as configured.\n")
+		return s.String()
+	}
+
+	counts := map[FindingKind]int{}
+	for _, f := range a.Findings {
+		counts[f.Kind]++
+	}
+	fmt.Fprintf(&s, "%d gaps found.\n", len(a.Findings))
+	for _, k := range findingKinds {
+		if counts[k.kind] == 0 {
+			continue
+		}
+		fmt.Fprintf(&s, "\n### %s (%d)\n\n| Repo | Branch | Problem |\n| --- | --- | --- |\n", k.title, counts[k.kind])
+		for _, f := range a.Findings {
+			if f.Kind == k.kind {
+				fmt.Fprintf(&s, "| %s/%s | %s | %s |\n", f.Org, f.Repo, f.Branch, f.Message)
+			}
+		}
+	}
+	return s.String()
+}
+
+// write writes the findings as json and markdown to the paths that are set.
+func (a *Audit) write(jsonPath, markdownPath string) error {
+	a.sort()
+	if jsonPath != "" {
+		raw, err := json.MarshalIndent(a, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal audit: %v", err)
+		}
+		if err := ioutil.WriteFile(jsonPath, append(raw, '\n'), 0644); err != nil {
+			return fmt.Errorf("write audit to %s: %v", jsonPath, err)
+		}
+	}
+	if markdownPath != "" {
+		if err := ioutil.WriteFile(markdownPath, []byte(a.Markdown()), 0644); err != nil {
+			return fmt.Errorf("write audit to %s: %v", markdownPath, err)
+		}
+	}
+	return nil
+}
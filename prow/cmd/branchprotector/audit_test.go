@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestAudit(t *testing.T) {
+	no := false
+	fc := fakeClient{
+		repos: map[string][]github.Repo{"org": {{Name: "repo"}, {Name: "inrepo"}, {Name: "retired"}}},
+		branches: map[string][]github.Branch{
+			"org/repo": {
+				{Name: "master", Protected: true},
+				{Name: "release-1.0"},
+				{Name: "release-2.0", Protected: true},
+				{Name: "feature"},
+			},
+			"org/inrepo":  {{Name: "master"}, {Name: "release-1.0"}},
+			"org/retired": {{Name: "master", Protected: true}},
+		},
+		branchProtections: map[string]github.BranchProtection{
+			"org/repo=master": {
+				RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"tide", "unit", "e2e", "manual", "old"}},
+			},
+			"org/retired=master": {},
+		},
+	}
+
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(`
+branch-protection:
+  orgs:
+    org:
+      exclude:
+      - release-.*
+      repos:
+        repo:
+          protect: true
+          required_status_checks:
+            contexts:
+            - tide
+            - old
+            - manual
+        inrepo:
+          protect: true
+          required_status_checks:
+            contexts:
+            - anything
+        retired:
+          protect: false
+tide:
+  queries:
+  - repos:
+    - org/repo
+    excludedBranches:
+    - feature
+in_repo_config:
+  enabled:
+    org/inrepo: true
+`), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	cfg.PresubmitsStatic = map[string][]config.Presubmit{
+		"org/repo": {
+			{JobBase: config.JobBase{Name: "unit"}, AlwaysRun: true, Reporter: config.Reporter{Context: "unit"}},
+			{JobBase: config.JobBase{Name: "e2e"}, RegexpChangeMatcher: config.RegexpChangeMatcher{RunIfChanged: "^test/"}, Reporter: config.Reporter{Context: "e2e"}},
+			{JobBase: config.JobBase{Name: "manual"}, Reporter: config.Reporter{Context: "manual"}},
+			{JobBase: config.JobBase{Name: "old"}, AlwaysRun: true, Brancher: config.Brancher{Branches: []string{"release-1.0"}}, Reporter: config.Reporter{Context: "old"}},
+		},
+	}
+	if err := config.SetPresubmitRegexes(cfg.PresubmitsStatic["org/repo"]); err != nil {
+		t.Fatalf("failed to compile presubmit regexes: %v", err)
+	}
+
+	p := protector{
+		client:         &fc,
+		cfg:            &cfg,
+		errors:         Errors{},
+		updates:        make(chan requirements),
+		done:           make(chan []error),
+		completedRepos: make(map[string]bool),
+		audit:          &Audit{releaseBranches: regexp.MustCompile("^release-")},
+	}
+	go p.auditBranches()
+	p.protect()
+	close(p.updates)
+	if errs := <-p.done; len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	p.audit.sort()
+	var actual []Finding
+	for _, f := range p.audit.Findings {
+		f.Message = ""
+		f.Wanted = nil
+		f.RequiredSignatures = nil
+		actual = append(actual, f)
+	}
+	expected := []Finding{
+		{Kind: DriftFinding, Org: "org", Repo: "inrepo", Branch: "master"},
+		{Kind: DriftFinding, Org: "org", Repo: "repo", Branch: "feature"},
+		{Kind: DriftFinding, Org: "org", Repo: "repo", Branch: "master"},
+		{Kind: DriftFinding, Org: "org", Repo: "retired", Branch: "master"},
+		{Kind: UnproducibleContextFinding, Org: "org", Repo: "repo", Branch: "feature", Context: "manual"},
+		{Kind: UnproducibleContextFinding, Org: "org", Repo: "repo", Branch: "feature", Context: "old"},
+		{Kind: UnproducibleContextFinding, Org: "org", Repo: "repo", Branch: "feature", Context: "tide"},
+		{Kind: UnproducibleContextFinding, Org: "org", Repo: "repo", Branch: "master", Context: "manual"},
+		{Kind: UnproducibleContextFinding, Org: "org", Repo: "repo", Branch: "master", Context: "old"},
+		{Kind: UnprotectedReleaseFinding, Org: "org", Repo: "inrepo", Branch: "release-1.0"},
+		{Kind: UnprotectedReleaseFinding, Org: "org", Repo: "repo", Branch: "release-1.0"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("findings differ: %s", diff.ObjectReflectDiff(expected, actual))
+	}
+	for _, f := range p.audit.Findings {
+		if f.Kind == DriftFinding && f.Repo == "retired" && f.Wanted != nil {
+			t.Errorf("expected retired to drift towards no protection, got %+v", *f.Wanted)
+		}
+		if f.Kind == DriftFinding && f.Branch == "master" && f.Repo == "repo" && (f.Wanted == nil || !reflect.DeepEqual(f.Wanted.EnforceAdmins, &no)) {
+			t.Errorf("expected master to drift towards the configured protection, got %+v", f.Wanted)
+		}
+	}
+}
+
+func TestAuditWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	jsonPath, markdownPath := filepath.Join(dir, "audit.json"), filepath.Join(dir, "audit.md")
+
+	a := &Audit{Findings: []Finding{
+		{Kind: UnprotectedReleaseFinding, Org: "org", Repo: "repo", Branch: "release-1.0", Message: "release branch is not protected"},
+		{Kind: DriftFinding, Org: "org", Repo: "repo", Branch: "master", Message: "protection does not match the config"},
+		{Kind: DriftFinding, Org: "org", Repo: "other", Branch: "master", Message: "protected, but the config disables protection"},
+	}}
+	if err := a.write(jsonPath, markdownPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("failed to read json: %v", err)
+	}
+	var decoded Audit
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("failed to decode json: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Findings, a.Findings) {
+		t.Errorf("json findings differ: %s", diff.ObjectReflectDiff(a.Findings, decoded.Findings))
+	}
+
+	markdown, err := ioutil.ReadFile(markdownPath)
+	if err != nil {
+		t.Fatalf("failed to read markdown: %v", err)
+	}
+	expected := `## Branch protection audit
+
+3 gaps found.
+
+### Protection differs from the config (2)
+
+| Repo | Branch | Problem |
+| --- | --- | --- |
+| org/other | master | protected, but the config disables protection |
+| org/repo | master | protection does not match the config |
+
+### Unprotected release branches (1)
+
+| Repo | Branch | Problem |
+| --- | --- | --- |
+| org/repo | release-1.0 | release branch is not protected |
+`
+	if string(markdown) != expected {
+		t.Errorf("expected markdown:\n%s\ngot:\n%s", expected, markdown)
+	}
+
+	if empty := (&Audit{}).Markdown(); !strings.Contains(empty, "No gaps found") {
+		t.Errorf("expected an empty audit to say so, got:\n%s", empty)
+	}
+}
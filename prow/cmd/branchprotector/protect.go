@@ -51,6 +51,11 @@ type options struct {
 	tokens             int
 	tokenBurst         int
 	github             flagutil.GitHubOptions
+
+	audit           bool
+	auditOutput     string
+	auditMarkdown   string
+	releaseBranches string
 }
 
 func (o *options) Validate() error {
@@ -62,6 +67,18 @@ func (o *options) Validate() error {
 		return errors.New("empty --config-path")
 	}
 
+	if o.audit {
+		if o.confirm {
+			return errors.New("--audit only reports, it cannot be used with --confirm")
+		}
+		if o.auditOutput == "" && o.auditMarkdown == "" {
+			return errors.New("--audit requires --audit-output or --audit-markdown")
+		}
+		if _, err := regexp.Compile(o.releaseBranches); err != nil {
+			return fmt.Errorf("invalid --audit-release-branches: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -74,6 +91,10 @@ func gatherOptions() options {
 	fs.BoolVar(&o.verifyRestrictions, "verify-restrictions", false, "Verify the restrictions section of the request for authorized collaborators/teams")
 	fs.IntVar(&o.tokens, "tokens", defaultTokens, "Throttle hourly token consumption (0 to disable)")
 	fs.IntVar(&o.tokenBurst, "token-burst", defaultBurst, "Allow consuming a subset of hourly tokens in a short burst")
+	fs.BoolVar(&o.audit, "audit", false, "Report protection gaps instead of protecting branches")
+	fs.StringVar(&o.auditOutput, "audit-output", "", "Path to write the --audit findings to as json")
+	fs.StringVar(&o.auditMarkdown, "audit-markdown", "", "Path to write the --audit findings to as markdown")
+	fs.StringVar(&o.releaseBranches, "audit-release-branches", "^release-", "Regex matching the branches --audit reports when unprotected")
 	o.github.AddFlags(fs)
 	fs.Parse(os.Args[1:])
 	return o
@@ -84,6 +105,9 @@ type requirements struct {
 	Repo    string
 	Branch  string
 	Request *github.BranchProtectionRequest
+	// RequiredSignatures changes whether the branch requires signed commits if set,
+	// which is not part of the Request in the GitHub api.
+	RequiredSignatures *bool
 }
 
 // Errors holds a list of errors, including a method to concurrently append.
@@ -134,10 +158,21 @@ func main() {
 		verifyRestrictions: o.verifyRestrictions,
 	}
 
-	go p.configureBranches()
+	if o.audit {
+		p.audit = &Audit{releaseBranches: regexp.MustCompile(o.releaseBranches)}
+		go p.auditBranches()
+	} else {
+		go p.configureBranches()
+	}
 	p.protect()
 	close(p.updates)
 	errors := <-p.done
+	if p.audit != nil {
+		if err := p.audit.write(o.auditOutput, o.auditMarkdown); err != nil {
+			logrus.WithError(err).Fatal("Error writing audit.")
+		}
+		logrus.Infof("Found %d protection gaps", len(p.audit.Findings))
+	}
 	if n := len(errors); n > 0 {
 		for i, err := range errors {
 			logrus.WithError(err).Error(i)
@@ -150,6 +185,10 @@ type client interface {
 	GetBranchProtection(org, repo, branch string) (*github.BranchProtection, error)
 	RemoveBranchProtection(org, repo, branch string) error
 	UpdateBranchProtection(org, repo, branch string, config github.BranchProtectionRequest) error
+	SetRequiredSignatures(org, repo, branch string, required bool) error
+	ListTagProtections(org, repo string) ([]github.TagProtection, error)
+	CreateTagProtection(org, repo, pattern string) error
+	DeleteTagProtection(org, repo string, id int) error
 	GetBranches(org, repo string, onlyProtected bool) ([]github.Branch, error)
 	GetRepo(owner, name string) (github.FullRepo, error)
 	GetRepos(org string, user bool) ([]github.Repo, error)
@@ -165,6 +204,8 @@ type protector struct {
 	completedRepos     map[string]bool
 	done               chan []error
 	verifyRestrictions bool
+	// audit collects protection gaps instead of configuring branches if set
+	audit *Audit
 }
 
 func (p *protector) configureBranches() {
@@ -178,6 +219,13 @@ func (p *protector) configureBranches() {
 
 		if err := p.client.UpdateBranchProtection(u.Org, u.Repo, u.Branch, *u.Request); err != nil {
 			p.errors.add(fmt.Errorf("update %s/%s=%s protection to %v failed: %v", u.Org, u.Repo, u.Branch, *u.Request, err))
+			continue
+		}
+
+		if u.RequiredSignatures != nil {
+			if err := p.client.SetRequiredSignatures(u.Org, u.Repo, u.Branch, *u.RequiredSignatures); err != nil {
+				p.errors.add(fmt.Errorf("update %s/%s=%s required signatures to %t failed: %v", u.Org, u.Repo, u.Branch, *u.RequiredSignatures, err))
+			}
 		}
 	}
 	p.done <- p.errors.errs
@@ -286,6 +334,7 @@ func (p *protector) UpdateRepo(orgName string, repoName string, repo config.Repo
 	}
 
 	branches := map[string]github.Branch{}
+	excluded := map[string]github.Branch{}
 	for _, onlyProtected := range []bool{false, true} { // put true second so b.Protected is set correctly
 		bs, err := p.client.GetBranches(orgName, repoName, onlyProtected)
 		if err != nil {
@@ -295,11 +344,17 @@ func (p *protector) UpdateRepo(orgName string, repoName string, repo config.Repo
 			_, ok := repo.Branches[b.Name]
 			if !ok && branchExclusions != nil && branchExclusions.MatchString(b.Name) {
 				logrus.Infof("%s/%s=%s: excluded", orgName, repoName, b.Name)
+				excluded[b.Name] = b
 				continue
 			}
 			branches[b.Name] = b
 		}
 	}
+	if p.audit != nil {
+		for bn, b := range excluded {
+			p.auditBranch(orgName, repoName, bn, nil, b.Protected)
+		}
+	}
 
 	var collaborators, teams []string
 	if p.verifyRestrictions {
@@ -325,6 +380,40 @@ func (p *protector) UpdateRepo(orgName string, repoName string, repo config.Repo
 		}
 	}
 
+	if len(repo.Policy.ProtectedTags) > 0 {
+		if err := p.UpdateTags(orgName, repoName, repo.Policy.ProtectedTags); err != nil {
+			errs = append(errs, fmt.Errorf("update protected tags: %v", err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// UpdateTags ensures exactly the tag patterns in the policy are protected in the repo
+func (p *protector) UpdateTags(orgName, repoName string, patterns []string) error {
+	current, err := p.client.ListTagProtections(orgName, repoName)
+	if err != nil {
+		return fmt.Errorf("list tag protections: %v", err)
+	}
+
+	missing := sets.NewString(patterns...)
+	var errs []error
+	for _, tp := range current {
+		if missing.Has(tp.Pattern) {
+			missing.Delete(tp.Pattern)
+			continue
+		}
+		logrus.Infof("%s/%s: unprotecting tags %s", orgName, repoName, tp.Pattern)
+		if err := p.client.DeleteTagProtection(orgName, repoName, tp.ID); err != nil {
+			errs = append(errs, fmt.Errorf("delete tag protection %s: %v", tp.Pattern, err))
+		}
+	}
+	for _, pattern := range missing.List() {
+		logrus.Infof("%s/%s: protecting tags %s", orgName, repoName, pattern)
+		if err := p.client.CreateTagProtection(orgName, repoName, pattern); err != nil {
+			errs = append(errs, fmt.Errorf("create tag protection %s: %v", pattern, err))
+		}
+	}
 	return utilerrors.NewAggregate(errs)
 }
 
@@ -385,6 +474,9 @@ func (p *protector) UpdateBranch(orgName, repo string, branchName string, branch
 	if err != nil {
 		return fmt.Errorf("get policy: %v", err)
 	}
+	if p.audit != nil {
+		p.auditBranch(orgName, repo, branchName, bp, protected)
+	}
 	if bp == nil || bp.Protect == nil {
 		return nil
 	}
@@ -422,16 +514,26 @@ func (p *protector) UpdateBranch(orgName, repo string, branchName string, branch
 		return fmt.Errorf("get current branch protection: %v", err)
 	}
 
-	if equalBranchProtections(currentBP, req) {
+	// Signed commits are configured on their own, and only when they change
+	var signatures *bool
+	if req != nil {
+		required := makeBool(bp.RequiredSignatures)
+		if (currentBP != nil && currentBP.RequiredSignatures.Enabled) != required {
+			signatures = &required
+		}
+	}
+
+	if equalBranchProtections(currentBP, req) && signatures == nil {
 		logrus.Debugf("%s/%s=%s: current branch protection matches policy, skipping", orgName, repo, branchName)
 		return nil
 	}
 
 	p.updates <- requirements{
-		Org:     orgName,
-		Repo:    repo,
-		Branch:  branchName,
-		Request: req,
+		Org:                orgName,
+		Repo:               repo,
+		Branch:             branchName,
+		Request:            req,
+		RequiredSignatures: signatures,
 	}
 	return nil
 }
@@ -444,7 +546,11 @@ func equalBranchProtections(state *github.BranchProtection, request *github.Bran
 		return equalRequiredStatusChecks(state.RequiredStatusChecks, request.RequiredStatusChecks) &&
 			equalAdminEnforcement(state.EnforceAdmins, request.EnforceAdmins) &&
 			equalRequiredPullRequestReviews(state.RequiredPullRequestReviews, request.RequiredPullRequestReviews) &&
-			equalRestrictions(state.Restrictions, request.Restrictions)
+			equalRestrictions(state.Restrictions, request.Restrictions) &&
+			state.RequiredLinearHistory.Enabled == request.RequiredLinearHistory &&
+			state.AllowForcePushes.Enabled == request.AllowForcePushes &&
+			state.AllowDeletions.Enabled == request.AllowDeletions &&
+			state.RequiredConversationResolution.Enabled == request.RequiredConversationResolution
 	default:
 		return false
 	}
@@ -70,6 +70,47 @@ func TestOptions_Validate(t *testing.T) {
 			},
 			expectedErr: false,
 		},
+		{
+			name: "audit to a file",
+			opt: options{
+				config:          "dummy",
+				audit:           true,
+				auditMarkdown:   "audit.md",
+				releaseBranches: "^release-",
+			},
+			expectedErr: false,
+		},
+		{
+			name: "audit without output",
+			opt: options{
+				config:          "dummy",
+				audit:           true,
+				releaseBranches: "^release-",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "audit with confirm",
+			opt: options{
+				config:          "dummy",
+				confirm:         true,
+				github:          flagutil.GitHubOptions{TokenPath: "fake"},
+				audit:           true,
+				auditOutput:     "audit.json",
+				releaseBranches: "^release-",
+			},
+			expectedErr: true,
+		},
+		{
+			name: "audit with invalid release branches",
+			opt: options{
+				config:          "dummy",
+				audit:           true,
+				auditOutput:     "audit.json",
+				releaseBranches: "release-(",
+			},
+			expectedErr: true,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -91,6 +132,8 @@ type fakeClient struct {
 	branchProtections map[string]github.BranchProtection
 	collaborators     []github.User
 	teams             []github.Team
+	signatures        map[string]bool
+	tagProtections    map[string][]github.TagProtection
 }
 
 func (c fakeClient) GetRepo(org string, repo string) (github.FullRepo, error) {
@@ -170,6 +213,41 @@ func (c *fakeClient) RemoveBranchProtection(org, repo, branch string) error {
 	return nil
 }
 
+func (c *fakeClient) SetRequiredSignatures(org, repo, branch string, required bool) error {
+	if c.signatures == nil {
+		c.signatures = map[string]bool{}
+	}
+	c.signatures[org+"/"+repo+"="+branch] = required
+	return nil
+}
+
+func (c *fakeClient) ListTagProtections(org, repo string) ([]github.TagProtection, error) {
+	return c.tagProtections[org+"/"+repo], nil
+}
+
+func (c *fakeClient) CreateTagProtection(org, repo, pattern string) error {
+	if c.tagProtections == nil {
+		c.tagProtections = map[string][]github.TagProtection{}
+	}
+	id := 1
+	for _, tps := range c.tagProtections {
+		id += len(tps)
+	}
+	c.tagProtections[org+"/"+repo] = append(c.tagProtections[org+"/"+repo], github.TagProtection{ID: id, Pattern: pattern})
+	return nil
+}
+
+func (c *fakeClient) DeleteTagProtection(org, repo string, id int) error {
+	var kept []github.TagProtection
+	for _, tp := range c.tagProtections[org+"/"+repo] {
+		if tp.ID != id {
+			kept = append(kept, tp)
+		}
+	}
+	c.tagProtections[org+"/"+repo] = kept
+	return nil
+}
+
 func (c *fakeClient) ListCollaborators(org, repo string) ([]github.User, error) {
 	return c.collaborators, nil
 }
@@ -191,6 +269,7 @@ func TestConfigureBranches(t *testing.T) {
 		updates []requirements
 		deletes map[string]bool
 		sets    map[string]github.BranchProtectionRequest
+		signed  map[string]bool
 		errors  int
 	}{
 		{
@@ -234,6 +313,22 @@ func TestConfigureBranches(t *testing.T) {
 				"one/1=other":  diffprot,
 			},
 		},
+		{
+			name: "update-signatures",
+			updates: []requirements{
+				{Org: "one", Repo: "1", Branch: "master", Request: &prot, RequiredSignatures: &yes},
+				{Org: "one", Repo: "1", Branch: "other", Request: &prot},
+				{Org: "one", Repo: "1", Branch: "error", Request: &prot, RequiredSignatures: &yes},
+			},
+			errors: 1, // the signatures of the branch that failed to update are left alone
+			sets: map[string]github.BranchProtectionRequest{
+				"one/1=master": prot,
+				"one/1=other":  prot,
+			},
+			signed: map[string]bool{
+				"one/1=master": true,
+			},
+		},
 		{
 			name: "complex",
 			updates: []requirements{
@@ -274,6 +369,9 @@ func TestConfigureBranches(t *testing.T) {
 		if !reflect.DeepEqual(fc.updated, tc.sets) {
 			t.Errorf("%s: updates %v != expected %v", tc.name, fc.updated, tc.sets)
 		}
+		if !reflect.DeepEqual(fc.signatures, tc.signed) {
+			t.Errorf("%s: required signatures %v != expected %v", tc.name, fc.signatures, tc.signed)
+		}
 
 	}
 }
@@ -1159,6 +1257,99 @@ branch-protection:
 				},
 			},
 		},
+		{
+			name: "protect branches matching patterns with signed commits",
+			branches: []string{
+				"org/repo=master",
+				"org/repo=release-1.0",
+				"org/repo=release-1.1",
+			},
+			config: `
+branch-protection:
+  orgs:
+    org:
+      repos:
+        repo:
+          required_conversation_resolution: true
+          branch_patterns:
+            release-*:
+              protect: true
+              required_signatures: true
+`,
+			branchProtections: map[string]github.BranchProtection{
+				"org/repo=release-1.1": {
+					RequiredConversationResolution: github.ProtectionSetting{Enabled: true},
+					RequiredSignatures:             github.ProtectionSetting{Enabled: true},
+				},
+			},
+			expected: []requirements{
+				{
+					Org:    "org",
+					Repo:   "repo",
+					Branch: "release-1.0",
+					Request: &github.BranchProtectionRequest{
+						EnforceAdmins:                  &no,
+						RequiredConversationResolution: true,
+					},
+					RequiredSignatures: &yes,
+				},
+			},
+		},
+		{
+			name:     "stop requiring signed commits",
+			branches: []string{"org/repo=master"},
+			config: `
+branch-protection:
+  protect: true
+  required_linear_history: true
+  orgs:
+    org:
+      required_signatures: false
+`,
+			branchProtections: map[string]github.BranchProtection{
+				"org/repo=master": {
+					RequiredLinearHistory: github.ProtectionSetting{Enabled: true},
+					RequiredSignatures:    github.ProtectionSetting{Enabled: true},
+				},
+			},
+			expected: []requirements{
+				{
+					Org:    "org",
+					Repo:   "repo",
+					Branch: "master",
+					Request: &github.BranchProtectionRequest{
+						EnforceAdmins:         &no,
+						RequiredLinearHistory: true,
+					},
+					RequiredSignatures: &no,
+				},
+			},
+		},
+		{
+			name:     "require linear history on protected branch",
+			branches: []string{"org/repo=master"},
+			config: `
+branch-protection:
+  protect: true
+  orgs:
+    org:
+      required_linear_history: true
+`,
+			branchProtections: map[string]github.BranchProtection{
+				"org/repo=master": {},
+			},
+			expected: []requirements{
+				{
+					Org:    "org",
+					Repo:   "repo",
+					Branch: "master",
+					Request: &github.BranchProtectionRequest{
+						EnforceAdmins:         &no,
+						RequiredLinearHistory: true,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -1244,6 +1435,62 @@ branch-protection:
 	}
 }
 
+func TestProtectTags(t *testing.T) {
+	fc := fakeClient{
+		repos: map[string][]github.Repo{"org": {{Name: "repo"}, {Name: "other"}}},
+		branches: map[string][]github.Branch{
+			"org/repo":  {{Name: "master"}},
+			"org/other": {{Name: "master"}},
+		},
+		tagProtections: map[string][]github.TagProtection{
+			"org/repo": {{ID: 10, Pattern: "v*"}, {ID: 11, Pattern: "old-*"}},
+		},
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(`
+branch-protection:
+  orgs:
+    org:
+      protected_tags:
+      - v*
+      repos:
+        repo:
+          protected_tags:
+          - release-*
+`), &cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	p := protector{
+		client:         &fc,
+		cfg:            &cfg,
+		updates:        make(chan requirements),
+		completedRepos: make(map[string]bool),
+	}
+	go func() {
+		p.protect()
+		close(p.updates)
+	}()
+	for range p.updates {
+	}
+	if len(p.errors.errs) != 0 {
+		t.Fatalf("unexpected errors: %v", p.errors.errs)
+	}
+
+	expected := map[string][]string{
+		"org/repo": {"release-*", "v*"},
+	}
+	actual := map[string][]string{}
+	for repo, tps := range fc.tagProtections {
+		for _, tp := range tps {
+			actual[repo] = append(actual[repo], tp.Pattern)
+		}
+		sort.Strings(actual[repo])
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected protected tags %v, got %v", expected, actual)
+	}
+}
+
 func fixup(r *requirements) {
 	if r == nil || r.Request == nil {
 		return
@@ -1448,6 +1695,30 @@ func TestEqualBranchProtection(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "matching settings work",
+			state: &github.BranchProtection{
+				RequiredLinearHistory:          github.ProtectionSetting{Enabled: true},
+				AllowDeletions:                 github.ProtectionSetting{Enabled: true},
+				RequiredConversationResolution: github.ProtectionSetting{Enabled: true},
+			},
+			request: &github.BranchProtectionRequest{
+				RequiredLinearHistory:          true,
+				AllowDeletions:                 true,
+				RequiredConversationResolution: true,
+			},
+			expected: true,
+		},
+		{
+			name: "differing settings don't match",
+			state: &github.BranchProtection{
+				AllowForcePushes: github.ProtectionSetting{Enabled: true},
+			},
+			request: &github.BranchProtectionRequest{
+				RequiredConversationResolution: true,
+			},
+			expected: false,
+		},
 	}
 
 	for _, testCase := range testCases {
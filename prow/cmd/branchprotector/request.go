@@ -27,13 +27,14 @@ import (
 // makeRequest renders a branch protection policy into the corresponding GitHub api request.
 func makeRequest(policy branchprotection.Policy) github.BranchProtectionRequest {
 	return github.BranchProtectionRequest{
-		EnforceAdmins:              makeAdmins(policy.Admins),
-		RequiredPullRequestReviews: makeReviews(policy.RequiredPullRequestReviews),
-		RequiredStatusChecks:       makeChecks(policy.RequiredStatusChecks),
-		Restrictions:               makeRestrictions(policy.Restrictions),
-		RequiredLinearHistory:      makeBool(policy.RequiredLinearHistory),
-		AllowForcePushes:           makeBool(policy.AllowForcePushes),
-		AllowDeletions:             makeBool(policy.AllowDeletions),
+		EnforceAdmins:                  makeAdmins(policy.Admins),
+		RequiredPullRequestReviews:     makeReviews(policy.RequiredPullRequestReviews),
+		RequiredStatusChecks:           makeChecks(policy.RequiredStatusChecks),
+		Restrictions:                   makeRestrictions(policy.Restrictions),
+		RequiredLinearHistory:          makeBool(policy.RequiredLinearHistory),
+		AllowForcePushes:               makeBool(policy.AllowForcePushes),
+		AllowDeletions:                 makeBool(policy.AllowDeletions),
+		RequiredConversationResolution: makeBool(policy.RequiredConversationResolution),
 	}
 
 }
@@ -175,6 +175,17 @@ func TestMakeRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Signatures are not part of the request",
+			policy: branchprotection.Policy{
+				RequiredConversationResolution: &yes,
+				RequiredSignatures:             &yes,
+			},
+			expected: github.BranchProtectionRequest{
+				EnforceAdmins:                  &no,
+				RequiredConversationResolution: true,
+			},
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+// checkResourceRequests finds job containers without resource requests.
+func checkResourceRequests(rc *ruleContext) []finding {
+	var findings []finding
+	check := func(repo string, job config.JobBase) {
+		if job.Spec == nil {
+			return
+		}
+		for i, container := range job.Spec.Containers {
+			if len(container.Resources.Requests) > 0 {
+				continue
+			}
+			name := container.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			findings = append(findings, finding{
+				Message: fmt.Sprintf("job %s: container %s does not request resources", job.Name, name),
+				Repo:    repo,
+				File:    job.SourcePath,
+			})
+		}
+	}
+
+	for _, repo := range sets.StringKeySet(rc.cfg.PresubmitsStatic).List() {
+		for _, job := range rc.cfg.PresubmitsStatic[repo] {
+			check(repo, job.JobBase)
+		}
+	}
+	for _, repo := range sets.StringKeySet(rc.cfg.PostsubmitsStatic).List() {
+		for _, job := range rc.cfg.PostsubmitsStatic[repo] {
+			check(repo, job.JobBase)
+		}
+	}
+	for _, job := range rc.cfg.Periodics {
+		var repo string
+		if len(job.ExtraRefs) > 0 {
+			repo = job.ExtraRefs[0].Org + "/" + job.ExtraRefs[0].Repo
+		}
+		check(repo, job.JobBase)
+	}
+	return findings
+}
+
+// checkRunIfChanged finds jobs whose run_if_changed matches none of the files
+// of their repo, for the repos with a local checkout.
+func checkRunIfChanged(rc *ruleContext) []finding {
+	var findings []finding
+	for _, repo := range sets.StringKeySet(rc.repoPaths).List() {
+		var jobs []config.JobBase
+		var matchers []config.RegexpChangeMatcher
+		for _, job := range rc.cfg.PresubmitsStatic[repo] {
+			jobs, matchers = append(jobs, job.JobBase), append(matchers, job.RegexpChangeMatcher)
+		}
+		for _, job := range rc.cfg.PostsubmitsStatic[repo] {
+			jobs, matchers = append(jobs, job.JobBase), append(matchers, job.RegexpChangeMatcher)
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+
+		files, err := repoFiles(rc.repoPaths[repo])
+		if err != nil {
+			logrus.WithError(err).Warnf("Skipping run_if_changed checks of %s.", repo)
+			continue
+		}
+		for i, job := range jobs {
+			if matchers[i].RunIfChanged == "" {
+				continue
+			}
+			re, err := regexp.Compile(matchers[i].RunIfChanged)
+			if err != nil {
+				// Config validation already rejects invalid regexes.
+				continue
+			}
+			matched := false
+			for _, file := range files {
+				if re.MatchString(file) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				findings = append(findings, finding{
+					Message: fmt.Sprintf("job %s: run_if_changed %q matches no file in %s", job.Name, matchers[i].RunIfChanged, repo),
+					Repo:    repo,
+					File:    job.SourcePath,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// repoFiles lists the files of a checkout, relative to its root.
+func repoFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// checkDuplicateContexts finds required contexts that are listed twice in
+// a branch protection policy, or that a parent policy already requires.
+func checkDuplicateContexts(rc *ruleContext) []finding {
+	bp := rc.cfg.BranchProtection
+	keys := []string{"branch-protection"}
+	findings := duplicateContexts(rc.configPath, "", "branch-protection", keys, nil, bp.Policy)
+	for _, orgName := range sets.StringKeySet(bp.Orgs).List() {
+		org := bp.Orgs[orgName]
+		orgKeys := append(keys[:len(keys):len(keys)], "orgs", orgName)
+		orgParent := policyContexts(bp.Policy)
+		findings = append(findings, duplicateContexts(rc.configPath, orgName, orgName, orgKeys, orgParent, org.Policy)...)
+
+		for _, repoName := range sets.StringKeySet(org.Repos).List() {
+			repo := org.Repos[repoName]
+			fullName := orgName + "/" + repoName
+			repoKeys := append(orgKeys[:len(orgKeys):len(orgKeys)], "repos", repoName)
+			repoParent := orgParent.Union(policyContexts(org.Policy))
+			findings = append(findings, duplicateContexts(rc.configPath, fullName, fullName, repoKeys, repoParent, repo.Policy)...)
+
+			branchParent := repoParent.Union(policyContexts(repo.Policy))
+			for _, level := range []struct {
+				key      string
+				branches map[string]config.Branch
+			}{
+				{key: "branches", branches: repo.Branches},
+				{key: "branch_patterns", branches: repo.BranchPatterns},
+			} {
+				for _, branchName := range sets.StringKeySet(level.branches).List() {
+					branchKeys := append(repoKeys[:len(repoKeys):len(repoKeys)], level.key, branchName)
+					findings = append(findings, duplicateContexts(rc.configPath, fullName, fullName+"="+branchName, branchKeys, branchParent, level.branches[branchName].Policy)...)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// checkUnusedJobTemplates finds job templates that no job or template extends.
+func checkUnusedJobTemplates(rc *ruleContext) []finding {
+	extended := sets.NewString()
+	for _, template := range rc.cfg.JobTemplates {
+		extended.Insert(template.Extends)
+	}
+	for _, jobs := range rc.cfg.PresubmitsStatic {
+		for _, job := range jobs {
+			extended.Insert(job.Extends)
+		}
+	}
+	for _, jobs := range rc.cfg.PostsubmitsStatic {
+		for _, job := range jobs {
+			extended.Insert(job.Extends)
+		}
+	}
+	for _, job := range rc.cfg.Periodics {
+		extended.Insert(job.Extends)
+	}
+
+	var findings []finding
+	for _, template := range rc.cfg.JobTemplates {
+		if !extended.Has(template.Name) {
+			findings = append(findings, finding{
+				Message: fmt.Sprintf("job template %s is not extended by any job or template", template.Name),
+				File:    template.SourcePath,
+			})
+		}
+	}
+	return findings
+}
+
+func policyContexts(p config.Policy) sets.String {
+	if p.RequiredStatusChecks == nil {
+		return sets.NewString()
+	}
+	return sets.NewString(p.RequiredStatusChecks.Contexts...)
+}
+
+// duplicateContexts finds the contexts of a policy that are listed twice, or
+// that are in parent. The fixes remove them from the policy at keys.
+func duplicateContexts(file, repo, name string, keys []string, parent sets.String, p config.Policy) []finding {
+	if p.RequiredStatusChecks == nil {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, context := range p.RequiredStatusChecks.Contexts {
+		counts[context]++
+	}
+	contextKeys := append(keys[:len(keys):len(keys)], "required_status_checks", "contexts")
+
+	var findings []finding
+	for _, context := range sets.StringKeySet(counts).List() {
+		var message string
+		switch {
+		case parent.Has(context):
+			message = fmt.Sprintf("%s requires context %q, which its parent policy already requires", name, context)
+		case counts[context] > 1:
+			message = fmt.Sprintf("%s lists required context %q %d times", name, context, counts[context])
+		default:
+			continue
+		}
+		findings = append(findings, finding{
+			Message: message,
+			Repo:    repo,
+			File:    file,
+			fix:     &sequenceFix{keys: contextKeys, value: context, keepFirst: !parent.Has(context)},
+		})
+	}
+	return findings
+}
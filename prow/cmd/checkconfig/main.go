@@ -71,13 +71,29 @@ type options struct {
 	strict          bool
 	expensive       bool
 
+	enableRules  flagutil.Strings
+	disableRules flagutil.Strings
+	repoPaths    flagutil.Strings
+	fix          bool
+	reportPath   string
+	reportFormat string
+
 	github flagutil.GitHubOptions
 }
 
 func reportWarning(strict bool, errs utilerrors.Aggregate) {
+	var failed bool
 	for _, item := range errs.Errors() {
+		if f, ok := item.(finding); ok && f.Severity == severityError {
+			logrus.Error(item.Error())
+			failed = true
+			continue
+		}
 		logrus.Warn(item.Error())
 	}
+	if failed {
+		logrus.Fatal("There were rule violations with error severity")
+	}
 	if strict {
 		logrus.Fatal("Strict is set and there were warnings")
 	}
@@ -161,6 +177,15 @@ func (o *options) DefaultAndValidate() error {
 			return fmt.Errorf("no such warning %q, valid warnings: %v", warning, allWarnings)
 		}
 	}
+	if _, err := parseRuleSelection(o.enableRules.Strings(), o.disableRules.Strings()); err != nil {
+		return err
+	}
+	if _, err := parseRepoPaths(o.repoPaths.Strings()); err != nil {
+		return err
+	}
+	if o.reportFormat != reportFormatJSON && o.reportFormat != reportFormatSARIF {
+		return fmt.Errorf("--report-format must be one of %q or %q, not %q", reportFormatJSON, reportFormatSARIF, o.reportFormat)
+	}
 	return nil
 }
 
@@ -183,6 +208,12 @@ func (o *options) gatherOptions(flag *flag.FlagSet, args []string) error {
 	flag.Var(&o.excludeWarnings, "exclude-warning", "Warnings to exclude. Use repeatedly to provide a list of warnings to exclude")
 	flag.BoolVar(&o.expensive, "expensive-checks", false, "If set, additional expensive warnings will be enabled")
 	flag.BoolVar(&o.strict, "strict", false, "If set, consider all warnings as errors.")
+	flag.Var(&o.enableRules, "enable-rule", "Rules to enable, none are by default, as <rule> or <rule>=<org>[/<repo>] to enable a rule for an org or repo only. Use repeatedly to provide a list of rules")
+	flag.Var(&o.disableRules, "disable-rule", "Rules to disable, as <rule> or <rule>=<org>[/<repo>] to disable a rule for an org or repo only. Use repeatedly to provide a list of rules")
+	flag.Var(&o.repoPaths, "repo-path", "Local checkout of a repo for rules that check its files, as <org>/<repo>=<path>. Use repeatedly to provide a list of repos")
+	flag.BoolVar(&o.fix, "fix", false, "If set, rewrite the config to fix the findings of rules that support it.")
+	flag.StringVar(&o.reportPath, "report-path", "", "If set, write the warnings and rule findings to this file.")
+	flag.StringVar(&o.reportFormat, "report-format", reportFormatJSON, "Format of the report written to --report-path, json or sarif.")
 	o.github.AddFlags(flag)
 	o.github.AllowAnonymous = true
 	if err := flag.Parse(args); err != nil {
@@ -232,6 +263,15 @@ func validate(o options) error {
 	}
 	cfg := configAgent.Config()
 
+	selection, err := parseRuleSelection(o.enableRules.Strings(), o.disableRules.Strings())
+	if err != nil {
+		return err
+	}
+	repoPaths, err := parseRepoPaths(o.repoPaths.Strings())
+	if err != nil {
+		return err
+	}
+
 	if o.prowYAMLRepoName != "" {
 		if err := validateInRepoConfig(cfg, o.prowYAMLPath, o.prowYAMLRepoName); err != nil {
 			return fmt.Errorf("error validating .prow.yaml: %w", err)
@@ -251,7 +291,7 @@ func validate(o options) error {
 	// presence won't lead to strictly incorrect behavior, so we can
 	// detect them here but don't necessarily want to stop config re-load
 	// in all components on their failure.
-	var errs []error
+	var findings []finding
 	if pcfg != nil && o.warningEnabled(verifyOwnersFilePresence) {
 		if o.github.TokenPath == "" {
 			return errors.New("cannot verify OWNERS file presence without a GitHub token")
@@ -272,61 +312,61 @@ func validate(o options) error {
 		githubClient.SetMax404Retries(0)
 
 		if err := verifyOwnersPresence(pcfg, githubClient); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(verifyOwnersFilePresence, err)...)
 		}
 	}
 	if pcfg != nil && o.warningEnabled(mismatchedTideWarning) {
 		if err := validateTideRequirements(cfg, pcfg, true); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(mismatchedTideWarning, err)...)
 		}
 	} else if pcfg != nil && o.warningEnabled(mismatchedTideLenientWarning) {
 		if err := validateTideRequirements(cfg, pcfg, false); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(mismatchedTideLenientWarning, err)...)
 		}
 	}
 	if o.warningEnabled(nonDecoratedJobsWarning) {
 		if err := validateDecoratedJobs(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(nonDecoratedJobsWarning, err)...)
 		}
 	}
 	if o.warningEnabled(validDecorationConfigWarning) {
 		if err := validateDecorationConfig(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(validDecorationConfigWarning, err)...)
 		}
 	}
 	if o.warningEnabled(jobNameLengthWarning) {
 		if err := validateJobRequirements(cfg.JobConfig); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(jobNameLengthWarning, err)...)
 		}
 	}
 	if o.warningEnabled(jobRefsDuplicationWarning) {
 		if err := validateJobExtraRefs(cfg.JobConfig); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(jobRefsDuplicationWarning, err)...)
 		}
 	}
 	if o.warningEnabled(needsOkToTestWarning) {
 		if err := validateNeedsOkToTestLabel(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(needsOkToTestWarning, err)...)
 		}
 	}
 	if o.warningEnabled(managedWebhooksWarning) {
 		if err := validateManagedWebhooks(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(managedWebhooksWarning, err)...)
 		}
 	}
 	if pcfg != nil && o.warningEnabled(validateOwnersWarning) {
 		if err := verifyOwnersPlugin(pcfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(validateOwnersWarning, err)...)
 		}
 	}
 	if pcfg != nil && o.warningEnabled(missingTriggerWarning) {
 		if err := validateTriggers(cfg, pcfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(missingTriggerWarning, err)...)
 		}
 	}
 	if pcfg != nil && o.warningEnabled(validateURLsWarning) {
 		if err := validateURLs(cfg.ProwConfig); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(validateURLsWarning, err)...)
 		}
 	}
 	if o.warningEnabled(unknownFieldsWarning) {
@@ -335,7 +375,7 @@ func validate(o options) error {
 			return fmt.Errorf("error reading Prow config for validation: %w", err)
 		}
 		if err := validateUnknownFields(&config.Config{}, cfgBytes, o.configPath); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(unknownFieldsWarning, err)...)
 		}
 	}
 	if pcfg != nil && o.warningEnabled(unknownFieldsWarning) {
@@ -344,27 +384,48 @@ func validate(o options) error {
 			return fmt.Errorf("error reading Prow plugin config for validation: %w", err)
 		}
 		if err := validateUnknownFields(&plugins.Configuration{}, pcfgBytes, o.pluginConfig); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(unknownFieldsWarning, err)...)
 		}
 	}
 	if o.warningEnabled(tideStrictBranchWarning) {
 		if err := validateStrictBranches(cfg.ProwConfig); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(tideStrictBranchWarning, err)...)
 		}
 	}
 	if o.warningEnabled(tideContextPolicy) {
 		if err := validateTideContextPolicy(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(tideContextPolicy, err)...)
 		}
 	}
 	if o.warningEnabled(validateClusterFieldWarning) {
 		if err := validateCluster(cfg); err != nil {
-			errs = append(errs, err)
+			findings = append(findings, warningFindings(validateClusterFieldWarning, err)...)
+		}
+	}
+
+	findings = append(findings, runRules(&ruleContext{cfg: cfg, configPath: o.configPath, repoPaths: repoPaths}, selection)...)
+	if o.fix {
+		if findings, err = applyFixes(findings); err != nil {
+			return fmt.Errorf("error fixing config: %w", err)
+		}
+	}
+	if o.reportPath != "" {
+		if err := writeReport(o.reportPath, o.reportFormat, findings); err != nil {
+			return err
 		}
 	}
 
+	var errs []error
+	for _, f := range findings {
+		if f.Severity == severityNote {
+			logrus.Info(f.Error())
+			continue
+		}
+		errs = append(errs, f)
+	}
 	return utilerrors.NewAggregate(errs)
 }
+
 func policyIsStrict(p config.Policy) bool {
 	if p.Protect == nil || !*p.Protect {
 		return false
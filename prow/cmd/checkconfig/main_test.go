@@ -1210,6 +1210,7 @@ func TestOptions(t *testing.T) {
 				excludeWarnings: StringsFlag([]string{"tide-strict-branch", "mismatched-tide", "ok-if-unknown-warning"}),
 				strict:          true,
 				expensive:       false,
+				reportFormat:    "json",
 				github:          defaultGitHubOptions,
 			},
 			expectedError: false,
@@ -1228,10 +1229,57 @@ func TestOptions(t *testing.T) {
 				jobConfigPath:    "config/jobs/org/job.yaml",
 				prowYAMLRepoName: "my/repo",
 				prowYAMLPath:     "/home/prow/go/src/github.com/my/repo/.prow.yaml",
+				reportFormat:     "json",
 				github:           defaultGitHubOptions,
 			},
 			expectedError: false,
 		},
+		{
+			name: "rules and reports",
+			args: []string{
+				"--config-path=prow/config.yaml",
+				"--enable-rule=job-resource-requests",
+				"--disable-rule=duplicate-contexts=org/repo",
+				"--repo-path=org/repo=/src/org/repo",
+				"--fix",
+				"--report-path=report.sarif",
+				"--report-format=sarif",
+			},
+			expectedOptions: &options{
+				configPath:   "prow/config.yaml",
+				enableRules:  StringsFlag([]string{"job-resource-requests"}),
+				disableRules: StringsFlag([]string{"duplicate-contexts=org/repo"}),
+				repoPaths:    StringsFlag([]string{"org/repo=/src/org/repo"}),
+				fix:          true,
+				reportPath:   "report.sarif",
+				reportFormat: "sarif",
+				github:       defaultGitHubOptions,
+			},
+		},
+		{
+			name: "unknown rule, reject",
+			args: []string{
+				"--config-path=prow/config.yaml",
+				"--disable-rule=unknown-rule",
+			},
+			expectedError: true,
+		},
+		{
+			name: "repo path without a repo, reject",
+			args: []string{
+				"--config-path=prow/config.yaml",
+				"--repo-path=org=/src/org",
+			},
+			expectedError: true,
+		},
+		{
+			name: "unknown report format, reject",
+			args: []string{
+				"--config-path=prow/config.yaml",
+				"--report-format=xml",
+			},
+			expectedError: true,
+		},
 		{
 			name: "prow-yaml-path without prow-yaml-repo-name is invalid",
 			args: []string{
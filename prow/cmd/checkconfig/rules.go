@@ -0,0 +1,464 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+// severity is how serious the findings of a rule are. The values match the
+// SARIF result levels.
+type severity string
+
+const (
+	// severityError findings fail checkconfig.
+	severityError severity = "error"
+	// severityWarning findings fail checkconfig if --strict is set.
+	severityWarning severity = "warning"
+	// severityNote findings are only reported.
+	severityNote severity = "note"
+)
+
+// finding is a problem a rule found in the configuration.
+type finding struct {
+	Rule     string   `json:"rule"`
+	Severity severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Repo is the org/repo, or org, the finding is about, if any.
+	Repo string `json:"repo,omitempty"`
+	// File is the config file the finding is about, if known.
+	File string `json:"file,omitempty"`
+	// Fixable is true if --fix rewrites File to address the finding.
+	Fixable bool `json:"fixable,omitempty"`
+
+	fix *sequenceFix
+}
+
+func (f finding) Error() string {
+	return fmt.Sprintf("%s: %s", f.Rule, f.Message)
+}
+
+// warningFindings describes the errors of a warning as findings, so they are
+// reported alongside those of the rules.
+func warningFindings(warning string, err error) []finding {
+	errs := []error{err}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		errs = agg.Errors()
+	}
+	var findings []finding
+	for _, err := range errs {
+		findings = append(findings, finding{Rule: warning, Severity: severityWarning, Message: err.Error()})
+	}
+	return findings
+}
+
+// ruleContext is what rules check.
+type ruleContext struct {
+	cfg        *config.Config
+	configPath string
+	// repoPaths maps org/repo to a local checkout of the repo.
+	repoPaths map[string]string
+}
+
+// rule is a named semantic check of the configuration.
+type rule struct {
+	id          string
+	severity    severity
+	description string
+	// fixable is true if --fix can address some findings of the rule.
+	fixable bool
+	check   func(rc *ruleContext) []finding
+}
+
+// rules are all registered rules, in the order they run. Rules only run where
+// they are enabled with --enable-rule.
+var rules = []rule{
+	{
+		id:          "job-resource-requests",
+		severity:    severityNote,
+		description: "Job containers should request resources so the scheduler can place their pods.",
+		check:       checkResourceRequests,
+	},
+	{
+		id:          "run-if-changed-never-matches",
+		severity:    severityWarning,
+		description: "The run_if_changed of a job should match a file in the repo, otherwise it never runs automatically. Checked for repos given with --repo-path.",
+		check:       checkRunIfChanged,
+	},
+	{
+		id:          "duplicate-contexts",
+		severity:    severityWarning,
+		description: "Branch protection should not list a required context twice, nor one that a parent policy already requires.",
+		fixable:     true,
+		check:       checkDuplicateContexts,
+	},
+	{
+		id:          "unused-job-templates",
+		severity:    severityWarning,
+		description: "Job templates should be extended by a job or another template. Templates only extended by jobs in a .prow.yaml are reported too.",
+		check:       checkUnusedJobTemplates,
+	},
+}
+
+func getRule(id string) (rule, bool) {
+	for _, r := range rules {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// ruleSelection is the rules enabled or disabled by --enable-rule and
+// --disable-rule, each globally or for an org or repo.
+type ruleSelection struct {
+	// enabled and disabled map rule IDs to the scopes they are set for,
+	// where "" is every repo.
+	enabled  map[string]sets.String
+	disabled map[string]sets.String
+}
+
+// parseRuleSelection parses values of --enable-rule and --disable-rule, which
+// are <rule> or <rule>=<org>[/<repo>].
+func parseRuleSelection(enable, disable []string) (ruleSelection, error) {
+	s := ruleSelection{enabled: map[string]sets.String{}, disabled: map[string]sets.String{}}
+	for _, values := range []struct {
+		flag   string
+		scopes map[string]sets.String
+		values []string
+	}{
+		{flag: "--enable-rule", scopes: s.enabled, values: enable},
+		{flag: "--disable-rule", scopes: s.disabled, values: disable},
+	} {
+		for _, value := range values.values {
+			id, scope := value, ""
+			if i := strings.Index(value, "="); i != -1 {
+				id, scope = value[:i], value[i+1:]
+				if scope == "" || strings.Count(scope, "/") > 1 {
+					return s, fmt.Errorf("%s %q: scope must be an org or org/repo", values.flag, value)
+				}
+			}
+			if _, ok := getRule(id); !ok {
+				return s, fmt.Errorf("%s: no such rule %q, valid rules: %v", values.flag, id, ruleIDs())
+			}
+			if values.scopes[id] == nil {
+				values.scopes[id] = sets.NewString()
+			}
+			values.scopes[id].Insert(scope)
+		}
+	}
+	return s, nil
+}
+
+// parseRepoPaths parses values of --repo-path, which are <org>/<repo>=<path>.
+func parseRepoPaths(values []string) (map[string]string, error) {
+	paths := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || strings.Count(parts[0], "/") != 1 {
+			return nil, fmt.Errorf("--repo-path %q: must be <org>/<repo>=<path>", value)
+		}
+		paths[parts[0]] = parts[1]
+	}
+	return paths, nil
+}
+
+func ruleIDs() []string {
+	var ids []string
+	for _, r := range rules {
+		ids = append(ids, r.id)
+	}
+	return ids
+}
+
+// enabledFor determines if a rule applies to findings about an org/repo, org
+// or, for repo "", the config as a whole. The most specific scope decides,
+// and rules are disabled unless enabled.
+func (s ruleSelection) enabledFor(id, repo string) bool {
+	scopes := []string{""}
+	if repo != "" {
+		org := strings.SplitN(repo, "/", 2)[0]
+		scopes = append(scopes, org)
+		if org != repo {
+			scopes = append(scopes, repo)
+		}
+	}
+	enabled := false
+	for _, scope := range scopes {
+		switch {
+		case s.disabled[id].Has(scope):
+			enabled = false
+		case s.enabled[id].Has(scope):
+			enabled = true
+		}
+	}
+	return enabled
+}
+
+// runRules runs the rules enabled anywhere and returns their findings where
+// they are enabled.
+func runRules(rc *ruleContext, selection ruleSelection) []finding {
+	var findings []finding
+	for _, r := range rules {
+		if selection.enabled[r.id].Len() == 0 {
+			continue
+		}
+		for _, f := range r.check(rc) {
+			if !selection.enabledFor(r.id, f.Repo) {
+				continue
+			}
+			f.Rule = r.id
+			f.Severity = r.severity
+			f.Fixable = f.fix != nil
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// sequenceFix removes the repeats of a value from a yaml sequence.
+type sequenceFix struct {
+	// keys lead from the root of the document to the sequence.
+	keys []string
+	// value is the value to remove.
+	value string
+	// keepFirst keeps the first occurrence of the value.
+	keepFirst bool
+}
+
+// apply applies the fix to a yaml document, and returns whether it changed.
+func (f sequenceFix) apply(doc *yaml.Node) bool {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node = node.Content[0]
+	}
+	for _, key := range f.keys {
+		if node.Kind != yaml.MappingNode {
+			return false
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return false
+		}
+		node = next
+	}
+	if node.Kind != yaml.SequenceNode {
+		return false
+	}
+
+	var kept []*yaml.Node
+	seen := false
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode && item.Value == f.value {
+			if !seen && f.keepFirst {
+				seen = true
+				kept = append(kept, item)
+			}
+			continue
+		}
+		kept = append(kept, item)
+	}
+	changed := len(kept) != len(node.Content)
+	node.Content = kept
+	return changed
+}
+
+// applyFixes rewrites the config files to address the fixable findings, and
+// returns the findings that remain.
+func applyFixes(findings []finding) ([]finding, error) {
+	byFile := map[string][]int{}
+	for i, f := range findings {
+		if f.fix != nil && f.File != "" {
+			byFile[f.File] = append(byFile[f.File], i)
+		}
+	}
+
+	fixed := sets.NewInt()
+	for file, indices := range byFile {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		changed := sets.NewInt()
+		for _, i := range indices {
+			if findings[i].fix.apply(&doc) {
+				changed.Insert(i)
+			}
+		}
+		if changed.Len() == 0 {
+			continue
+		}
+		var out bytes.Buffer
+		encoder := yaml.NewEncoder(&out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file, err)
+		}
+		if err := ioutil.WriteFile(file, out.Bytes(), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		logrus.Infof("Fixed %d findings in %s", changed.Len(), file)
+		fixed = fixed.Union(changed)
+	}
+
+	var remaining []finding
+	for i, f := range findings {
+		if !fixed.Has(i) {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining, nil
+}
+
+const (
+	reportFormatJSON  = "json"
+	reportFormatSARIF = "sarif"
+)
+
+// writeReport writes the findings as json or SARIF.
+func writeReport(path, format string, findings []finding) error {
+	sorted := append([]finding(nil), findings...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Rule < sorted[j].Rule })
+
+	var report interface{}
+	switch format {
+	case reportFormatJSON:
+		report = struct {
+			Findings []finding `json:"findings"`
+		}{Findings: sorted}
+	case reportFormatSARIF:
+		report = sarifReport(sorted)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := ioutil.WriteFile(path, append(raw, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report to %s: %w", path, err)
+	}
+	return nil
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level severity `json:"level"`
+	} `json:"defaultConfiguration"`
+	Properties struct {
+		Fixable bool `json:"fixable,omitempty"`
+	} `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     severity        `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver sarifDriver `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifReport describes the findings in SARIF, which CI systems can show as
+// annotations. Warnings are described as rules too.
+func sarifReport(findings []finding) sarifLog {
+	var log sarifLog
+	log.Version = "2.1.0"
+	log.Schema = "https://json.schemastore.org/sarif-2.1.0.json"
+	log.Runs = make([]sarifRun, 1)
+	run := &log.Runs[0]
+	run.Tool.Driver.Name = "checkconfig"
+	run.Tool.Driver.InformationURI = "https://github.com/kubernetes/test-infra/tree/master/prow/cmd/checkconfig"
+
+	addRule := func(id, description string, level severity, fixable bool) {
+		r := sarifRule{ID: id, ShortDescription: sarifMessage{Text: description}}
+		r.DefaultConfiguration.Level = level
+		r.Properties.Fixable = fixable
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, r)
+	}
+	for _, r := range rules {
+		addRule(r.id, r.description, r.severity, r.fixable)
+	}
+	for _, warning := range getAllWarnings() {
+		addRule(warning, fmt.Sprintf("The %s warning.", warning), severityWarning, false)
+	}
+
+	run.Results = []sarifResult{}
+	for _, f := range findings {
+		result := sarifResult{RuleID: f.Rule, Level: f.Severity, Message: sarifMessage{Text: f.Message}}
+		if f.File != "" {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = f.File
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+	return log
+}
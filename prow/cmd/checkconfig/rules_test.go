@@ -0,0 +1,306 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"k8s.io/test-infra/prow/config"
+)
+
+func TestRuleSelection(t *testing.T) {
+	selection, err := parseRuleSelection(
+		[]string{"duplicate-contexts", "duplicate-contexts=org/allowed", "job-resource-requests=org"},
+		[]string{"duplicate-contexts=org", "job-resource-requests=org/repo"},
+	)
+	if err != nil {
+		t.Fatalf("parseRuleSelection() returned error: %v", err)
+	}
+
+	testCases := []struct {
+		rule     string
+		repo     string
+		expected bool
+	}{
+		{rule: "duplicate-contexts", repo: "", expected: true},
+		{rule: "duplicate-contexts", repo: "other/repo", expected: true},
+		{rule: "duplicate-contexts", repo: "org", expected: false},
+		{rule: "duplicate-contexts", repo: "org/repo", expected: false},
+		{rule: "duplicate-contexts", repo: "org/allowed", expected: true},
+		{rule: "job-resource-requests", repo: "", expected: false},
+		{rule: "job-resource-requests", repo: "org/other", expected: true},
+		{rule: "job-resource-requests", repo: "org/repo", expected: false},
+		{rule: "run-if-changed-never-matches", repo: "org/repo", expected: false},
+	}
+	for _, tc := range testCases {
+		if actual := selection.enabledFor(tc.rule, tc.repo); actual != tc.expected {
+			t.Errorf("enabledFor(%q, %q) = %t, expected %t", tc.rule, tc.repo, actual, tc.expected)
+		}
+	}
+
+	for _, bad := range []string{"no-such-rule", "duplicate-contexts=", "duplicate-contexts=a/b/c"} {
+		if _, err := parseRuleSelection([]string{bad}, nil); err == nil {
+			t.Errorf("parseRuleSelection(%q) returned no error", bad)
+		}
+	}
+}
+
+func TestCheckResourceRequests(t *testing.T) {
+	requested := v1.Container{Name: "test", Resources: v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+	}}
+	cfg := &config.Config{JobConfig: config.JobConfig{
+		PresubmitsStatic: map[string][]config.Presubmit{
+			"org/repo": {
+				{JobBase: config.JobBase{Name: "requests", Spec: &v1.PodSpec{Containers: []v1.Container{requested}}}},
+				{JobBase: config.JobBase{Name: "no-requests", SourcePath: "jobs.yaml", Spec: &v1.PodSpec{Containers: []v1.Container{{}}}}},
+				{JobBase: config.JobBase{Name: "jenkins"}},
+			},
+		},
+	}}
+
+	actual := checkResourceRequests(&ruleContext{cfg: cfg})
+	expected := []finding{{Message: "job no-requests: container #0 does not request resources", Repo: "org/repo", File: "jobs.yaml"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("checkResourceRequests() = %#v, expected %#v", actual, expected)
+	}
+}
+
+func TestCheckRunIfChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkconfig")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"prow/main.go", ".git/HEAD"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	presubmit := func(name, runIfChanged string) config.Presubmit {
+		return config.Presubmit{
+			JobBase:             config.JobBase{Name: name},
+			RegexpChangeMatcher: config.RegexpChangeMatcher{RunIfChanged: runIfChanged},
+		}
+	}
+	cfg := &config.Config{JobConfig: config.JobConfig{
+		PresubmitsStatic: map[string][]config.Presubmit{
+			"org/repo":  {presubmit("matches", `^prow/`), presubmit("never", `^docker/`), presubmit("git", `^\.git/`), presubmit("always", "")},
+			"org/other": {presubmit("unchecked", `^docker/`)},
+		},
+	}}
+
+	actual := checkRunIfChanged(&ruleContext{cfg: cfg, repoPaths: map[string]string{"org/repo": dir}})
+	expected := []finding{
+		{Message: `job never: run_if_changed "^docker/" matches no file in org/repo`, Repo: "org/repo"},
+		{Message: `job git: run_if_changed "^\\.git/" matches no file in org/repo`, Repo: "org/repo"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("checkRunIfChanged() = %#v, expected %#v", actual, expected)
+	}
+}
+
+const duplicateContextsConfig = `# Protection for all repos.
+branch-protection:
+  required_status_checks:
+    contexts:
+    - cla
+  orgs:
+    org:
+      required_status_checks:
+        contexts:
+        - cla
+        - unit
+      repos:
+        repo:
+          branches:
+            main:
+              required_status_checks:
+                contexts:
+                - e2e
+                - unit
+                - e2e # listed twice
+`
+
+func TestDuplicateContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkconfig")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(duplicateContextsConfig), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := config.Load(path, "")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	selection, err := parseRuleSelection([]string{"duplicate-contexts"}, nil)
+	if err != nil {
+		t.Fatalf("parseRuleSelection() returned error: %v", err)
+	}
+	findings := runRules(&ruleContext{cfg: cfg, configPath: path}, selection)
+	var messages []string
+	for _, f := range findings {
+		if f.Rule != "duplicate-contexts" {
+			continue
+		}
+		if !f.Fixable || f.Severity != severityWarning || f.File != path {
+			t.Errorf("unexpected finding %#v", f)
+		}
+		messages = append(messages, f.Message)
+	}
+	expectedMessages := []string{
+		`org requires context "cla", which its parent policy already requires`,
+		`org/repo=main lists required context "e2e" 2 times`,
+		`org/repo=main requires context "unit", which its parent policy already requires`,
+	}
+	if !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("messages = %q, expected %q", messages, expectedMessages)
+	}
+
+	if none := runRules(&ruleContext{cfg: cfg, configPath: path}, ruleSelection{}); len(none) != 0 {
+		t.Errorf("expected no findings without enabled rules, got %#v", none)
+	}
+
+	unfixable := finding{Rule: jobNameLengthWarning, Severity: severityWarning, Message: "too long"}
+	remaining, err := applyFixes(append(findings, unfixable))
+	if err != nil {
+		t.Fatalf("applyFixes() returned error: %v", err)
+	}
+	if expected := []finding{unfixable}; !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("applyFixes() left findings %#v, expected %#v", remaining, expected)
+	}
+	fixed, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixed config: %v", err)
+	}
+	expected := `# Protection for all repos.
+branch-protection:
+  required_status_checks:
+    contexts:
+    - cla
+  orgs:
+    org:
+      required_status_checks:
+        contexts:
+        - unit
+      repos:
+        repo:
+          branches:
+            main:
+              required_status_checks:
+                contexts:
+                - e2e
+`
+	if string(fixed) != expected {
+		t.Errorf("fixed config:\n%s\nexpected:\n%s", fixed, expected)
+	}
+}
+
+func TestCheckUnusedJobTemplates(t *testing.T) {
+	cfg := &config.Config{JobConfig: config.JobConfig{
+		JobTemplates: []config.JobTemplate{
+			{JobBase: config.JobBase{Name: "base"}},
+			{JobBase: config.JobBase{Name: "e2e", Extends: "base"}},
+			{JobBase: config.JobBase{Name: "unit"}},
+			{JobBase: config.JobBase{Name: "unused", SourcePath: "templates.yaml"}},
+		},
+		PresubmitsStatic: map[string][]config.Presubmit{
+			"org/repo": {{JobBase: config.JobBase{Name: "pull-unit", Extends: "unit"}}},
+		},
+		Periodics: []config.Periodic{{JobBase: config.JobBase{Name: "ci-e2e", Extends: "e2e"}}},
+	}}
+
+	actual := checkUnusedJobTemplates(&ruleContext{cfg: cfg})
+	expected := []finding{{Message: "job template unused is not extended by any job or template", File: "templates.yaml"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("checkUnusedJobTemplates() = %#v, expected %#v", actual, expected)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkconfig")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	findings := []finding{
+		{Rule: "duplicate-contexts", Severity: severityWarning, Message: "duplicated", File: "config.yaml", Fixable: true},
+		{Rule: jobNameLengthWarning, Severity: severityWarning, Message: "too long"},
+	}
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if err := writeReport(jsonPath, reportFormatJSON, findings); err != nil {
+		t.Fatalf("writeReport() returned error: %v", err)
+	}
+	var report struct {
+		Findings []finding `json:"findings"`
+	}
+	readJSON(t, jsonPath, &report)
+	if !reflect.DeepEqual(report.Findings, findings) {
+		t.Errorf("json report = %#v, expected %#v", report.Findings, findings)
+	}
+
+	sarifPath := filepath.Join(dir, "report.sarif")
+	if err := writeReport(sarifPath, reportFormatSARIF, findings); err != nil {
+		t.Fatalf("writeReport() returned error: %v", err)
+	}
+	var log sarifLog
+	readJSON(t, sarifPath, &log)
+	if len(log.Runs) != 1 {
+		t.Fatalf("expected one run, got %d", len(log.Runs))
+	}
+	if len(log.Runs[0].Tool.Driver.Rules) != len(rules)+len(getAllWarnings()) {
+		t.Errorf("expected the rules and warnings to be described, got %#v", log.Runs[0].Tool.Driver.Rules)
+	}
+	var location sarifLocation
+	location.PhysicalLocation.ArtifactLocation.URI = "config.yaml"
+	expectedResults := []sarifResult{
+		{RuleID: "duplicate-contexts", Level: severityWarning, Message: sarifMessage{Text: "duplicated"}, Locations: []sarifLocation{location}},
+		{RuleID: jobNameLengthWarning, Level: severityWarning, Message: sarifMessage{Text: "too long"}},
+	}
+	if !reflect.DeepEqual(log.Runs[0].Results, expectedResults) {
+		t.Errorf("sarif results = %#v, expected %#v", log.Runs[0].Results, expectedResults)
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", path, err)
+	}
+}
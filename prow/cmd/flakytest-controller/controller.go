@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/flakytest"
+	"k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+	pluginflakytest "k8s.io/test-infra/prow/plugins/flakytest"
+	"k8s.io/test-infra/robots/pr-creator/updater"
+)
+
+// quarantineBranch is the branch of the bot's fork that quarantine pull
+// requests are opened from.
+const quarantineBranch = "flakytest-quarantine"
+
+type githubClient interface {
+	AddLabel(org, repo string, number int, label string) error
+	BotUser() (*github.UserData, error)
+	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
+	EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error)
+	EnsureFork(forkingUser, org, repo string) (string, error)
+	FindAllIssues(query, sort string, asc bool) ([]github.Issue, error)
+	FindIssues(query, sort string, asc bool) ([]github.Issue, error)
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
+	GetIssue(org, repo string, number int) (*github.Issue, error)
+	UpdatePullRequest(org, repo string, number int, title, body *string, open *bool, branch *string, canModify *bool) error
+}
+
+type historyReader interface {
+	Builds(ctx context.Context, job string, since time.Time, max int) ([]flakytest.Build, error)
+}
+
+type controller struct {
+	ghc          githubClient
+	gc           git.ClientFactory
+	history      historyReader
+	config       config.Getter
+	pluginConfig func() *plugins.Configuration
+
+	deckURL   string
+	window    time.Duration
+	maxBuilds int
+	dryRun    bool
+
+	now    func() time.Time
+	logger *logrus.Entry
+}
+
+// sync looks for flaky tests in the presubmits of every repo the flakytest
+// plugin is enabled for, and files, updates and quarantines them.
+func (c *controller) sync(ctx context.Context) error {
+	cfg, pc := c.config(), c.pluginConfig()
+	orgs, repos := pc.EnabledReposForPlugin(pluginflakytest.PluginName)
+	enabledOrgs, enabledRepos := sets.NewString(orgs...), sets.NewString(repos...)
+
+	var orgRepos []string
+	for orgRepo := range cfg.PresubmitsStatic {
+		org := strings.SplitN(orgRepo, "/", 2)[0]
+		if enabledRepos.Has(orgRepo) || enabledOrgs.Has(org) {
+			orgRepos = append(orgRepos, orgRepo)
+		}
+	}
+	sort.Strings(orgRepos)
+
+	var errs []error
+	for _, orgRepo := range orgRepos {
+		parts := strings.SplitN(orgRepo, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		org, repo := parts[0], parts[1]
+		if err := c.syncRepo(ctx, org, repo, cfg.PresubmitsStatic[orgRepo], pc.FlakyTestFor(org, repo)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", orgRepo, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (c *controller) syncRepo(ctx context.Context, org, repo string, presubmits []config.Presubmit, opts *plugins.FlakyTest) error {
+	log := c.logger.WithFields(logrus.Fields{"org": org, "repo": repo})
+	since := c.now().Add(-c.window)
+
+	var flakes []flakytest.Flake
+	for _, ps := range presubmits {
+		builds, err := c.history.Builds(ctx, ps.Name, since, c.maxBuilds)
+		if err != nil {
+			log.WithError(err).WithField("job", ps.Name).Warn("Failed to read job history.")
+			continue
+		}
+		flakes = append(flakes, flakytest.Detect(ps.Name, builds, opts.MinFlakes)...)
+	}
+	log.Infof("Found %d flaky tests.", len(flakes))
+	if len(flakes) == 0 {
+		return nil
+	}
+
+	issues, err := c.ghc.FindAllIssues(flakytest.IssueQuery(org, repo, opts.Label), "", false)
+	if err != nil {
+		return fmt.Errorf("failed to search for flaky test issues: %v", err)
+	}
+	tracked := map[string]github.Issue{}
+	for _, issue := range issues {
+		if job, test, ok := flakytest.ParseMarker(issue.Body); ok {
+			tracked[flakytest.Marker(job, test)] = issue
+		}
+	}
+
+	var errs []error
+	for _, flake := range flakes {
+		body := flakytest.IssueBody(flake, c.link)
+		issue, exists := tracked[flakytest.Marker(flake.Job, flake.Test)]
+		switch {
+		case !exists:
+			number, err := c.ghc.CreateIssue(org, repo, flakytest.IssueTitle(flake), body, 0, []string{opts.Label}, nil)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to file issue for %s in %s: %v", flake.Test, flake.Job, err))
+				continue
+			}
+			log.WithField("issue", number).Infof("Filed issue for %s in %s.", flake.Test, flake.Job)
+		case issue.Body != body:
+			issue.Body = body
+			if _, err := c.ghc.EditIssue(org, repo, issue.Number, &issue); err != nil {
+				errs = append(errs, fmt.Errorf("failed to update issue #%d: %v", issue.Number, err))
+			}
+		}
+	}
+
+	if opts.QuarantineFile != "" {
+		if err := c.quarantine(org, repo, opts, flakes, log); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// quarantine opens or updates a pull request adding every flaky test that
+// is not yet quarantined to the repo's quarantine file.
+func (c *controller) quarantine(org, repo string, opts *plugins.FlakyTest, flakes []flakytest.Flake, log *logrus.Entry) error {
+	content, err := c.ghc.GetFile(org, repo, opts.QuarantineFile, opts.QuarantineBranch)
+	if _, notFound := err.(*github.FileNotFound); err != nil && !notFound {
+		return fmt.Errorf("failed to get %s: %v", opts.QuarantineFile, err)
+	}
+	quarantined := parseQuarantineFile(content)
+	missing := sets.NewString()
+	for _, flake := range flakes {
+		if !quarantined.Has(flake.Test) {
+			missing.Insert(flake.Test)
+		}
+	}
+	if missing.Len() == 0 {
+		return nil
+	}
+	if c.dryRun {
+		log.Infof("Would quarantine %d tests in %s: %v", missing.Len(), opts.QuarantineFile, missing.List())
+		return nil
+	}
+
+	botUser, err := c.ghc.BotUser()
+	if err != nil {
+		return fmt.Errorf("failed to get bot user: %v", err)
+	}
+	if _, err := c.ghc.EnsureFork(botUser.Login, org, repo); err != nil {
+		return fmt.Errorf("failed to fork %s/%s: %v", org, repo, err)
+	}
+	r, err := c.gc.ClientFor(org, repo)
+	if err != nil {
+		return fmt.Errorf("failed to clone %s/%s: %v", org, repo, err)
+	}
+	defer func() {
+		if err := r.Clean(); err != nil {
+			log.WithError(err).Error("Error cleaning up repo.")
+		}
+	}()
+	if err := r.Checkout(opts.QuarantineBranch); err != nil {
+		return fmt.Errorf("failed to checkout %s: %v", opts.QuarantineBranch, err)
+	}
+	if err := r.CheckoutNewBranch(quarantineBranch); err != nil {
+		return fmt.Errorf("failed to create branch %s: %v", quarantineBranch, err)
+	}
+	if err := appendTests(filepath.Join(r.Directory(), opts.QuarantineFile), missing.List()); err != nil {
+		return err
+	}
+	if err := r.Config("user.name", botUser.Login); err != nil {
+		return err
+	}
+	if err := r.Config("user.email", botUser.Email); err != nil {
+		return err
+	}
+	title := fmt.Sprintf("Quarantine %d flaky tests", missing.Len())
+	body := quarantineBody(missing.List())
+	if err := r.Commit(title, body); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	if err := r.PushToFork(quarantineBranch, true); err != nil {
+		return fmt.Errorf("failed to push: %v", err)
+	}
+	source := fmt.Sprintf("%s:%s", botUser.Login, quarantineBranch)
+	number, err := updater.EnsurePR(org, repo, title, body, source, opts.QuarantineBranch, quarantineBranch, updater.AllowMods, c.ghc)
+	if err != nil {
+		return fmt.Errorf("failed to ensure quarantine pull request: %v", err)
+	}
+	log.WithField("pr", *number).Infof("Quarantining %d tests.", missing.Len())
+	return nil
+}
+
+// parseQuarantineFile returns the tests listed in a quarantine file, which
+// holds one test per line. Blank lines and lines starting with # are ignored.
+func parseQuarantineFile(content []byte) sets.String {
+	tests := sets.NewString()
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tests.Insert(line)
+	}
+	return tests
+}
+
+func appendTests(path string, tests []string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, []byte(strings.Join(tests, "\n")+"\n")...)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+func quarantineBody(tests []string) string {
+	var b strings.Builder
+	b.WriteString("The following tests were found to flake in presubmits and are added to the quarantine list:\n\n")
+	for _, test := range tests {
+		fmt.Fprintf(&b, "- `%s`\n", test)
+	}
+	b.WriteString("\nTheir tracking issues carry the details. Remove a test from the list once its issue is fixed.\n")
+	return b.String()
+}
+
+// link returns the URL a build is listed with in tracking issues.
+func (c *controller) link(b flakytest.Build) string {
+	if c.deckURL == "" {
+		return b.Path
+	}
+	return fmt.Sprintf("%s/view/%s", strings.TrimSuffix(c.deckURL, "/"), strings.Replace(b.Path, "://", "/", 1))
+}
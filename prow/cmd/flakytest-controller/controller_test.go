@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/flakytest"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// fakeGitHub adds the fork handling the controller needs to the fake client.
+type fakeGitHub struct {
+	*fakegithub.FakeClient
+}
+
+func (f fakeGitHub) EnsureFork(forkingUser, org, repo string) (string, error) {
+	return repo, nil
+}
+
+type fakeHistory map[string][]flakytest.Build
+
+func (f fakeHistory) Builds(_ context.Context, job string, _ time.Time, _ int) ([]flakytest.Build, error) {
+	return f[job], nil
+}
+
+func flakyBuilds(test string) []flakytest.Build {
+	var builds []flakytest.Build
+	for _, rev := range []string{"a", "b"} {
+		builds = append(builds,
+			flakytest.Build{ID: rev + "1", Path: "gs://bucket/" + rev + "1", Pull: "1", Revision: rev, Tests: map[string]flakytest.TestResult{test: flakytest.TestFailed}},
+			flakytest.Build{ID: rev + "2", Path: "gs://bucket/" + rev + "2", Pull: "1", Revision: rev, Tests: map[string]flakytest.TestResult{test: flakytest.TestPassed}},
+		)
+	}
+	return builds
+}
+
+func TestSync(t *testing.T) {
+	cfg := &config.Config{JobConfig: config.JobConfig{PresubmitsStatic: map[string][]config.Presubmit{
+		"org/repo":     {{JobBase: config.JobBase{Name: "pull-unit"}}, {JobBase: config.JobBase{Name: "pull-e2e"}}},
+		"org/disabled": {{JobBase: config.JobBase{Name: "pull-other"}}},
+	}}}
+	pc := &plugins.Configuration{
+		Plugins: map[string][]string{"org/repo": {"flakytest"}},
+		FlakyTest: []plugins.FlakyTest{{
+			Repos:          []string{"org/repo"},
+			QuarantineFile: "hack/quarantine.txt",
+		}},
+	}
+	history := fakeHistory{
+		"pull-unit":  flakyBuilds("TestNew"),
+		"pull-e2e":   flakyBuilds("TestTracked"),
+		"pull-other": flakyBuilds("TestIgnored"),
+	}
+	staleIssue := &github.Issue{Number: 3, Body: flakytest.Marker("pull-e2e", "TestTracked") + "\nstale"}
+	fc := &fakegithub.FakeClient{
+		Issues: map[int]*github.Issue{3: staleIssue},
+		RemoteFiles: map[string]map[string]string{
+			"hack/quarantine.txt": {"master": "# quarantined tests\nTestTracked\n"},
+		},
+	}
+
+	c := &controller{
+		ghc:          fakeGitHub{fc},
+		history:      history,
+		config:       func() *config.Config { return cfg },
+		pluginConfig: func() *plugins.Configuration { return pc },
+		deckURL:      "https://prow.k8s.io/",
+		window:       time.Hour,
+		maxBuilds:    10,
+		dryRun:       true,
+		now:          time.Now,
+		logger:       logrus.WithField("component", "flakytest-controller"),
+	}
+	if err := c.sync(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fc.Issues) != 2 {
+		t.Fatalf("expected one new issue, got %v", fc.Issues)
+	}
+	created := fc.Issues[1]
+	if created.Title != "Flaky test: TestNew in pull-unit" {
+		t.Errorf("unexpected title %q", created.Title)
+	}
+	if job, test, ok := flakytest.ParseMarker(created.Body); !ok || job != "pull-unit" || test != "TestNew" {
+		t.Errorf("unexpected marker in body %q", created.Body)
+	}
+	if !strings.Contains(created.Body, "(https://prow.k8s.io/view/gs/bucket/a1)") {
+		t.Errorf("expected body to link build through deck, got %q", created.Body)
+	}
+	if diff := cmp.Diff([]github.Label{{Name: "kind/flake"}}, created.Labels); diff != "" {
+		t.Errorf("unexpected labels (-want +got):\n%s", diff)
+	}
+	if strings.Contains(fc.Issues[3].Body, "stale") {
+		t.Errorf("expected tracked issue to be updated, got %q", fc.Issues[3].Body)
+	}
+	if len(fc.PullRequests) != 0 {
+		t.Errorf("expected no quarantine pull request in dry-run mode, got %v", fc.PullRequests)
+	}
+}
+
+func TestParseQuarantineFile(t *testing.T) {
+	tests := parseQuarantineFile([]byte("# comment\nTestA\n\n  TestB  \n"))
+	if diff := cmp.Diff([]string{"TestA", "TestB"}, tests.List()); diff != "" {
+		t.Errorf("unexpected tests (-want +got):\n%s", diff)
+	}
+}
+
+func TestAppendTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flakytest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hack", "quarantine.txt")
+	if err := appendTests(path, []string{"TestA"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("TestA"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := appendTests(path, []string{"TestB", "TestC"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if diff := cmp.Diff("TestA\nTestB\nTestC\n", string(content)); diff != "" {
+		t.Errorf("unexpected content (-want +got):\n%s", diff)
+	}
+}
@@ -208,7 +208,10 @@ func main() {
 	resolver := func(org, repo string) ownersconfig.Filenames {
 		return pluginAgent.Config().OwnersFilenames(org, repo)
 	}
-	ownersClient := repoowners.NewClient(git.ClientFactoryFrom(gitClient), githubClient, mdYAMLEnabled, skipCollaborators, ownersDirBlacklist, resolver)
+	codeOwners := func(org, repo string) ownersconfig.CodeOwnersPrecedence {
+		return pluginAgent.Config().CodeOwnersPrecedence(org, repo)
+	}
+	ownersClient := repoowners.NewClient(git.ClientFactoryFrom(gitClient), githubClient, mdYAMLEnabled, skipCollaborators, ownersDirBlacklist, resolver, codeOwners)
 
 	clientAgent := &plugins.ClientAgent{
 		GitHubClient:              githubClient,
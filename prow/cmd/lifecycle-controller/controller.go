@@ -0,0 +1,262 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+var (
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lifecycle_transitions_total",
+		Help: "Number of issues and pull requests moved to a lifecycle state, dry runs included.",
+	}, []string{"org", "repo", "transition", "dry_run"})
+	syncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lifecycle_sync_errors_total",
+		Help: "Number of failed searches and transitions.",
+	}, []string{"scope"})
+)
+
+func init() {
+	prometheus.MustRegister(transitions)
+	prometheus.MustRegister(syncErrors)
+}
+
+type githubClient interface {
+	AddLabel(org, repo string, number int, label string) error
+	CloseIssue(org, repo string, number int) error
+	ClosePR(org, repo string, number int) error
+	CreateComment(org, repo string, number int, comment string) error
+	FindIssues(query, sort string, asc bool) ([]github.Issue, error)
+	RemoveLabel(org, repo string, number int, label string) error
+}
+
+type controller struct {
+	ghc          githubClient
+	pluginConfig func() *plugins.Configuration
+	dryRun       bool
+
+	now    func() time.Time
+	logger *logrus.Entry
+}
+
+// transition moves matching issues and PRs from one lifecycle state to the
+// next one.
+type transition struct {
+	name string
+	// query selects the issues and PRs in the state to move from.
+	query string
+	// inactive is how long they must be inactive to be moved.
+	inactive func(*plugins.Lifecycle) time.Duration
+	apply    func(ghc githubClient, org, repo string, issue github.Issue, opts *plugins.Lifecycle) error
+}
+
+// Rotten issues and PRs are closed before stale ones rot so that none moves
+// more than one state per sync, even though moving updates them anyway.
+var lifecycleTransitions = []transition{
+	{
+		name:     "close",
+		query:    fmt.Sprintf("label:%s", labels.LifecycleRotten),
+		inactive: func(l *plugins.Lifecycle) time.Duration { return l.CloseAfterDuration },
+		apply: func(ghc githubClient, org, repo string, issue github.Issue, l *plugins.Lifecycle) error {
+			if err := ghc.CreateComment(org, repo, issue.Number, closeComment(issue, l)); err != nil {
+				return err
+			}
+			if issue.IsPullRequest() {
+				return ghc.ClosePR(org, repo, issue.Number)
+			}
+			return ghc.CloseIssue(org, repo, issue.Number)
+		},
+	},
+	{
+		name:     "rotten",
+		query:    fmt.Sprintf("label:%s -label:%s", labels.LifecycleStale, labels.LifecycleRotten),
+		inactive: func(l *plugins.Lifecycle) time.Duration { return l.RottenAfterDuration },
+		apply: func(ghc githubClient, org, repo string, issue github.Issue, l *plugins.Lifecycle) error {
+			if err := ghc.AddLabel(org, repo, issue.Number, labels.LifecycleRotten); err != nil {
+				return err
+			}
+			if err := ghc.RemoveLabel(org, repo, issue.Number, labels.LifecycleStale); err != nil {
+				return err
+			}
+			return ghc.CreateComment(org, repo, issue.Number, rottenComment(issue, l))
+		},
+	},
+	{
+		name:     "stale",
+		query:    fmt.Sprintf("-label:%s -label:%s", labels.LifecycleStale, labels.LifecycleRotten),
+		inactive: func(l *plugins.Lifecycle) time.Duration { return l.StaleAfterDuration },
+		apply: func(ghc githubClient, org, repo string, issue github.Issue, l *plugins.Lifecycle) error {
+			if err := ghc.AddLabel(org, repo, issue.Number, labels.LifecycleStale); err != nil {
+				return err
+			}
+			return ghc.CreateComment(org, repo, issue.Number, staleComment(issue, l))
+		},
+	},
+}
+
+// sync ages the issues and PRs of every org and repo with lifecycle config.
+func (c *controller) sync() error {
+	pc := c.pluginConfig()
+	var errs []error
+	for i := range pc.Lifecycle {
+		opts := &pc.Lifecycle[i]
+		for _, scope := range opts.Repos {
+			if err := c.syncScope(scope, searchScope(scope, pc.Lifecycle), opts); err != nil {
+				syncErrors.WithLabelValues(scope).Inc()
+				errs = append(errs, fmt.Errorf("%s: %v", scope, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// searchScope returns the search qualifiers selecting the org or repo. Repos
+// with their own config are excluded from their org.
+func searchScope(scope string, lifecycles []plugins.Lifecycle) string {
+	if strings.Contains(scope, "/") {
+		return "repo:" + scope
+	}
+	qualifiers := []string{"org:" + scope}
+	for _, l := range lifecycles {
+		for _, orgRepo := range l.Repos {
+			if strings.HasPrefix(orgRepo, scope+"/") {
+				qualifiers = append(qualifiers, "-repo:"+orgRepo)
+			}
+		}
+	}
+	return strings.Join(qualifiers, " ")
+}
+
+// baseQuery returns the search query selecting the open issues and PRs of
+// the scope that are not exempt from aging.
+func baseQuery(scope string, opts *plugins.Lifecycle) string {
+	parts := []string{scope, "is:open", "archived:false", "-label:" + labels.LifecycleFrozen}
+	for _, label := range opts.ExemptLabels {
+		parts = append(parts, fmt.Sprintf("-label:%q", label))
+	}
+	for _, milestone := range opts.ExemptMilestones {
+		parts = append(parts, fmt.Sprintf("-milestone:%q", milestone))
+	}
+	switch {
+	case opts.SkipIssues:
+		parts = append(parts, "is:pr")
+	case opts.SkipPullRequests:
+		parts = append(parts, "is:issue")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *controller) syncScope(name, scope string, opts *plugins.Lifecycle) error {
+	log := c.logger.WithField("scope", name)
+	base := baseQuery(scope, opts)
+	now := c.now()
+	dryRun := c.dryRun || opts.DryRun
+
+	var errs []error
+	for _, t := range lifecycleTransitions {
+		query := fmt.Sprintf("%s %s updated:<=%s", base, t.query, now.Add(-t.inactive(opts)).Format(time.RFC3339))
+		// The search returns a single page, the least recently updated issues
+		// come first and the rest are handled by the next syncs.
+		issues, err := c.ghc.FindIssues(query, "updated", true)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to search for issues to %s: %v", t.name, err))
+			continue
+		}
+		for _, issue := range issues {
+			org, repo, err := orgRepo(issue)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			l := log.WithFields(logrus.Fields{"org": org, "repo": repo, "number": issue.Number, "transition": t.name})
+			transitions.WithLabelValues(org, repo, t.name, strconv.FormatBool(dryRun)).Inc()
+			if dryRun {
+				l.Info("Would move inactive issue to its next lifecycle state.")
+				continue
+			}
+			if err := t.apply(c.ghc, org, repo, issue, opts); err != nil {
+				errs = append(errs, fmt.Errorf("failed to %s %s/%s#%d: %v", t.name, org, repo, issue.Number, err))
+				continue
+			}
+			l.Info("Moved inactive issue to its next lifecycle state.")
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// orgRepo returns the org and repo of an issue found by search, which is
+// only given by its URL.
+func orgRepo(issue github.Issue) (string, string, error) {
+	u, err := url.Parse(issue.HTMLURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse URL of issue #%d: %v", issue.Number, err)
+	}
+	// The path is /org/repo/issues/number or /org/repo/pull/number.
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return "", "", fmt.Errorf("unexpected URL of issue #%d: %q", issue.Number, issue.HTMLURL)
+	}
+	return parts[len(parts)-4], parts[len(parts)-3], nil
+}
+
+func kind(issue github.Issue) string {
+	if issue.IsPullRequest() {
+		return "PRs"
+	}
+	return "issues"
+}
+
+func staleComment(issue github.Issue, l *plugins.Lifecycle) string {
+	return fmt.Sprintf(`Issues go stale after %s of inactivity.
+Mark the issue as fresh with `+"`/remove-lifecycle stale`"+`.
+Stale %s rot after an additional %s of inactivity and eventually close.
+
+If this issue is safe to close now please do so with `+"`/close`"+`.
+
+Prevent aging of this issue with `+"`/lifecycle frozen`"+`.`, plugins.FormatDays(l.StaleAfterDuration), kind(issue), plugins.FormatDays(l.RottenAfterDuration))
+}
+
+func rottenComment(issue github.Issue, l *plugins.Lifecycle) string {
+	return fmt.Sprintf(`Stale %s rot after %s of inactivity.
+Mark the issue as fresh with `+"`/remove-lifecycle rotten`"+`.
+Rotten %s close after an additional %s of inactivity.
+
+If this issue is safe to close now please do so with `+"`/close`"+`.
+
+Prevent aging of this issue with `+"`/lifecycle frozen`"+`.`, kind(issue), plugins.FormatDays(l.RottenAfterDuration), kind(issue), plugins.FormatDays(l.CloseAfterDuration))
+}
+
+func closeComment(issue github.Issue, l *plugins.Lifecycle) string {
+	return fmt.Sprintf(`Rotten %s close after %s of inactivity.
+Reopen the issue with `+"`/reopen`"+`.
+Mark the issue as fresh with `+"`/remove-lifecycle rotten`"+`.
+
+/close`, kind(issue), plugins.FormatDays(l.CloseAfterDuration))
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// fakeGitHub returns the issues of the transition a search query is for and
+// records mutating calls.
+type fakeGitHub struct {
+	search  map[string][]github.Issue
+	queries []string
+	calls   []string
+}
+
+func (f *fakeGitHub) FindIssues(query, sort string, asc bool) ([]github.Issue, error) {
+	f.queries = append(f.queries, query)
+	for part, issues := range f.search {
+		if strings.Contains(query, " "+part+" updated:") {
+			return issues, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeGitHub) AddLabel(org, repo string, number int, label string) error {
+	f.calls = append(f.calls, fmt.Sprintf("add %s/%s#%d:%s", org, repo, number, label))
+	return nil
+}
+
+func (f *fakeGitHub) RemoveLabel(org, repo string, number int, label string) error {
+	f.calls = append(f.calls, fmt.Sprintf("remove %s/%s#%d:%s", org, repo, number, label))
+	return nil
+}
+
+func (f *fakeGitHub) CreateComment(org, repo string, number int, comment string) error {
+	f.calls = append(f.calls, fmt.Sprintf("comment %s/%s#%d", org, repo, number))
+	return nil
+}
+
+func (f *fakeGitHub) CloseIssue(org, repo string, number int) error {
+	f.calls = append(f.calls, fmt.Sprintf("close issue %s/%s#%d", org, repo, number))
+	return nil
+}
+
+func (f *fakeGitHub) ClosePR(org, repo string, number int) error {
+	f.calls = append(f.calls, fmt.Sprintf("close PR %s/%s#%d", org, repo, number))
+	return nil
+}
+
+func TestBaseQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		scope    string
+		opts     plugins.Lifecycle
+		expected string
+	}{
+		{
+			name:     "defaults",
+			scope:    "repo:org/repo",
+			expected: "repo:org/repo is:open archived:false -label:lifecycle/frozen",
+		},
+		{
+			name:  "exemptions and issues only",
+			scope: "org:org",
+			opts: plugins.Lifecycle{
+				ExemptLabels:     []string{"priority/important-soon", "help wanted"},
+				ExemptMilestones: []string{"v1.0"},
+				SkipPullRequests: true,
+			},
+			expected: `org:org is:open archived:false -label:lifecycle/frozen -label:"priority/important-soon" -label:"help wanted" -milestone:"v1.0" is:issue`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := baseQuery(tc.scope, &tc.opts); got != tc.expected {
+				t.Errorf("expected query %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSearchScope(t *testing.T) {
+	lifecycles := []plugins.Lifecycle{
+		{Repos: []string{"org", "other"}},
+		{Repos: []string{"org/repo", "org-two/repo"}},
+	}
+	for scope, expected := range map[string]string{
+		"org":      "org:org -repo:org/repo",
+		"other":    "org:other",
+		"org/repo": "repo:org/repo",
+	} {
+		if got := searchScope(scope, lifecycles); got != expected {
+			t.Errorf("expected search scope %q for %s, got %q", expected, scope, got)
+		}
+	}
+}
+
+func TestOrgRepo(t *testing.T) {
+	for _, tc := range []struct {
+		url, org, repo string
+		expectErr      bool
+	}{
+		{url: "https://github.com/org/repo/issues/1", org: "org", repo: "repo"},
+		{url: "https://github.example.com/org/repo/pull/2", org: "org", repo: "repo"},
+		{url: "https://github.com/org/repo", expectErr: true},
+	} {
+		org, repo, err := orgRepo(github.Issue{HTMLURL: tc.url})
+		if (err != nil) != tc.expectErr {
+			t.Errorf("%s: expected error %t, got %v", tc.url, tc.expectErr, err)
+		}
+		if org != tc.org || repo != tc.repo {
+			t.Errorf("%s: expected %s/%s, got %s/%s", tc.url, tc.org, tc.repo, org, repo)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	issue := func(number int, pr bool) github.Issue {
+		i := github.Issue{Number: number, HTMLURL: fmt.Sprintf("https://github.com/org/repo/issues/%d", number)}
+		if pr {
+			i.PullRequest = &struct{}{}
+		}
+		return i
+	}
+	search := map[string][]github.Issue{
+		"label:lifecycle/rotten":                         {issue(1, false), issue(2, true)},
+		"label:lifecycle/stale -label:lifecycle/rotten":  {issue(3, false)},
+		"-label:lifecycle/stale -label:lifecycle/rotten": {issue(4, true)},
+	}
+
+	testCases := []struct {
+		name          string
+		dryRun        bool
+		configDryRun  bool
+		expectedCalls []string
+	}{
+		{
+			name: "transitions",
+			expectedCalls: []string{
+				"comment org/repo#1",
+				"close issue org/repo#1",
+				"comment org/repo#2",
+				"close PR org/repo#2",
+				"add org/repo#3:lifecycle/rotten",
+				"remove org/repo#3:lifecycle/stale",
+				"comment org/repo#3",
+				"add org/repo#4:lifecycle/stale",
+				"comment org/repo#4",
+			},
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+		},
+		{
+			name:         "dry run in config",
+			configDryRun: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pc := &plugins.Configuration{Lifecycle: []plugins.Lifecycle{{
+				Repos:  []string{"org/repo"},
+				DryRun: tc.configDryRun,
+			}}}
+			if err := pc.Validate(); err != nil {
+				t.Fatalf("invalid config: %v", err)
+			}
+			ghc := &fakeGitHub{search: search}
+			c := &controller{
+				ghc:          ghc,
+				pluginConfig: func() *plugins.Configuration { return pc },
+				dryRun:       tc.dryRun,
+				now:          func() time.Time { return now },
+				logger:       logrus.WithField("component", "lifecycle-controller"),
+			}
+			if err := c.sync(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectedCalls, ghc.calls); diff != "" {
+				t.Errorf("unexpected calls (-want +got):\n%s", diff)
+			}
+
+			expectedQueries := []string{
+				"repo:org/repo is:open archived:false -label:lifecycle/frozen label:lifecycle/rotten updated:<=2021-01-30T00:00:00Z",
+				"repo:org/repo is:open archived:false -label:lifecycle/frozen label:lifecycle/stale -label:lifecycle/rotten updated:<=2021-01-30T00:00:00Z",
+				"repo:org/repo is:open archived:false -label:lifecycle/frozen -label:lifecycle/stale -label:lifecycle/rotten updated:<=2020-12-01T00:00:00Z",
+			}
+			if diff := cmp.Diff(expectedQueries, ghc.queries); diff != "" {
+				t.Errorf("unexpected queries (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
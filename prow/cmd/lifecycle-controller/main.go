@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/interrupts"
+	"k8s.io/test-infra/prow/logrusutil"
+	"k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+const (
+	defaultTokens = 300
+	defaultBurst  = 100
+)
+
+type options struct {
+	configPath    string
+	jobConfigPath string
+	pluginConfig  string
+
+	interval time.Duration
+
+	dryRun                 bool
+	github                 prowflagutil.GitHubOptions
+	instrumentationOptions prowflagutil.InstrumentationOptions
+	tokenBurst             int
+	tokensPerHour          int
+}
+
+func gatherOptions(fs *flag.FlagSet, args ...string) options {
+	o := options{}
+	fs.StringVar(&o.configPath, "config-path", "/etc/config/config.yaml", "Path to config.yaml.")
+	fs.StringVar(&o.jobConfigPath, "job-config-path", "", "Path to prow job configs.")
+	fs.StringVar(&o.pluginConfig, "plugin-config", "/etc/plugins/plugins.yaml", "Path to plugin config file.")
+	fs.DurationVar(&o.interval, "interval", time.Hour, "How often to age inactive issues and PRs. Runs once and exits if zero.")
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Whether or not to make mutating API calls to GitHub.")
+	fs.IntVar(&o.tokensPerHour, "tokens", defaultTokens, "Throttle hourly token consumption (0 to disable)")
+	fs.IntVar(&o.tokenBurst, "token-burst", defaultBurst, "Allow consuming a subset of hourly tokens in a short burst")
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.instrumentationOptions} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+	return o
+}
+
+func (o *options) Validate() error {
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.instrumentationOptions} {
+		if err := group.Validate(o.dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	logrusutil.ComponentInit()
+
+	o := gatherOptions(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:]...)
+	if err := o.Validate(); err != nil {
+		logrus.WithError(err).Fatal("Invalid options")
+	}
+
+	pjutil.ServePProf(o.instrumentationOptions.PProfPort)
+
+	configAgent := &config.Agent{}
+	if err := configAgent.Start(o.configPath, o.jobConfigPath); err != nil {
+		logrus.WithError(err).Fatal("Error starting config agent.")
+	}
+
+	pluginAgent := &plugins.ConfigAgent{}
+	if err := pluginAgent.Start(o.pluginConfig, false); err != nil {
+		logrus.WithError(err).Fatal("Error starting plugin configuration agent.")
+	}
+
+	secretAgent := &secret.Agent{}
+	if err := secretAgent.Start([]string{o.github.TokenPath}); err != nil {
+		logrus.WithError(err).Fatal("Error starting secrets agent.")
+	}
+
+	githubClient, err := o.github.GitHubClient(secretAgent, o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting GitHub client.")
+	}
+	if o.tokensPerHour > 0 {
+		githubClient.Throttle(o.tokensPerHour, o.tokenBurst)
+	}
+
+	metrics.ExposeMetrics("lifecycle-controller", configAgent.Config().PushGateway, o.instrumentationOptions.MetricsPort)
+
+	c := &controller{
+		ghc:          githubClient,
+		pluginConfig: pluginAgent.Config,
+		dryRun:       o.dryRun,
+		now:          time.Now,
+		logger:       logrus.WithField("component", "lifecycle-controller"),
+	}
+
+	if o.interval == 0 {
+		if err := c.sync(); err != nil {
+			logrus.WithError(err).Fatal("Error aging issues and PRs.")
+		}
+		return
+	}
+
+	defer interrupts.WaitForGracefulShutdown()
+	interrupts.TickLiteral(func() {
+		start := time.Now()
+		if err := c.sync(); err != nil {
+			c.logger.WithError(err).Error("Error aging issues and PRs.")
+		}
+		c.logger.WithField("duration", time.Since(start).String()).Info("Aged issues and PRs.")
+	}, o.interval)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/interrupts"
+	"k8s.io/test-infra/prow/metrics"
+)
+
+// driftIssueTitle is the title of the issue listing the drift, which is how
+// the issue is found again after a restart.
+const driftIssueTitle = "Peribolos: GitHub has drifted from the org config"
+
+var (
+	driftChanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peribolos_drift_changes",
+		Help: "Number of changes configuring the org would make to GitHub, by kind and action.",
+	}, []string{"org", "kind", "action"})
+	driftLastCheck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peribolos_drift_last_check_timestamp_seconds",
+		Help: "Time of the last successful comparison of the org with the config.",
+	}, []string{"org"})
+	driftCheckErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peribolos_drift_check_errors_total",
+		Help: "Number of failed comparisons of orgs with the config.",
+	}, []string{"org"})
+)
+
+func init() {
+	prometheus.MustRegister(driftChanges)
+	prometheus.MustRegister(driftLastCheck)
+	prometheus.MustRegister(driftCheckErrors)
+}
+
+type driftIssueClient interface {
+	BotUser() (*github.UserData, error)
+	CloseIssue(org, repo string, number int) error
+	CreateComment(org, repo string, number int, comment string) error
+	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+	EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error)
+	FindIssues(query, sort string, asc bool) ([]github.Issue, error)
+	GetIssue(org, repo string, number int) (*github.Issue, error)
+}
+
+// driftController periodically compares GitHub with the config, without
+// changing either.
+type driftController struct {
+	opt    options
+	client github.Client
+	// issues files the drift in issueOrg/issueRepo, nil to not file it
+	issues              driftIssueClient
+	issueOrg, issueRepo string
+	// issueNumber is the open drift issue, 0 when unknown
+	issueNumber int
+
+	loadConfig func() (org.FullConfig, error)
+	now        func() time.Time
+}
+
+func runDriftController(o options, client github.Client, issues driftIssueClient) {
+	metrics.ExposeMetrics("peribolos", config.PushGateway{}, o.instrumentation.MetricsPort)
+
+	c := &driftController{
+		opt:    o,
+		client: client,
+		loadConfig: func() (org.FullConfig, error) {
+			var cfg org.FullConfig
+			raw, err := ioutil.ReadFile(o.config)
+			if err != nil {
+				return cfg, fmt.Errorf("could not read --config-path file: %v", err)
+			}
+			if err := yaml.Unmarshal(raw, &cfg); err != nil {
+				return cfg, fmt.Errorf("failed to load configuration: %v", err)
+			}
+			return cfg, nil
+		},
+		now: time.Now,
+	}
+	if o.driftIssueRepo != "" {
+		c.issues = issues
+		parts := strings.SplitN(o.driftIssueRepo, "/", 2)
+		c.issueOrg, c.issueRepo = parts[0], parts[1]
+	}
+
+	defer interrupts.WaitForGracefulShutdown()
+	interrupts.TickLiteral(func() {
+		start := time.Now()
+		if err := c.sync(); err != nil {
+			logrus.WithError(err).Error("Error detecting drift.")
+		}
+		logrus.WithField("duration", time.Since(start).String()).Info("Compared GitHub with the config.")
+	}, o.driftInterval)
+}
+
+// sync plans every org of the config on its own, exports the planned changes
+// as metrics and files them in the drift issue.
+func (c *driftController) sync() error {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	driftChanges.Reset()
+	drift := &Plan{}
+	var errs []error
+	for _, name := range orgNames(cfg) {
+		plan, err := makePlan(c.opt, c.client, org.FullConfig{Orgs: map[string]org.Config{name: cfg.Orgs[name]}}, "")
+		if err != nil {
+			driftCheckErrors.WithLabelValues(name).Inc()
+			errs = append(errs, err)
+			continue
+		}
+		summary := summarize(plan.Changes)
+		for _, kind := range kindOrder {
+			for _, action := range actionOrder {
+				driftChanges.WithLabelValues(name, string(kind), string(action)).Set(float64(summary[kind][action]))
+			}
+		}
+		driftLastCheck.WithLabelValues(name).Set(float64(c.now().Unix()))
+		logrus.WithField("org", name).Infof("Found %d changes between GitHub and the config.", len(plan.Changes))
+		drift.Changes = append(drift.Changes, plan.Changes...)
+	}
+
+	// An incomplete comparison would misreport what drifted, so the issue
+	// only changes when every org was compared.
+	if len(errs) == 0 && c.issues != nil {
+		if err := c.fileIssue(drift); err != nil {
+			errs = append(errs, fmt.Errorf("failed to file the drift issue: %v", err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// driftIssueBody explains and lists the drift.
+func driftIssueBody(drift *Plan) string {
+	return "GitHub no longer matches the org config. These changes were made outside of the config, " +
+		"or the config changed without being applied. Applying the config reverts the changes GitHub has, " +
+		"otherwise update the config to keep them.\n\n" + drift.Markdown()
+}
+
+// fileIssue opens or updates the drift issue while there is drift, and
+// closes it once there is none left.
+func (c *driftController) fileIssue(drift *Plan) error {
+	if c.issueNumber == 0 {
+		if err := c.findIssue(); err != nil {
+			return err
+		}
+	}
+
+	if len(drift.Changes) == 0 {
+		if c.issueNumber == 0 {
+			return nil
+		}
+		if err := c.issues.CreateComment(c.issueOrg, c.issueRepo, c.issueNumber, "GitHub matches the org config again, closing."); err != nil {
+			return err
+		}
+		if err := c.issues.CloseIssue(c.issueOrg, c.issueRepo, c.issueNumber); err != nil {
+			return err
+		}
+		c.issueNumber = 0
+		return nil
+	}
+
+	body := driftIssueBody(drift)
+	if c.issueNumber == 0 {
+		number, err := c.issues.CreateIssue(c.issueOrg, c.issueRepo, driftIssueTitle, body, 0, nil, nil)
+		if err != nil {
+			return err
+		}
+		logrus.WithField("issue", number).Info("Filed drift issue.")
+		c.issueNumber = number
+		return nil
+	}
+	issue, err := c.issues.GetIssue(c.issueOrg, c.issueRepo, c.issueNumber)
+	if err != nil {
+		return err
+	}
+	if issue.State != "open" {
+		// Someone closed the issue, so the drift is filed again.
+		c.issueNumber = 0
+		return c.fileIssue(drift)
+	}
+	if issue.Body == body {
+		return nil
+	}
+	issue.Body = body
+	_, err = c.issues.EditIssue(c.issueOrg, c.issueRepo, c.issueNumber, issue)
+	return err
+}
+
+// findIssue looks for the open drift issue the bot filed before.
+func (c *driftController) findIssue() error {
+	bot, err := c.issues.BotUser()
+	if err != nil {
+		return fmt.Errorf("failed to get bot user: %v", err)
+	}
+	query := fmt.Sprintf("repo:%s/%s is:issue is:open author:%s in:title %q", c.issueOrg, c.issueRepo, bot.Login, driftIssueTitle)
+	issues, err := c.issues.FindIssues(query, "", false)
+	if err != nil {
+		return fmt.Errorf("failed to search for the drift issue: %v", err)
+	}
+	for _, issue := range issues {
+		if issue.Title == driftIssueTitle {
+			c.issueNumber = issue.Number
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeIssues holds the issues of the repo the drift is filed in.
+type fakeIssues struct {
+	issues   map[int]*github.Issue
+	comments map[int][]string
+	searches int
+}
+
+func (c *fakeIssues) BotUser() (*github.UserData, error) {
+	return &github.UserData{Login: "bot"}, nil
+}
+
+func (c *fakeIssues) CloseIssue(org, repo string, number int) error {
+	c.issues[number].State = "closed"
+	return nil
+}
+
+func (c *fakeIssues) CreateComment(org, repo string, number int, comment string) error {
+	c.comments[number] = append(c.comments[number], comment)
+	return nil
+}
+
+func (c *fakeIssues) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	number := len(c.issues) + 1
+	c.issues[number] = &github.Issue{Number: number, Title: title, Body: body, State: "open"}
+	return number, nil
+}
+
+func (c *fakeIssues) EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error) {
+	edited := *issue
+	c.issues[number] = &edited
+	return &edited, nil
+}
+
+func (c *fakeIssues) FindIssues(query, sort string, asc bool) ([]github.Issue, error) {
+	c.searches++
+	var issues []github.Issue
+	for _, issue := range c.issues {
+		if issue.State == "open" {
+			issues = append(issues, *issue)
+		}
+	}
+	return issues, nil
+}
+
+func (c *fakeIssues) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	issue, ok := c.issues[number]
+	if !ok {
+		return nil, fmt.Errorf("no issue %d", number)
+	}
+	copied := *issue
+	return &copied, nil
+}
+
+func TestDriftControllerSync(t *testing.T) {
+	client := newFakeGitHub()
+	issues := &fakeIssues{issues: map[int]*github.Issue{}, comments: map[int][]string{}}
+	now := time.Unix(1600000000, 0)
+	c := &driftController{
+		opt:        planOptions(),
+		client:     client,
+		issues:     issues,
+		issueOrg:   "org",
+		issueRepo:  "admin",
+		loadConfig: func() (org.FullConfig, error) { return planConfig(), nil },
+		now:        func() time.Time { return now },
+	}
+
+	// Someone made carol an admin by hand
+	client.members.Delete("carol")
+	client.admins.Insert("carol")
+	if err := c.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.mutations != 0 {
+		t.Errorf("expected drift detection to make no changes, made %d", client.mutations)
+	}
+	for _, tc := range []struct {
+		kind     ChangeKind
+		action   ChangeAction
+		expected float64
+	}{
+		{kind: OrgMemberKind, action: CreateAction, expected: 1},
+		{kind: OrgMemberKind, action: DeleteAction, expected: 1},
+		{kind: TeamKind, action: DeleteAction, expected: 1},
+		{kind: TeamRepoKind, action: UpdateAction, expected: 1},
+		{kind: RepoWebhookKind, action: DeleteAction, expected: 0},
+	} {
+		if actual := testutil.ToFloat64(driftChanges.WithLabelValues("org", string(tc.kind), string(tc.action))); actual != tc.expected {
+			t.Errorf("expected %v %s changes to %s, got %v", tc.expected, tc.kind, tc.action, actual)
+		}
+	}
+	if actual := testutil.ToFloat64(driftLastCheck.WithLabelValues("org")); actual != float64(now.Unix()) {
+		t.Errorf("expected the last check at %d, got %v", now.Unix(), actual)
+	}
+
+	if len(issues.issues) != 1 {
+		t.Fatalf("expected the drift to be filed in one issue, got %d", len(issues.issues))
+	}
+	body := issues.issues[1].Body
+	if !strings.Contains(body, "- carol") {
+		t.Errorf("expected the removal of admin carol in the issue:\n%s", body)
+	}
+
+	// The issue is updated rather than filed again
+	client.members.Insert("dave")
+	if err := c.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues.issues) != 1 || !strings.Contains(issues.issues[1].Body, "- dave") {
+		t.Errorf("expected the issue to be updated with dave, got %v", issues.issues)
+	}
+
+	// A restarted controller finds the issue again
+	c.issueNumber = 0
+	if err := c.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues.issues) != 1 || issues.searches != 2 {
+		t.Errorf("expected the issue to be found again, got %d issues after %d searches", len(issues.issues), issues.searches)
+	}
+
+	// Once the drift is gone the issue is closed
+	if err := applyPlan(planOptions(), client, planConfig(), "", mustPlan(t, client)); err != nil {
+		t.Fatalf("failed to apply the config: %v", err)
+	}
+	if err := c.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issues.issues[1].State != "closed" || len(issues.comments[1]) != 1 {
+		t.Errorf("expected the issue to be closed with a comment, got %v and comments %v", issues.issues[1], issues.comments[1])
+	}
+	if actual := testutil.ToFloat64(driftChanges.WithLabelValues("org", string(OrgMemberKind), string(DeleteAction))); actual != 0 {
+		t.Errorf("expected no drift left, got %v org members to delete", actual)
+	}
+}
+
+func TestDriftControllerSkipsIssueOnErrors(t *testing.T) {
+	issues := &fakeIssues{issues: map[int]*github.Issue{}, comments: map[int][]string{}}
+	c := &driftController{
+		opt:       planOptions(),
+		client:    newFakeGitHub(),
+		issues:    issues,
+		issueOrg:  "org",
+		issueRepo: "admin",
+		loadConfig: func() (org.FullConfig, error) {
+			cfg := planConfig()
+			broken := cfg.Orgs["org"]
+			broken.Teams = map[string]org.Team{"a": {Previously: []string{"b"}}, "b": {}}
+			cfg.Orgs["broken"] = broken
+			return cfg, nil
+		},
+		now: time.Now,
+	}
+	if err := c.sync(); err == nil {
+		t.Error("expected an error comparing the broken org")
+	}
+	if len(issues.issues) != 0 {
+		t.Errorf("expected no issue from an incomplete comparison, got %v", issues.issues)
+	}
+	if actual := testutil.ToFloat64(driftCheckErrors.WithLabelValues("broken")); actual != 1 {
+		t.Errorf("expected one error comparing the broken org, got %v", actual)
+	}
+}
+
+func mustPlan(t *testing.T, client github.Client) *Plan {
+	plan, err := makePlan(planOptions(), client, planConfig(), "")
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	return plan
+}
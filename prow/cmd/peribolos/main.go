@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -45,23 +46,37 @@ const (
 )
 
 type options struct {
-	config            string
-	confirm           bool
-	dump              string
-	dumpFull          bool
-	maximumDelta      float64
-	minAdmins         int
-	requireSelf       bool
-	requiredAdmins    flagutil.Strings
-	fixOrg            bool
-	fixOrgMembers     bool
-	fixTeamMembers    bool
-	fixTeams          bool
-	fixTeamRepos      bool
-	fixRepos          bool
+	config               string
+	confirm              bool
+	dump                 string
+	dumpFull             bool
+	maximumDelta         float64
+	minAdmins            int
+	requireSelf          bool
+	requiredAdmins       flagutil.Strings
+	fixOrg               bool
+	fixOrgMembers        bool
+	fixTeamMembers       bool
+	fixTeams             bool
+	fixTeamRepos         bool
+	fixRepos             bool
+	fixRepoCollaborators bool
+	fixRepoTopics        bool
+	fixRepoDeployKeys    bool
+	fixRepoWebhooks      bool
+	fixRepoSecurity      bool
+	hmacTokenPath        string
+	// hmacTokens generates the contents of --hmac-token-path once it is loaded
+	hmacTokens        func() []byte
 	ignoreSecretTeams bool
 	allowRepoArchival bool
 	allowRepoPublish  bool
+	planOutput        string
+	planMarkdown      string
+	applyPlan         string
+	driftInterval     time.Duration
+	driftIssueRepo    string
+	instrumentation   flagutil.InstrumentationOptions
 	github            flagutil.GitHubOptions
 	tokenBurst        int
 	tokensPerHour     int
@@ -95,10 +110,22 @@ func (o *options) parseArgs(flags *flag.FlagSet, args []string) error {
 	flags.BoolVar(&o.fixTeamMembers, "fix-team-members", false, "Add/remove team members if set")
 	flags.BoolVar(&o.fixTeamRepos, "fix-team-repos", false, "Add/remove team permissions on repos if set")
 	flags.BoolVar(&o.fixRepos, "fix-repos", false, "Create/update repositories if set")
+	flags.BoolVar(&o.fixRepoCollaborators, "fix-repo-collaborators", false, "Add/remove/update outside collaborators of repos if set")
+	flags.BoolVar(&o.fixRepoTopics, "fix-repo-topics", false, "Replace the topics of repos if set")
+	flags.BoolVar(&o.fixRepoDeployKeys, "fix-repo-deploy-keys", false, "Add/remove deploy keys of repos if set")
+	flags.BoolVar(&o.fixRepoWebhooks, "fix-repo-webhooks", false, "Create/delete/update webhooks of repos if set")
+	flags.BoolVar(&o.fixRepoSecurity, "fix-repo-security", false, "Enable/disable vulnerability alerts of repos if set")
+	flags.StringVar(&o.hmacTokenPath, "hmac-token-path", "", "Path to the file containing the HMAC tokens to sign repo webhooks with")
 	flags.BoolVar(&o.allowRepoArchival, "allow-repo-archival", false, "If set, archiving repos is allowed while updating repos")
 	flags.BoolVar(&o.allowRepoPublish, "allow-repo-publish", false, "If set, making private repos public is allowed while updating repos")
+	flags.StringVar(&o.planOutput, "plan-output", "", "Write the changes configuring the orgs would make to this json file instead of making them")
+	flags.StringVar(&o.planMarkdown, "plan-markdown", "", "Write the changes configuring the orgs would make to this file as markdown, e.g. for a PR comment")
+	flags.StringVar(&o.applyPlan, "apply-plan", "", "Apply exactly the changes of this plan written by --plan-output, refusing if GitHub has changed since")
+	flags.DurationVar(&o.driftInterval, "drift-interval", 0, "If set, keep running and compare GitHub with the config this often, exporting the differences as metrics instead of fixing them")
+	flags.StringVar(&o.driftIssueRepo, "drift-issue-repo", "", "Open, update and close an issue listing the differences in this org/repo while --drift-interval is set")
 	flags.StringVar(&o.logLevel, "log-level", logrus.InfoLevel.String(), fmt.Sprintf("Logging level, one of %v", logrus.AllLevels))
 	o.github.AddFlags(flags)
+	o.instrumentation.AddFlags(flags)
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -126,6 +153,39 @@ func (o *options) parseArgs(flags *flag.FlagSet, args []string) error {
 		return fmt.Errorf("--config-path=%s and --dump=%s cannot both be set", o.config, o.dump)
 	}
 
+	planning := o.planOutput != "" || o.planMarkdown != ""
+	if planning && o.confirm {
+		return errors.New("--plan-output and --plan-markdown make no changes, they cannot be used with --confirm")
+	}
+	if o.applyPlan != "" && !o.confirm {
+		return errors.New("--apply-plan requires --confirm")
+	}
+	if (planning || o.applyPlan != "") && o.config == "" {
+		return errors.New("--plan-output, --plan-markdown and --apply-plan require --config-path")
+	}
+
+	if o.driftInterval < 0 {
+		return fmt.Errorf("--drift-interval=%s must not be negative", o.driftInterval)
+	}
+	if o.driftInterval > 0 {
+		switch {
+		case o.confirm:
+			return errors.New("--drift-interval makes no changes, it cannot be used with --confirm")
+		case o.config == "":
+			return errors.New("--drift-interval requires --config-path")
+		case planning || o.applyPlan != "":
+			return errors.New("--drift-interval cannot be used with --plan-output, --plan-markdown or --apply-plan")
+		}
+	}
+	if o.driftIssueRepo != "" {
+		if o.driftInterval == 0 {
+			return errors.New("--drift-issue-repo requires --drift-interval")
+		}
+		if parts := strings.Split(o.driftIssueRepo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("--drift-issue-repo=%s must be org/repo", o.driftIssueRepo)
+		}
+	}
+
 	if o.dumpFull && o.dump == "" {
 		return errors.New("--dump-full can't be used without --dump")
 	}
@@ -138,6 +198,10 @@ func (o *options) parseArgs(flags *flag.FlagSet, args []string) error {
 		return fmt.Errorf("--fix-team-repos requires --fix-teams")
 	}
 
+	if o.fixRepoWebhooks && o.hmacTokenPath == "" {
+		return errors.New("--fix-repo-webhooks requires --hmac-token-path")
+	}
+
 	level, err := logrus.ParseLevel(o.logLevel)
 	if err != nil {
 		return fmt.Errorf("--log-level invalid: %v", err)
@@ -152,10 +216,17 @@ func main() {
 
 	o := parseOptions()
 
+	secrets := []string{o.github.TokenPath}
+	if o.hmacTokenPath != "" {
+		secrets = append(secrets, o.hmacTokenPath)
+	}
 	secretAgent := &secret.Agent{}
-	if err := secretAgent.Start([]string{o.github.TokenPath}); err != nil {
+	if err := secretAgent.Start(secrets); err != nil {
 		logrus.WithError(err).Fatal("Error starting secrets agent.")
 	}
+	if o.hmacTokenPath != "" {
+		o.hmacTokens = secretAgent.GetTokenGenerator(o.hmacTokenPath)
+	}
 
 	githubClient, err := o.github.GitHubClient(secretAgent, !o.confirm)
 	if err != nil {
@@ -165,6 +236,18 @@ func main() {
 		githubClient.Throttle(o.tokensPerHour, o.tokenBurst) // 300 hourly tokens, bursts of 100 (default)
 	}
 
+	if o.driftInterval > 0 {
+		var issueClient driftIssueClient
+		if o.driftIssueRepo != "" {
+			// Filing the drift is the only change this mode makes.
+			if issueClient, err = o.github.GitHubClient(secretAgent, false); err != nil {
+				logrus.WithError(err).Fatal("Error getting GitHub client for the drift issue.")
+			}
+		}
+		runDriftController(o, githubClient, issueClient)
+		return
+	}
+
 	if o.dump != "" {
 		ret, err := dumpOrgConfig(githubClient, o.dump, o.ignoreSecretTeams)
 		if err != nil {
@@ -197,9 +280,37 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to load configuration")
 	}
 
-	for name, orgcfg := range cfg.Orgs {
-		if err := configureOrg(o, githubClient, name, orgcfg); err != nil {
-			logrus.Fatalf("Configuration failed: %v", err)
+	switch {
+	case o.planOutput != "" || o.planMarkdown != "":
+		plan, err := makePlan(o, githubClient, cfg, configDigest(raw))
+		if err != nil {
+			logrus.Fatalf("Planning failed: %v", err)
+		}
+		if o.planOutput != "" {
+			if err := writePlan(o.planOutput, plan); err != nil {
+				logrus.WithError(err).Fatal("Failed to write plan")
+			}
+		}
+		if o.planMarkdown != "" {
+			if err := ioutil.WriteFile(o.planMarkdown, []byte(plan.Markdown()), 0644); err != nil {
+				logrus.WithError(err).Fatal("Failed to write plan markdown")
+			}
+		}
+		logrus.Infof("Planned %d changes.", len(plan.Changes))
+		return
+	case o.applyPlan != "":
+		plan, err := loadPlan(o.applyPlan)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to load plan")
+		}
+		if err := applyPlan(o, githubClient, cfg, configDigest(raw), plan); err != nil {
+			logrus.Fatalf("Applying the plan failed: %v", err)
+		}
+	default:
+		for name, orgcfg := range cfg.Orgs {
+			if err := configureOrg(o, githubClient, name, orgcfg); err != nil {
+				logrus.Fatalf("Configuration failed: %v", err)
+			}
 		}
 	}
 	logrus.Info("Finished syncing configuration.")
@@ -840,6 +951,12 @@ func configureOrg(opt options, client github.Client, orgName string, orgConfig o
 		return fmt.Errorf("failed to configure %s repos: %v", orgName, err)
 	}
 
+	// Configure collaborators, topics, deploy keys, webhooks and security
+	// settings of the repos
+	if err := configureRepoSettings(opt, client, orgName, orgConfig); err != nil {
+		return fmt.Errorf("failed to configure %s repo settings: %v", orgName, err)
+	}
+
 	if !opt.fixTeams {
 		logrus.Infof("Skipping team and team member configuration")
 		return nil
@@ -23,6 +23,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"k8s.io/apimachinery/pkg/util/diff"
@@ -120,6 +121,84 @@ func TestOptions(t *testing.T) {
 			name: "reject --fix-team-members without --fix-teams",
 			args: []string{"--config-path=foo", "--fix-team-members"},
 		},
+		{
+			name: "reject --plan-output with --confirm",
+			args: []string{"--config-path=foo", "--confirm", "--plan-output=plan.json"},
+		},
+		{
+			name: "reject --apply-plan without --confirm",
+			args: []string{"--config-path=foo", "--apply-plan=plan.json"},
+		},
+		{
+			name: "reject --plan-markdown without --config-path",
+			args: []string{"--dump=frogger", "--plan-markdown=plan.md"},
+		},
+		{
+			name: "allow planning",
+			args: []string{"--config-path=foo", "--plan-output=plan.json", "--plan-markdown=plan.md"},
+			expected: &options{
+				config:        "foo",
+				minAdmins:     defaultMinAdmins,
+				requireSelf:   true,
+				maximumDelta:  defaultDelta,
+				tokensPerHour: defaultTokens,
+				tokenBurst:    defaultBurst,
+				planOutput:    "plan.json",
+				planMarkdown:  "plan.md",
+				logLevel:      "info",
+			},
+		},
+		{
+			name: "reject --fix-repo-webhooks without --hmac-token-path",
+			args: []string{"--config-path=foo", "--fix-repo-webhooks"},
+		},
+		{
+			name: "allow fixing repo settings",
+			args: []string{"--config-path=foo", "--fix-repo-collaborators", "--fix-repo-topics", "--fix-repo-deploy-keys", "--fix-repo-webhooks", "--fix-repo-security", "--hmac-token-path=hmac"},
+			expected: &options{
+				config:               "foo",
+				minAdmins:            defaultMinAdmins,
+				requireSelf:          true,
+				maximumDelta:         defaultDelta,
+				tokensPerHour:        defaultTokens,
+				tokenBurst:           defaultBurst,
+				fixRepoCollaborators: true,
+				fixRepoTopics:        true,
+				fixRepoDeployKeys:    true,
+				fixRepoWebhooks:      true,
+				fixRepoSecurity:      true,
+				hmacTokenPath:        "hmac",
+				logLevel:             "info",
+			},
+		},
+		{
+			name: "reject --drift-interval with --confirm",
+			args: []string{"--config-path=foo", "--confirm", "--drift-interval=1h"},
+		},
+		{
+			name: "reject --drift-issue-repo without --drift-interval",
+			args: []string{"--config-path=foo", "--drift-issue-repo=org/repo"},
+		},
+		{
+			name: "reject --drift-issue-repo that is not org/repo",
+			args: []string{"--config-path=foo", "--drift-interval=1h", "--drift-issue-repo=org"},
+		},
+		{
+			name: "allow drift detection",
+			args: []string{"--config-path=foo", "--fix-org-members", "--drift-interval=1h", "--drift-issue-repo=org/repo"},
+			expected: &options{
+				config:         "foo",
+				minAdmins:      defaultMinAdmins,
+				requireSelf:    true,
+				maximumDelta:   defaultDelta,
+				tokensPerHour:  defaultTokens,
+				tokenBurst:     defaultBurst,
+				fixOrgMembers:  true,
+				driftInterval:  time.Hour,
+				driftIssueRepo: "org/repo",
+				logLevel:       "info",
+			},
+		},
 		{
 			name: "allow disabled throttle",
 			args: []string{"--config-path=foo", "--tokens=0"},
@@ -184,6 +263,7 @@ func TestOptions(t *testing.T) {
 		var actual options
 		err := actual.parseArgs(flags, tc.args)
 		actual.github = flagutil.GitHubOptions{}
+		actual.instrumentation = flagutil.InstrumentationOptions{}
 		switch {
 		case err == nil && tc.expected == nil:
 			t.Errorf("%s: failed to return an error", tc.name)
@@ -0,0 +1,893 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// ChangeKind is the kind of thing a change applies to.
+type ChangeKind string
+
+// Kinds of changes, in the order they are presented
+const (
+	OrgKind              ChangeKind = "org"
+	OrgMemberKind        ChangeKind = "org-member"
+	RepoKind             ChangeKind = "repo"
+	RepoCollaboratorKind ChangeKind = "repo-collaborator"
+	RepoTopicsKind       ChangeKind = "repo-topics"
+	RepoDeployKeyKind    ChangeKind = "repo-deploy-key"
+	RepoWebhookKind      ChangeKind = "repo-webhook"
+	RepoSecurityKind     ChangeKind = "repo-security"
+	TeamKind             ChangeKind = "team"
+	TeamMemberKind       ChangeKind = "team-member"
+	TeamRepoKind         ChangeKind = "team-repo"
+)
+
+var kindOrder = []ChangeKind{
+	OrgKind, OrgMemberKind,
+	RepoKind, RepoCollaboratorKind, RepoTopicsKind, RepoDeployKeyKind, RepoWebhookKind, RepoSecurityKind,
+	TeamKind, TeamMemberKind, TeamRepoKind,
+}
+
+// ChangeAction is what a change does.
+type ChangeAction string
+
+// Actions of changes. Adding or removing memberships and permissions are
+// creations and deletions.
+const (
+	CreateAction ChangeAction = "create"
+	UpdateAction ChangeAction = "update"
+	DeleteAction ChangeAction = "delete"
+)
+
+var actionOrder = []ChangeAction{CreateAction, UpdateAction, DeleteAction}
+
+// Change is a single mutation peribolos makes on GitHub.
+type Change struct {
+	Org    string       `json:"org"`
+	Kind   ChangeKind   `json:"kind"`
+	Action ChangeAction `json:"action"`
+	// Team is the team of team members and team repo permissions.
+	Team string `json:"team,omitempty"`
+	// Repo is the repo of collaborators, deploy keys and webhooks.
+	Repo string `json:"repo,omitempty"`
+	// Name is the current name of the org, repo or team, the login of the
+	// member or collaborator, the title of the deploy key or the url of the
+	// webhook the change applies to.
+	Name string `json:"name"`
+	// Fields are the new values of the fields the change sets, e.g. the
+	// role of a member or the privacy of a team.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// key identifies equal changes
+func (c Change) key() string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// String describes the change for logs and errors.
+func (c Change) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name)
+	if c.Team != "" {
+		s += " of team " + c.Team
+	}
+	if c.Repo != "" {
+		s += " of repo " + c.Repo
+	}
+	s += " in " + c.Org
+	if fields := c.formatFields(); fields != "" {
+		s += " (" + fields + ")"
+	}
+	return s
+}
+
+func (c Change) formatFields() string {
+	var names []string
+	for name := range c.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fields []string
+	for _, name := range names {
+		fields = append(fields, fmt.Sprintf("%s: %q", name, c.Fields[name]))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Plan is the list of changes that make GitHub match the config.
+type Plan struct {
+	// ConfigDigest is the sha256 of the config the plan was made for.
+	ConfigDigest string `json:"config_digest"`
+	// Summary counts the changes by kind and action. It is informational
+	// and ignored when a plan is loaded.
+	Summary map[ChangeKind]map[ChangeAction]int `json:"summary,omitempty"`
+	// Changes are sorted by org, kind, team, name and action.
+	Changes []Change `json:"changes"`
+}
+
+// configDigest returns the digest of the raw config plans refer to.
+func configDigest(raw []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(raw))
+}
+
+// sortChanges orders changes deterministically, independent of the order
+// in which they were planned.
+func sortChanges(changes []Change) {
+	rank := func(kind ChangeKind) int {
+		for i, k := range kindOrder {
+			if k == kind {
+				return i
+			}
+		}
+		return len(kindOrder)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		switch {
+		case a.Org != b.Org:
+			return a.Org < b.Org
+		case a.Kind != b.Kind:
+			return rank(a.Kind) < rank(b.Kind)
+		case a.Team != b.Team:
+			return a.Team < b.Team
+		case a.Repo != b.Repo:
+			return a.Repo < b.Repo
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return a.key() < b.key()
+	})
+}
+
+// summarize counts the changes by kind and action
+func summarize(changes []Change) map[ChangeKind]map[ChangeAction]int {
+	summary := map[ChangeKind]map[ChangeAction]int{}
+	for _, change := range changes {
+		if summary[change.Kind] == nil {
+			summary[change.Kind] = map[ChangeAction]int{}
+		}
+		summary[change.Kind][change.Action]++
+	}
+	return summary
+}
+
+// writePlan writes the plan as json.
+func writePlan(path string, plan *Plan) error {
+	plan.Summary = summarize(plan.Changes)
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %v", err)
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// loadPlan reads a plan written by writePlan.
+func loadPlan(path string) (*Plan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %v", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %v", err)
+	}
+	if plan.ConfigDigest == "" {
+		return nil, fmt.Errorf("plan has no config digest")
+	}
+	sortChanges(plan.Changes)
+	return &plan, nil
+}
+
+// Markdown renders the plan for e.g. a comment on the PR changing the config.
+func (p *Plan) Markdown() string {
+	var s strings.Builder
+	s.WriteString("## Peribolos plan\n\n")
+	if len(p.Changes) == 0 {
+		s.WriteString("No changes. GitHub matches the config.\n")
+		return s.String()
+	}
+
+	summary := summarize(p.Changes)
+	var counts []string
+	for _, kind := range kindOrder {
+		for _, action := range actionOrder {
+			if n := summary[kind][action]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s to %s", n, kind, action))
+			}
+		}
+	}
+	fmt.Fprintf(&s, "%d changes: %s.\n", len(p.Changes), strings.Join(counts, ", "))
+
+	symbols := map[ChangeAction]string{CreateAction: "+", UpdateAction: "~", DeleteAction: "-"}
+	for i, change := range p.Changes {
+		if i == 0 || p.Changes[i-1].Org != change.Org {
+			fmt.Fprintf(&s, "\n### Org `%s`\n", change.Org)
+		}
+		if i == 0 || p.Changes[i-1].Org != change.Org || p.Changes[i-1].Kind != change.Kind {
+			fmt.Fprintf(&s, "\n#### %s\n\n```diff\n", change.Kind)
+		}
+		line := fmt.Sprintf("%s %s", symbols[change.Action], change.Name)
+		if change.Team != "" {
+			line += fmt.Sprintf(" (team %s)", change.Team)
+		}
+		if change.Repo != "" {
+			line += fmt.Sprintf(" (repo %s)", change.Repo)
+		}
+		if fields := change.formatFields(); fields != "" {
+			line += ": " + fields
+		}
+		s.WriteString(line + "\n")
+		if i == len(p.Changes)-1 || p.Changes[i+1].Org != change.Org || p.Changes[i+1].Kind != change.Kind {
+			s.WriteString("```\n")
+		}
+	}
+	return s.String()
+}
+
+// planClient records the mutations of peribolos as changes instead of making
+// them. When applying a plan, it makes the mutations of planned changes and
+// refuses any others.
+type planClient struct {
+	github.Client
+
+	changes []Change
+	// expected counts the changes left to apply by key, nil when planning
+	expected map[string]int
+
+	// teams are the known teams by id, including planned ones
+	teams map[int]github.Team
+	// nextID is the id of the next planned team, negative to never clash
+	nextID int
+	// members are the known members of orgs and teams, for telling
+	// additions from updates
+	orgMembers  map[string]sets.String
+	teamMembers map[int]sets.String
+	teamRepos   map[int]sets.String
+
+	// repos are the current names of repos the plan renames by their new
+	// org/name, or empty for repos the plan creates
+	repos map[string]string
+	// collaborators are the known collaborators and invitees by org/repo
+	collaborators map[string]sets.String
+	// deployKeys and hooks are the titles of deploy keys and urls of
+	// webhooks by id
+	deployKeys map[int]string
+	hooks      map[int]string
+}
+
+func newPlanClient(client github.Client, plan *Plan) *planClient {
+	c := &planClient{
+		Client:      client,
+		teams:       map[int]github.Team{},
+		nextID:      -1,
+		orgMembers:  map[string]sets.String{},
+		teamMembers: map[int]sets.String{},
+		teamRepos:   map[int]sets.String{},
+
+		repos:         map[string]string{},
+		collaborators: map[string]sets.String{},
+		deployKeys:    map[int]string{},
+		hooks:         map[int]string{},
+	}
+	if plan != nil {
+		c.expected = map[string]int{}
+		for _, change := range plan.Changes {
+			c.expected[change.key()]++
+		}
+	}
+	return c
+}
+
+// record plans the change, or makes it by calling apply if it was planned
+func (c *planClient) record(change Change, apply func() error) error {
+	if c.expected == nil {
+		logrus.Infof("Planning to %s", change)
+		c.changes = append(c.changes, change)
+		return nil
+	}
+	key := change.key()
+	if c.expected[key] == 0 {
+		return fmt.Errorf("refusing to %s, it is not in the plan", change)
+	}
+	c.expected[key]--
+	if err := apply(); err != nil {
+		return err
+	}
+	c.changes = append(c.changes, change)
+	return nil
+}
+
+// unapplied returns the planned changes which weren't made
+func (c *planClient) unapplied() []string {
+	var left []string
+	for key, n := range c.expected {
+		for i := 0; i < n; i++ {
+			left = append(left, key)
+		}
+	}
+	sort.Strings(left)
+	return left
+}
+
+func (c *planClient) planning() bool {
+	return c.expected == nil
+}
+
+func (c *planClient) teamName(id int) string {
+	if t, ok := c.teams[id]; ok {
+		return t.Name
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+func (c *planClient) ListOrgMembers(orgName, role string) ([]github.TeamMember, error) {
+	members, err := c.Client.ListOrgMembers(orgName, role)
+	if err != nil {
+		return nil, err
+	}
+	if c.orgMembers[orgName] == nil {
+		c.orgMembers[orgName] = sets.String{}
+	}
+	for _, m := range members {
+		c.orgMembers[orgName].Insert(github.NormLogin(m.Login))
+	}
+	return members, nil
+}
+
+func (c *planClient) UpdateOrgMembership(orgName, user string, admin bool) (*github.OrgMembership, error) {
+	role := github.RoleMember
+	if admin {
+		role = github.RoleAdmin
+	}
+	change := Change{Org: orgName, Kind: OrgMemberKind, Action: CreateAction, Name: user, Fields: map[string]string{"role": role}}
+	if c.orgMembers[orgName].Has(github.NormLogin(user)) {
+		change.Action = UpdateAction
+	}
+	membership := &github.OrgMembership{Membership: github.Membership{Role: role, State: github.StateActive}}
+	err := c.record(change, func() error {
+		var err error
+		membership, err = c.Client.UpdateOrgMembership(orgName, user, admin)
+		return err
+	})
+	return membership, err
+}
+
+func (c *planClient) RemoveOrgMembership(orgName, user string) error {
+	return c.record(Change{Org: orgName, Kind: OrgMemberKind, Action: DeleteAction, Name: user}, func() error {
+		return c.Client.RemoveOrgMembership(orgName, user)
+	})
+}
+
+func (c *planClient) EditOrg(name string, config github.Organization) (*github.Organization, error) {
+	current, err := c.Client.GetOrg(name)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	setField := func(field, have, want string) {
+		if have != want {
+			fields[field] = want
+		}
+	}
+	setField("billing_email", current.BillingEmail, config.BillingEmail)
+	setField("company", current.Company, config.Company)
+	setField("email", current.Email, config.Email)
+	setField("name", current.Name, config.Name)
+	setField("description", current.Description, config.Description)
+	setField("location", current.Location, config.Location)
+	setField("default_repository_permission", current.DefaultRepositoryPermission, config.DefaultRepositoryPermission)
+	setField("has_organization_projects", fmt.Sprint(current.HasOrganizationProjects), fmt.Sprint(config.HasOrganizationProjects))
+	setField("has_repository_projects", fmt.Sprint(current.HasRepositoryProjects), fmt.Sprint(config.HasRepositoryProjects))
+	setField("members_can_create_repositories", fmt.Sprint(current.MembersCanCreateRepositories), fmt.Sprint(config.MembersCanCreateRepositories))
+	edited := &config
+	err = c.record(Change{Org: name, Kind: OrgKind, Action: UpdateAction, Name: name, Fields: fields}, func() error {
+		var err error
+		edited, err = c.Client.EditOrg(name, config)
+		return err
+	})
+	return edited, err
+}
+
+func (c *planClient) ListTeams(orgName string) ([]github.Team, error) {
+	teams, err := c.Client.ListTeams(orgName)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range teams {
+		c.teams[t.ID] = t
+	}
+	return teams, nil
+}
+
+func (c *planClient) CreateTeam(orgName string, team github.Team) (*github.Team, error) {
+	fields := map[string]string{}
+	if team.Description != "" {
+		fields["description"] = team.Description
+	}
+	if team.Privacy != "" {
+		fields["privacy"] = team.Privacy
+	}
+	if team.ParentTeamID != nil {
+		fields["parent"] = c.teamName(*team.ParentTeamID)
+	}
+	created := team
+	created.ID = c.nextID
+	err := c.record(Change{Org: orgName, Kind: TeamKind, Action: CreateAction, Name: team.Name, Fields: fields}, func() error {
+		t, err := c.Client.CreateTeam(orgName, team)
+		if err == nil {
+			created = *t
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created.ID == c.nextID {
+		c.nextID--
+	}
+	c.teams[created.ID] = created
+	return &created, nil
+}
+
+func (c *planClient) EditTeam(orgName string, team github.Team) (*github.Team, error) {
+	current := c.teams[team.ID]
+	fields := map[string]string{}
+	if team.Name != current.Name {
+		fields["name"] = team.Name
+	}
+	if team.Description != "" && team.Description != current.Description {
+		fields["description"] = team.Description
+	}
+	if team.Privacy != "" && team.Privacy != current.Privacy {
+		fields["privacy"] = team.Privacy
+	}
+	currentParent, wantParent := "", ""
+	if current.Parent != nil {
+		currentParent = c.teamName(current.Parent.ID)
+	}
+	// configureTeam only sets the parent id to change the parent
+	if team.ParentTeamID != nil {
+		wantParent = c.teamName(*team.ParentTeamID)
+	} else if team.Parent != nil {
+		wantParent = c.teamName(team.Parent.ID)
+	}
+	if currentParent != wantParent {
+		fields["parent"] = wantParent
+	}
+	edited := team
+	if len(fields) > 0 {
+		err := c.record(Change{Org: orgName, Kind: TeamKind, Action: UpdateAction, Name: current.Name, Fields: fields}, func() error {
+			t, err := c.Client.EditTeam(orgName, team)
+			if err == nil {
+				edited = *t
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.teams[team.ID] = edited
+	return &edited, nil
+}
+
+func (c *planClient) DeleteTeam(orgName string, id int) error {
+	return c.record(Change{Org: orgName, Kind: TeamKind, Action: DeleteAction, Name: c.teamName(id)}, func() error {
+		return c.Client.DeleteTeam(orgName, id)
+	})
+}
+
+func (c *planClient) ListTeamMembers(orgName string, id int, role string) ([]github.TeamMember, error) {
+	if c.teamMembers[id] == nil {
+		c.teamMembers[id] = sets.String{}
+	}
+	if id < 0 {
+		return nil, nil
+	}
+	members, err := c.Client.ListTeamMembers(orgName, id, role)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		c.teamMembers[id].Insert(github.NormLogin(m.Login))
+	}
+	return members, nil
+}
+
+func (c *planClient) ListTeamInvitations(orgName string, id int) ([]github.OrgInvitation, error) {
+	if id < 0 {
+		return nil, nil
+	}
+	return c.Client.ListTeamInvitations(orgName, id)
+}
+
+func (c *planClient) UpdateTeamMembership(orgName string, id int, user string, maintainer bool) (*github.TeamMembership, error) {
+	role := github.RoleMember
+	if maintainer {
+		role = github.RoleMaintainer
+	}
+	change := Change{Org: orgName, Kind: TeamMemberKind, Action: CreateAction, Team: c.teamName(id), Name: user, Fields: map[string]string{"role": role}}
+	if c.teamMembers[id].Has(github.NormLogin(user)) {
+		change.Action = UpdateAction
+	}
+	membership := &github.TeamMembership{Membership: github.Membership{Role: role, State: github.StateActive}}
+	err := c.record(change, func() error {
+		var err error
+		membership, err = c.Client.UpdateTeamMembership(orgName, id, user, maintainer)
+		return err
+	})
+	return membership, err
+}
+
+func (c *planClient) RemoveTeamMembership(orgName string, id int, user string) error {
+	return c.record(Change{Org: orgName, Kind: TeamMemberKind, Action: DeleteAction, Team: c.teamName(id), Name: user}, func() error {
+		return c.Client.RemoveTeamMembership(orgName, id, user)
+	})
+}
+
+func (c *planClient) ListTeamRepos(orgName string, id int) ([]github.Repo, error) {
+	c.teamRepos[id] = sets.String{}
+	if id < 0 {
+		return nil, nil
+	}
+	repos, err := c.Client.ListTeamRepos(orgName, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		c.teamRepos[id].Insert(repo.Name)
+	}
+	return repos, nil
+}
+
+func (c *planClient) UpdateTeamRepo(id int, orgName, repo string, permission github.TeamPermission) error {
+	change := Change{Org: orgName, Kind: TeamRepoKind, Action: CreateAction, Team: c.teamName(id), Name: repo, Fields: map[string]string{"permission": string(permission)}}
+	if c.teamRepos[id].Has(repo) {
+		change.Action = UpdateAction
+	}
+	return c.record(change, func() error {
+		return c.Client.UpdateTeamRepo(id, orgName, repo, permission)
+	})
+}
+
+func (c *planClient) RemoveTeamRepo(id int, orgName, repo string) error {
+	return c.record(Change{Org: orgName, Kind: TeamRepoKind, Action: DeleteAction, Team: c.teamName(id), Name: repo}, func() error {
+		return c.Client.RemoveTeamRepo(id, orgName, repo)
+	})
+}
+
+// repoRequestFields returns the fields a repo request sets
+func repoRequestFields(request github.RepoRequest) map[string]string {
+	fields := map[string]string{}
+	setString := func(field string, value *string) {
+		if value != nil {
+			fields[field] = *value
+		}
+	}
+	setBool := func(field string, value *bool) {
+		if value != nil {
+			fields[field] = fmt.Sprint(*value)
+		}
+	}
+	setString("name", request.Name)
+	setString("description", request.Description)
+	setString("homepage", request.Homepage)
+	setBool("private", request.Private)
+	setBool("has_issues", request.HasIssues)
+	setBool("has_projects", request.HasProjects)
+	setBool("has_wiki", request.HasWiki)
+	setBool("allow_squash_merge", request.AllowSquashMerge)
+	setBool("allow_merge_commit", request.AllowMergeCommit)
+	setBool("allow_rebase_merge", request.AllowRebaseMerge)
+	return fields
+}
+
+func (c *planClient) CreateRepo(owner string, isUser bool, repo github.RepoCreateRequest) (*github.FullRepo, error) {
+	fields := repoRequestFields(repo.RepoRequest)
+	delete(fields, "name")
+	created := repo.ToRepo()
+	err := c.record(Change{Org: owner, Kind: RepoKind, Action: CreateAction, Name: *repo.Name, Fields: fields}, func() error {
+		var err error
+		created, err = c.Client.CreateRepo(owner, isUser, repo)
+		return err
+	})
+	if err == nil && c.planning() {
+		c.repos[owner+"/"+*repo.Name] = ""
+	}
+	return created, err
+}
+
+func (c *planClient) UpdateRepo(owner, name string, repo github.RepoUpdateRequest) (*github.FullRepo, error) {
+	fields := repoRequestFields(repo.RepoRequest)
+	if repo.DefaultBranch != nil {
+		fields["default_branch"] = *repo.DefaultBranch
+	}
+	if repo.Archived != nil {
+		fields["archived"] = fmt.Sprint(*repo.Archived)
+	}
+	updated := repo.ToRepo()
+	err := c.record(Change{Org: owner, Kind: RepoKind, Action: UpdateAction, Name: name, Fields: fields}, func() error {
+		var err error
+		updated, err = c.Client.UpdateRepo(owner, name, repo)
+		return err
+	})
+	if err == nil && c.planning() && repo.Name != nil && *repo.Name != name {
+		c.repos[owner+"/"+*repo.Name] = name
+	}
+	return updated, err
+}
+
+// currentRepo returns the name the repo has before the plan is applied, and
+// false if the plan creates it
+func (c *planClient) currentRepo(orgName, repo string) (string, bool) {
+	current, planned := c.repos[orgName+"/"+repo]
+	if !planned {
+		return repo, true
+	}
+	return current, current != ""
+}
+
+func (c *planClient) ListOutsideCollaborators(orgName, repo string) ([]github.User, error) {
+	key := orgName + "/" + repo
+	if c.collaborators[key] == nil {
+		c.collaborators[key] = sets.String{}
+	}
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return nil, nil
+	}
+	users, err := c.Client.ListOutsideCollaborators(orgName, current)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		c.collaborators[key].Insert(github.NormLogin(user.Login))
+	}
+	return users, nil
+}
+
+func (c *planClient) ListRepoInvitations(orgName, repo string) ([]github.RepoInvitation, error) {
+	key := orgName + "/" + repo
+	if c.collaborators[key] == nil {
+		c.collaborators[key] = sets.String{}
+	}
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return nil, nil
+	}
+	invitations, err := c.Client.ListRepoInvitations(orgName, current)
+	if err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		c.collaborators[key].Insert(github.NormLogin(invitation.Invitee.Login))
+	}
+	return invitations, nil
+}
+
+func (c *planClient) AddCollaborator(orgName, repo, user string, permission github.TeamPermission) error {
+	change := Change{Org: orgName, Kind: RepoCollaboratorKind, Action: CreateAction, Repo: repo, Name: user, Fields: map[string]string{"permission": string(permission)}}
+	if c.collaborators[orgName+"/"+repo].Has(github.NormLogin(user)) {
+		change.Action = UpdateAction
+	}
+	return c.record(change, func() error {
+		return c.Client.AddCollaborator(orgName, repo, user, permission)
+	})
+}
+
+func (c *planClient) RemoveCollaborator(orgName, repo, user string) error {
+	return c.record(Change{Org: orgName, Kind: RepoCollaboratorKind, Action: DeleteAction, Repo: repo, Name: user}, func() error {
+		return c.Client.RemoveCollaborator(orgName, repo, user)
+	})
+}
+
+func (c *planClient) ListRepoTopics(orgName, repo string) ([]string, error) {
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return nil, nil
+	}
+	return c.Client.ListRepoTopics(orgName, current)
+}
+
+func (c *planClient) ReplaceRepoTopics(orgName, repo string, topics []string) error {
+	return c.record(Change{Org: orgName, Kind: RepoTopicsKind, Action: UpdateAction, Name: repo, Fields: map[string]string{"topics": strings.Join(topics, ",")}}, func() error {
+		return c.Client.ReplaceRepoTopics(orgName, repo, topics)
+	})
+}
+
+func (c *planClient) ListDeployKeys(orgName, repo string) ([]github.DeployKey, error) {
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return nil, nil
+	}
+	keys, err := c.Client.ListDeployKeys(orgName, current)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		c.deployKeys[key.ID] = key.Title
+	}
+	return keys, nil
+}
+
+func (c *planClient) CreateDeployKey(orgName, repo string, key github.DeployKey) (*github.DeployKey, error) {
+	created := &key
+	err := c.record(Change{Org: orgName, Kind: RepoDeployKeyKind, Action: CreateAction, Repo: repo, Name: key.Title, Fields: map[string]string{"key": key.Key, "read_only": fmt.Sprint(key.ReadOnly)}}, func() error {
+		var err error
+		created, err = c.Client.CreateDeployKey(orgName, repo, key)
+		return err
+	})
+	return created, err
+}
+
+func (c *planClient) DeleteDeployKey(orgName, repo string, id int) error {
+	return c.record(Change{Org: orgName, Kind: RepoDeployKeyKind, Action: DeleteAction, Repo: repo, Name: c.deployKeys[id]}, func() error {
+		return c.Client.DeleteDeployKey(orgName, repo, id)
+	})
+}
+
+func (c *planClient) ListRepoHooks(orgName, repo string) ([]github.Hook, error) {
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return nil, nil
+	}
+	hooks, err := c.Client.ListRepoHooks(orgName, current)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range hooks {
+		c.hooks[hook.ID] = hook.Config.URL
+	}
+	return hooks, nil
+}
+
+// hookRequestFields returns the fields a hook request sets, never the secret
+func hookRequestFields(req github.HookRequest) map[string]string {
+	fields := map[string]string{"events": strings.Join(req.Events, ",")}
+	if req.Active != nil {
+		fields["active"] = fmt.Sprint(*req.Active)
+	}
+	if req.Config != nil && req.Config.ContentType != nil {
+		fields["content_type"] = *req.Config.ContentType
+	}
+	return fields
+}
+
+func (c *planClient) CreateRepoHook(orgName, repo string, req github.HookRequest) (int, error) {
+	var id int
+	err := c.record(Change{Org: orgName, Kind: RepoWebhookKind, Action: CreateAction, Repo: repo, Name: req.Config.URL, Fields: hookRequestFields(req)}, func() error {
+		var err error
+		id, err = c.Client.CreateRepoHook(orgName, repo, req)
+		return err
+	})
+	return id, err
+}
+
+func (c *planClient) EditRepoHook(orgName, repo string, id int, req github.HookRequest) error {
+	return c.record(Change{Org: orgName, Kind: RepoWebhookKind, Action: UpdateAction, Repo: repo, Name: c.hooks[id], Fields: hookRequestFields(req)}, func() error {
+		return c.Client.EditRepoHook(orgName, repo, id, req)
+	})
+}
+
+func (c *planClient) DeleteRepoHook(orgName, repo string, id int, req github.HookRequest) error {
+	return c.record(Change{Org: orgName, Kind: RepoWebhookKind, Action: DeleteAction, Repo: repo, Name: c.hooks[id]}, func() error {
+		return c.Client.DeleteRepoHook(orgName, repo, id, req)
+	})
+}
+
+func (c *planClient) GetVulnerabilityAlerts(orgName, repo string) (bool, error) {
+	current, exists := c.currentRepo(orgName, repo)
+	if !exists {
+		return false, nil
+	}
+	return c.Client.GetVulnerabilityAlerts(orgName, current)
+}
+
+func (c *planClient) SetVulnerabilityAlerts(orgName, repo string, enabled bool) error {
+	return c.record(Change{Org: orgName, Kind: RepoSecurityKind, Action: UpdateAction, Name: repo, Fields: map[string]string{"vulnerability_alerts": fmt.Sprint(enabled)}}, func() error {
+		return c.Client.SetVulnerabilityAlerts(orgName, repo, enabled)
+	})
+}
+
+// orgNames returns the orgs of the config in order
+func orgNames(cfg org.FullConfig) []string {
+	var names []string
+	for name := range cfg.Orgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// makePlan returns the changes configuring the orgs would make, without
+// making them.
+func makePlan(o options, client github.Client, cfg org.FullConfig, digest string) (*Plan, error) {
+	planner := newPlanClient(client, nil)
+	for _, name := range orgNames(cfg) {
+		if err := configureOrg(o, planner, name, cfg.Orgs[name]); err != nil {
+			return nil, fmt.Errorf("failed to plan %s: %v", name, err)
+		}
+	}
+	sortChanges(planner.changes)
+	return &Plan{ConfigDigest: digest, Changes: planner.changes}, nil
+}
+
+// applyPlan makes the changes of the plan, after making sure it is still
+// what configuring the orgs would do. It refuses to apply the plan if the
+// config or GitHub changed since the plan was made.
+func applyPlan(o options, client github.Client, cfg org.FullConfig, digest string, plan *Plan) error {
+	if plan.ConfigDigest != digest {
+		return fmt.Errorf("plan was made for config %s, but --config-path is %s", plan.ConfigDigest, digest)
+	}
+	current, err := makePlan(o, client, cfg, digest)
+	if err != nil {
+		return fmt.Errorf("failed to check the plan against GitHub: %v", err)
+	}
+	if drift := planDrift(plan, current); len(drift) > 0 {
+		return fmt.Errorf("GitHub has drifted since the plan was made, make a new plan:\n%s", strings.Join(drift, "\n"))
+	}
+
+	applier := newPlanClient(client, plan)
+	for _, name := range orgNames(cfg) {
+		if err := configureOrg(o, applier, name, cfg.Orgs[name]); err != nil {
+			return fmt.Errorf("failed to apply the plan to %s: %v", name, err)
+		}
+	}
+	if left := applier.unapplied(); len(left) > 0 {
+		return fmt.Errorf("%d planned changes were not applied: %s", len(left), strings.Join(left, ", "))
+	}
+	logrus.Infof("Applied %d planned changes.", len(applier.changes))
+	return nil
+}
+
+// planDrift lists the changes only one of the plans has
+func planDrift(plan, current *Plan) []string {
+	counts := map[string]int{}
+	for _, change := range plan.Changes {
+		counts[change.key()]++
+	}
+	for _, change := range current.Changes {
+		counts[change.key()]--
+	}
+	var drift []string
+	for _, change := range plan.Changes {
+		if counts[change.key()] > 0 {
+			counts[change.key()]--
+			drift = append(drift, fmt.Sprintf("- no longer needed: %s", change))
+		}
+	}
+	for _, change := range current.Changes {
+		if counts[change.key()] < 0 {
+			counts[change.key()]++
+			drift = append(drift, fmt.Sprintf("+ not planned: %s", change))
+		}
+	}
+	return drift
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeGitHub holds the state of a single org and counts mutations.
+type fakeGitHub struct {
+	github.Client
+
+	org       github.Organization
+	admins    sets.String
+	members   sets.String
+	teams     map[int]*fakeTeam
+	nextID    int
+	repos     map[string]github.FullRepo
+	mutations int
+}
+
+type fakeTeam struct {
+	team        github.Team
+	members     sets.String
+	maintainers sets.String
+	repos       map[string]github.RepoPermissionLevel
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{
+		org:     github.Organization{Login: "org", Name: "Org", DefaultRepositoryPermission: "read"},
+		admins:  sets.NewString("admin1", "admin2"),
+		members: sets.NewString("alice", "carol"),
+		teams: map[int]*fakeTeam{
+			1: {
+				team:        github.Team{ID: 1, Name: "devs", Privacy: github.PrivacyClosed},
+				members:     sets.NewString("alice"),
+				maintainers: sets.NewString(),
+				repos:       map[string]github.RepoPermissionLevel{"app": github.Read},
+			},
+			2: {
+				team:        github.Team{ID: 2, Name: "old", Privacy: github.PrivacyClosed},
+				members:     sets.NewString("carol"),
+				maintainers: sets.NewString(),
+				repos:       map[string]github.RepoPermissionLevel{},
+			},
+		},
+		nextID: 3,
+		repos:  map[string]github.FullRepo{"app": {Repo: github.Repo{Name: "app", Description: "app"}}},
+	}
+}
+
+func logins(people sets.String) []github.TeamMember {
+	var members []github.TeamMember
+	for _, login := range people.List() {
+		members = append(members, github.TeamMember{Login: login})
+	}
+	return members
+}
+
+func (c *fakeGitHub) GetOrg(name string) (*github.Organization, error) {
+	org := c.org
+	return &org, nil
+}
+
+func (c *fakeGitHub) EditOrg(name string, config github.Organization) (*github.Organization, error) {
+	c.mutations++
+	c.org = config
+	return &config, nil
+}
+
+func (c *fakeGitHub) ListOrgInvitations(org string) ([]github.OrgInvitation, error) {
+	return nil, nil
+}
+
+func (c *fakeGitHub) ListOrgMembers(org, role string) ([]github.TeamMember, error) {
+	if role == github.RoleAdmin {
+		return logins(c.admins), nil
+	}
+	return logins(c.members), nil
+}
+
+func (c *fakeGitHub) UpdateOrgMembership(org, user string, admin bool) (*github.OrgMembership, error) {
+	c.mutations++
+	c.admins.Delete(user)
+	c.members.Delete(user)
+	if admin {
+		c.admins.Insert(user)
+	} else {
+		c.members.Insert(user)
+	}
+	return &github.OrgMembership{Membership: github.Membership{State: github.StateActive}}, nil
+}
+
+func (c *fakeGitHub) RemoveOrgMembership(org, user string) error {
+	c.mutations++
+	c.admins.Delete(user)
+	c.members.Delete(user)
+	return nil
+}
+
+func (c *fakeGitHub) GetRepos(org string, isUser bool) ([]github.Repo, error) {
+	var repos []github.Repo
+	for _, repo := range c.repos {
+		repos = append(repos, repo.Repo)
+	}
+	return repos, nil
+}
+
+func (c *fakeGitHub) GetRepo(owner, name string) (github.FullRepo, error) {
+	return c.repos[name], nil
+}
+
+func (c *fakeGitHub) CreateRepo(owner string, isUser bool, repo github.RepoCreateRequest) (*github.FullRepo, error) {
+	c.mutations++
+	created := repo.ToRepo()
+	c.repos[created.Name] = *created
+	return created, nil
+}
+
+func (c *fakeGitHub) UpdateRepo(owner, name string, repo github.RepoUpdateRequest) (*github.FullRepo, error) {
+	c.mutations++
+	updated := c.repos[name]
+	if repo.Description != nil {
+		updated.Description = *repo.Description
+	}
+	c.repos[name] = updated
+	return &updated, nil
+}
+
+func (c *fakeGitHub) ListTeams(org string) ([]github.Team, error) {
+	var teams []github.Team
+	for _, t := range c.teams {
+		teams = append(teams, t.team)
+	}
+	return teams, nil
+}
+
+func (c *fakeGitHub) CreateTeam(org string, team github.Team) (*github.Team, error) {
+	c.mutations++
+	team.ID = c.nextID
+	c.nextID++
+	c.teams[team.ID] = &fakeTeam{team: team, members: sets.NewString(), maintainers: sets.NewString(), repos: map[string]github.RepoPermissionLevel{}}
+	return &team, nil
+}
+
+func (c *fakeGitHub) EditTeam(org string, team github.Team) (*github.Team, error) {
+	c.mutations++
+	c.teams[team.ID].team = team
+	return &team, nil
+}
+
+func (c *fakeGitHub) DeleteTeam(org string, id int) error {
+	c.mutations++
+	delete(c.teams, id)
+	return nil
+}
+
+func (c *fakeGitHub) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	t, ok := c.teams[id]
+	if !ok {
+		return nil, fmt.Errorf("no team %d", id)
+	}
+	if role == github.RoleMaintainer {
+		return logins(t.maintainers), nil
+	}
+	return logins(t.members), nil
+}
+
+func (c *fakeGitHub) ListTeamInvitations(org string, id int) ([]github.OrgInvitation, error) {
+	return nil, nil
+}
+
+func (c *fakeGitHub) UpdateTeamMembership(org string, id int, user string, maintainer bool) (*github.TeamMembership, error) {
+	c.mutations++
+	t := c.teams[id]
+	t.members.Delete(user)
+	t.maintainers.Delete(user)
+	if maintainer {
+		t.maintainers.Insert(user)
+	} else {
+		t.members.Insert(user)
+	}
+	return &github.TeamMembership{Membership: github.Membership{State: github.StateActive}}, nil
+}
+
+func (c *fakeGitHub) RemoveTeamMembership(org string, id int, user string) error {
+	c.mutations++
+	c.teams[id].members.Delete(user)
+	c.teams[id].maintainers.Delete(user)
+	return nil
+}
+
+func (c *fakeGitHub) ListTeamRepos(org string, id int) ([]github.Repo, error) {
+	var repos []github.Repo
+	for name, level := range c.teams[id].repos {
+		repo := github.Repo{Name: name}
+		switch level {
+		case github.Admin:
+			repo.Permissions.Admin = true
+			fallthrough
+		case github.Write:
+			repo.Permissions.Push = true
+			fallthrough
+		case github.Read:
+			repo.Permissions.Pull = true
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+func (c *fakeGitHub) UpdateTeamRepo(id int, org, repo string, permission github.TeamPermission) error {
+	c.mutations++
+	levels := map[github.TeamPermission]github.RepoPermissionLevel{github.RepoPull: github.Read, github.RepoPush: github.Write, github.RepoAdmin: github.Admin}
+	c.teams[id].repos[repo] = levels[permission]
+	return nil
+}
+
+func (c *fakeGitHub) RemoveTeamRepo(id int, org, repo string) error {
+	c.mutations++
+	delete(c.teams[id].repos, repo)
+	return nil
+}
+
+func planConfig() org.FullConfig {
+	name, description, closed := "New Org", "docs", org.Closed
+	return org.FullConfig{Orgs: map[string]org.Config{"org": {
+		Metadata: org.Metadata{Name: &name},
+		Admins:   []string{"admin1", "admin2"},
+		Members:  []string{"alice", "bob"},
+		Teams: map[string]org.Team{
+			"devs": {
+				TeamMetadata: org.TeamMetadata{Privacy: &closed},
+				Members:      []string{"alice", "bob"},
+				Repos:        map[string]github.RepoPermissionLevel{"app": github.Write, "docs": github.Read},
+			},
+			"new": {
+				TeamMetadata: org.TeamMetadata{Privacy: &closed},
+				Maintainers:  []string{"alice"},
+			},
+		},
+		Repos: map[string]org.Repo{
+			"app":  {},
+			"docs": {Description: &description},
+		},
+	}}}
+}
+
+func planOptions() options {
+	return options{
+		minAdmins:      2,
+		maximumDelta:   1,
+		fixOrg:         true,
+		fixOrgMembers:  true,
+		fixTeams:       true,
+		fixTeamMembers: true,
+		fixTeamRepos:   true,
+		fixRepos:       true,
+	}
+}
+
+func TestMakePlan(t *testing.T) {
+	client := newFakeGitHub()
+	plan, err := makePlan(planOptions(), client, planConfig(), "sha256:config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.mutations != 0 {
+		t.Errorf("expected planning to make no mutations, made %d", client.mutations)
+	}
+
+	expected := []Change{
+		{Org: "org", Kind: OrgKind, Action: UpdateAction, Name: "org", Fields: map[string]string{"name": "New Org"}},
+		{Org: "org", Kind: OrgMemberKind, Action: CreateAction, Name: "bob", Fields: map[string]string{"role": "member"}},
+		{Org: "org", Kind: OrgMemberKind, Action: DeleteAction, Name: "carol"},
+		{Org: "org", Kind: RepoKind, Action: CreateAction, Name: "docs", Fields: map[string]string{"description": "docs"}},
+		{Org: "org", Kind: TeamKind, Action: CreateAction, Name: "new", Fields: map[string]string{"privacy": "closed"}},
+		{Org: "org", Kind: TeamKind, Action: DeleteAction, Name: "old"},
+		{Org: "org", Kind: TeamMemberKind, Action: CreateAction, Team: "devs", Name: "bob", Fields: map[string]string{"role": "member"}},
+		{Org: "org", Kind: TeamMemberKind, Action: CreateAction, Team: "new", Name: "alice", Fields: map[string]string{"role": "maintainer"}},
+		{Org: "org", Kind: TeamRepoKind, Action: UpdateAction, Team: "devs", Name: "app", Fields: map[string]string{"permission": "push"}},
+		{Org: "org", Kind: TeamRepoKind, Action: CreateAction, Team: "devs", Name: "docs", Fields: map[string]string{"permission": "pull"}},
+	}
+	if !reflect.DeepEqual(plan.Changes, expected) {
+		t.Errorf("expected changes:\n%v\ngot:\n%v", expected, plan.Changes)
+	}
+
+	markdown := plan.Markdown()
+	for _, line := range []string{"10 changes:", "1 team to create", "### Org `org`", "#### team-member", "+ bob (team devs): role: \"member\"", "- carol\n"} {
+		if !strings.Contains(markdown, line) {
+			t.Errorf("expected %q in markdown:\n%s", line, markdown)
+		}
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peribolos")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "plan.json")
+
+	client := newFakeGitHub()
+	plan, err := makePlan(planOptions(), client, planConfig(), "sha256:config")
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if err := writePlan(path, plan); err != nil {
+		t.Fatalf("failed to write plan: %v", err)
+	}
+	loaded, err := loadPlan(path)
+	if err != nil {
+		t.Fatalf("failed to load plan: %v", err)
+	}
+
+	if err := applyPlan(planOptions(), client, planConfig(), "sha256:other", loaded); err == nil {
+		t.Error("expected a plan of another config to be refused")
+	}
+
+	drifted := newFakeGitHub()
+	drifted.members.Insert("dave")
+	err = applyPlan(planOptions(), drifted, planConfig(), "sha256:config", loaded)
+	if err == nil || !strings.Contains(err.Error(), "not planned: delete org-member dave") {
+		t.Errorf("expected drift removing dave to be refused, got %v", err)
+	}
+	if drifted.mutations != 0 {
+		t.Errorf("expected a drifted plan to make no mutations, made %d", drifted.mutations)
+	}
+
+	if err := applyPlan(planOptions(), client, planConfig(), "sha256:config", loaded); err != nil {
+		t.Fatalf("failed to apply plan: %v", err)
+	}
+	if client.mutations != len(plan.Changes) {
+		t.Errorf("expected %d mutations, made %d", len(plan.Changes), client.mutations)
+	}
+	after, err := makePlan(planOptions(), client, planConfig(), "sha256:config")
+	if err != nil {
+		t.Fatalf("failed to plan after applying: %v", err)
+	}
+	if len(after.Changes) != 0 {
+		t.Errorf("expected no changes after applying the plan, got %v", after.Changes)
+	}
+	if markdown := after.Markdown(); !strings.Contains(markdown, "No changes") {
+		t.Errorf("expected an empty plan, got:\n%s", markdown)
+	}
+}
+
+func TestPlanClientRefusesUnplannedChanges(t *testing.T) {
+	client := newPlanClient(newFakeGitHub(), &Plan{Changes: []Change{{Org: "org", Kind: OrgMemberKind, Action: DeleteAction, Name: "carol"}}})
+	if err := client.RemoveOrgMembership("org", "alice"); err == nil {
+		t.Error("expected removing an unplanned member to be refused")
+	}
+	if err := client.RemoveOrgMembership("org", "carol"); err != nil {
+		t.Errorf("unexpected error removing a planned member: %v", err)
+	}
+	if err := client.RemoveOrgMembership("org", "carol"); err == nil {
+		t.Error("expected removing a planned member twice to be refused")
+	}
+	if left := client.unapplied(); len(left) != 0 {
+		t.Errorf("expected all changes to be applied, left %v", left)
+	}
+}
@@ -0,0 +1,397 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// topicRegex matches the topics GitHub accepts.
+var topicRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+var teamPermissions = map[github.RepoPermissionLevel]github.TeamPermission{
+	github.Read:  github.RepoPull,
+	github.Write: github.RepoPush,
+	github.Admin: github.RepoAdmin,
+}
+
+func validateRepoSettings(orgConfig org.Config) error {
+	orgMembers := sets.NewString()
+	for _, login := range append(orgConfig.Members, orgConfig.Admins...) {
+		orgMembers.Insert(github.NormLogin(login))
+	}
+
+	var errs []error
+	for name, repo := range orgConfig.Repos {
+		for login, level := range repo.Collaborators {
+			if orgMembers.Has(github.NormLogin(login)) {
+				errs = append(errs, fmt.Errorf("repo %s: collaborator %s is an org member, grant access through a team instead", name, login))
+			}
+			if _, ok := teamPermissions[level]; !ok {
+				errs = append(errs, fmt.Errorf("repo %s: collaborator %s has permission %s, remove the collaborator instead", name, login, level))
+			}
+		}
+		for _, topic := range repo.Topics {
+			if !topicRegex.MatchString(topic) {
+				errs = append(errs, fmt.Errorf("repo %s: topic %q must be at most 50 lowercase letters, numbers and hyphens", name, topic))
+			}
+		}
+		titles := sets.NewString()
+		for _, key := range repo.DeployKeys {
+			if key.Title == "" || key.Key == "" {
+				errs = append(errs, fmt.Errorf("repo %s: deploy keys need a title and a key", name))
+			}
+			if titles.Has(key.Title) {
+				errs = append(errs, fmt.Errorf("repo %s: duplicate deploy key title %q", name, key.Title))
+			}
+			titles.Insert(key.Title)
+		}
+		urls := sets.NewString()
+		for _, hook := range repo.Webhooks {
+			if hook.URL == "" {
+				errs = append(errs, fmt.Errorf("repo %s: webhooks need a url", name))
+			}
+			if urls.Has(hook.URL) {
+				errs = append(errs, fmt.Errorf("repo %s: duplicate webhook url %q", name, hook.URL))
+			}
+			urls.Insert(hook.URL)
+			if hook.ContentType != nil && *hook.ContentType != "json" && *hook.ContentType != "form" {
+				errs = append(errs, fmt.Errorf("repo %s: webhook %s has content type %q, not json or form", name, hook.URL, *hook.ContentType))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+type repoSettingsClient interface {
+	repoCollaboratorClient
+	repoTopicsClient
+	deployKeyClient
+	repoHookClient
+	repoSecurityClient
+}
+
+// configureRepoSettings configures the collaborators, topics, deploy keys,
+// webhooks and security settings of the repos that the options fix.
+func configureRepoSettings(opt options, client repoSettingsClient, orgName string, orgConfig org.Config) error {
+	if !opt.fixRepoCollaborators && !opt.fixRepoTopics && !opt.fixRepoDeployKeys && !opt.fixRepoWebhooks && !opt.fixRepoSecurity {
+		logrus.Info("Skipping repo settings configuration")
+		return nil
+	}
+	if err := validateRepoSettings(orgConfig); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range orgConfig.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var allErrors []error
+	for _, name := range names {
+		repo := orgConfig.Repos[name]
+		repoLogger := logrus.WithField("repo", name)
+		if repo.Archived != nil && *repo.Archived {
+			repoLogger.Info("Skipping settings of archived repo")
+			continue
+		}
+		if opt.fixRepoCollaborators && repo.Collaborators != nil {
+			if err := configureRepoCollaborators(client, orgName, name, repo.Collaborators); err != nil {
+				allErrors = append(allErrors, fmt.Errorf("failed to configure %s collaborators: %v", name, err))
+			}
+		}
+		if opt.fixRepoTopics && repo.Topics != nil {
+			if err := configureRepoTopics(client, orgName, name, repo.Topics); err != nil {
+				allErrors = append(allErrors, fmt.Errorf("failed to configure %s topics: %v", name, err))
+			}
+		}
+		if opt.fixRepoDeployKeys && repo.DeployKeys != nil {
+			if err := configureDeployKeys(client, orgName, name, repo.DeployKeys); err != nil {
+				allErrors = append(allErrors, fmt.Errorf("failed to configure %s deploy keys: %v", name, err))
+			}
+		}
+		if opt.fixRepoWebhooks && repo.Webhooks != nil {
+			if err := configureRepoWebhooks(client, orgName, name, repo.Webhooks, opt.hmacTokens); err != nil {
+				allErrors = append(allErrors, fmt.Errorf("failed to configure %s webhooks: %v", name, err))
+			}
+		}
+		if opt.fixRepoSecurity && repo.VulnerabilityAlerts != nil {
+			if err := configureRepoSecurity(client, orgName, name, *repo.VulnerabilityAlerts); err != nil {
+				allErrors = append(allErrors, fmt.Errorf("failed to configure %s security settings: %v", name, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(allErrors)
+}
+
+type repoCollaboratorClient interface {
+	ListOutsideCollaborators(org, repo string) ([]github.User, error)
+	ListRepoInvitations(org, repo string) ([]github.RepoInvitation, error)
+	AddCollaborator(org, repo, user string, permission github.TeamPermission) error
+	RemoveCollaborator(org, repo, user string) error
+}
+
+// configureRepoCollaborators invites or updates the declared outside
+// collaborators, and removes all others.
+func configureRepoCollaborators(client repoCollaboratorClient, orgName, repo string, want map[string]github.RepoPermissionLevel) error {
+	have := map[string]github.RepoPermissionLevel{}
+	collaborators, err := client.ListOutsideCollaborators(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list collaborators: %v", err)
+	}
+	for _, user := range collaborators {
+		have[github.NormLogin(user.Login)] = github.LevelFromPermissions(user.Permissions)
+	}
+	invitations, err := client.ListRepoInvitations(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list invitations: %v", err)
+	}
+	invitees := sets.NewString()
+	for _, invitation := range invitations {
+		login := github.NormLogin(invitation.Invitee.Login)
+		invitees.Insert(login)
+		have[login] = github.RepoPermissionLevel(invitation.Permissions)
+	}
+
+	wantNorm := sets.NewString()
+	var errs []error
+	for user, level := range want {
+		wantNorm.Insert(github.NormLogin(user))
+		if have[github.NormLogin(user)] == level {
+			continue
+		}
+		if err := client.AddCollaborator(orgName, repo, user, teamPermissions[level]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set %s permission to %s: %v", user, level, err))
+		}
+	}
+	for _, user := range collaborators {
+		if wantNorm.Has(github.NormLogin(user.Login)) {
+			continue
+		}
+		if err := client.RemoveCollaborator(orgName, repo, user.Login); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %v", user.Login, err))
+		}
+	}
+	for _, login := range invitees.Difference(wantNorm).List() {
+		logrus.WithFields(logrus.Fields{"repo": repo, "user": login}).Warn("Undeclared collaborator has a pending invitation, not removing it.")
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+type repoTopicsClient interface {
+	ListRepoTopics(org, repo string) ([]string, error)
+	ReplaceRepoTopics(org, repo string, topics []string) error
+}
+
+// configureRepoTopics replaces the topics of the repo unless they already
+// match the declared ones.
+func configureRepoTopics(client repoTopicsClient, orgName, repo string, want []string) error {
+	have, err := client.ListRepoTopics(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list topics: %v", err)
+	}
+	wantTopics := sets.NewString(want...)
+	if sets.NewString(have...).Equal(wantTopics) {
+		return nil
+	}
+	return client.ReplaceRepoTopics(orgName, repo, wantTopics.List())
+}
+
+type deployKeyClient interface {
+	ListDeployKeys(org, repo string) ([]github.DeployKey, error)
+	CreateDeployKey(org, repo string, key github.DeployKey) (*github.DeployKey, error)
+	DeleteDeployKey(org, repo string, id int) error
+}
+
+// sameKey compares public keys without their comments, which GitHub drops.
+func sameKey(a, b string) bool {
+	fieldsA, fieldsB := strings.Fields(a), strings.Fields(b)
+	if len(fieldsA) < 2 || len(fieldsB) < 2 {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return fieldsA[0] == fieldsB[0] && fieldsA[1] == fieldsB[1]
+}
+
+// configureDeployKeys adds the declared deploy keys and removes all others.
+// Deploy keys can't be edited, so changed keys are replaced.
+func configureDeployKeys(client deployKeyClient, orgName, repo string, want []org.DeployKey) error {
+	keys, err := client.ListDeployKeys(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list deploy keys: %v", err)
+	}
+	have := map[string]github.DeployKey{}
+	var errs []error
+	for _, key := range keys {
+		if _, dup := have[key.Title]; dup {
+			// Titles identify keys, so remove duplicates and recreate them.
+			if err := client.DeleteDeployKey(orgName, repo, key.ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete duplicate deploy key %s: %v", key.Title, err))
+			}
+			continue
+		}
+		have[key.Title] = key
+	}
+
+	wantTitles := sets.NewString()
+	for _, key := range want {
+		wantTitles.Insert(key.Title)
+		readOnly := key.ReadOnly == nil || *key.ReadOnly
+		if current, ok := have[key.Title]; ok {
+			if sameKey(current.Key, key.Key) && current.ReadOnly == readOnly {
+				continue
+			}
+			if err := client.DeleteDeployKey(orgName, repo, current.ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete changed deploy key %s: %v", key.Title, err))
+				continue
+			}
+		}
+		if _, err := client.CreateDeployKey(orgName, repo, github.DeployKey{Title: key.Title, Key: key.Key, ReadOnly: readOnly}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create deploy key %s: %v", key.Title, err))
+		}
+	}
+	for title, key := range have {
+		if wantTitles.Has(title) {
+			continue
+		}
+		if err := client.DeleteDeployKey(orgName, repo, key.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete deploy key %s: %v", title, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+type repoHookClient interface {
+	ListRepoHooks(org, repo string) ([]github.Hook, error)
+	CreateRepoHook(org, repo string, req github.HookRequest) (int, error)
+	EditRepoHook(org, repo string, id int, req github.HookRequest) error
+	DeleteRepoHook(org, repo string, id int, req github.HookRequest) error
+}
+
+// configureRepoWebhooks creates or updates the declared webhooks, signed with
+// the newest hmac token of the repo, and deletes all others.
+//
+// GitHub never returns the secret of a hook, so a hook is only edited when
+// its url, events, content type or activity differ. Every edit sets the
+// secret again, as editing the config of a hook replaces it as a whole.
+func configureRepoWebhooks(client repoHookClient, orgName, repo string, want []org.Webhook, hmacTokens func() []byte) error {
+	hooks, err := client.ListRepoHooks(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	have := map[string]github.Hook{}
+	for _, hook := range hooks {
+		have[hook.Config.URL] = hook
+	}
+
+	var secret *string
+	hookRequest := func(hook org.Webhook) (github.HookRequest, error) {
+		if secret == nil {
+			if hmacTokens == nil {
+				return github.HookRequest{}, fmt.Errorf("webhooks need --hmac-token-path")
+			}
+			token, err := github.HMACForRepo(orgName+"/"+repo, hmacTokens)
+			if err != nil {
+				return github.HookRequest{}, fmt.Errorf("failed to get the hmac token: %v", err)
+			}
+			secret = &token
+		}
+		events := hook.Events
+		if len(events) == 0 {
+			events = github.AllHookEvents
+		}
+		contentType := "json"
+		if hook.ContentType != nil {
+			contentType = *hook.ContentType
+		}
+		active := hook.Active == nil || *hook.Active
+		return github.HookRequest{
+			Name:   "web",
+			Active: &active,
+			Events: events,
+			Config: &github.HookConfig{
+				URL:         hook.URL,
+				ContentType: &contentType,
+				Secret:      secret,
+			},
+		}, nil
+	}
+
+	wantURLs := sets.NewString()
+	var errs []error
+	for _, hook := range want {
+		wantURLs.Insert(hook.URL)
+		req, err := hookRequest(hook)
+		if err != nil {
+			return err
+		}
+		current, ok := have[hook.URL]
+		if !ok {
+			if _, err := client.CreateRepoHook(orgName, repo, req); err != nil {
+				errs = append(errs, fmt.Errorf("failed to create webhook %s: %v", hook.URL, err))
+			}
+			continue
+		}
+		currentContentType := "form"
+		if current.Config.ContentType != nil {
+			currentContentType = *current.Config.ContentType
+		}
+		if current.Active == *req.Active && currentContentType == *req.Config.ContentType && sets.NewString(current.Events...).Equal(sets.NewString(req.Events...)) {
+			continue
+		}
+		req.Name = ""
+		if err := client.EditRepoHook(orgName, repo, current.ID, req); err != nil {
+			errs = append(errs, fmt.Errorf("failed to edit webhook %s: %v", hook.URL, err))
+		}
+	}
+	for url, hook := range have {
+		if wantURLs.Has(url) {
+			continue
+		}
+		if err := client.DeleteRepoHook(orgName, repo, hook.ID, github.HookRequest{}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete webhook %s: %v", url, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+type repoSecurityClient interface {
+	GetVulnerabilityAlerts(org, repo string) (bool, error)
+	SetVulnerabilityAlerts(org, repo string, enabled bool) error
+}
+
+// configureRepoSecurity enables or disables vulnerability alerts.
+func configureRepoSecurity(client repoSecurityClient, orgName, repo string, vulnerabilityAlerts bool) error {
+	enabled, err := client.GetVulnerabilityAlerts(orgName, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get vulnerability alerts: %v", err)
+	}
+	if enabled == vulnerabilityAlerts {
+		return nil
+	}
+	return client.SetVulnerabilityAlerts(orgName, repo, vulnerabilityAlerts)
+}
@@ -0,0 +1,472 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config/org"
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeRepoSettings holds the settings of the repos of a single org and
+// records mutations.
+type fakeRepoSettings struct {
+	collaborators map[string]map[string]github.RepoPermissionLevel
+	invitees      map[string]map[string]github.RepoPermissionLevel
+	topics        map[string][]string
+	keys          map[string][]github.DeployKey
+	hooks         map[string][]github.Hook
+	alerts        map[string]bool
+	nextID        int
+	mutations     []string
+}
+
+func newFakeRepoSettings() *fakeRepoSettings {
+	return &fakeRepoSettings{
+		collaborators: map[string]map[string]github.RepoPermissionLevel{},
+		invitees:      map[string]map[string]github.RepoPermissionLevel{},
+		topics:        map[string][]string{},
+		keys:          map[string][]github.DeployKey{},
+		hooks:         map[string][]github.Hook{},
+		alerts:        map[string]bool{},
+		nextID:        100,
+	}
+}
+
+func (c *fakeRepoSettings) mutate(format string, args ...interface{}) {
+	c.mutations = append(c.mutations, fmt.Sprintf(format, args...))
+}
+
+func (c *fakeRepoSettings) ListOutsideCollaborators(org, repo string) ([]github.User, error) {
+	var users []github.User
+	for login, level := range c.collaborators[repo] {
+		users = append(users, github.User{Login: login, Permissions: github.PermissionsFromTeamPermission(teamPermissions[level])})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+	return users, nil
+}
+
+func (c *fakeRepoSettings) ListRepoInvitations(org, repo string) ([]github.RepoInvitation, error) {
+	var invitations []github.RepoInvitation
+	for login, level := range c.invitees[repo] {
+		invitations = append(invitations, github.RepoInvitation{Invitee: github.User{Login: login}, Permissions: string(level)})
+	}
+	return invitations, nil
+}
+
+func (c *fakeRepoSettings) AddCollaborator(org, repo, user string, permission github.TeamPermission) error {
+	c.mutate("add %s %s", user, permission)
+	if c.invitees[repo] == nil {
+		c.invitees[repo] = map[string]github.RepoPermissionLevel{}
+	}
+	levels := map[github.TeamPermission]github.RepoPermissionLevel{github.RepoPull: github.Read, github.RepoPush: github.Write, github.RepoAdmin: github.Admin}
+	if _, ok := c.collaborators[repo][user]; ok {
+		c.collaborators[repo][user] = levels[permission]
+	} else {
+		c.invitees[repo][user] = levels[permission]
+	}
+	return nil
+}
+
+func (c *fakeRepoSettings) RemoveCollaborator(org, repo, user string) error {
+	c.mutate("remove %s", user)
+	delete(c.collaborators[repo], user)
+	return nil
+}
+
+func (c *fakeRepoSettings) ListRepoTopics(org, repo string) ([]string, error) {
+	return c.topics[repo], nil
+}
+
+func (c *fakeRepoSettings) ReplaceRepoTopics(org, repo string, topics []string) error {
+	c.mutate("topics %s", strings.Join(topics, ","))
+	c.topics[repo] = topics
+	return nil
+}
+
+func (c *fakeRepoSettings) ListDeployKeys(org, repo string) ([]github.DeployKey, error) {
+	return c.keys[repo], nil
+}
+
+func (c *fakeRepoSettings) CreateDeployKey(org, repo string, key github.DeployKey) (*github.DeployKey, error) {
+	c.mutate("create key %s", key.Title)
+	key.ID = c.nextID
+	c.nextID++
+	// GitHub drops the comment of keys
+	key.Key = strings.Join(strings.Fields(key.Key)[:2], " ")
+	c.keys[repo] = append(c.keys[repo], key)
+	return &key, nil
+}
+
+func (c *fakeRepoSettings) DeleteDeployKey(org, repo string, id int) error {
+	var keys []github.DeployKey
+	for _, key := range c.keys[repo] {
+		if key.ID == id {
+			c.mutate("delete key %s", key.Title)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	c.keys[repo] = keys
+	return nil
+}
+
+func (c *fakeRepoSettings) ListRepoHooks(org, repo string) ([]github.Hook, error) {
+	return c.hooks[repo], nil
+}
+
+func (c *fakeRepoSettings) CreateRepoHook(org, repo string, req github.HookRequest) (int, error) {
+	c.mutate("create hook %s with secret %s", req.Config.URL, *req.Config.Secret)
+	hook := github.Hook{ID: c.nextID, Name: req.Name, Events: req.Events, Active: *req.Active, Config: *req.Config}
+	hook.Config.Secret = nil
+	c.nextID++
+	c.hooks[repo] = append(c.hooks[repo], hook)
+	return hook.ID, nil
+}
+
+func (c *fakeRepoSettings) EditRepoHook(org, repo string, id int, req github.HookRequest) error {
+	for i, hook := range c.hooks[repo] {
+		if hook.ID == id {
+			c.mutate("edit hook %s with secret %s", hook.Config.URL, *req.Config.Secret)
+			c.hooks[repo][i] = github.Hook{ID: id, Name: hook.Name, Events: req.Events, Active: *req.Active, Config: *req.Config}
+			c.hooks[repo][i].Config.Secret = nil
+		}
+	}
+	return nil
+}
+
+func (c *fakeRepoSettings) DeleteRepoHook(org, repo string, id int, req github.HookRequest) error {
+	var hooks []github.Hook
+	for _, hook := range c.hooks[repo] {
+		if hook.ID == id {
+			c.mutate("delete hook %s", hook.Config.URL)
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	c.hooks[repo] = hooks
+	return nil
+}
+
+func (c *fakeRepoSettings) GetVulnerabilityAlerts(org, repo string) (bool, error) {
+	return c.alerts[repo], nil
+}
+
+func (c *fakeRepoSettings) SetVulnerabilityAlerts(org, repo string, enabled bool) error {
+	c.mutate("alerts %t", enabled)
+	c.alerts[repo] = enabled
+	return nil
+}
+
+func TestValidateRepoSettings(t *testing.T) {
+	form, xml := "form", "xml"
+	testCases := []struct {
+		name      string
+		repo      org.Repo
+		expectErr bool
+	}{
+		{
+			name: "valid settings",
+			repo: org.Repo{
+				Collaborators: map[string]github.RepoPermissionLevel{"outsider": github.Write},
+				Topics:        []string{"kubernetes", "k8s-sig-testing"},
+				DeployKeys:    []org.DeployKey{{Title: "ci", Key: "ssh-ed25519 AAAA"}},
+				Webhooks:      []org.Webhook{{URL: "https://hook.example.com/hook", ContentType: &form}},
+			},
+		},
+		{
+			name:      "org members cannot be collaborators",
+			repo:      org.Repo{Collaborators: map[string]github.RepoPermissionLevel{"Alice": github.Read}},
+			expectErr: true,
+		},
+		{
+			name:      "collaborators need a permission",
+			repo:      org.Repo{Collaborators: map[string]github.RepoPermissionLevel{"outsider": github.None}},
+			expectErr: true,
+		},
+		{
+			name:      "topics are lowercase",
+			repo:      org.Repo{Topics: []string{"Kubernetes"}},
+			expectErr: true,
+		},
+		{
+			name:      "deploy key titles are unique",
+			repo:      org.Repo{DeployKeys: []org.DeployKey{{Title: "ci", Key: "ssh-ed25519 AAAA"}, {Title: "ci", Key: "ssh-ed25519 BBBB"}}},
+			expectErr: true,
+		},
+		{
+			name:      "webhook urls are unique",
+			repo:      org.Repo{Webhooks: []org.Webhook{{URL: "https://hook.example.com/hook"}, {URL: "https://hook.example.com/hook"}}},
+			expectErr: true,
+		},
+		{
+			name:      "webhook content type is json or form",
+			repo:      org.Repo{Webhooks: []org.Webhook{{URL: "https://hook.example.com/hook", ContentType: &xml}}},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := org.Config{Members: []string{"alice"}, Repos: map[string]org.Repo{"repo": tc.repo}}
+			err := validateRepoSettings(cfg)
+			if err != nil != tc.expectErr {
+				t.Errorf("expected error %t, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigureRepoCollaborators(t *testing.T) {
+	client := newFakeRepoSettings()
+	client.collaborators["repo"] = map[string]github.RepoPermissionLevel{"keep": github.Write, "promote": github.Read, "drop": github.Read}
+	client.invitees["repo"] = map[string]github.RepoPermissionLevel{"invited": github.Read, "stale": github.Read}
+	want := map[string]github.RepoPermissionLevel{
+		"keep":    github.Write,
+		"promote": github.Admin,
+		"invited": github.Read,
+		"new":     github.Read,
+	}
+	if err := configureRepoCollaborators(client, "org", "repo", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(client.mutations)
+	expected := []string{"add new pull", "add promote admin", "remove drop"}
+	if !reflect.DeepEqual(client.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, client.mutations)
+	}
+}
+
+func TestConfigureRepoSettingsUnmanagedCollaborators(t *testing.T) {
+	client := newFakeRepoSettings()
+	client.collaborators["managed"] = map[string]github.RepoPermissionLevel{"outsider": github.Read}
+	client.collaborators["unmanaged"] = map[string]github.RepoPermissionLevel{"outsider": github.Read}
+	cfg := org.Config{Repos: map[string]org.Repo{
+		"managed":   {Collaborators: map[string]github.RepoPermissionLevel{}},
+		"unmanaged": {},
+	}}
+	if err := configureRepoSettings(options{fixRepoCollaborators: true}, client, "org", cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"remove outsider"}; !reflect.DeepEqual(client.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, client.mutations)
+	}
+	if _, ok := client.collaborators["unmanaged"]["outsider"]; !ok {
+		t.Error("expected the collaborators of a repo without any configured to be left alone")
+	}
+}
+
+func TestConfigureRepoTopics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		have     []string
+		want     []string
+		expected []string
+	}{
+		{
+			name: "same topics in another order are unchanged",
+			have: []string{"b", "a"},
+			want: []string{"a", "b"},
+		},
+		{
+			name:     "different topics are replaced",
+			have:     []string{"a"},
+			want:     []string{"c", "b"},
+			expected: []string{"topics b,c"},
+		},
+		{
+			name:     "empty topics remove all",
+			have:     []string{"a"},
+			want:     []string{},
+			expected: []string{"topics "},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newFakeRepoSettings()
+			client.topics["repo"] = tc.have
+			if err := configureRepoTopics(client, "org", "repo", tc.want); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(client.mutations, tc.expected) {
+				t.Errorf("expected mutations %v, got %v", tc.expected, client.mutations)
+			}
+		})
+	}
+}
+
+func TestConfigureDeployKeys(t *testing.T) {
+	writable := false
+	client := newFakeRepoSettings()
+	client.keys["repo"] = []github.DeployKey{
+		{ID: 1, Title: "same", Key: "ssh-ed25519 AAAA", ReadOnly: true},
+		{ID: 2, Title: "rotated", Key: "ssh-ed25519 BBBB", ReadOnly: true},
+		{ID: 3, Title: "writable", Key: "ssh-ed25519 CCCC", ReadOnly: true},
+		{ID: 4, Title: "old", Key: "ssh-ed25519 DDDD", ReadOnly: true},
+	}
+	want := []org.DeployKey{
+		{Title: "same", Key: "ssh-ed25519 AAAA ci@example.com"},
+		{Title: "rotated", Key: "ssh-ed25519 EEEE"},
+		{Title: "writable", Key: "ssh-ed25519 CCCC", ReadOnly: &writable},
+		{Title: "new", Key: "ssh-ed25519 FFFF"},
+	}
+	if err := configureDeployKeys(client, "org", "repo", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"delete key rotated", "create key rotated", "delete key writable", "create key writable", "create key new", "delete key old"}
+	if !reflect.DeepEqual(client.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, client.mutations)
+	}
+
+	client.mutations = nil
+	if err := configureDeployKeys(client, "org", "repo", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.mutations) != 0 {
+		t.Errorf("expected configured keys to be unchanged, got %v", client.mutations)
+	}
+}
+
+func TestConfigureRepoWebhooks(t *testing.T) {
+	json, inactive := "json", false
+	client := newFakeRepoSettings()
+	client.hooks["repo"] = []github.Hook{
+		{ID: 1, Name: "web", Events: []string{"*"}, Active: true, Config: github.HookConfig{URL: "https://hook.example.com/same", ContentType: &json}},
+		{ID: 2, Name: "web", Events: []string{"push"}, Active: true, Config: github.HookConfig{URL: "https://hook.example.com/events", ContentType: &json}},
+		{ID: 3, Name: "web", Events: []string{"*"}, Active: true, Config: github.HookConfig{URL: "https://hook.example.com/old", ContentType: &json}},
+	}
+	want := []org.Webhook{
+		{URL: "https://hook.example.com/same"},
+		{URL: "https://hook.example.com/events", Events: []string{"push", "pull_request"}},
+		{URL: "https://hook.example.com/new", Active: &inactive},
+	}
+	tokens := func() []byte {
+		return []byte(`
+'*':
+  - value: global
+    created_at: 2020-10-02T15:00:00Z
+'org/repo':
+  - value: old
+    created_at: 2019-10-02T15:00:00Z
+  - value: new
+    created_at: 2020-10-02T15:00:00Z
+`)
+	}
+	if err := configureRepoWebhooks(client, "org", "repo", want, tokens); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(client.mutations)
+	expected := []string{
+		"create hook https://hook.example.com/new with secret new",
+		"delete hook https://hook.example.com/old",
+		"edit hook https://hook.example.com/events with secret new",
+	}
+	if !reflect.DeepEqual(client.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, client.mutations)
+	}
+
+	client.mutations = nil
+	if err := configureRepoWebhooks(client, "org", "repo", want, tokens); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.mutations) != 0 {
+		t.Errorf("expected configured webhooks to be unchanged, got %v", client.mutations)
+	}
+
+	if err := configureRepoWebhooks(newFakeRepoSettings(), "org", "repo", want, nil); err == nil {
+		t.Error("expected an error creating webhooks without hmac tokens")
+	}
+}
+
+func TestConfigureRepoSecurity(t *testing.T) {
+	client := newFakeRepoSettings()
+	if err := configureRepoSecurity(client, "org", "repo", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := configureRepoSecurity(client, "org", "repo", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"alerts true"}
+	if !reflect.DeepEqual(client.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, client.mutations)
+	}
+}
+
+// fakeGitHubWithRepoSettings adds repo settings to the fake of plan_test.go
+type fakeGitHubWithRepoSettings struct {
+	*fakeGitHub
+	*fakeRepoSettings
+}
+
+func TestPlanRepoSettings(t *testing.T) {
+	enabled := true
+	opt := planOptions()
+	opt.fixRepoCollaborators = true
+	opt.fixRepoTopics = true
+	opt.fixRepoSecurity = true
+	cfg := planConfig()
+	orgConfig := cfg.Orgs["org"]
+	orgConfig.Repos = map[string]org.Repo{
+		"app":  {Topics: []string{"app"}, Collaborators: map[string]github.RepoPermissionLevel{"outsider": github.Read}},
+		"docs": {Topics: []string{"docs"}, VulnerabilityAlerts: &enabled},
+	}
+	cfg.Orgs["org"] = orgConfig
+
+	settings := newFakeRepoSettings()
+	settings.collaborators["app"] = map[string]github.RepoPermissionLevel{"outsider": github.Write}
+	client := &fakeGitHubWithRepoSettings{fakeGitHub: newFakeGitHub(), fakeRepoSettings: settings}
+
+	plan, err := makePlan(opt, client, cfg, "sha256:config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(settings.mutations) != 0 {
+		t.Errorf("expected planning to make no mutations, made %v", settings.mutations)
+	}
+	var actual []Change
+	for _, change := range plan.Changes {
+		if strings.HasPrefix(string(change.Kind), "repo-") {
+			actual = append(actual, change)
+		}
+	}
+	// docs is created by the plan, so all its settings are changes
+	expected := []Change{
+		{Org: "org", Kind: RepoCollaboratorKind, Action: UpdateAction, Repo: "app", Name: "outsider", Fields: map[string]string{"permission": "pull"}},
+		{Org: "org", Kind: RepoTopicsKind, Action: UpdateAction, Name: "app", Fields: map[string]string{"topics": "app"}},
+		{Org: "org", Kind: RepoTopicsKind, Action: UpdateAction, Name: "docs", Fields: map[string]string{"topics": "docs"}},
+		{Org: "org", Kind: RepoSecurityKind, Action: UpdateAction, Name: "docs", Fields: map[string]string{"vulnerability_alerts": "true"}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected changes:\n%v\ngot:\n%v", expected, actual)
+	}
+	if markdown := plan.Markdown(); !strings.Contains(markdown, "~ outsider (repo app): permission: \"pull\"") {
+		t.Errorf("expected the collaborator change in markdown:\n%s", markdown)
+	}
+
+	if err := applyPlan(opt, client, cfg, "sha256:config", plan); err != nil {
+		t.Fatalf("failed to apply plan: %v", err)
+	}
+	if applied := sets.NewString(settings.mutations...); !applied.Equal(sets.NewString("add outsider pull", "topics app", "topics docs", "alerts true")) {
+		t.Errorf("expected the planned settings to be applied, got %v", settings.mutations)
+	}
+}
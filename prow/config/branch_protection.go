@@ -19,9 +19,12 @@ package config
 import (
 	"errors"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -44,6 +47,13 @@ type Policy struct {
 	AllowForcePushes *bool `json:"allow_force_pushes,omitempty"`
 	// AllowDeletions allows deletion of the protected branch by anyone with write access to the repository.
 	AllowDeletions *bool `json:"allow_deletions,omitempty"`
+	// RequiredConversationResolution requires all conversations on code to be resolved before a pull request can be merged.
+	RequiredConversationResolution *bool `json:"required_conversation_resolution,omitempty"`
+	// RequiredSignatures requires commits pushed to the branch to have verified signatures.
+	RequiredSignatures *bool `json:"required_signatures,omitempty"`
+	// ProtectedTags specifies patterns of tags that only maintainers and admins can create or delete.
+	// Unlike the other settings it applies to the whole repo, so it is ignored at the branch level.
+	ProtectedTags []string `json:"protected_tags,omitempty"`
 	// Exclude specifies a set of regular expressions which identify branches
 	// that should be excluded from the protection policy
 	Exclude []string `json:"exclude,omitempty"`
@@ -51,7 +61,8 @@ type Policy struct {
 
 func (p Policy) defined() bool {
 	return p.Protect != nil || p.RequiredStatusChecks != nil || p.Admins != nil || p.Restrictions != nil || p.RequiredPullRequestReviews != nil ||
-		p.RequiredLinearHistory != nil || p.AllowForcePushes != nil || p.AllowDeletions != nil
+		p.RequiredLinearHistory != nil || p.AllowForcePushes != nil || p.AllowDeletions != nil ||
+		p.RequiredConversationResolution != nil || p.RequiredSignatures != nil
 }
 
 // ContextPolicy configures required github contexts.
@@ -158,15 +169,18 @@ func mergeRestrictions(parent, child *Restrictions) *Restrictions {
 // Apply returns a policy that merges the child into the parent
 func (p Policy) Apply(child Policy) Policy {
 	return Policy{
-		Protect:                    selectBool(p.Protect, child.Protect),
-		RequiredStatusChecks:       mergeContextPolicy(p.RequiredStatusChecks, child.RequiredStatusChecks),
-		Admins:                     selectBool(p.Admins, child.Admins),
-		RequiredLinearHistory:      selectBool(p.RequiredLinearHistory, child.RequiredLinearHistory),
-		AllowForcePushes:           selectBool(p.AllowForcePushes, child.AllowForcePushes),
-		AllowDeletions:             selectBool(p.AllowDeletions, child.AllowDeletions),
-		Restrictions:               mergeRestrictions(p.Restrictions, child.Restrictions),
-		RequiredPullRequestReviews: mergeReviewPolicy(p.RequiredPullRequestReviews, child.RequiredPullRequestReviews),
-		Exclude:                    unionStrings(p.Exclude, child.Exclude),
+		Protect:                        selectBool(p.Protect, child.Protect),
+		RequiredStatusChecks:           mergeContextPolicy(p.RequiredStatusChecks, child.RequiredStatusChecks),
+		Admins:                         selectBool(p.Admins, child.Admins),
+		RequiredLinearHistory:          selectBool(p.RequiredLinearHistory, child.RequiredLinearHistory),
+		AllowForcePushes:               selectBool(p.AllowForcePushes, child.AllowForcePushes),
+		AllowDeletions:                 selectBool(p.AllowDeletions, child.AllowDeletions),
+		RequiredConversationResolution: selectBool(p.RequiredConversationResolution, child.RequiredConversationResolution),
+		RequiredSignatures:             selectBool(p.RequiredSignatures, child.RequiredSignatures),
+		Restrictions:                   mergeRestrictions(p.Restrictions, child.Restrictions),
+		RequiredPullRequestReviews:     mergeReviewPolicy(p.RequiredPullRequestReviews, child.RequiredPullRequestReviews),
+		Exclude:                        unionStrings(p.Exclude, child.Exclude),
+		ProtectedTags:                  unionStrings(p.ProtectedTags, child.ProtectedTags),
 	}
 }
 
@@ -219,11 +233,21 @@ func (o Org) GetRepo(name string) *Repo {
 type Repo struct {
 	Policy   `json:",inline"`
 	Branches map[string]Branch `json:"branches,omitempty"`
+	// BranchPatterns holds protection policy overrides for the branches whose
+	// names match a pattern such as release-*, in the syntax of path.Match.
+	// Branches listed in Branches ignore these patterns.
+	BranchPatterns map[string]Branch `json:"branch_patterns,omitempty"`
 }
 
 // GetBranch returns the branch config after merging in any repo policies.
 func (r Repo) GetBranch(name string) (*Branch, error) {
 	b, ok := r.Branches[name]
+	if !ok {
+		var err error
+		if b, ok, err = r.matchBranchPattern(name); err != nil {
+			return nil, err
+		}
+	}
 	if ok {
 		b.Policy = r.Apply(b.Policy)
 		if b.Protect == nil {
@@ -235,11 +259,49 @@ func (r Repo) GetBranch(name string) (*Branch, error) {
 	return &b, nil
 }
 
+// matchBranchPattern returns the policy of the only branch pattern the name matches.
+func (r Repo) matchBranchPattern(name string) (Branch, bool, error) {
+	var matches []string
+	for pattern := range r.BranchPatterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return Branch{}, false, fmt.Errorf("invalid branch pattern %q: %v", pattern, err)
+		}
+		if matched {
+			matches = append(matches, pattern)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Branch{}, false, nil
+	case 1:
+		return r.BranchPatterns[matches[0]], true, nil
+	default:
+		sort.Strings(matches)
+		return Branch{}, false, fmt.Errorf("branch %s matches several patterns: %s", name, strings.Join(matches, ", "))
+	}
+}
+
 // Branch holds protection policy overrides for a particular branch.
 type Branch struct {
 	Policy `json:",inline"`
 }
 
+// validate ensures the branch patterns are well formed.
+func (bp BranchProtection) validate() error {
+	var errs []error
+	for orgName, org := range bp.Orgs {
+		for repoName, repo := range org.Repos {
+			for pattern := range repo.BranchPatterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Errorf("branch-protection: %s/%s: invalid branch pattern %q: %v", orgName, repoName, pattern, err))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
 // GetBranchProtection returns the policy for a given branch.
 //
 // Handles merging any policies defined at repo/org/global levels into the branch policy.
@@ -276,6 +276,32 @@ func TestApply(test *testing.T) {
 				Protect: &t,
 			},
 		},
+		{
+			name: "merge signature and conversation settings",
+			parent: Policy{
+				RequiredSignatures:             &t,
+				RequiredConversationResolution: &t,
+			},
+			child: Policy{
+				RequiredConversationResolution: &f,
+			},
+			expected: Policy{
+				RequiredSignatures:             &t,
+				RequiredConversationResolution: &f,
+			},
+		},
+		{
+			name: "merge protected tags",
+			child: Policy{
+				ProtectedTags: []string{"v*"},
+			},
+			parent: Policy{
+				ProtectedTags: []string{"release-*"},
+			},
+			expected: Policy{
+				ProtectedTags: []string{"release-*", "v*"},
+			},
+		},
 		{
 			name: "merge exclusion strings",
 			child: Policy{
@@ -816,6 +842,116 @@ func TestConfig_GetBranchProtection(t *testing.T) {
 			},
 			expected: nil,
 		},
+		{
+			name: "protect via branch pattern",
+			config: Config{
+				ProwConfig: ProwConfig{
+					BranchProtection: BranchProtection{
+						Orgs: map[string]Org{
+							"org": {
+								Repos: map[string]Repo{
+									"repo": {
+										Policy: Policy{
+											RequiredSignatures: no,
+										},
+										BranchPatterns: map[string]Branch{
+											"bran*": {
+												Policy: Policy{
+													Protect:            yes,
+													RequiredSignatures: yes,
+												},
+											},
+											"release-*": {
+												Policy: Policy{
+													Protect: no,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: &Policy{Protect: yes, RequiredSignatures: yes},
+		},
+		{
+			name: "branch name overrides branch pattern",
+			config: Config{
+				ProwConfig: ProwConfig{
+					BranchProtection: BranchProtection{
+						Orgs: map[string]Org{
+							"org": {
+								Repos: map[string]Repo{
+									"repo": {
+										Branches: map[string]Branch{
+											"branch": {
+												Policy: Policy{
+													Protect: yes,
+												},
+											},
+										},
+										BranchPatterns: map[string]Branch{
+											"bran*": {
+												Policy: Policy{
+													Protect:                        yes,
+													RequiredConversationResolution: yes,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: &Policy{Protect: yes},
+		},
+		{
+			name: "branch matching several patterns",
+			config: Config{
+				ProwConfig: ProwConfig{
+					BranchProtection: BranchProtection{
+						Orgs: map[string]Org{
+							"org": {
+								Repos: map[string]Repo{
+									"repo": {
+										BranchPatterns: map[string]Branch{
+											"bran*":  {Policy: Policy{Protect: yes}},
+											"*ranch": {Policy: Policy{Protect: yes}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			err: true,
+		},
+		{
+			name: "branch pattern must set protect",
+			config: Config{
+				ProwConfig: ProwConfig{
+					BranchProtection: BranchProtection{
+						Orgs: map[string]Org{
+							"org": {
+								Repos: map[string]Repo{
+									"repo": {
+										BranchPatterns: map[string]Branch{
+											"b*": {Policy: Policy{RequiredSignatures: yes}},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			err: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -839,6 +975,35 @@ func TestConfig_GetBranchProtection(t *testing.T) {
 	}
 }
 
+func TestBranchProtectionValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns map[string]Branch
+		err      bool
+	}{
+		{
+			name: "no patterns",
+		},
+		{
+			name:     "valid patterns",
+			patterns: map[string]Branch{"release-*": {}, "feature/[a-z]?": {}},
+		},
+		{
+			name:     "invalid pattern",
+			patterns: map[string]Branch{"release-[": {}},
+			err:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bp := BranchProtection{Orgs: map[string]Org{"org": {Repos: map[string]Repo{"repo": {BranchPatterns: tc.patterns}}}}}
+			if err := bp.validate(); (err != nil) != tc.err {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
 func TestReposWithDisabledPolicy(t *testing.T) {
 	testCases := []struct {
 		name              string
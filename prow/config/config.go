@@ -81,6 +81,8 @@ type Config struct {
 type JobConfig struct {
 	// Presets apply to all job types.
 	Presets []Preset `json:"presets,omitempty"`
+	// JobTemplates can be extended by jobs of all types.
+	JobTemplates []JobTemplate `json:"job_templates,omitempty"`
 	// .PresubmitsStatic contains the presubmits in Prows main config.
 	// **Warning:** This does not return dynamic Presubmits configured
 	// inside the code repo, hence giving an incomplete view. Use
@@ -1154,6 +1156,9 @@ func yamlToConfig(path string, nc interface{}) error {
 	for i := range jc.Periodics {
 		fix(&jc.Periodics[i])
 	}
+	for i := range jc.JobTemplates {
+		jc.JobTemplates[i].SourcePath = path
+	}
 	return nil
 }
 
@@ -1180,6 +1185,7 @@ func ReadFileMaybeGZIP(path string) ([]byte, error) {
 func (c *Config) mergeJobConfig(jc JobConfig) error {
 	m, err := mergeJobConfigs(JobConfig{
 		Presets:           c.Presets,
+		JobTemplates:      c.JobTemplates,
 		PresubmitsStatic:  c.PresubmitsStatic,
 		Periodics:         c.Periodics,
 		PostsubmitsStatic: c.PostsubmitsStatic,
@@ -1188,6 +1194,7 @@ func (c *Config) mergeJobConfig(jc JobConfig) error {
 		return err
 	}
 	c.Presets = m.Presets
+	c.JobTemplates = m.JobTemplates
 	c.PresubmitsStatic = m.PresubmitsStatic
 	c.Periodics = m.Periodics
 	c.PostsubmitsStatic = m.PostsubmitsStatic
@@ -1200,6 +1207,7 @@ func (c *Config) mergeJobConfig(jc JobConfig) error {
 //	- Postsubmits
 // 	- Periodics
 //	- Presets
+//	- JobTemplates
 func mergeJobConfigs(a, b JobConfig) (JobConfig, error) {
 	// Merge everything
 	// *** Presets ***
@@ -1218,6 +1226,18 @@ func mergeJobConfigs(a, b JobConfig) (JobConfig, error) {
 		}
 	}
 
+	// *** JobTemplates ***
+	c.JobTemplates = append(a.JobTemplates, b.JobTemplates...)
+
+	// validate no duplicated template names
+	templateNames := sets.NewString()
+	for _, template := range c.JobTemplates {
+		if templateNames.Has(template.Name) {
+			return JobConfig{}, fmt.Errorf("duplicated job template %q", template.Name)
+		}
+		templateNames.Insert(template.Name)
+	}
+
 	// *** Periodics ***
 	c.Periodics = append(a.Periodics, b.Periodics...)
 
@@ -1321,6 +1341,10 @@ func defaultPeriodics(periodics []Periodic, c *Config) error {
 
 // finalizeJobConfig mutates and fixes entries for jobspecs
 func (c *Config) finalizeJobConfig() error {
+	if err := c.expandJobTemplates(); err != nil {
+		return err
+	}
+
 	if c.decorationRequested() {
 
 		def, ok := c.Plank.DefaultDecorationConfigs["*"]
@@ -1413,6 +1437,10 @@ func (c *Config) validateComponentConfig() error {
 		return err
 	}
 
+	if err := c.BranchProtection.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
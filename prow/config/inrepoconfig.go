@@ -121,6 +121,9 @@ func defaultProwYAMLGetter(
 }
 
 func DefaultAndValidateProwYAML(c *Config, p *ProwYAML, identifier string) error {
+	if err := c.expandProwYAMLTemplates(p); err != nil {
+		return err
+	}
 	if err := defaultPresubmits(p.Presubmits, c, identifier); err != nil {
 		return err
 	}
@@ -121,6 +121,10 @@ type JobBase struct {
 	// Presubmits and Postsubmits can also be set to hidden by
 	// adding their repository in Decks `hidden_repo` setting.
 	Hidden bool `json:"hidden,omitempty"`
+	// Extends is the name of the job template this job is based on.
+	Extends string `json:"extends,omitempty"`
+	// Params sets the parameters of the job template this job extends.
+	Params map[string]string `json:"params,omitempty"`
 
 	UtilityConfig
 }
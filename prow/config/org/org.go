@@ -72,6 +72,52 @@ type Repo struct {
 	Previously []string `json:"previously,omitempty"`
 
 	OnCreate *RepoCreateOptions `json:"on_create,omitempty"`
+
+	// Collaborators are the outside collaborators of the repo, people who
+	// aren't org members, and their permission on it. Unmanaged when unset,
+	// an empty map removes all outside collaborators.
+	//
+	// See https://developer.github.com/v3/repos/collaborators/
+	Collaborators map[string]github.RepoPermissionLevel `json:"collaborators,omitempty"`
+	// Topics of the repo, unmanaged when unset. An empty list removes all
+	// topics.
+	//
+	// See https://developer.github.com/v3/repos/#replace-all-repository-topics
+	Topics []string `json:"topics,omitempty"`
+	// DeployKeys of the repo, unmanaged when unset.
+	//
+	// See https://developer.github.com/v3/repos/keys/
+	DeployKeys []DeployKey `json:"deploy_keys,omitempty"`
+	// Webhooks of the repo, unmanaged when unset. Their secret is the HMAC
+	// token of the repo.
+	//
+	// See https://developer.github.com/v3/repos/hooks/
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// VulnerabilityAlerts enables or disables the alerts about vulnerable
+	// dependencies of the repo.
+	//
+	// See https://developer.github.com/v3/repos/#enable-vulnerability-alerts
+	VulnerabilityAlerts *bool `json:"vulnerability_alerts,omitempty"`
+}
+
+// DeployKey declares an SSH key with access to a single repo, identified by
+// its title.
+type DeployKey struct {
+	Title string `json:"title"`
+	Key   string `json:"key"`
+	// ReadOnly defaults to true.
+	ReadOnly *bool `json:"read_only,omitempty"`
+}
+
+// Webhook declares a webhook of a repo, identified by its url.
+type Webhook struct {
+	URL string `json:"url"`
+	// Events defaults to all events.
+	Events []string `json:"events,omitempty"`
+	// ContentType is json or form, defaults to json.
+	ContentType *string `json:"content_type,omitempty"`
+	// Active defaults to true.
+	Active *bool `json:"active,omitempty"`
 }
 
 // Config declares org metadata as well as its people and teams.
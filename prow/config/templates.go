@@ -0,0 +1,364 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+// JobTemplate is a named base for jobs. Jobs that extend a template inherit
+// the fields they do not set themselves, and set the template's parameters.
+// Maps like labels are merged, with the values of the job taking precedence,
+// while a spec or other field set by the job replaces that of the template.
+// Hidden, ErrorOnEviction, SkipSubmodules and SkipFetchHead are true if
+// either the job or the template sets them, as a job can't tell them apart
+// from being unset.
+type JobTemplate struct {
+	// The name and fields of the template, which can itself extend another
+	// template.
+	JobBase `json:",inline"`
+	// Parameters of the template. Every ${name} of a parameter in the spec,
+	// labels, annotations and extra_refs of the jobs extending the template
+	// is replaced with the value of the parameter.
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+}
+
+// TemplateParameter is a parameter of a job template.
+type TemplateParameter struct {
+	// Name of the parameter.
+	Name string `json:"name"`
+	// Default is the value of the parameter for jobs that do not set it.
+	// Jobs must set the parameters that have no default.
+	Default *string `json:"default,omitempty"`
+}
+
+// jobTemplates maps the names of job templates to the templates, merged with
+// the templates they extend.
+type jobTemplates map[string]resolvedTemplate
+
+type resolvedTemplate struct {
+	name string
+	base JobBase
+	// values maps the parameters of the template to their values, which are
+	// nil for the parameters jobs must set.
+	values map[string]*string
+}
+
+// resolveJobTemplates merges the job templates with the templates they extend.
+func resolveJobTemplates(templates []JobTemplate) (jobTemplates, error) {
+	byName := map[string]JobTemplate{}
+	for _, template := range templates {
+		if template.Name == "" {
+			return nil, fmt.Errorf("job template defined in %s has no name", template.SourcePath)
+		}
+		if _, ok := byName[template.Name]; ok {
+			return nil, fmt.Errorf("duplicated job template %q", template.Name)
+		}
+		byName[template.Name] = template
+	}
+
+	resolved := jobTemplates{}
+	var resolve func(name string, extendedBy []string) (resolvedTemplate, error)
+	resolve = func(name string, extendedBy []string) (resolvedTemplate, error) {
+		if r, ok := resolved[name]; ok {
+			return r, nil
+		}
+		for _, other := range extendedBy {
+			if other == name {
+				return resolvedTemplate{}, fmt.Errorf("job templates extend each other: %s", strings.Join(append(extendedBy, name), " -> "))
+			}
+		}
+		template, ok := byName[name]
+		if !ok {
+			return resolvedTemplate{}, fmt.Errorf("job template %q does not exist", name)
+		}
+
+		r := resolvedTemplate{name: name, base: template.JobBase, values: map[string]*string{}}
+		if template.Extends != "" {
+			parent, err := resolve(template.Extends, append(extendedBy, name))
+			if err != nil {
+				return resolvedTemplate{}, err
+			}
+			if r.base, r.values, err = parent.extend(template.JobBase); err != nil {
+				return resolvedTemplate{}, fmt.Errorf("job template %q: %v", name, err)
+			}
+		} else if len(template.Params) > 0 {
+			return resolvedTemplate{}, fmt.Errorf("job template %q sets params but does not extend a template", name)
+		}
+		for _, parameter := range template.Parameters {
+			if parameter.Name == "" {
+				return resolvedTemplate{}, fmt.Errorf("job template %q has a parameter without a name", name)
+			}
+			r.values[parameter.Name] = parameter.Default
+		}
+		resolved[name] = r
+		return r, nil
+	}
+
+	var errs []error
+	for _, template := range templates {
+		if _, err := resolve(template.Name, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return resolved, nil
+}
+
+// extend merges a job, or template, with the template it extends, and returns
+// the values of the template's parameters.
+func (t resolvedTemplate) extend(base JobBase) (JobBase, map[string]*string, error) {
+	values := make(map[string]*string, len(t.values))
+	for name, value := range t.values {
+		values[name] = value
+	}
+	for name, value := range base.Params {
+		if _, ok := values[name]; !ok {
+			return JobBase{}, nil, fmt.Errorf("job template %q has no parameter %q", t.name, name)
+		}
+		value := value
+		values[name] = &value
+	}
+	return mergeJobBase(base, t.base), values, nil
+}
+
+// expand merges a job with the template it extends, and substitutes the
+// template's parameters.
+func (templates jobTemplates) expand(job *JobBase) error {
+	if job.Extends == "" {
+		if len(job.Params) > 0 {
+			return fmt.Errorf("job %s sets params but does not extend a template", job.Name)
+		}
+		return nil
+	}
+	template, ok := templates[job.Extends]
+	if !ok {
+		return fmt.Errorf("job %s extends job template %q, which does not exist", job.Name, job.Extends)
+	}
+	expanded, values, err := template.extend(*job)
+	if err != nil {
+		return fmt.Errorf("job %s: %v", job.Name, err)
+	}
+
+	var unset []string
+	parameters := map[string]string{}
+	for name, value := range values {
+		if value == nil {
+			unset = append(unset, name)
+			continue
+		}
+		parameters[name] = *value
+	}
+	if len(unset) > 0 {
+		sort.Strings(unset)
+		return fmt.Errorf("job %s does not set parameters %s of job template %q", job.Name, strings.Join(unset, ", "), job.Extends)
+	}
+	if err := substituteParameters(&expanded, parameters); err != nil {
+		return fmt.Errorf("job %s: %v", job.Name, err)
+	}
+	*job = expanded
+	return nil
+}
+
+// expandJobTemplates expands the jobs that extend a job template.
+func (c *JobConfig) expandJobTemplates() error {
+	templates, err := resolveJobTemplates(c.JobTemplates)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, presubmits := range c.PresubmitsStatic {
+		errs = append(errs, templates.expandPresubmits(presubmits)...)
+	}
+	for _, postsubmits := range c.PostsubmitsStatic {
+		errs = append(errs, templates.expandPostsubmits(postsubmits)...)
+	}
+	for i := range c.Periodics {
+		if err := templates.expand(&c.Periodics[i].JobBase); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// expandProwYAMLTemplates expands the jobs of a .prow.yaml that extend a job
+// template of the central config.
+func (c *JobConfig) expandProwYAMLTemplates(p *ProwYAML) error {
+	templates, err := resolveJobTemplates(c.JobTemplates)
+	if err != nil {
+		return err
+	}
+	errs := templates.expandPresubmits(p.Presubmits)
+	errs = append(errs, templates.expandPostsubmits(p.Postsubmits)...)
+	return utilerrors.NewAggregate(errs)
+}
+
+func (templates jobTemplates) expandPresubmits(presubmits []Presubmit) []error {
+	var errs []error
+	for i := range presubmits {
+		if err := templates.expand(&presubmits[i].JobBase); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (templates jobTemplates) expandPostsubmits(postsubmits []Postsubmit) []error {
+	var errs []error
+	for i := range postsubmits {
+		if err := templates.expand(&postsubmits[i].JobBase); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// mergeJobBase fills in the fields a job does not set from its template. The
+// flags that are false when unset are ORed, see JobTemplate.
+func mergeJobBase(job, template JobBase) JobBase {
+	merged := job
+	merged.Labels = mergeStringMaps(template.Labels, job.Labels)
+	merged.Annotations = mergeStringMaps(template.Annotations, job.Annotations)
+	if merged.MaxConcurrency == 0 {
+		merged.MaxConcurrency = template.MaxConcurrency
+	}
+	if merged.Agent == "" {
+		merged.Agent = template.Agent
+	}
+	if merged.Cluster == "" {
+		merged.Cluster = template.Cluster
+	}
+	if merged.Namespace == nil && template.Namespace != nil {
+		namespace := *template.Namespace
+		merged.Namespace = &namespace
+	}
+	merged.ErrorOnEviction = job.ErrorOnEviction || template.ErrorOnEviction
+	if merged.Spec == nil {
+		merged.Spec = template.Spec.DeepCopy()
+	}
+	if merged.PipelineRunSpec == nil {
+		merged.PipelineRunSpec = template.PipelineRunSpec.DeepCopy()
+	}
+	if merged.ReporterConfig == nil {
+		merged.ReporterConfig = template.ReporterConfig.DeepCopy()
+	}
+	if merged.RerunAuthConfig == nil {
+		merged.RerunAuthConfig = template.RerunAuthConfig.DeepCopy()
+	}
+	merged.Hidden = job.Hidden || template.Hidden
+
+	if merged.Decorate == nil && template.Decorate != nil {
+		decorate := *template.Decorate
+		merged.Decorate = &decorate
+	}
+	if merged.PathAlias == "" {
+		merged.PathAlias = template.PathAlias
+	}
+	if merged.CloneURI == "" {
+		merged.CloneURI = template.CloneURI
+	}
+	merged.SkipSubmodules = job.SkipSubmodules || template.SkipSubmodules
+	if merged.CloneDepth == 0 {
+		merged.CloneDepth = template.CloneDepth
+	}
+	merged.SkipFetchHead = job.SkipFetchHead || template.SkipFetchHead
+	if merged.ExtraRefs == nil && template.ExtraRefs != nil {
+		merged.ExtraRefs = make([]prowapi.Refs, len(template.ExtraRefs))
+		for i := range template.ExtraRefs {
+			template.ExtraRefs[i].DeepCopyInto(&merged.ExtraRefs[i])
+		}
+	}
+	merged.DecorationConfig = job.DecorationConfig.ApplyDefault(template.DecorationConfig)
+	return merged
+}
+
+// mergeStringMaps returns a new map with the entries of both maps, where those
+// of override take precedence.
+func mergeStringMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return override
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// substituteParameters replaces ${name} with the value of each parameter in
+// the spec, labels, annotations and extra refs of a job.
+func substituteParameters(job *JobBase, parameters map[string]string) error {
+	if len(parameters) == 0 {
+		return nil
+	}
+	var pairs, escapedPairs []string
+	for name, value := range parameters {
+		escaped, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, "${"+name+"}", value)
+		escapedPairs = append(escapedPairs, "${"+name+"}", string(escaped[1:len(escaped)-1]))
+	}
+	replacer := strings.NewReplacer(pairs...)
+	escapedReplacer := strings.NewReplacer(escapedPairs...)
+
+	for k, v := range job.Labels {
+		job.Labels[k] = replacer.Replace(v)
+	}
+	for k, v := range job.Annotations {
+		job.Annotations[k] = replacer.Replace(v)
+	}
+	// The spec and refs are substituted in their serialized form, so that
+	// every string in them is covered. They are decoded into new values, as
+	// decoding into the old ones would keep map keys that were substituted.
+	var spec *v1.PodSpec
+	if err := substituteJSON(escapedReplacer, job.Spec, &spec); err != nil {
+		return err
+	}
+	var extraRefs []prowapi.Refs
+	if err := substituteJSON(escapedReplacer, job.ExtraRefs, &extraRefs); err != nil {
+		return err
+	}
+	job.Spec, job.ExtraRefs = spec, extraRefs
+	return nil
+}
+
+// substituteJSON serializes in, replaces the parameters in it and decodes the
+// result into out.
+func substituteJSON(replacer *strings.Replacer, in, out interface{}) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job for parameter substitution: %v", err)
+	}
+	if err := json.Unmarshal([]byte(replacer.Replace(string(raw))), out); err != nil {
+		return fmt.Errorf("failed to substitute parameters: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+func TestExpandJobTemplates(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+	e2eTemplate := JobTemplate{
+		JobBase: JobBase{
+			Name:        "e2e",
+			Labels:      map[string]string{"preset-e2e": "true", "provider": "${provider}"},
+			Annotations: map[string]string{"testgrid-dashboards": "e2e-${provider}"},
+			Cluster:     "build",
+			Spec: &v1.PodSpec{Containers: []v1.Container{{
+				Image: "e2e:${version}",
+				Args:  []string{"--provider=${provider}", "--focus=${focus}", "--home=${HOME}"},
+				Env:   []v1.EnvVar{{Name: "QUOTED", Value: "${focus}"}},
+			}}},
+			UtilityConfig: UtilityConfig{
+				ExtraRefs: []prowapi.Refs{{Org: "kubernetes", Repo: "kubernetes", BaseRef: "${branch}"}},
+			},
+		},
+		Parameters: []TemplateParameter{
+			{Name: "provider"},
+			{Name: "version", Default: strPtr("latest")},
+			{Name: "focus", Default: strPtr("")},
+			{Name: "branch", Default: strPtr("master")},
+		},
+	}
+	gceTemplate := JobTemplate{
+		JobBase: JobBase{
+			Name:    "e2e-gce",
+			Extends: "e2e",
+			Params:  map[string]string{"provider": "gce"},
+			Labels:  map[string]string{"preset-gce": "true"},
+		},
+		Parameters: []TemplateParameter{{Name: "zone", Default: strPtr("us-central1-b")}},
+	}
+
+	testCases := []struct {
+		name          string
+		templates     []JobTemplate
+		job           JobBase
+		expected      JobBase
+		expectedError string
+	}{
+		{
+			name: "job without a template is unchanged",
+			job:  JobBase{Name: "plain", Cluster: "default"},
+			expected: JobBase{
+				Name:    "plain",
+				Cluster: "default",
+			},
+		},
+		{
+			name:      "job inherits the template and substitutes parameters",
+			templates: []JobTemplate{e2eTemplate},
+			job: JobBase{
+				Name:    "ci-e2e-aws",
+				Extends: "e2e",
+				Params:  map[string]string{"provider": "aws", "focus": `\[Conformance\] "quoted"`, "branch": "release-1.20"},
+				Labels:  map[string]string{"provider": "overridden"},
+			},
+			expected: JobBase{
+				Name:        "ci-e2e-aws",
+				Extends:     "e2e",
+				Params:      map[string]string{"provider": "aws", "focus": `\[Conformance\] "quoted"`, "branch": "release-1.20"},
+				Labels:      map[string]string{"preset-e2e": "true", "provider": "overridden"},
+				Annotations: map[string]string{"testgrid-dashboards": "e2e-aws"},
+				Cluster:     "build",
+				Spec: &v1.PodSpec{Containers: []v1.Container{{
+					Image: "e2e:latest",
+					Args:  []string{"--provider=aws", `--focus=\[Conformance\] "quoted"`, "--home=${HOME}"},
+					Env:   []v1.EnvVar{{Name: "QUOTED", Value: `\[Conformance\] "quoted"`}},
+				}}},
+				UtilityConfig: UtilityConfig{
+					ExtraRefs: []prowapi.Refs{{Org: "kubernetes", Repo: "kubernetes", BaseRef: "release-1.20"}},
+				},
+			},
+		},
+		{
+			name:      "templates extend templates",
+			templates: []JobTemplate{gceTemplate, e2eTemplate},
+			job: JobBase{
+				Name:    "ci-e2e-gce",
+				Extends: "e2e-gce",
+				Params:  map[string]string{"version": "v1.20.0"},
+				Cluster: "e2e",
+				Spec:    &v1.PodSpec{Containers: []v1.Container{{Image: "custom:${version}", Args: []string{"--zone=${zone}"}}}},
+			},
+			expected: JobBase{
+				Name:        "ci-e2e-gce",
+				Extends:     "e2e-gce",
+				Params:      map[string]string{"version": "v1.20.0"},
+				Labels:      map[string]string{"preset-e2e": "true", "preset-gce": "true", "provider": "gce"},
+				Annotations: map[string]string{"testgrid-dashboards": "e2e-gce"},
+				Cluster:     "e2e",
+				Spec:        &v1.PodSpec{Containers: []v1.Container{{Image: "custom:v1.20.0", Args: []string{"--zone=us-central1-b"}}}},
+				UtilityConfig: UtilityConfig{
+					ExtraRefs: []prowapi.Refs{{Org: "kubernetes", Repo: "kubernetes", BaseRef: "master"}},
+				},
+			},
+		},
+		{
+			name: "parameters in map keys of the spec are substituted",
+			templates: []JobTemplate{{
+				JobBase:    JobBase{Name: "pool", Spec: &v1.PodSpec{NodeSelector: map[string]string{"pool-${size}": "true"}}},
+				Parameters: []TemplateParameter{{Name: "size"}},
+			}},
+			job: JobBase{Name: "ci-large", Extends: "pool", Params: map[string]string{"size": "large"}},
+			expected: JobBase{
+				Name:    "ci-large",
+				Extends: "pool",
+				Params:  map[string]string{"size": "large"},
+				Spec:    &v1.PodSpec{NodeSelector: map[string]string{"pool-large": "true"}},
+			},
+		},
+		{
+			name:      "flags set by the template stay set",
+			templates: []JobTemplate{{JobBase: JobBase{Name: "hidden", Hidden: true, UtilityConfig: UtilityConfig{SkipSubmodules: true}}}},
+			job:       JobBase{Name: "ci-hidden", Extends: "hidden"},
+			expected: JobBase{
+				Name:          "ci-hidden",
+				Extends:       "hidden",
+				Hidden:        true,
+				UtilityConfig: UtilityConfig{SkipSubmodules: true},
+			},
+		},
+		{
+			name:          "parameters without a default must be set",
+			templates:     []JobTemplate{e2eTemplate},
+			job:           JobBase{Name: "ci-e2e", Extends: "e2e"},
+			expectedError: `job ci-e2e does not set parameters provider of job template "e2e"`,
+		},
+		{
+			name:          "unknown parameters are rejected",
+			templates:     []JobTemplate{e2eTemplate},
+			job:           JobBase{Name: "ci-e2e", Extends: "e2e", Params: map[string]string{"provider": "aws", "typo": "x"}},
+			expectedError: `job ci-e2e: job template "e2e" has no parameter "typo"`,
+		},
+		{
+			name:          "unknown templates are rejected",
+			job:           JobBase{Name: "ci-e2e", Extends: "e2e"},
+			expectedError: `job ci-e2e extends job template "e2e", which does not exist`,
+		},
+		{
+			name:          "params without a template are rejected",
+			job:           JobBase{Name: "ci-e2e", Params: map[string]string{"provider": "aws"}},
+			expectedError: "job ci-e2e sets params but does not extend a template",
+		},
+		{
+			name: "templates must not extend each other",
+			templates: []JobTemplate{
+				{JobBase: JobBase{Name: "a", Extends: "b"}},
+				{JobBase: JobBase{Name: "b", Extends: "a"}},
+			},
+			job:           JobBase{Name: "ci-e2e"},
+			expectedError: "job templates extend each other: a -> b -> a",
+		},
+		{
+			name:          "templates must extend existing templates",
+			templates:     []JobTemplate{gceTemplate},
+			job:           JobBase{Name: "ci-e2e"},
+			expectedError: `job template "e2e" does not exist`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := JobConfig{
+				JobTemplates: tc.templates,
+				Periodics:    []Periodic{{JobBase: tc.job}},
+			}
+			err := c.expandJobTemplates()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual := c.Periodics[0].JobBase; !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expanded job %#v, expected %#v", actual, tc.expected)
+			}
+		})
+	}
+
+	// Expansion must not change the templates shared by other jobs
+	if e2eTemplate.Labels["provider"] != "${provider}" || e2eTemplate.Spec.Containers[0].Image != "e2e:${version}" {
+		t.Errorf("expansion changed the template: %#v", e2eTemplate)
+	}
+}
+
+func TestLoadJobTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatalf("fail to make tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.yaml": "",
+		"jobs/templates.yaml": `
+job_templates:
+- name: unit
+  labels:
+    preset-cache: "true"
+  max_concurrency: 5
+  spec:
+    containers:
+    - image: golang:${go}
+      command:
+      - make
+      args:
+      - test
+  parameters:
+  - name: go
+    default: "1.16"
+`,
+		"jobs/jobs.yaml": `
+presubmits:
+  org/repo:
+  - name: pull-unit
+    extends: unit
+    always_run: true
+  - name: pull-unit-old
+    extends: unit
+    params:
+      go: "1.15"
+    always_run: true
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("fail to make dir: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatalf("fail to write %s: %v", name, err)
+		}
+	}
+
+	c, err := Load(filepath.Join(dir, "config.yaml"), filepath.Join(dir, "jobs"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if len(c.JobTemplates) != 1 || c.JobTemplates[0].SourcePath != filepath.Join(dir, "jobs/templates.yaml") {
+		t.Errorf("expected one template defined in templates.yaml, got %#v", c.JobTemplates)
+	}
+
+	images := map[string]string{}
+	for _, job := range c.PresubmitsStatic["org/repo"] {
+		if job.MaxConcurrency != 5 || job.Labels["preset-cache"] != "true" || job.Context != job.Name {
+			t.Errorf("job %s did not inherit the template or was not defaulted: %#v", job.Name, job)
+		}
+		images[job.Name] = job.Spec.Containers[0].Image
+	}
+	expected := map[string]string{"pull-unit": "golang:1.16", "pull-unit-old": "golang:1.15"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("images = %v, expected %v", images, expected)
+	}
+}
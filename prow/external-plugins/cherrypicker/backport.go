@@ -0,0 +1,237 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// backportStatusPrefix starts the comment that tracks all backports of a PR.
+// It is followed by the JSON encoded state of the backports.
+const backportStatusPrefix = "<!-- cherrypicker backport-status: "
+
+var backportStatusRe = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(backportStatusPrefix) + `(.*) -->$`)
+
+type backportState string
+
+const (
+	// backportPending means the PR has not merged yet.
+	backportPending backportState = "pending"
+	// backportOpened means the cherry-pick PR was opened.
+	backportOpened backportState = "opened"
+	// backportConflict means the PR does not apply cleanly on the branch.
+	backportConflict backportState = "conflict"
+	// backportFailed means the cherry-pick failed for another reason.
+	backportFailed backportState = "failed"
+)
+
+// backport is the state of the backport of a PR to a single branch.
+type backport struct {
+	State  backportState `json:"state"`
+	PR     int           `json:"pr,omitempty"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+func (b backport) String() string {
+	switch b.State {
+	case backportPending:
+		return ":hourglass: Pending | Opens once this PR merges."
+	case backportOpened:
+		return fmt.Sprintf(":heavy_check_mark: Opened | #%d", b.PR)
+	case backportConflict:
+		return ":x: Conflict | Needs a manual cherry-pick."
+	default:
+		return fmt.Sprintf(":x: Failed | %s", b.Reason)
+	}
+}
+
+// parseBackportStatus returns the backports tracked by a status comment, or
+// false if the comment does not track backports.
+func parseBackportStatus(body string) (map[string]backport, bool) {
+	match := backportStatusRe.FindStringSubmatch(body)
+	if match == nil {
+		return nil, false
+	}
+	backports := map[string]backport{}
+	if err := json.Unmarshal([]byte(match[1]), &backports); err != nil {
+		return nil, false
+	}
+	return backports, true
+}
+
+func formatBackportStatus(backports map[string]backport) (string, error) {
+	raw, err := json.Marshal(backports)
+	if err != nil {
+		return "", err
+	}
+	var branches []string
+	for branch := range backports {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s -->\n", backportStatusPrefix, raw)
+	b.WriteString("Backports of this pull request:\n\n")
+	b.WriteString("| Branch | State | |\n| --- | --- | --- |\n")
+	for _, branch := range branches {
+		fmt.Fprintf(&b, "| `%s` | %s |\n", branch, backports[branch])
+	}
+	return b.String(), nil
+}
+
+// updateBackportStatus records the state of the backport of a PR to a branch
+// in the status comment of the PR, creating the comment if needed. Failing to
+// do so is logged but does not fail the cherry-pick.
+func (s *Server) updateBackportStatus(l *logrus.Entry, org, repo string, num int, branch string, b backport) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	comments, err := s.ghc.ListIssueComments(org, repo, num)
+	if err != nil {
+		l.WithError(err).Warn("Failed to list comments to update the backport status.")
+		return
+	}
+	backports := map[string]backport{}
+	statusID, oldBody := 0, ""
+	for _, c := range comments {
+		if c.User.Login != s.botUser.Login {
+			continue
+		}
+		if tracked, ok := parseBackportStatus(c.Body); ok {
+			backports, statusID, oldBody = tracked, c.ID, c.Body
+			break
+		}
+	}
+	backports[branch] = b
+
+	body, err := formatBackportStatus(backports)
+	if err != nil {
+		l.WithError(err).Warn("Failed to format the backport status.")
+		return
+	}
+	switch {
+	case statusID == 0:
+		err = s.ghc.CreateComment(org, repo, num, body)
+	case body != oldBody:
+		err = s.ghc.EditComment(org, repo, statusID, body)
+	}
+	if err != nil {
+		l.WithError(err).Warn("Failed to update the backport status.")
+	}
+}
+
+// fileChange is the diffstat of a single file of a patch.
+type fileChange struct {
+	name      string
+	additions int
+	deletions int
+}
+
+// summarizePatch returns the files changed by a patch generated by
+// `git format-patch`, which may hold several commits.
+func summarizePatch(patch []byte) []fileChange {
+	changes := map[string]*fileChange{}
+	var names []string
+	var current *fileChange
+	inHunk := false
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHunk = false
+			name := line[strings.LastIndex(line, " b/")+len(" b/"):]
+			if changes[name] == nil {
+				changes[name] = &fileChange{name: name}
+				names = append(names, name)
+			}
+			current = changes[name]
+		case current == nil:
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case !inHunk:
+		case line == "-- ":
+			// The signature that ends every commit of the patch.
+			inHunk = false
+		case strings.HasPrefix(line, "+"):
+			current.additions++
+		case strings.HasPrefix(line, "-"):
+			current.deletions++
+		case strings.HasPrefix(line, " "), strings.HasPrefix(line, `\`), line == "":
+		default:
+			inHunk = false
+		}
+	}
+	summary := make([]fileChange, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, *changes[name])
+	}
+	return summary
+}
+
+var conflictRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^CONFLICT \([^)]*\): Merge conflict in (\S+)$`),
+	regexp.MustCompile(`(?m)^CONFLICT \([^)]*\): (\S+) deleted in `),
+	regexp.MustCompile(`(?m)^error: patch failed: ([^:]+):\d+$`),
+	regexp.MustCompile(`(?m)^error: (\S+): does not exist in index$`),
+}
+
+// conflictedFiles returns the files `git am` reported conflicts for.
+func conflictedFiles(output string) sets.String {
+	files := sets.NewString()
+	for _, re := range conflictRes {
+		for _, match := range re.FindAllStringSubmatch(output, -1) {
+			files.Insert(match[1])
+		}
+	}
+	return files
+}
+
+// conflictSummary describes which of the files changed by a patch failed to
+// apply.
+func conflictSummary(patch []byte, output string) string {
+	changes := summarizePatch(patch)
+	if len(changes) == 0 {
+		return ""
+	}
+	conflicts := conflictedFiles(output)
+	var b strings.Builder
+	b.WriteString("| File | Changes | |\n| --- | --- | --- |\n")
+	for _, change := range changes {
+		// Without conflicts reported by git, it is unknown which files failed.
+		state := ""
+		switch {
+		case conflicts.Has(change.name):
+			state = "**conflict**"
+		case conflicts.Len() > 0:
+			state = "applies cleanly"
+		}
+		fmt.Fprintf(&b, "| `%s` | +%d -%d | %s |\n", change.name, change.additions, change.deletions, state)
+	}
+	return b.String()
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+var multiCommitPatch = []byte(`From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001
+From: Wise Guy <wise@guy.com>
+Subject: [PATCH 1/2] Update magic number
+
+---
+ bar.go | 3 ++-
+ 1 file changed, 2 insertions(+), 1 deletion(-)
+
+diff --git a/bar.go b/bar.go
+index 1ea52dc..5bd70a9 100644
+--- a/bar.go
++++ b/bar.go
+@@ -3,5 +3,6 @@ package bar
+
+ // Foo does a thing.
+ func Foo(wow int) int {
+-	return 42 + wow
++	// Needs to be 49 because of a reason.
++	return 49 + wow
+ }
+-- 
+2.14.1
+
+From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001
+From: Wise Guy <wise@guy.com>
+Subject: [PATCH 2/2] Add docs and rename
+
+---
+diff --git a/docs/README.md b/docs/README.md
+new file mode 100644
+index 0000000..5bd70a9
+--- /dev/null
++++ b/docs/README.md
+@@ -0,0 +1 @@
++# Docs
+diff --git a/bar.go b/bar.go
+index 5bd70a9..6bd70a9 100644
+--- a/bar.go
++++ b/bar.go
+@@ -1,2 +1,2 @@
+-// Package bar does an interesting thing.
++// Package bar does a very interesting thing.
+ package bar
+-- 
+2.14.1
+`)
+
+func TestSummarizePatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patch    []byte
+		expected []fileChange
+	}{
+		{
+			name:     "single commit",
+			patch:    patch,
+			expected: []fileChange{{name: "bar.go", additions: 2, deletions: 1}},
+		},
+		{
+			name:  "multiple commits",
+			patch: multiCommitPatch,
+			expected: []fileChange{
+				{name: "bar.go", additions: 3, deletions: 2},
+				{name: "docs/README.md", additions: 1},
+			},
+		},
+		{
+			name:     "no changes",
+			patch:    []byte("not a patch"),
+			expected: []fileChange{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := summarizePatch(tc.patch); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestConflictSummary(t *testing.T) {
+	output := `Applying: Update magic number
+Using index info to reconstruct a base tree...
+M	bar.go
+Falling back to patching base and 3-way merge...
+Auto-merging bar.go
+CONFLICT (content): Merge conflict in bar.go
+error: Failed to merge in the changes.
+Patch failed at 0001 Update magic number`
+	expected := "| File | Changes | |\n| --- | --- | --- |\n" +
+		"| `bar.go` | +3 -2 | **conflict** |\n" +
+		"| `docs/README.md` | +1 -0 | applies cleanly |\n"
+	if got := conflictSummary(multiCommitPatch, output); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	unknown := "| File | Changes | |\n| --- | --- | --- |\n| `bar.go` | +2 -1 |  |\n"
+	if got := conflictSummary(patch, "error: something went wrong"); got != unknown {
+		t.Errorf("expected:\n%s\ngot:\n%s", unknown, got)
+	}
+}
+
+func TestUpdateBackportStatus(t *testing.T) {
+	botUser := &github.UserData{Login: "ci-robot"}
+	ghc := &fghc{}
+	s := &Server{ghc: ghc, botUser: botUser}
+	log := logrus.WithField("plugin", pluginName)
+
+	s.updateBackportStatus(log, "org", "repo", 2, "release-1.6", backport{State: backportPending})
+	if len(ghc.comments) != 1 {
+		t.Fatalf("expected a status comment to be created, got %v", ghc.comments)
+	}
+	body := strings.TrimPrefix(ghc.comments[0], fmt.Sprintf(commentFormat, "org", "repo", 2, ""))
+
+	// Another bot comment tracking backports must be updated instead of
+	// creating a new one.
+	ghc.prComments = []github.IssueComment{
+		{ID: 1, User: github.User{Login: "someone"}, Body: body},
+		{ID: 2, User: github.User{Login: "ci-robot"}, Body: body},
+	}
+	s.updateBackportStatus(log, "org", "repo", 2, "release-1.5", backport{State: backportOpened, PR: 3})
+	s.updateBackportStatus(log, "org", "repo", 2, "release-1.7", backport{State: backportConflict})
+	if len(ghc.comments) != 1 {
+		t.Fatalf("expected the status comment to be edited, got new comments %v", ghc.comments[1:])
+	}
+	if ghc.prComments[0].Body != body {
+		t.Errorf("expected comments of other users to be left alone, got %q", ghc.prComments[0].Body)
+	}
+
+	backports, ok := parseBackportStatus(ghc.prComments[1].Body)
+	if !ok {
+		t.Fatalf("failed to parse status comment %q", ghc.prComments[1].Body)
+	}
+	expected := map[string]backport{
+		"release-1.5": {State: backportOpened, PR: 3},
+		"release-1.6": {State: backportPending},
+		"release-1.7": {State: backportConflict},
+	}
+	if !reflect.DeepEqual(backports, expected) {
+		t.Errorf("expected backports %+v, got %+v", expected, backports)
+	}
+	for _, row := range []string{
+		"| `release-1.5` | :heavy_check_mark: Opened | #3 |",
+		"| `release-1.6` | :hourglass: Pending | Opens once this PR merges. |",
+		"| `release-1.7` | :x: Conflict | Needs a manual cherry-pick. |",
+	} {
+		if !strings.Contains(ghc.prComments[1].Body, row) {
+			t.Errorf("expected status comment to contain %q, got %q", row, ghc.prComments[1].Body)
+		}
+	}
+}
+
+func TestHandleLabelBeforeMerge(t *testing.T) {
+	testCases := []struct {
+		name          string
+		label         string
+		isMember      bool
+		expectPending bool
+	}{
+		{
+			name:          "backport label from member",
+			label:         "backport/release-1.6",
+			isMember:      true,
+			expectPending: true,
+		},
+		{
+			name:     "backport label from non-member",
+			label:    "backport/release-1.6",
+			isMember: false,
+		},
+		{
+			name:     "other label",
+			label:    "lgtm",
+			isMember: true,
+		},
+		{
+			name:     "backport to the base branch",
+			label:    "backport/master",
+			isMember: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ghc := &fghc{isMember: tc.isMember}
+			s := &Server{
+				ghc:         ghc,
+				botUser:     &github.UserData{Login: "ci-robot"},
+				labelPrefix: "backport/",
+				log:         logrus.WithField("plugin", pluginName),
+			}
+			pre := github.PullRequestEvent{
+				Action: github.PullRequestActionLabeled,
+				Label:  github.Label{Name: tc.label},
+				PullRequest: github.PullRequest{
+					Number: 2,
+					State:  "open",
+					User:   github.User{Login: "author"},
+					Base: github.PullRequestBranch{
+						Ref:  "master",
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+				},
+			}
+			if err := s.handlePullRequest(s.log, pre); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.expectPending {
+				if len(ghc.comments) != 0 {
+					t.Errorf("expected no comments, got %v", ghc.comments)
+				}
+				return
+			}
+			if len(ghc.comments) != 1 || !strings.Contains(ghc.comments[0], "| `release-1.6` | :hourglass: Pending |") {
+				t.Errorf("expected a pending backport status, got %v", ghc.comments)
+			}
+			if len(ghc.prs) != 0 {
+				t.Errorf("expected no cherry-pick before merge, got %v", ghc.prs)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"regexp"
@@ -51,6 +52,7 @@ type githubClient interface {
 	CreateFork(org, repo string) (string, error)
 	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
 	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+	EditComment(org, repo string, id int, comment string) error
 	EnsureFork(forkingUser, org, repo string) (string, error)
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
 	GetPullRequestPatch(org, repo string, number int) ([]byte, error)
@@ -65,7 +67,7 @@ type githubClient interface {
 // HelpProvider construct the pluginhelp.PluginHelp for this plugin.
 func HelpProvider(_ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
 	pluginHelp := &pluginhelp.PluginHelp{
-		Description: `The cherrypick plugin is used for cherrypicking PRs across branches. For every successful cherrypick invocation a new PR is opened against the target branch and assigned to the requestor. If the parent PR contains a release note, it is copied to the cherrypick PR.`,
+		Description: `The cherrypick plugin is used for cherrypicking PRs across branches. For every successful cherrypick invocation a new PR is opened against the target branch and assigned to the requestor. If the parent PR contains a release note, it is copied to the cherrypick PR. Cherrypicks can also be requested by labeling a PR with the configured label prefix followed by the target branch, before or after it merges. The state of all cherrypicks of a PR is tracked in a single status comment.`,
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
 		Usage:       "/cherrypick [branch]",
@@ -107,6 +109,9 @@ type Server struct {
 
 	repoLock sync.Mutex
 	repos    []github.Repo
+
+	// statusLock serializes updates to backport status comments.
+	statusLock sync.Mutex
 }
 
 // ServeHTTP validates an incoming webhook and puts it into the event channel.
@@ -195,7 +200,11 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic github.IssueCommentEvent
 		}
 		resp := fmt.Sprintf("once the present PR merges, I will cherry-pick it on top of %s in a new PR and assign it to you.", targetBranch)
 		l.Info(resp)
-		return s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp))
+		if err := s.ghc.CreateComment(org, repo, num, plugins.FormatICResponse(ic.Comment, resp)); err != nil {
+			return err
+		}
+		s.updateBackportStatus(l, org, repo, num, targetBranch, backport{State: backportPending})
+		return nil
 	}
 
 	pr, err := s.ghc.GetPullRequest(org, repo, num)
@@ -249,6 +258,9 @@ func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent)
 
 	pr := pre.PullRequest
 	if !pr.Merged || pr.MergeSHA == nil {
+		if pre.Action == github.PullRequestActionLabeled && pr.State == "open" {
+			return s.handleLabelBeforeMerge(l, pre)
+		}
 		return nil
 	}
 
@@ -363,9 +375,48 @@ func (s *Server) handlePullRequest(l *logrus.Entry, pre github.PullRequestEvent)
 	return nil
 }
 
+// handleLabelBeforeMerge tracks the backport requested by labeling an open PR.
+// The cherry-pick itself happens once the PR merges.
+func (s *Server) handleLabelBeforeMerge(l *logrus.Entry, pre github.PullRequestEvent) error {
+	if !strings.HasPrefix(pre.Label.Name, s.labelPrefix) {
+		return nil
+	}
+	pr := pre.PullRequest
+	org, repo, num := pr.Base.Repo.Owner.Login, pr.Base.Repo.Name, pr.Number
+	targetBranch := pre.Label.Name[len(s.labelPrefix):]
+	if targetBranch == pr.Base.Ref {
+		return nil
+	}
+	// Label-initiated cherry-picks are requested on behalf of the PR author.
+	if !s.allowAll {
+		ok, err := s.ghc.IsMember(org, pr.User.Login)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	l = l.WithFields(logrus.Fields{
+		github.OrgLogField:  org,
+		github.RepoLogField: repo,
+		github.PrLogField:   num,
+		"target_branch":     targetBranch,
+	})
+	l.Debug("Cherrypick label added to an open PR.")
+	s.updateBackportStatus(l, org, repo, num, targetBranch, backport{State: backportPending})
+	return nil
+}
+
 var cherryPickBranchFmt = "cherry-pick-%d-to-%s"
 
 func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.IssueComment, org, repo, targetBranch, title, body string, num int) error {
+	// Keep the backport status of the PR up to date, whatever the outcome.
+	status := backport{State: backportFailed, Reason: "See the comments above."}
+	defer func() {
+		s.updateBackportStatus(logger, org, repo, num, targetBranch, status)
+	}()
+
 	forkName, err := s.ensureForkExists(org, repo)
 	if err != nil {
 		resp := fmt.Sprintf("cannot fork %s/%s: %v", org, repo, err)
@@ -420,6 +471,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 		}
 		for _, pr := range prs {
 			if pr.Head.Ref == fmt.Sprintf("%s:%s", s.botUser.Login, newBranch) {
+				status = backport{State: backportOpened, PR: pr.Number}
 				resp := fmt.Sprintf("Looks like #%d has already been cherry picked in %s", num, pr.HTMLURL)
 				logger.Info(resp)
 				return s.createComment(org, repo, num, comment, resp)
@@ -437,7 +489,13 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 
 	// Apply the patch.
 	if err := r.Am(localPath); err != nil {
+		status = backport{State: backportConflict}
 		resp := fmt.Sprintf("#%d failed to apply on top of branch %q:\n```\n%v\n```", num, targetBranch, err)
+		if patch, readErr := ioutil.ReadFile(localPath); readErr == nil {
+			if summary := conflictSummary(patch, err.Error()); summary != "" {
+				resp = fmt.Sprintf("%s\n\nChanges of #%d:\n\n%s", resp, num, summary)
+			}
+		}
 		logger.Info(resp)
 		err := s.createComment(org, repo, num, comment, resp)
 
@@ -474,6 +532,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string, comment *github.
 		logger.Info(resp)
 		return s.createComment(org, repo, num, comment, resp)
 	}
+	status = backport{State: backportOpened, PR: createdNum}
 	resp := fmt.Sprintf("new pull request created: #%d", createdNum)
 	logger.Info(resp)
 	if err := s.createComment(org, repo, num, comment, resp); err != nil {
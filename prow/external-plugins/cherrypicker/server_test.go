@@ -87,6 +87,18 @@ func (f *fghc) CreateComment(org, repo string, number int, comment string) error
 	return nil
 }
 
+func (f *fghc) EditComment(org, repo string, id int, comment string) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.prComments {
+		if f.prComments[i].ID == id {
+			f.prComments[i].Body = comment
+			return nil
+		}
+	}
+	return fmt.Errorf("no comment with id %d", id)
+}
+
 func (f *fghc) IsMember(org, user string) (bool, error) {
 	f.Lock()
 	defer f.Unlock()
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flakytest finds tests that fail intermittently in presubmit job
+// history and describes the GitHub issues that track them. It is shared by
+// the flakytest plugin and the flakytest-controller.
+package flakytest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Flake is a test that has been seen to both fail and pass on the same code.
+type Flake struct {
+	// Job is the presubmit the test flaked in.
+	Job string
+	// Test is the name of the test as it appears in JUnit results.
+	Test string
+	// Flakes is the number of revisions the test both failed and passed on.
+	Flakes int
+	// Failed lists the builds the test failed in, most recent first.
+	Failed []Build
+}
+
+// Detect returns the tests of job that flaked on at least minFlakes
+// revisions within builds, flakiest first. A test flakes on a revision when
+// one build of that revision failed it and another passed it, or when it
+// both failed and passed within a single build.
+func Detect(job string, builds []Build, minFlakes int) []Flake {
+	type outcome struct{ passed, failed bool }
+	outcomes := map[string]map[string]*outcome{}
+	failed := map[string][]Build{}
+	for _, b := range builds {
+		for test, result := range b.Tests {
+			if outcomes[test] == nil {
+				outcomes[test] = map[string]*outcome{}
+			}
+			o := outcomes[test][b.Revision]
+			if o == nil {
+				o = &outcome{}
+				outcomes[test][b.Revision] = o
+			}
+			switch result {
+			case TestPassed:
+				o.passed = true
+			case TestFailed:
+				o.failed = true
+				failed[test] = append(failed[test], b)
+			case TestFlaked:
+				o.passed, o.failed = true, true
+				failed[test] = append(failed[test], b)
+			}
+		}
+	}
+
+	var flakes []Flake
+	for test, revisions := range outcomes {
+		var count int
+		for _, o := range revisions {
+			if o.passed && o.failed {
+				count++
+			}
+		}
+		if count == 0 || count < minFlakes {
+			continue
+		}
+		flakes = append(flakes, Flake{Job: job, Test: test, Flakes: count, Failed: failed[test]})
+	}
+	sort.Slice(flakes, func(i, j int) bool {
+		if flakes[i].Flakes != flakes[j].Flakes {
+			return flakes[i].Flakes > flakes[j].Flakes
+		}
+		return flakes[i].Test < flakes[j].Test
+	})
+	return flakes
+}
+
+var markerRe = regexp.MustCompile(`<!-- flakytest job=("(?:[^"\\]|\\.)*") test=("(?:[^"\\]|\\.)*") -->`)
+
+// Marker returns the hidden comment that identifies the tracking issue for a
+// test of a job. It must appear in the issue body.
+// DO NOT CHANGE how it is formatted or duplicate issues will be filed.
+func Marker(job, test string) string {
+	return fmt.Sprintf("<!-- flakytest job=%s test=%s -->", strconv.Quote(job), strconv.Quote(test))
+}
+
+// ParseMarker extracts the job and test from the body of a tracking issue.
+func ParseMarker(body string) (job, test string, ok bool) {
+	matches := markerRe.FindStringSubmatch(body)
+	if matches == nil {
+		return "", "", false
+	}
+	job, err := strconv.Unquote(matches[1])
+	if err != nil {
+		return "", "", false
+	}
+	test, err = strconv.Unquote(matches[2])
+	if err != nil {
+		return "", "", false
+	}
+	return job, test, true
+}
+
+// IssueQuery returns the GitHub search query matching the open tracking
+// issues of a repo.
+func IssueQuery(org, repo, label string) string {
+	return fmt.Sprintf("is:issue is:open repo:%s/%s label:%q", org, repo, label)
+}
+
+// IssueTitle returns the title of the tracking issue for a flake.
+func IssueTitle(f Flake) string {
+	return fmt.Sprintf("Flaky test: %s in %s", f.Test, f.Job)
+}
+
+// maxListedBuilds caps the number of failed builds listed in an issue.
+const maxListedBuilds = 10
+
+// IssueBody returns the body of the tracking issue for a flake. link maps a
+// build to the URL it is listed with.
+func IssueBody(f Flake, link func(Build) string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n", Marker(f.Job, f.Test))
+	fmt.Fprintf(&buf, "`%s` in `%s` both failed and passed on the same code in **%d** revisions and failed in **%d** builds.\n", f.Test, f.Job, f.Flakes, len(f.Failed))
+	if len(f.Failed) > 0 {
+		fmt.Fprint(&buf, "\n#### Recent failures:\n| Build | PR | Started |\n| --- | --- | --- |\n")
+		for i, b := range f.Failed {
+			if i == maxListedBuilds {
+				break
+			}
+			fmt.Fprintf(&buf, "| [%s](%s) | #%s | %s |\n", b.ID, link(b), b.Pull, b.Started.UTC().Format("2006-01-02 15:04"))
+		}
+	}
+	fmt.Fprint(&buf, "\nThis issue is kept up to date automatically while the test keeps flaking.\n")
+	return buf.String()
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flakytest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// fakeOpener serves objects from memory. Keys are full storage paths.
+type fakeOpener struct {
+	pkgio.Opener
+	objects map[string]string
+}
+
+func (f fakeOpener) Reader(_ context.Context, path string) (pkgio.ReadCloser, error) {
+	content, ok := f.objects[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewBufferString(content)), nil
+}
+
+func (f fakeOpener) Iterator(_ context.Context, prefix, _ string) (pkgio.ObjectIterator, error) {
+	var it fakeIterator
+	for path := range f.objects {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(path, "gs://bucket/")
+		it.attrs = append(it.attrs, pkgio.ObjectAttributes{Name: name, ObjName: name[strings.LastIndex(name, "/")+1:]})
+	}
+	sort.Slice(it.attrs, func(i, j int) bool { return it.attrs[i].Name < it.attrs[j].Name })
+	return &it, nil
+}
+
+type fakeIterator struct {
+	attrs []pkgio.ObjectAttributes
+}
+
+func (f *fakeIterator) Next(_ context.Context) (pkgio.ObjectAttributes, error) {
+	if len(f.attrs) == 0 {
+		return pkgio.ObjectAttributes{}, io.EOF
+	}
+	next := f.attrs[0]
+	f.attrs = f.attrs[1:]
+	return next, nil
+}
+
+const (
+	passingJUnit = `<testsuite><testcase name="TestA"/><testcase name="TestB"/><testcase name="TestC"><skipped/></testcase></testsuite>`
+	failingJUnit = `<testsuites><testsuite><testcase name="TestA"><failure>boom</failure></testcase><testcase name="TestB"/></testsuite></testsuites>`
+	retriedJUnit = `<testsuite><testcase name="TestB"><failure>boom</failure></testcase><testcase name="TestB"/><testcase name="TestA"/></testsuite>`
+)
+
+func addBuild(objects map[string]string, job, id, pull, sha string, started int64, finished string, junit string) {
+	dir := "gs://bucket/pr-logs/pull/org_repo/" + pull + "/" + job + "/" + id
+	objects["gs://bucket/pr-logs/directory/"+job+"/"+id+".txt"] = dir + "\n"
+	objects[dir+"/started.json"] = `{"timestamp":` + strconv.FormatInt(started, 10) + `,"pull":"` + pull + `","repos":{"org/repo":"master:base,` + pull + `:` + sha + `"}}`
+	if finished != "" {
+		objects[dir+"/finished.json"] = finished
+	}
+	if junit != "" {
+		objects[dir+"/artifacts/junit_01.xml"] = junit
+		objects[dir+"/artifacts/build-log.txt"] = "not junit"
+	}
+}
+
+func TestBuildsAndDetect(t *testing.T) {
+	objects := map[string]string{}
+	passed := `{"passed": true, "result": "SUCCESS"}`
+	failed := `{"passed": false, "result": "FAILURE"}`
+	addBuild(objects, "pull-unit", "1", "10", "aaa", 1000, failed, failingJUnit)
+	addBuild(objects, "pull-unit", "2", "10", "aaa", 2000, passed, passingJUnit)
+	addBuild(objects, "pull-unit", "3", "11", "bbb", 3000, failed, failingJUnit)
+	addBuild(objects, "pull-unit", "4", "11", "bbb", 4000, passed, passingJUnit)
+	addBuild(objects, "pull-unit", "5", "12", "ccc", 5000, passed, retriedJUnit)
+	// Still running, so not a finished build.
+	addBuild(objects, "pull-unit", "6", "13", "ddd", 6000, "", "")
+
+	h := NewHistory(fakeOpener{objects: objects}, "gs://bucket/")
+	builds, err := h.Builds(context.Background(), "pull-unit", time.Unix(1500, 0), 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, b := range builds {
+		ids = append(ids, b.ID)
+	}
+	if diff := cmp.Diff([]string{"5", "4", "3", "2"}, ids); diff != "" {
+		t.Errorf("unexpected builds (-want +got):\n%s", diff)
+	}
+	if got := builds[2]; got.Passed || got.Pull != "11" || got.Path != "gs://bucket/pr-logs/pull/org_repo/11/pull-unit/3" {
+		t.Errorf("unexpected build 3: %+v", got)
+	}
+	if diff := cmp.Diff(map[string]TestResult{"TestA": TestPassed, "TestB": TestFlaked}, builds[0].Tests); diff != "" {
+		t.Errorf("unexpected tests in build 5 (-want +got):\n%s", diff)
+	}
+
+	builds, err = h.Builds(context.Background(), "pull-unit", time.Unix(0, 0), 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	flakes := Detect("pull-unit", builds, 1)
+	var got []string
+	for _, f := range flakes {
+		got = append(got, f.Test)
+	}
+	if diff := cmp.Diff([]string{"TestA", "TestB"}, got); diff != "" {
+		t.Errorf("unexpected flakes (-want +got):\n%s", diff)
+	}
+	if flakes[0].Flakes != 2 || len(flakes[0].Failed) != 2 || flakes[0].Failed[0].ID != "3" {
+		t.Errorf("unexpected flake for TestA: %+v", flakes[0])
+	}
+	if flakes := Detect("pull-unit", builds, 2); len(flakes) != 1 || flakes[0].Test != "TestA" {
+		t.Errorf("expected only TestA to flake twice, got %+v", flakes)
+	}
+}
+
+func TestDetectIgnoresConsistentFailures(t *testing.T) {
+	builds := []Build{
+		{ID: "2", Revision: "a", Tests: map[string]TestResult{"TestA": TestFailed}},
+		{ID: "1", Revision: "a", Tests: map[string]TestResult{"TestA": TestFailed}},
+		{ID: "0", Revision: "b", Tests: map[string]TestResult{"TestA": TestPassed}},
+	}
+	if flakes := Detect("job", builds, 1); len(flakes) != 0 {
+		t.Errorf("expected no flakes, got %+v", flakes)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	body := IssueBody(Flake{Job: "pull-unit", Test: `Test "quoted" \ thing`, Flakes: 1}, func(Build) string { return "" })
+	job, test, ok := ParseMarker("prefix\n" + body)
+	if !ok {
+		t.Fatalf("failed to parse marker from %q", body)
+	}
+	if job != "pull-unit" || test != `Test "quoted" \ thing` {
+		t.Errorf("unexpected job %q and test %q", job, test)
+	}
+	if _, _, ok := ParseMarker("no marker here"); ok {
+		t.Error("expected no marker to be found")
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flakytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
+	"github.com/sirupsen/logrus"
+
+	prowv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/pod-utils/gcs"
+)
+
+var (
+	aliasRe = regexp.MustCompile(`/([0-9]+)\.txt$`)
+	junitRe = regexp.MustCompile(`^junit.*\.xml$`)
+)
+
+// TestResult is the outcome of a single test within a build.
+type TestResult string
+
+const (
+	// TestPassed means every run of the test in the build passed.
+	TestPassed TestResult = "passed"
+	// TestFailed means every run of the test in the build failed.
+	TestFailed TestResult = "failed"
+	// TestFlaked means the test both failed and passed within the build,
+	// e.g. because the test runner retried it.
+	TestFlaked TestResult = "flaked"
+)
+
+// Build is a single finished run of a presubmit job.
+type Build struct {
+	// ID is the build ID of the run.
+	ID string
+	// Path is the storage path of the build's artifacts, e.g.
+	// gs://bucket/pr-logs/pull/org_repo/123/job/456
+	Path string
+	// Pull is the pull request number the build tested.
+	Pull string
+	// Revision identifies the code under test: every repo and ref that
+	// was checked out, as recorded in started.json.
+	Revision string
+	// Started is when the build started.
+	Started time.Time
+	// Passed is true if the build as a whole passed.
+	Passed bool
+	// Tests maps test names to their outcome in this build. Skipped
+	// tests are not recorded.
+	Tests map[string]TestResult
+}
+
+// History reads presubmit job results from artifact storage, assuming the
+// layout written by the pod utilities.
+type History struct {
+	opener pkgio.Opener
+	// bucket is the storage root holding the pr-logs tree, e.g. gs://bucket.
+	bucket string
+}
+
+// NewHistory returns a History that reads builds below bucket, e.g.
+// gs://kubernetes-jenkins or s3://prow-logs.
+func NewHistory(opener pkgio.Opener, bucket string) *History {
+	return &History{opener: opener, bucket: strings.TrimSuffix(bucket, "/")}
+}
+
+// Builds returns the finished builds of a presubmit job that started after
+// since, most recent first. At most max builds are inspected.
+func (h *History) Builds(ctx context.Context, job string, since time.Time, max int) ([]Build, error) {
+	ids, err := h.buildIDs(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	var builds []Build
+	for i, id := range ids {
+		if i >= max {
+			break
+		}
+		b, finished, err := h.build(ctx, job, id)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"job": job, "build": id}).Warn("Failed to read build.")
+			continue
+		}
+		// Build IDs increase monotonically, so everything after this
+		// build is older still.
+		if b.Started.Before(since) {
+			break
+		}
+		if !finished {
+			continue
+		}
+		builds = append(builds, b)
+	}
+	return builds, nil
+}
+
+// buildIDs lists the builds of a presubmit job by their aliases in the
+// pr-logs/directory tree, most recent first.
+func (h *History) buildIDs(ctx context.Context, job string) ([]int64, error) {
+	prefix := fmt.Sprintf("%s/%s/", h.bucket, path.Join(gcs.PRLogs, "directory", job))
+	it, err := h.opener.Iterator(ctx, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+	}
+	var ids []int64
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+		}
+		matches := aliasRe.FindStringSubmatch(attrs.Name)
+		if len(matches) != 2 {
+			continue
+		}
+		id, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids, nil
+}
+
+// build reads a single build. The returned bool is false if the build has
+// not finished yet.
+func (h *History) build(ctx context.Context, job string, id int64) (Build, bool, error) {
+	b := Build{ID: strconv.FormatInt(id, 10)}
+	alias := fmt.Sprintf("%s/%s", h.bucket, path.Join(gcs.PRLogs, "directory", job, b.ID+".txt"))
+	link, err := h.read(ctx, alias)
+	if err != nil {
+		return b, false, err
+	}
+	b.Path = strings.TrimSuffix(strings.TrimSpace(string(link)), "/")
+
+	var started gcs.Started
+	if err := h.readJSON(ctx, b.Path+"/"+prowv1.StartedStatusFile, &started); err != nil {
+		return b, false, err
+	}
+	b.Started = time.Unix(started.Timestamp, 0)
+	b.Pull = started.Pull
+	b.Revision = revision(started)
+
+	var finished gcs.Finished
+	if err := h.readJSON(ctx, b.Path+"/"+prowv1.FinishedStatusFile, &finished); err != nil {
+		if pkgio.IsNotExist(err) {
+			return b, false, nil
+		}
+		return b, false, err
+	}
+	b.Passed = finished.Passed != nil && *finished.Passed || finished.Result == "SUCCESS"
+
+	b.Tests, err = h.tests(ctx, b.Path)
+	if err != nil {
+		return b, false, err
+	}
+	return b, true, nil
+}
+
+// tests reads every JUnit file in the build's artifacts.
+func (h *History) tests(ctx context.Context, dir string) (map[string]TestResult, error) {
+	prefix := dir + "/artifacts/"
+	it, err := h.opener.Iterator(ctx, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+	}
+	tests := map[string]TestResult{}
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+		}
+		if attrs.IsDir || !junitRe.MatchString(attrs.ObjName) {
+			continue
+		}
+		data, err := h.read(ctx, root(prefix)+attrs.Name)
+		if err != nil {
+			return nil, err
+		}
+		suites, err := junit.Parse(data)
+		if err != nil {
+			logrus.WithError(err).WithField("path", attrs.Name).Info("Failed to parse JUnit file.")
+			continue
+		}
+		for _, suite := range suites.Suites {
+			record(tests, suite)
+		}
+	}
+	return tests, nil
+}
+
+// record adds the results of a suite to tests. A test that appears several
+// times with differing outcomes is considered to have flaked.
+func record(tests map[string]TestResult, suite junit.Suite) {
+	for _, sub := range suite.Suites {
+		record(tests, sub)
+	}
+	for _, r := range suite.Results {
+		if r.Skipped != nil {
+			continue
+		}
+		result := TestPassed
+		if r.Failure != nil {
+			result = TestFailed
+		}
+		if previous, seen := tests[r.Name]; seen && previous != result {
+			result = TestFlaked
+		}
+		tests[r.Name] = result
+	}
+}
+
+func (h *History) read(ctx context.Context, path string) ([]byte, error) {
+	r, err := h.opener.Reader(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (h *History) readJSON(ctx context.Context, path string, v interface{}) error {
+	data, err := h.read(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// root returns the scheme and bucket of a storage path, e.g. gs://bucket/.
+// Object iterators name the objects they return relative to it.
+func root(storagePath string) string {
+	i := strings.Index(storagePath, "://")
+	if i == -1 {
+		return ""
+	}
+	j := strings.Index(storagePath[i+len("://"):], "/")
+	if j == -1 {
+		return storagePath + "/"
+	}
+	return storagePath[:i+len("://")+j+1]
+}
+
+// revision returns a stable description of the code a build tested.
+func revision(started gcs.Started) string {
+	if len(started.Repos) == 0 {
+		return started.Pull + ":" + started.RepoCommit
+	}
+	var repos []string
+	for repo, refs := range started.Repos {
+		repos = append(repos, repo+"="+refs)
+	}
+	sort.Strings(repos)
+	return strings.Join(repos, ";")
+}
@@ -108,6 +108,7 @@ type IssueClient interface {
 	CloseIssue(org, repo string, number int) error
 	ReopenIssue(org, repo string, number int) error
 	FindIssues(query, sort string, asc bool) ([]Issue, error)
+	FindAllIssues(query, sort string, asc bool) ([]Issue, error)
 	ListOpenIssues(org, repo string) ([]Issue, error)
 	GetIssue(org, repo string, number int) (*Issue, error)
 	EditIssue(org, repo string, number int, issue *Issue) (*Issue, error)
@@ -154,6 +155,10 @@ type RepositoryClient interface {
 	GetBranchProtection(org, repo, branch string) (*BranchProtection, error)
 	RemoveBranchProtection(org, repo, branch string) error
 	UpdateBranchProtection(org, repo, branch string, config BranchProtectionRequest) error
+	SetRequiredSignatures(org, repo, branch string, required bool) error
+	ListTagProtections(org, repo string) ([]TagProtection, error)
+	CreateTagProtection(org, repo, pattern string) error
+	DeleteTagProtection(org, repo string, id int) error
 	AddRepoLabel(org, repo, label, description, color string) error
 	UpdateRepoLabel(org, repo, label, newName, description, color string) error
 	DeleteRepoLabel(org, repo, label string) error
@@ -165,6 +170,17 @@ type RepositoryClient interface {
 	GetDirectory(org, repo, dirpath, commit string) ([]DirectoryContent, error)
 	IsCollaborator(org, repo, user string) (bool, error)
 	ListCollaborators(org, repo string) ([]User, error)
+	ListOutsideCollaborators(org, repo string) ([]User, error)
+	ListRepoInvitations(org, repo string) ([]RepoInvitation, error)
+	AddCollaborator(org, repo, user string, permission TeamPermission) error
+	RemoveCollaborator(org, repo, user string) error
+	ListRepoTopics(org, repo string) ([]string, error)
+	ReplaceRepoTopics(org, repo string, topics []string) error
+	ListDeployKeys(org, repo string) ([]DeployKey, error)
+	CreateDeployKey(org, repo string, key DeployKey) (*DeployKey, error)
+	DeleteDeployKey(org, repo string, id int) error
+	GetVulnerabilityAlerts(org, repo string) (bool, error)
+	SetVulnerabilityAlerts(org, repo string, enabled bool) error
 	CreateFork(owner, repo string) (string, error)
 	EnsureFork(forkingUser, org, repo string) (string, error)
 	ListRepoTeams(org, repo string) ([]Team, error)
@@ -2339,6 +2355,77 @@ func (c *client) UpdateBranchProtection(org, repo, branch string, config BranchP
 	return err
 }
 
+// SetRequiredSignatures requires or stops requiring signed commits on the protected org/repo=branch.
+//
+// See https://docs.github.com/en/rest/reference/repos#create-commit-signature-protection
+func (c *client) SetRequiredSignatures(org, repo, branch string, required bool) error {
+	durationLogger := c.log("SetRequiredSignatures", org, repo, branch, required)
+	defer durationLogger()
+
+	method, exitCodes := http.MethodPost, []int{200}
+	if !required {
+		method, exitCodes = http.MethodDelete, []int{204}
+	}
+	_, err := c.request(&request{
+		accept:    "application/vnd.github.zzzax-preview+json",
+		method:    method,
+		path:      fmt.Sprintf("/repos/%s/%s/branches/%s/protection/required_signatures", org, repo, branch),
+		org:       org,
+		exitCodes: exitCodes,
+	}, nil)
+	return err
+}
+
+// ListTagProtections lists the tag patterns protected in org/repo.
+//
+// See https://docs.github.com/en/rest/reference/repos#list-tag-protection-states-for-a-repository
+func (c *client) ListTagProtections(org, repo string) ([]TagProtection, error) {
+	durationLogger := c.log("ListTagProtections", org, repo)
+	defer durationLogger()
+
+	var protections []TagProtection
+	_, err := c.request(&request{
+		method:    http.MethodGet,
+		path:      fmt.Sprintf("/repos/%s/%s/tags/protection", org, repo),
+		org:       org,
+		exitCodes: []int{200},
+	}, &protections)
+	return protections, err
+}
+
+// CreateTagProtection protects the tags of org/repo matching pattern.
+//
+// See https://docs.github.com/en/rest/reference/repos#create-a-tag-protection-state-for-a-repository
+func (c *client) CreateTagProtection(org, repo, pattern string) error {
+	durationLogger := c.log("CreateTagProtection", org, repo, pattern)
+	defer durationLogger()
+
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/repos/%s/%s/tags/protection", org, repo),
+		org:         org,
+		requestBody: TagProtection{Pattern: pattern},
+		exitCodes:   []int{201},
+	}, nil)
+	return err
+}
+
+// DeleteTagProtection removes the tag protection with the given id from org/repo.
+//
+// See https://docs.github.com/en/rest/reference/repos#delete-a-tag-protection-state-for-a-repository
+func (c *client) DeleteTagProtection(org, repo string, id int) error {
+	durationLogger := c.log("DeleteTagProtection", org, repo, id)
+	defer durationLogger()
+
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/repos/%s/%s/tags/protection/%d", org, repo, id),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
 // AddRepoLabel adds a defined label given org/repo
 //
 // See https://developer.github.com/v3/issues/labels/#create-a-label
@@ -2996,6 +3083,43 @@ func (c *client) FindIssues(query, sort string, asc bool) ([]Issue, error) {
 	return issSearchResult.Issues, err
 }
 
+// FindAllIssues is like FindIssues, but pages through the search results to
+// return all the issues which match the query rather than the first page.
+//
+// Each page of results consumes one API token.
+func (c *client) FindAllIssues(query, sort string, asc bool) ([]Issue, error) {
+	durationLogger := c.log("FindAllIssues", query)
+	defer durationLogger()
+
+	values := url.Values{
+		"q":        []string{query},
+		"per_page": []string{"100"},
+	}
+	if sort != "" {
+		values.Set("sort", sort)
+		if asc {
+			values.Set("order", "asc")
+		}
+	}
+	var issues []Issue
+	err := c.readPaginatedResultsWithValues(
+		"/search/issues",
+		values,
+		acceptNone,
+		"",
+		func() interface{} {
+			return &IssuesSearchResult{}
+		},
+		func(obj interface{}) {
+			issues = append(issues, obj.(*IssuesSearchResult).Issues...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
 // FileNotFound happens when github cannot find the file requested by GetFile().
 type FileNotFound struct {
 	org, repo, path, commit string
@@ -3544,6 +3668,286 @@ func (c *client) ListCollaborators(org, repo string) ([]User, error) {
 	return users, nil
 }
 
+// ListOutsideCollaborators gets the users who have access to a repo without
+// being members of its org, with their permissions on the repo.
+//
+// See https://developer.github.com/v3/repos/collaborators/#list-collaborators
+func (c *client) ListOutsideCollaborators(org, repo string) ([]User, error) {
+	durationLogger := c.log("ListOutsideCollaborators", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/collaborators?affiliation=outside", org, repo)
+	var users []User
+	err := c.readPaginatedResults(
+		path,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]User{}
+		},
+		func(obj interface{}) {
+			users = append(users, *(obj.(*[]User))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListRepoInvitations lists the pending invitations to collaborate on a repo.
+//
+// See https://developer.github.com/v3/repos/invitations/#list-invitations-for-a-repository
+func (c *client) ListRepoInvitations(org, repo string) ([]RepoInvitation, error) {
+	durationLogger := c.log("ListRepoInvitations", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/invitations", org, repo)
+	var invitations []RepoInvitation
+	err := c.readPaginatedResults(
+		path,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]RepoInvitation{}
+		},
+		func(obj interface{}) {
+			invitations = append(invitations, *(obj.(*[]RepoInvitation))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AddCollaborator invites the user to collaborate on the repo with the
+// permission, or updates the permission of an existing collaborator.
+//
+// See https://developer.github.com/v3/repos/collaborators/#add-user-as-a-collaborator
+func (c *client) AddCollaborator(org, repo, user string, permission TeamPermission) error {
+	durationLogger := c.log("AddCollaborator", org, repo, user, permission)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+
+	data := struct {
+		Permission string `json:"permission"`
+	}{
+		Permission: string(permission),
+	}
+
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        fmt.Sprintf("/repos/%s/%s/collaborators/%s", org, repo, user),
+		org:         org,
+		requestBody: &data,
+		exitCodes:   []int{201, 204},
+	}, nil)
+	return err
+}
+
+// RemoveCollaborator removes the user from the collaborators of the repo.
+//
+// See https://developer.github.com/v3/repos/collaborators/#remove-user-as-a-collaborator
+func (c *client) RemoveCollaborator(org, repo, user string) error {
+	durationLogger := c.log("RemoveCollaborator", org, repo, user)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/repos/%s/%s/collaborators/%s", org, repo, user),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
+// ListRepoTopics returns the topics of the repo.
+//
+// See https://developer.github.com/v3/repos/#get-all-repository-topics
+func (c *client) ListRepoTopics(org, repo string) ([]string, error) {
+	durationLogger := c.log("ListRepoTopics", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	var topics repoTopics
+	_, err := c.request(&request{
+		method: http.MethodGet,
+		// This accept header enables the topics preview.
+		// https://developer.github.com/v3/repos/#get-all-repository-topics
+		accept:    "application/vnd.github.mercy-preview+json",
+		path:      fmt.Sprintf("/repos/%s/%s/topics", org, repo),
+		org:       org,
+		exitCodes: []int{200},
+	}, &topics)
+	if err != nil {
+		return nil, err
+	}
+	return topics.Names, nil
+}
+
+// ReplaceRepoTopics sets the topics of the repo, an empty list removes all
+// topics.
+//
+// See https://developer.github.com/v3/repos/#replace-all-repository-topics
+func (c *client) ReplaceRepoTopics(org, repo string, topics []string) error {
+	durationLogger := c.log("ReplaceRepoTopics", org, repo, topics)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+	if topics == nil {
+		topics = []string{}
+	}
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		accept:      "application/vnd.github.mercy-preview+json",
+		path:        fmt.Sprintf("/repos/%s/%s/topics", org, repo),
+		org:         org,
+		requestBody: &repoTopics{Names: topics},
+		exitCodes:   []int{200},
+	}, nil)
+	return err
+}
+
+// ListDeployKeys returns the deploy keys of the repo.
+//
+// See https://developer.github.com/v3/repos/keys/#list-deploy-keys
+func (c *client) ListDeployKeys(org, repo string) ([]DeployKey, error) {
+	durationLogger := c.log("ListDeployKeys", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return nil, nil
+	}
+	path := fmt.Sprintf("/repos/%s/%s/keys", org, repo)
+	var keys []DeployKey
+	err := c.readPaginatedResults(
+		path,
+		acceptNone,
+		org,
+		func() interface{} {
+			return &[]DeployKey{}
+		},
+		func(obj interface{}) {
+			keys = append(keys, *(obj.(*[]DeployKey))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CreateDeployKey adds the deploy key to the repo.
+//
+// See https://developer.github.com/v3/repos/keys/#create-a-deploy-key
+func (c *client) CreateDeployKey(org, repo string, key DeployKey) (*DeployKey, error) {
+	durationLogger := c.log("CreateDeployKey", org, repo, key.Title)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return &key, nil
+	}
+	var created DeployKey
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/repos/%s/%s/keys", org, repo),
+		org:         org,
+		requestBody: &key,
+		exitCodes:   []int{201},
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteDeployKey removes the deploy key from the repo.
+//
+// See https://developer.github.com/v3/repos/keys/#remove-a-deploy-key
+func (c *client) DeleteDeployKey(org, repo string, id int) error {
+	durationLogger := c.log("DeleteDeployKey", org, repo, id)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/repos/%s/%s/keys/%d", org, repo, id),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
+// GetVulnerabilityAlerts returns whether vulnerability alerts are enabled
+// for the repo.
+//
+// See https://developer.github.com/v3/repos/#check-if-vulnerability-alerts-are-enabled-for-a-repository
+func (c *client) GetVulnerabilityAlerts(org, repo string) (bool, error) {
+	durationLogger := c.log("GetVulnerabilityAlerts", org, repo)
+	defer durationLogger()
+
+	if c.fake {
+		return false, nil
+	}
+	code, err := c.request(&request{
+		method: http.MethodGet,
+		// This accept header enables the vulnerability alerts preview.
+		accept:    "application/vnd.github.dorian-preview+json",
+		path:      fmt.Sprintf("/repos/%s/%s/vulnerability-alerts", org, repo),
+		org:       org,
+		exitCodes: []int{204, 404},
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return code == 204, nil
+}
+
+// SetVulnerabilityAlerts enables or disables vulnerability alerts for the
+// repo.
+//
+// See https://developer.github.com/v3/repos/#enable-vulnerability-alerts
+func (c *client) SetVulnerabilityAlerts(org, repo string, enabled bool) error {
+	durationLogger := c.log("SetVulnerabilityAlerts", org, repo, enabled)
+	defer durationLogger()
+
+	if c.fake || c.dry {
+		return nil
+	}
+	method := http.MethodPut
+	if !enabled {
+		method = http.MethodDelete
+	}
+	_, err := c.request(&request{
+		method:    method,
+		accept:    "application/vnd.github.dorian-preview+json",
+		path:      fmt.Sprintf("/repos/%s/%s/vulnerability-alerts", org, repo),
+		org:       org,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
 // CreateFork creates a fork for the authenticated user. Forking a repository
 // happens asynchronously. Therefore, we may have to wait a short period before
 // accessing the git objects. If this takes longer than 5 minutes, GitHub
@@ -1490,6 +1490,41 @@ func TestFindIssues(t *testing.T) {
 	}
 }
 
+func TestFindAllIssues(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		var result IssuesSearchResult
+		if r.URL.Path == "/search/issues" {
+			if q := r.URL.Query().Get("q"); q != "is:issue label:flake" {
+				t.Errorf("Bad query: %s", q)
+			}
+			result = IssuesSearchResult{Total: 2, Issues: []Issue{{Number: 1}}}
+			w.Header().Set("Link", fmt.Sprintf(`<blorp>; rel="first", <https://%s/someotherpath>; rel="next"`, r.Host))
+		} else if r.URL.Path == "/someotherpath" {
+			result = IssuesSearchResult{Total: 2, Issues: []Issue{{Number: 2}}}
+		} else {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := json.Marshal(&result)
+		if err != nil {
+			t.Fatalf("Didn't expect error: %v", err)
+		}
+		fmt.Fprint(w, string(b))
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	issues, err := c.FindAllIssues("is:issue label:flake", "", false)
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	} else if len(issues) != 2 {
+		t.Errorf("Expected two issues, found %d: %v", len(issues), issues)
+	} else if issues[0].Number != 1 || issues[1].Number != 2 {
+		t.Errorf("Wrong issue numbers: %v", issues)
+	}
+}
+
 func TestGetFile(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -1779,6 +1814,142 @@ func TestListCollaborators(t *testing.T) {
 	}
 }
 
+func TestAddCollaborator(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/collaborators/foo" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		if string(b) != `{"permission":"push"}` {
+			t.Errorf("Bad request body: %s", b)
+		}
+		http.Error(w, "201 Created", http.StatusCreated)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.AddCollaborator("org", "repo", "foo", RepoPush); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestReplaceRepoTopics(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/topics" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		if string(b) != `{"names":[]}` {
+			t.Errorf("Bad request body, removing all topics needs an empty list: %s", b)
+		}
+		fmt.Fprint(w, `{"names":[]}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.ReplaceRepoTopics("org", "repo", nil); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestGetVulnerabilityAlerts(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("Bad method: %s", r.Method)
+			}
+			if r.URL.Path != "/repos/org/repo/vulnerability-alerts" {
+				t.Errorf("Bad request path: %s", r.URL.Path)
+			}
+			if enabled {
+				http.Error(w, "204 No Content", http.StatusNoContent)
+			} else {
+				http.Error(w, "404 Not Found", http.StatusNotFound)
+			}
+		}))
+		c := getClient(ts.URL)
+		actual, err := c.GetVulnerabilityAlerts("org", "repo")
+		if err != nil {
+			t.Errorf("Didn't expect error: %v", err)
+		} else if actual != enabled {
+			t.Errorf("Expected vulnerability alerts enabled %t, got %t", enabled, actual)
+		}
+		ts.Close()
+	}
+}
+
+func TestSetRequiredSignatures(t *testing.T) {
+	for _, required := range []bool{true, false} {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/repos/org/repo/branches/master/protection/required_signatures" {
+				t.Errorf("Bad request path: %s", r.URL.Path)
+			}
+			switch {
+			case required && r.Method == http.MethodPost:
+				fmt.Fprint(w, `{"enabled":true}`)
+			case !required && r.Method == http.MethodDelete:
+				http.Error(w, "204 No Content", http.StatusNoContent)
+			default:
+				t.Errorf("Bad method to set required=%t: %s", required, r.Method)
+			}
+		}))
+		c := getClient(ts.URL)
+		if err := c.SetRequiredSignatures("org", "repo", "master", required); err != nil {
+			t.Errorf("Didn't expect error setting required=%t: %v", required, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestCreateTagProtection(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/org/repo/tags/protection" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		if string(b) != `{"pattern":"v*"}` {
+			t.Errorf("Bad request body: %s", b)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":2,"pattern":"v*"}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CreateTagProtection("org", "repo", "v*"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestListTagProtections(t *testing.T) {
+	expected := []TagProtection{{ID: 1, Pattern: "v*"}, {ID: 2, Pattern: "release-*"}}
+	ts := simpleTestServer(t, "/repos/org/repo/tags/protection", expected)
+	defer ts.Close()
+	c := getClient(ts.URL)
+	protections, err := c.ListTagProtections("org", "repo")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if !reflect.DeepEqual(protections, expected) {
+		t.Errorf("Wrong tag protections, expected: %v, got: %v", expected, protections)
+	}
+}
+
 func TestListRepoTeams(t *testing.T) {
 	expectedTeams := []Team{
 		{ID: 1, Slug: "foo", Permission: RepoPull},
@@ -2638,6 +2809,7 @@ func TestAllMethodsThatDoRequestSetOrgHeader(t *testing.T) {
 		// They fetch the user, which doesn't exist in case of github app.
 		// TODO: Split the search query by org when app auth is used
 		"FindIssues",
+		"FindAllIssues",
 	)
 
 	for i := 0; i < clientType.NumMethod(); i++ {
@@ -266,6 +266,30 @@ func (f *FakeClient) GetIssue(owner, repo string, number int) (*github.Issue, er
 	return val, nil
 }
 
+// CreateIssue creates the issue.
+func (f *FakeClient) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	if f.Issues == nil {
+		f.Issues = map[int]*github.Issue{}
+	}
+	number := 1
+	for f.Issues[number] != nil || f.PullRequests[number] != nil {
+		number++
+	}
+	issue := &github.Issue{
+		Number: number,
+		Title:  title,
+		Body:   body,
+	}
+	for _, label := range labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: label})
+	}
+	for _, assignee := range assignees {
+		issue.Assignees = append(issue.Assignees, github.User{Login: assignee})
+	}
+	f.Issues[number] = issue
+	return number, nil
+}
+
 // EditIssue edits the issue.
 func (f *FakeClient) EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error) {
 	if _, exists := f.Issues[number]; !exists {
@@ -412,6 +436,11 @@ func (f *FakeClient) FindIssues(query, sort string, asc bool) ([]github.Issue, e
 	return issues, nil
 }
 
+// FindAllIssues returns f.Issues
+func (f *FakeClient) FindAllIssues(query, sort string, asc bool) ([]github.Issue, error) {
+	return f.FindIssues(query, sort, asc)
+}
+
 // AssignIssue adds assignees.
 func (f *FakeClient) AssignIssue(owner, repo string, number int, assignees []string) error {
 	var m github.MissingUsers
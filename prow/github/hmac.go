@@ -22,6 +22,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -92,6 +93,35 @@ func PayloadSignature(payload []byte, key []byte) string {
 // not try to find a match with org level token. However if no token is present for repo,
 // we will try to match with org level.
 func extractHMACs(orgRepo string, tokenGenerator func() []byte) ([][]byte, error) {
+	tokens, err := hmacsForRepo(orgRepo, tokenGenerator)
+	if err != nil {
+		return nil, err
+	}
+	return extractTokens(tokens), nil
+}
+
+// HMACForRepo returns the newest HMAC token for given repository, which is the
+// one to sign new webhooks of the repo with.
+func HMACForRepo(orgRepo string, tokenGenerator func() []byte) (string, error) {
+	tokens, err := hmacsForRepo(orgRepo, tokenGenerator)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("no hmac token for %s", orgRepo)
+	}
+	newest := tokens[0]
+	for _, token := range tokens[1:] {
+		if !token.CreatedAt.Before(newest.CreatedAt) {
+			newest = token
+		}
+	}
+	return newest.Value, nil
+}
+
+// hmacsForRepo returns the HMAC tokens at the most specific level configured
+// for given repository/organization.
+func hmacsForRepo(orgRepo string, tokenGenerator func() []byte) (HMACsForRepo, error) {
 	t := tokenGenerator()
 	repoToTokenMap := map[string]HMACsForRepo{}
 
@@ -101,19 +131,19 @@ func extractHMACs(orgRepo string, tokenGenerator func() []byte) ([][]byte, error
 		// TODO: Once this code has been released and file has been moved to new format,
 		// we should delete this code and return error.
 		logrus.WithError(err).Trace("Couldn't unmarshal the hmac secret as hierarchical file. Parsing as single token format")
-		return [][]byte{t}, nil
+		return HMACsForRepo{{Value: string(t)}}, nil
 	}
 
 	orgName := strings.Split(orgRepo, "/")[0]
 
 	if val, ok := repoToTokenMap[orgRepo]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	if val, ok := repoToTokenMap[orgName]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	if val, ok := repoToTokenMap["*"]; ok {
-		return extractTokens(val), nil
+		return val, nil
 	}
 	return nil, errors.New("invalid content in secret file, global token doesn't exist")
 }
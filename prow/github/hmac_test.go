@@ -101,3 +101,73 @@ func TestValidatePayload(t *testing.T) {
 		}
 	}
 }
+
+func TestHMACForRepo(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		orgRepo        string
+		tokenGenerator func() []byte
+		expected       string
+		expectErr      bool
+	}{
+		{
+			name:           "repo-level token is preferred",
+			orgRepo:        "org2/repo",
+			tokenGenerator: defaultTokenGenerator,
+			expected:       "abc2",
+		},
+		{
+			name:           "org-level token is used without a repo-level token",
+			orgRepo:        "org1/repo",
+			tokenGenerator: defaultTokenGenerator,
+			expected:       "abc1",
+		},
+		{
+			name:           "global token is used without an org-level token",
+			orgRepo:        "org3/repo",
+			tokenGenerator: defaultTokenGenerator,
+			expected:       "abc",
+		},
+		{
+			name:    "newest token is returned regardless of its position",
+			orgRepo: "org/repo",
+			tokenGenerator: func() []byte {
+				return []byte(`
+'*':
+  - value: new
+    created_at: 2020-10-02T15:00:00Z
+  - value: old
+    created_at: 2018-10-02T15:00:00Z
+`)
+			},
+			expected: "new",
+		},
+		{
+			name:    "single token format is still supported",
+			orgRepo: "org/repo",
+			tokenGenerator: func() []byte {
+				return []byte("sometoken")
+			},
+			expected: "sometoken",
+		},
+		{
+			name:    "no token for the repo is an error",
+			orgRepo: "org/repo",
+			tokenGenerator: func() []byte {
+				return []byte(`'org2': []`)
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := HMACForRepo(tc.orgRepo, tc.tokenGenerator)
+			if err != nil != tc.expectErr {
+				t.Fatalf("expected error %t, got %v", tc.expectErr, err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected token %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -538,10 +538,21 @@ type Branch struct {
 // currently in place for a branch
 // See also: https://developer.github.com/v3/repos/branches/#get-branch-protection
 type BranchProtection struct {
-	RequiredStatusChecks       *RequiredStatusChecks       `json:"required_status_checks"`
-	EnforceAdmins              EnforceAdmins               `json:"enforce_admins"`
-	RequiredPullRequestReviews *RequiredPullRequestReviews `json:"required_pull_request_reviews"`
-	Restrictions               *Restrictions               `json:"restrictions"`
+	RequiredStatusChecks           *RequiredStatusChecks       `json:"required_status_checks"`
+	EnforceAdmins                  EnforceAdmins               `json:"enforce_admins"`
+	RequiredPullRequestReviews     *RequiredPullRequestReviews `json:"required_pull_request_reviews"`
+	Restrictions                   *Restrictions               `json:"restrictions"`
+	RequiredLinearHistory          ProtectionSetting           `json:"required_linear_history"`
+	AllowForcePushes               ProtectionSetting           `json:"allow_force_pushes"`
+	AllowDeletions                 ProtectionSetting           `json:"allow_deletions"`
+	RequiredConversationResolution ProtectionSetting           `json:"required_conversation_resolution"`
+	RequiredSignatures             ProtectionSetting           `json:"required_signatures"`
+}
+
+// ProtectionSetting specifies whether a branch protection
+// setting without further options is turned on.
+type ProtectionSetting struct {
+	Enabled bool `json:"enabled"`
 }
 
 // EnforceAdmins specifies whether to enforce the
@@ -568,13 +579,14 @@ type Restrictions struct {
 // protections to put in place for a branch.
 // See also: https://developer.github.com/v3/repos/branches/#update-branch-protection
 type BranchProtectionRequest struct {
-	RequiredStatusChecks       *RequiredStatusChecks              `json:"required_status_checks"`
-	EnforceAdmins              *bool                              `json:"enforce_admins"`
-	RequiredPullRequestReviews *RequiredPullRequestReviewsRequest `json:"required_pull_request_reviews"`
-	Restrictions               *RestrictionsRequest               `json:"restrictions"`
-	RequiredLinearHistory      bool                               `json:"required_linear_history"`
-	AllowForcePushes           bool                               `json:"allow_force_pushes"`
-	AllowDeletions             bool                               `json:"allow_deletions"`
+	RequiredStatusChecks           *RequiredStatusChecks              `json:"required_status_checks"`
+	EnforceAdmins                  *bool                              `json:"enforce_admins"`
+	RequiredPullRequestReviews     *RequiredPullRequestReviewsRequest `json:"required_pull_request_reviews"`
+	Restrictions                   *RestrictionsRequest               `json:"restrictions"`
+	RequiredLinearHistory          bool                               `json:"required_linear_history"`
+	AllowForcePushes               bool                               `json:"allow_force_pushes"`
+	AllowDeletions                 bool                               `json:"allow_deletions"`
+	RequiredConversationResolution bool                               `json:"required_conversation_resolution"`
 }
 
 func (r BranchProtectionRequest) String() string {
@@ -585,6 +597,12 @@ func (r BranchProtectionRequest) String() string {
 	return string(bytes)
 }
 
+// TagProtection restricts who can create or delete the tags matching a pattern.
+type TagProtection struct {
+	ID      int    `json:"id,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
 // RequiredStatusChecks specifies which contexts must pass to merge.
 type RequiredStatusChecks struct {
 	Strict   bool     `json:"strict"` // PR must be up to date (include latest base branch commit).
@@ -611,6 +629,27 @@ type RestrictionsRequest struct {
 	Teams *[]string `json:"teams,omitempty"`
 }
 
+// RepoInvitation is a pending invitation to collaborate on a repo.
+type RepoInvitation struct {
+	ID      int  `json:"id"`
+	Invitee User `json:"invitee"`
+	// Permissions is read, write or admin
+	Permissions string `json:"permissions"`
+}
+
+// repoTopics is the request and response body of the topics API.
+type repoTopics struct {
+	Names []string `json:"names"`
+}
+
+// DeployKey is an SSH key with access to a single repo.
+type DeployKey struct {
+	ID       int    `json:"id,omitempty"`
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	ReadOnly bool   `json:"read_only"`
+}
+
 // HookConfig holds the endpoint and its secret.
 type HookConfig struct {
 	URL         string  `json:"url"`
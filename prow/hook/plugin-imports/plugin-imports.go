@@ -31,6 +31,7 @@ import (
 	_ "k8s.io/test-infra/prow/plugins/cla"
 	_ "k8s.io/test-infra/prow/plugins/dco"
 	_ "k8s.io/test-infra/prow/plugins/dog"
+	_ "k8s.io/test-infra/prow/plugins/flakytest"
 	_ "k8s.io/test-infra/prow/plugins/golint"
 	_ "k8s.io/test-infra/prow/plugins/goose"
 	_ "k8s.io/test-infra/prow/plugins/heart"
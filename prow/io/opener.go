@@ -318,6 +318,13 @@ func (o *opener) Attributes(ctx context.Context, path string) (Attributes, error
 			Size:            attr.Size,
 		}, nil
 	}
+	if strings.HasPrefix(path, "/") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return Attributes{}, err
+		}
+		return Attributes{Size: info.Size()}, nil
+	}
 
 	bucket, relativePath, err := o.getBucket(ctx, path)
 	if err != nil {
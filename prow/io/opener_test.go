@@ -204,3 +204,27 @@ func TestIsNotExist(t *testing.T) {
 		})
 	}
 }
+
+func TestAttributesLocalPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attributes")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/file"
+	if err := ioutil.WriteFile(path, []byte("contents"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	o := &opener{}
+	attrs, err := o.Attributes(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Failed to get attributes: %v", err)
+	}
+	if attrs.Size != int64(len("contents")) {
+		t.Errorf("Expected size %d, got %d", len("contents"), attrs.Size)
+	}
+	if _, err := o.Attributes(context.Background(), dir+"/missing"); !IsNotExist(err) {
+		t.Errorf("Expected a missing file not to exist, got %v", err)
+	}
+}
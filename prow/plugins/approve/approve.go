@@ -23,9 +23,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
@@ -53,6 +55,10 @@ var (
 
 	// handleFunc is used to allow mocking out the behavior of 'handle' while testing.
 	handleFunc = handle
+
+	// ruleTeams caches the members of the teams of approval rules, so that
+	// they are not listed again for every event.
+	ruleTeams = newTeamCache(10 * time.Minute)
 )
 
 type githubClient interface {
@@ -68,6 +74,8 @@ type githubClient interface {
 	AddLabel(org, repo string, number int, label string) error
 	RemoveLabel(org, repo string, number int, label string) error
 	ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error)
+	GetTeamBySlug(slug string, org string) (*github.Team, error)
+	ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error)
 }
 
 type ownersClient interface {
@@ -110,6 +118,9 @@ func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo)
 	for _, repo := range enabledRepos {
 		opts := config.ApproveFor(repo.Org, repo.Repo)
 		approveConfig[repo.String()] = fmt.Sprintf("Pull requests %s require an associated issue.<br>Pull request authors %s implicitly approve their own PRs.<br>The /lgtm [cancel] command(s) %s act as approval.<br>A GitHub approved or changes requested review %s act as approval or cancel respectively.", doNot(opts.IssueRequired), doNot(opts.HasSelfApproval()), willNot(opts.LgtmActsAsApprove), willNot(opts.ConsiderReviewState()))
+		for _, rule := range opts.Rules {
+			approveConfig[repo.String()] += fmt.Sprintf("<br>Changes to %s need %d approvals under the %q rule.", strings.Join(rule.Paths, ", "), rule.MinApprovals, rule.Name)
+		}
 	}
 
 	yamlSnippet, err := plugins.CommentMap.GenYaml(&plugins.Configuration{
@@ -121,6 +132,14 @@ func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo)
 				},
 				RequireSelfApproval: new(bool),
 				IgnoreReviewState:   new(bool),
+				Rules: []plugins.ApproveRule{
+					{
+						Name:         "api-review",
+						Paths:        []string{"api/**/*"},
+						Teams:        []string{"api-reviewers"},
+						MinApprovals: 2,
+					},
+				},
 			},
 		},
 	})
@@ -132,6 +151,7 @@ func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo)
 		Description: `The approve plugin implements a pull request approval process that manages the '` + labels.Approved + `' label and an approval notification comment. Approval is achieved when the set of users that have approved the PR is capable of approving every file changed by the PR. A user is able to approve a file if their username or an alias they belong to is listed in the 'approvers' section of an OWNERS file in the directory of the file or higher in the directory tree.
 <br>
 <br>Per-repo configuration may be used to require that PRs link to an associated issue before approval is granted. It may also be used to specify that the PR authors implicitly approve their own PRs.
+<br>Per-repo rules may additionally require approvals from specific users or team members for changes to files matching given paths. The approval notification lists which of these rules are satisfied.
 <br>For more information see <a href="https://git.k8s.io/test-infra/prow/plugins/approve/approvers/README.md">here</a>.`,
 		Config:  approveConfig,
 		Snippet: yamlSnippet,
@@ -432,6 +452,10 @@ func handle(log *logrus.Entry, ghc githubClient, repo approvers.Repo, githubConf
 		log.WithError(err).Errorf("Failed to find associated issue from PR body: %v", err)
 	}
 	approversHandler.RequireIssue = opts.IssueRequired
+	approversHandler.Rules, err = matchingRules(ghc, ruleTeams, pr.org, pr.author, opts.Rules, filenames)
+	if err != nil {
+		return fmt.Errorf("failed to resolve approval rules for %s/%s#%d: %v", pr.org, pr.repo, pr.number, err)
+	}
 	approversHandler.ManuallyApproved = humanAddedApproved(ghc, log, pr.org, pr.repo, pr.number, botUserChecker, hasApprovedLabel)
 
 	// Author implicitly approves their own PR if config allows it
@@ -492,6 +516,87 @@ func handle(log *logrus.Entry, ghc githubClient, repo approvers.Repo, githubConf
 	return nil
 }
 
+// matchingRules returns the rules that apply to the changed files, with
+// their teams resolved to the logins of their members. The author of the PR
+// can not satisfy rules, even if they are allowed to approve them.
+func matchingRules(ghc githubClient, teams *teamCache, org, author string, rules []plugins.ApproveRule, filenames []string) ([]approvers.Rule, error) {
+	var matching []approvers.Rule
+	for _, rule := range rules {
+		files := rule.Matches(filenames)
+		if len(files) == 0 {
+			continue
+		}
+		allowed := sets.NewString()
+		for _, login := range rule.Approvers {
+			allowed.Insert(github.NormLogin(login))
+		}
+		for _, slug := range rule.Teams {
+			members, err := teams.members(ghc, org, slug)
+			if err != nil {
+				return nil, err
+			}
+			allowed = allowed.Union(members)
+		}
+		allowed.Delete(github.NormLogin(author))
+		matching = append(matching, approvers.Rule{
+			Name:         rule.Name,
+			Files:        files,
+			Approvers:    allowed,
+			MinApprovals: rule.MinApprovals,
+		})
+	}
+	return matching, nil
+}
+
+// teamCache caches the normalized logins of the members of teams.
+type teamCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]teamCacheEntry
+}
+
+type teamCacheEntry struct {
+	members sets.String
+	expiry  time.Time
+}
+
+func newTeamCache(ttl time.Duration) *teamCache {
+	return &teamCache{ttl: ttl, now: time.Now, entries: map[string]teamCacheEntry{}}
+}
+
+// members returns the members of a team, listing them if they are not cached
+// or the cached members expired. The returned set must not be modified.
+// The lock isn't held while listing, so that a slow team doesn't block
+// lookups of other teams.
+func (c *teamCache) members(ghc githubClient, org, slug string) (sets.String, error) {
+	key := org + "/" + slug
+	c.Lock()
+	entry, ok := c.entries[key]
+	fresh := ok && c.now().Before(entry.expiry)
+	c.Unlock()
+	if fresh {
+		return entry.members, nil
+	}
+
+	team, err := ghc.GetTeamBySlug(slug, org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team %s: %v", key, err)
+	}
+	members, err := ghc.ListTeamMembers(org, team.ID, github.RoleAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of team %s: %v", key, err)
+	}
+	logins := sets.NewString()
+	for _, member := range members {
+		logins.Insert(github.NormLogin(member.Login))
+	}
+	c.Lock()
+	c.entries[key] = teamCacheEntry{members: logins, expiry: c.now().Add(c.ttl)}
+	c.Unlock()
+	return logins, nil
+}
+
 func humanAddedApproved(ghc githubClient, log *logrus.Entry, org, repo string, number int, isBot func(string) bool, hasLabel bool) func() bool {
 	findOut := func() bool {
 		if !hasLabel {
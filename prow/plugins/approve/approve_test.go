@@ -24,6 +24,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -1767,6 +1768,129 @@ func TestHandlePullRequest(t *testing.T) {
 	}
 }
 
+func TestMatchingRules(t *testing.T) {
+	rules := []plugins.ApproveRule{
+		{Name: "api-review", Paths: []string{"api/**/*"}, Approvers: []string{"@Alice"}, Teams: []string{"Leads"}, MinApprovals: 2},
+		{Name: "security", Paths: []string{"**/secrets/*"}, Approvers: []string{"bob"}, MinApprovals: 1},
+	}
+	got, err := matchingRules(&fakegithub.FakeClient{}, newTeamCache(time.Minute), "org", "Bob", rules, []string{"api/v1/types.go", "README.md"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []approvers.Rule{{
+		Name:         "api-review",
+		Files:        []string{"api/v1/types.go"},
+		Approvers:    sets.NewString("alice", "sig-lead"),
+		MinApprovals: 2,
+	}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected rules %+v, got %+v", expected, got)
+	}
+
+	got, err = matchingRules(&fakegithub.FakeClient{}, newTeamCache(time.Minute), "org", "@Alice", rules, []string{"api/v1/types.go", "secrets/key"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = []approvers.Rule{
+		{
+			Name:         "api-review",
+			Files:        []string{"api/v1/types.go"},
+			Approvers:    sets.NewString("sig-lead"),
+			MinApprovals: 2,
+		},
+		{
+			Name:         "security",
+			Files:        []string{"secrets/key"},
+			Approvers:    sets.NewString("bob"),
+			MinApprovals: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected rules without the author %+v, got %+v", expected, got)
+	}
+}
+
+type teamCountingClient struct {
+	*fakegithub.FakeClient
+	lock   sync.Mutex
+	listed int
+	// blockTeam0 makes listing the members of the team with ID 0 wait until
+	// it is closed.
+	blockTeam0 chan struct{}
+}
+
+func (c *teamCountingClient) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	if id == 0 && c.blockTeam0 != nil {
+		<-c.blockTeam0
+	}
+	c.lock.Lock()
+	c.listed++
+	c.lock.Unlock()
+	return c.FakeClient.ListTeamMembers(org, id, role)
+}
+
+func TestTeamCache(t *testing.T) {
+	ghc := &teamCountingClient{FakeClient: &fakegithub.FakeClient{}}
+	now := time.Now()
+	cache := newTeamCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		members, err := cache.members(ghc, "org", "Leads")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !members.Equal(sets.NewString("sig-lead")) {
+			t.Errorf("expected members sig-lead, got %v", members.List())
+		}
+	}
+	if ghc.listed != 1 {
+		t.Errorf("expected team members to be listed once, were listed %d times", ghc.listed)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.members(ghc, "org", "Leads"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ghc.listed != 2 {
+		t.Errorf("expected expired team members to be listed again, were listed %d times", ghc.listed)
+	}
+}
+
+func TestTeamCacheDoesNotBlockOnSlowTeams(t *testing.T) {
+	ghc := &teamCountingClient{FakeClient: &fakegithub.FakeClient{}}
+	cache := newTeamCache(time.Minute)
+	if _, err := cache.members(ghc, "org", "Leads"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ghc.blockTeam0 = make(chan struct{})
+	slow := make(chan error)
+	go func() {
+		// Unknown teams get the ID 0 from the fake client
+		_, err := cache.members(ghc, "org", "Slow")
+		slow <- err
+	}()
+
+	cached := make(chan error)
+	go func() {
+		_, err := cache.members(ghc, "org", "Leads")
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cached team lookup was blocked by listing another team")
+	}
+	close(ghc.blockTeam0)
+	if err := <-slow; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestHelpProvider(t *testing.T) {
 	enabledRepos := []config.OrgRepo{
 		{Org: "org1", Repo: "repo"},
@@ -1793,6 +1917,9 @@ func TestHelpProvider(t *testing.T) {
 						RequireSelfApproval: &[]bool{true}[0],
 						LgtmActsAsApprove:   true,
 						IgnoreReviewState:   &[]bool{true}[0],
+						Rules: []plugins.ApproveRule{
+							{Name: "api-review", Paths: []string{"api/**/*"}, Teams: []string{"api-reviewers"}, MinApprovals: 2},
+						},
 					},
 				},
 			},
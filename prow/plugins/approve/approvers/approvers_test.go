@@ -23,6 +23,7 @@ import (
 
 	"net/url"
 	"reflect"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 
@@ -618,6 +619,90 @@ func TestIsApprovedWithIssue(t *testing.T) {
 	}
 }
 
+func TestIsApprovedWithRules(t *testing.T) {
+	rule := Rule{
+		Name:         "api-review",
+		Files:        []string{"api/types.go"},
+		Approvers:    sets.NewString("alice", "anne", "bob"),
+		MinApprovals: 2,
+	}
+	tests := []struct {
+		name         string
+		approvers    []string
+		selfApprover string
+		rules        []Rule
+
+		manuallyApproved bool
+		isApproved       bool
+	}{
+		{
+			name:       "no rules",
+			approvers:  []string{"Alice"},
+			isApproved: true,
+		},
+		{
+			name:       "rule without enough approvals",
+			approvers:  []string{"Alice"},
+			rules:      []Rule{rule},
+			isApproved: false,
+		},
+		{
+			name:       "rule with enough approvals",
+			approvers:  []string{"Alice", "Anne"},
+			rules:      []Rule{rule},
+			isApproved: true,
+		},
+		{
+			name:       "approvals from users outside of the rule do not count",
+			approvers:  []string{"Alice", "Art"},
+			rules:      []Rule{rule},
+			isApproved: false,
+		},
+		{
+			name:         "implicit self-approval does not count",
+			approvers:    []string{"Alice"},
+			selfApprover: "Bob",
+			rules:        []Rule{rule},
+			isApproved:   false,
+		},
+		{
+			name:             "manual approval does not bypass rules",
+			approvers:        []string{"Alice"},
+			rules:            []Rule{rule},
+			manuallyApproved: true,
+			isApproved:       false,
+		},
+		{
+			name:             "manual approval bypasses OWNERS files when rules are met",
+			approvers:        []string{"Anne", "Bob"},
+			rules:            []Rule{rule},
+			manuallyApproved: true,
+			isApproved:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ap := NewApprovers(Owners{
+				filenames: []string{"api/types.go"},
+				repo:      createFakeRepo(map[string]sets.String{"": sets.NewString("Alice", "Art")}),
+				log:       logrus.WithField("plugin", "some_plugin"),
+			})
+			ap.Rules = test.rules
+			ap.ManuallyApproved = func() bool { return test.manuallyApproved }
+			if test.selfApprover != "" {
+				ap.AddAuthorSelfApprover(test.selfApprover, "REFERENCE", false)
+			}
+			for _, approver := range test.approvers {
+				ap.AddApprover(approver, "REFERENCE", false)
+			}
+			if got := ap.IsApproved(); got != test.isApproved {
+				t.Errorf("expected approval status %v, got %v", test.isApproved, got)
+			}
+		})
+	}
+}
+
 func TestGetFilesApprovers(t *testing.T) {
 	tests := []struct {
 		testName       string
@@ -985,3 +1070,87 @@ Approvers can cancel approval by writing ` + "`/approve cancel`" + ` in a commen
 		t.Errorf("GetMessage() = %+v, want = %+v", *got, want)
 	}
 }
+
+func TestGetMessageWithRules(t *testing.T) {
+	ap := NewApprovers(
+		Owners{
+			filenames: []string{"a/a.go", "api/types.go"},
+			repo: createFakeRepo(map[string]sets.String{
+				"": sets.NewString("Alice"),
+			}),
+			log: logrus.WithField("plugin", "some_plugin"),
+		},
+	)
+	ap.Rules = []Rule{
+		{Name: "api-review", Files: []string{"api/types.go"}, Approvers: sets.NewString("alice", "anne"), MinApprovals: 2},
+		{Name: "lead-review", Files: []string{"a/a.go", "api/types.go"}, Approvers: sets.NewString("alice"), MinApprovals: 1},
+	}
+	ap.AddApprover("Alice", "REFERENCE", false)
+
+	want := `[APPROVALNOTIFIER] This PR is **NOT APPROVED**
+
+This pull-request has been approved by: *<a href="REFERENCE" title="Approved">Alice</a>*
+
+Approval rules that apply to this pull request:
+
+- **api-review**: 1/2 approvals for ` + "`api/types.go`" + `
+- ~~lead-review~~ [Alice]
+
+The full list of commands accepted by this bot can be found [here](https://go.k8s.io/bot-commands?repo=org%2Frepo).
+
+The pull request process is described [here](https://git.k8s.io/community/contributors/guide/owners.md#the-code-review-process)
+
+<details >
+Needs approval from an approver in each of these files:
+
+- ~~[OWNERS](https://github.com/org/repo/blob/dev/OWNERS)~~ [Alice]
+
+Approvers can indicate their approval by writing ` + "`/approve`" + ` in a comment
+Approvers can cancel approval by writing ` + "`/approve cancel`" + ` in a comment
+</details>
+<!-- META={"approvers":[]} -->`
+	if got := GetMessage(ap, &url.URL{Scheme: "https", Host: "github.com"}, "https://go.k8s.io/bot-commands", "https://git.k8s.io/community/contributors/guide/owners.md#the-code-review-process", "org", "repo", "dev"); got == nil {
+		t.Error("GetMessage() failed")
+	} else if *got != want {
+		t.Errorf("GetMessage() = %+v, want = %+v", *got, want)
+	}
+}
+
+func TestGetMessageManuallyApprovedWithRules(t *testing.T) {
+	ap := NewApprovers(
+		Owners{
+			filenames: []string{"api/types.go"},
+			repo: createFakeRepo(map[string]sets.String{
+				"": sets.NewString("Alice"),
+			}),
+			log: logrus.WithField("plugin", "some_plugin"),
+		},
+	)
+	ap.Rules = []Rule{
+		{Name: "api-review", Files: []string{"api/types.go"}, Approvers: sets.NewString("alice", "anne"), MinApprovals: 2},
+	}
+	ap.ManuallyApproved = func() bool { return true }
+
+	want := `[APPROVALNOTIFIER] This PR is **NOT APPROVED**
+
+Manually added approval does not bypass the approval rules below, which still need to be satisfied.
+
+This pull-request has been approved by:
+`
+	if got := GetMessage(ap, &url.URL{Scheme: "https", Host: "github.com"}, "https://go.k8s.io/bot-commands", "https://git.k8s.io/community/contributors/guide/owners.md#the-code-review-process", "org", "repo", "dev"); got == nil {
+		t.Error("GetMessage() failed")
+	} else if !strings.HasPrefix(*got, want) {
+		t.Errorf("GetMessage() = %+v, want prefix = %+v", *got, want)
+	}
+}
+
+func TestRuleStatusString(t *testing.T) {
+	status := RuleStatus{
+		Rule:      Rule{Name: "security", Files: []string{"a", "b", "c", "d", "e"}, MinApprovals: 1},
+		Approvals: sets.NewString(),
+	}
+	want := "- **security**: 0/1 approvals for `a`, `b`, `c` and 2 more files\n"
+	if got := status.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
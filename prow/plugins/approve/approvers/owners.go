@@ -38,6 +38,8 @@ import (
 const (
 	// ApprovalNotificationName defines the name used in the title for the approval notifications.
 	ApprovalNotificationName = "ApprovalNotifier"
+
+	selfApprovalHow = "Author self-approved"
 )
 
 // Repo allows querying and interacting with OWNERS information in a repo.
@@ -240,6 +242,48 @@ func (a Approval) String() string {
 	)
 }
 
+// Rule is an approval requirement that applies to a change in addition to
+// the OWNERS files.
+type Rule struct {
+	Name string
+	// Files is the list of changed files the rule applies to.
+	Files []string
+	// Approvers is the set of logins (normalized to lowercase) allowed to
+	// satisfy the rule.
+	Approvers    sets.String
+	MinApprovals int
+}
+
+// RuleStatus has the information about the approvals a rule has received.
+type RuleStatus struct {
+	Rule      Rule
+	Approvals sets.String
+}
+
+// Met returns whether the rule received enough approvals.
+func (s RuleStatus) Met() bool {
+	return s.Approvals.Len() >= s.Rule.MinApprovals
+}
+
+func (s RuleStatus) String() string {
+	if s.Met() {
+		return fmt.Sprintf("- ~~%s~~ [%s]\n", s.Rule.Name, strings.Join(s.Approvals.List(), ","))
+	}
+	return fmt.Sprintf("- **%s**: %d/%d approvals for %s\n", s.Rule.Name, s.Approvals.Len(), s.Rule.MinApprovals, formatFiles(s.Rule.Files))
+}
+
+func formatFiles(files []string) string {
+	const max = 3
+	quoted := make([]string, 0, max)
+	for i, file := range files {
+		if i == max {
+			return fmt.Sprintf("%s and %d more files", strings.Join(quoted, ", "), len(files)-max)
+		}
+		quoted = append(quoted, "`"+file+"`")
+	}
+	return strings.Join(quoted, ", ")
+}
+
 // Approvers is struct that provide functionality with regard to approvals of a specific
 // code change.
 type Approvers struct {
@@ -248,6 +292,7 @@ type Approvers struct {
 	assignees       sets.String
 	AssociatedIssue int
 	RequireIssue    bool
+	Rules           []Rule
 
 	ManuallyApproved func() bool
 }
@@ -327,7 +372,7 @@ func (ap *Approvers) AddAuthorSelfApprover(login, reference string, noIssue bool
 	}
 	ap.approvers[strings.ToLower(login)] = Approval{
 		Login:     login,
-		How:       "Author self-approved",
+		How:       selfApprovalHow,
 		Reference: reference,
 		NoIssue:   noIssue,
 	}
@@ -496,22 +541,51 @@ func (ap Approvers) AreFilesApproved() bool {
 	return len(ap.owners.filenames) != 0 && ap.UnapprovedFiles().Len() == 0
 }
 
+// RuleStatuses returns the approvals each rule has received. Implicit
+// self-approvals by the author do not count towards rules.
+func (ap Approvers) RuleStatuses() []RuleStatus {
+	statuses := make([]RuleStatus, 0, len(ap.Rules))
+	for _, rule := range ap.Rules {
+		approvals := sets.NewString()
+		for login, approval := range ap.approvers {
+			if approval.How != selfApprovalHow && rule.Approvers.Has(login) {
+				approvals.Insert(approval.Login)
+			}
+		}
+		statuses = append(statuses, RuleStatus{Rule: rule, Approvals: approvals})
+	}
+	return statuses
+}
+
+// AreRulesMet returns a bool indicating whether every rule that applies to
+// the PR received enough approvals.
+func (ap Approvers) AreRulesMet() bool {
+	for _, status := range ap.RuleStatuses() {
+		if !status.Met() {
+			return false
+		}
+	}
+	return true
+}
+
 // RequirementsMet returns a bool indicating whether the PR has met all approval requirements:
 // - all OWNERS files associated with the PR have been approved AND
+// - all rules that apply to the PR have been satisfied AND
 // EITHER
 // 	- the munger config is such that an issue is not required to be associated with the PR
 // 	- that there is an associated issue with the PR
 // 	- an OWNER has indicated that the PR is trivial enough that an issue need not be associated with the PR
 func (ap Approvers) RequirementsMet() bool {
-	return ap.AreFilesApproved() && (!ap.RequireIssue || ap.AssociatedIssue != 0 || len(ap.NoIssueApprovers()) != 0)
+	return ap.AreFilesApproved() && ap.AreRulesMet() && (!ap.RequireIssue || ap.AssociatedIssue != 0 || len(ap.NoIssueApprovers()) != 0)
 }
 
 // IsApproved returns a bool indicating whether the PR is fully approved.
-// If a human manually added the approved label, this returns true, ignoring normal approval rules.
+// If a human manually added the approved label, this returns true as long as
+// the rules that apply to the PR are met, ignoring the other requirements.
 func (ap Approvers) IsApproved() bool {
 	reqsMet := ap.RequirementsMet()
 	if !reqsMet && ap.ManuallyApproved() {
-		return true
+		return ap.AreRulesMet()
 	}
 	return reqsMet
 }
@@ -609,7 +683,11 @@ func GenerateTemplate(templ, name string, data interface{}) (string, error) {
 func GetMessage(ap Approvers, linkURL *url.URL, commandHelpLink, prProcessLink, org, repo, branch string) *string {
 	linkURL.Path = org + "/" + repo
 	message, err := GenerateTemplate(`{{if (and (not .ap.RequirementsMet) (call .ap.ManuallyApproved )) }}
+{{- if .ap.AreRulesMet }}
 Approval requirements bypassed by manually added approval.
+{{- else }}
+Manually added approval does not bypass the approval rules below, which still need to be satisfied.
+{{- end }}
 
 {{end -}}
 This pull-request has been approved by:{{range $index, $approval := .ap.ListApprovals}}{{if $index}}, {{else}} {{end}}{{$approval}}{{end}}
@@ -634,6 +712,12 @@ Associated issue requirement bypassed by:{{range $index, $approval := .ap.ListNo
 
 {{ end -}}
 
+{{if .ap.Rules -}}
+Approval rules that apply to this pull request:
+
+{{range .ap.RuleStatuses}}{{.}}{{end}}
+{{ end -}}
+
 The full list of commands accepted by this bot can be found [here]({{ .commandHelpLink }}?repo={{ .org }}%2F{{ .repo }}).
 
 {{ if (or .ap.AreFilesApproved (call .ap.ManuallyApproved)) -}}
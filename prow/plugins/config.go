@@ -26,6 +26,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mattn/go-zglob"
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -68,12 +69,14 @@ type Configuration struct {
 	CherryPickUnapproved CherryPickUnapproved         `json:"cherry_pick_unapproved,omitempty"`
 	ConfigUpdater        ConfigUpdater                `json:"config_updater,omitempty"`
 	Dco                  map[string]*Dco              `json:"dco,omitempty"`
+	FlakyTest            []FlakyTest                  `json:"flaky_test,omitempty"`
 	Golint               Golint                       `json:"golint,omitempty"`
 	Goose                Goose                        `json:"goose,omitempty"`
 	Heart                Heart                        `json:"heart,omitempty"`
 	JiraLinker           JiraLinker                   `json:"jira_linker,omitempty"`
 	Label                Label                        `json:"label,omitempty"`
 	Lgtm                 []Lgtm                       `json:"lgtm,omitempty"`
+	Lifecycle            []Lifecycle                  `json:"lifecycle,omitempty"`
 	MilestoneApplier     map[string]BranchToMilestone `json:"milestone_applier,omitempty"`
 	RepoMilestone        map[string]Milestone         `json:"repo_milestone,omitempty"`
 	Project              ProjectConfig                `json:"project_config,omitempty"`
@@ -173,6 +176,12 @@ type Owners struct {
 	// Filenames allows configuring repos to use a separate set of filenames for
 	// any plugin that interacts with these files. Keys are in "org/repo" format.
 	Filenames map[string]ownersconfig.Filenames `json:"filenames,omitempty"`
+
+	// CodeOwners configures repos to also use GitHub CODEOWNERS files as a source
+	// of approvers and reviewers. Keys are in "org" or "org/repo" format, values
+	// are one of "fallback" (only use CODEOWNERS if the repo has no OWNERS files),
+	// "merge" (use both) or "override" (ignore OWNERS files).
+	CodeOwners map[string]ownersconfig.CodeOwnersPrecedence `json:"codeowners,omitempty"`
 }
 
 // OwnersFilenames determines which filenames to use for OWNERS and OWNERS_ALIASES for a repo.
@@ -187,6 +196,15 @@ func (c *Configuration) OwnersFilenames(org, repo string) ownersconfig.Filenames
 	}
 }
 
+// CodeOwnersPrecedence determines how CODEOWNERS files are used for a repo.
+// Repo level configuration takes precedence over org level configuration.
+func (c *Configuration) CodeOwnersPrecedence(org, repo string) ownersconfig.CodeOwnersPrecedence {
+	if precedence, configured := c.Owners.CodeOwners[fmt.Sprintf("%s/%s", org, repo)]; configured {
+		return precedence
+	}
+	return c.Owners.CodeOwners[org]
+}
+
 // MDYAMLEnabled returns a boolean denoting if the passed repo supports YAML OWNERS config headers
 // at the top of markdown (*.md) files. These function like OWNERS files but only apply to the file
 // itself.
@@ -290,6 +308,44 @@ type Approve struct {
 	// PrProcessLink is the link to the help page which explains the code review process.
 	// The default value is "https://git.k8s.io/community/contributors/guide/owners.md#the-code-review-process".
 	PrProcessLink string `json:"pr_process_link,omitempty"`
+	// Rules are path-scoped approval requirements that apply in addition to
+	// OWNERS files. A pull request is only approved once every rule matching
+	// one of its changed files is satisfied.
+	Rules []ApproveRule `json:"rules,omitempty"`
+}
+
+// ApproveRule requires approvals from a given set of users for changes to
+// the files matching its paths.
+type ApproveRule struct {
+	// Name identifies the rule in the approval notification.
+	Name string `json:"name"`
+	// Paths is a list of globs, relative to the repository root, that the
+	// rule applies to. "**" matches any number of directories, so all files
+	// under api/ are matched by "api/**/*".
+	Paths []string `json:"paths"`
+	// Approvers is a list of GitHub logins allowed to satisfy the rule.
+	Approvers []string `json:"approvers,omitempty"`
+	// Teams is a list of team slugs in the repo's org whose members are
+	// allowed to satisfy the rule.
+	Teams []string `json:"teams,omitempty"`
+	// MinApprovals is the number of distinct approvals needed to satisfy
+	// the rule. Approvals by the author of the pull request do not count.
+	// Defaults to 1.
+	MinApprovals int `json:"min_approvals,omitempty"`
+}
+
+// Matches returns the files a rule applies to.
+func (r ApproveRule) Matches(files []string) []string {
+	var matched []string
+	for _, file := range files {
+		for _, path := range r.Paths {
+			if match, err := zglob.Match(path, file); err == nil && match {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	return matched
 }
 
 var (
@@ -601,6 +657,67 @@ type Dco struct {
 	SkipDCOCheckForCollaborators bool `json:"skip_dco_check_for_collaborators,omitempty"`
 }
 
+// FlakyTest is the config for the flakytest plugin and the flakytest-controller,
+// which track tests that fail intermittently in presubmits.
+type FlakyTest struct {
+	// Repos is either of the form org/repo or just org.
+	Repos []string `json:"repos,omitempty"`
+	// Label is applied to the issues filed for flaky tests and is used to
+	// find them again. Defaults to "kind/flake".
+	Label string `json:"label,omitempty"`
+	// MinFlakes is the number of revisions a test must both fail and pass
+	// on before an issue is filed for it. Defaults to 2.
+	MinFlakes int `json:"min_flakes,omitempty"`
+	// QuarantineFile is the path, relative to the repository root, of a file
+	// listing quarantined tests one per line. If set, the controller opens
+	// a pull request adding newly detected flaky tests to it.
+	QuarantineFile string `json:"quarantine_file,omitempty"`
+	// QuarantineBranch is the branch quarantine pull requests are opened
+	// against. Defaults to "master".
+	QuarantineBranch string `json:"quarantine_branch,omitempty"`
+}
+
+// Lifecycle is the config for the lifecycle-controller, which marks inactive
+// issues and pull requests as stale, then as rotten, and finally closes them,
+// using the labels of the lifecycle plugin.
+type Lifecycle struct {
+	// Repos is either of the form org/repo or just org.
+	Repos []string `json:"repos,omitempty"`
+	// StaleAfter is how long an issue or PR must be inactive before it is
+	// marked stale. Defaults to "2160h" (90 days).
+	StaleAfter         string        `json:"stale_after,omitempty"`
+	StaleAfterDuration time.Duration `json:"-"`
+	// RottenAfter is how long a stale issue or PR must be inactive before it
+	// is marked rotten. Defaults to "720h" (30 days).
+	RottenAfter         string        `json:"rotten_after,omitempty"`
+	RottenAfterDuration time.Duration `json:"-"`
+	// CloseAfter is how long a rotten issue or PR must be inactive before it
+	// is closed. Defaults to "720h" (30 days).
+	CloseAfter         string        `json:"close_after,omitempty"`
+	CloseAfterDuration time.Duration `json:"-"`
+	// ExemptLabels lists labels that exempt issues and PRs from aging, in
+	// addition to lifecycle/frozen.
+	ExemptLabels []string `json:"exempt_labels,omitempty"`
+	// ExemptMilestones lists milestones that exempt issues and PRs from aging.
+	ExemptMilestones []string `json:"exempt_milestones,omitempty"`
+	// SkipIssues disables aging of issues.
+	SkipIssues bool `json:"skip_issues,omitempty"`
+	// SkipPullRequests disables aging of pull requests.
+	SkipPullRequests bool `json:"skip_pull_requests,omitempty"`
+	// DryRun makes the controller log the transitions it would make in these
+	// repos instead of making them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// FormatDays formats the durations of the Lifecycle config, which are usually
+// whole days, in days.
+func FormatDays(d time.Duration) string {
+	if d%(24*time.Hour) != 0 {
+		return d.String()
+	}
+	return fmt.Sprintf("%d days", d/(24*time.Hour))
+}
+
 // CherryPickUnapproved is the config for the cherrypick-unapproved plugin.
 type CherryPickUnapproved struct {
 	// BranchRegexp is the regular expression for branch names such that
@@ -751,6 +868,14 @@ func (c *Configuration) ApproveFor(org, repo string) *Approve {
 	if a.PrProcessLink == "" {
 		a.PrProcessLink = "https://git.k8s.io/community/contributors/guide/owners.md#the-code-review-process"
 	}
+	rules := make([]ApproveRule, 0, len(a.Rules))
+	for _, rule := range a.Rules {
+		if rule.MinApprovals == 0 {
+			rule.MinApprovals = 1
+		}
+		rules = append(rules, rule)
+	}
+	a.Rules = rules
 	return a
 }
 
@@ -814,6 +939,55 @@ func (c *Configuration) DcoFor(org, repo string) *Dco {
 	return &Dco{}
 }
 
+// FlakyTestFor finds the FlakyTest for a repo, if one exists.
+// FlakyTest configuration can be listed for a repository
+// or an organization.
+func (c *Configuration) FlakyTestFor(org, repo string) *FlakyTest {
+	fullName := fmt.Sprintf("%s/%s", org, repo)
+
+	f := func() FlakyTest {
+		for _, flakyTest := range c.FlakyTest {
+			if sets.NewString(flakyTest.Repos...).Has(fullName) {
+				return flakyTest
+			}
+		}
+		for _, flakyTest := range c.FlakyTest {
+			if sets.NewString(flakyTest.Repos...).Has(org) {
+				return flakyTest
+			}
+		}
+		return FlakyTest{}
+	}()
+	if f.Label == "" {
+		f.Label = "kind/flake"
+	}
+	if f.MinFlakes == 0 {
+		f.MinFlakes = 2
+	}
+	if f.QuarantineBranch == "" {
+		f.QuarantineBranch = "master"
+	}
+	return &f
+}
+
+// LifecycleFor finds the Lifecycle for a repo, or nil if issues and PRs of
+// the repo are not aged.
+// Lifecycle configuration can be listed for a repository or an organization.
+func (c *Configuration) LifecycleFor(org, repo string) *Lifecycle {
+	fullName := fmt.Sprintf("%s/%s", org, repo)
+	for i, lifecycle := range c.Lifecycle {
+		if sets.NewString(lifecycle.Repos...).Has(fullName) {
+			return &c.Lifecycle[i]
+		}
+	}
+	for i, lifecycle := range c.Lifecycle {
+		if sets.NewString(lifecycle.Repos...).Has(org) {
+			return &c.Lifecycle[i]
+		}
+	}
+	return nil
+}
+
 // EnabledReposForPlugin returns the orgs and repos that have enabled the passed plugin.
 func (c *Configuration) EnabledReposForPlugin(plugin string) (orgs, repos []string) {
 	for repo, plugins := range c.Plugins {
@@ -1096,6 +1270,84 @@ func validateProjectManager(pm ProjectManager) error {
 	return nil
 }
 
+func validateApprove(approves []Approve) error {
+	for _, a := range approves {
+		names := sets.NewString()
+		for i, rule := range a.Rules {
+			if rule.Name == "" {
+				return fmt.Errorf("approve rule #%d for %v has no name", i, a.Repos)
+			}
+			if names.Has(rule.Name) {
+				return fmt.Errorf("approve rule %q for %v is defined more than once", rule.Name, a.Repos)
+			}
+			names.Insert(rule.Name)
+			if len(rule.Paths) == 0 {
+				return fmt.Errorf("approve rule %q has no paths configured", rule.Name)
+			}
+			for _, path := range rule.Paths {
+				if _, err := zglob.Match(path, ""); err != nil {
+					return fmt.Errorf("approve rule %q has invalid path %q: %v", rule.Name, path, err)
+				}
+			}
+			if len(rule.Approvers) == 0 && len(rule.Teams) == 0 {
+				return fmt.Errorf("approve rule %q has neither approvers nor teams configured", rule.Name)
+			}
+			if rule.MinApprovals < 0 {
+				return fmt.Errorf("approve rule %q has invalid min_approvals: %d (needs to be positive)", rule.Name, rule.MinApprovals)
+			}
+		}
+	}
+	return nil
+}
+
+func validateFlakyTest(flakyTests []FlakyTest) error {
+	for i, f := range flakyTests {
+		if len(f.Repos) == 0 {
+			return fmt.Errorf("flaky_test config #%d has no repos configured", i)
+		}
+		if f.MinFlakes < 0 {
+			return fmt.Errorf("flaky_test config #%d has invalid min_flakes: %d (needs to be positive)", i, f.MinFlakes)
+		}
+	}
+	return nil
+}
+
+func validateLifecycle(lifecycles []Lifecycle) error {
+	configured := sets.NewString()
+	for i, l := range lifecycles {
+		if len(l.Repos) == 0 {
+			return fmt.Errorf("lifecycle config #%d has no repos configured", i)
+		}
+		for _, orgRepo := range l.Repos {
+			if configured.Has(orgRepo) {
+				return fmt.Errorf("lifecycle is configured more than once for %s", orgRepo)
+			}
+			configured.Insert(orgRepo)
+		}
+		for _, d := range []struct {
+			field    string
+			duration time.Duration
+		}{{"stale_after", l.StaleAfterDuration}, {"rotten_after", l.RottenAfterDuration}, {"close_after", l.CloseAfterDuration}} {
+			if d.duration <= 0 {
+				return fmt.Errorf("lifecycle config #%d has invalid %s: %v (needs to be positive)", i, d.field, d.duration)
+			}
+		}
+		if l.SkipIssues && l.SkipPullRequests {
+			return fmt.Errorf("lifecycle config #%d skips both issues and pull requests", i)
+		}
+	}
+	return nil
+}
+
+func validateOwners(owners Owners) error {
+	for orgRepo, precedence := range owners.CodeOwners {
+		if err := precedence.Validate(); err != nil {
+			return fmt.Errorf("invalid owners.codeowners config for %s: %v", orgRepo, err)
+		}
+	}
+	return nil
+}
+
 var warnTriggerTrustedOrg time.Time
 
 func validateTrigger(triggers []Trigger) error {
@@ -1141,6 +1393,30 @@ func compileRegexpsAndDurations(pc *Configuration) error {
 		}
 		rs[i].GracePeriodDuration = dur
 	}
+
+	for i := range pc.Lifecycle {
+		lifecycle := &pc.Lifecycle[i]
+		for _, d := range []struct {
+			field    string
+			value    string
+			def      time.Duration
+			duration *time.Duration
+		}{
+			{field: "stale_after", value: lifecycle.StaleAfter, def: 90 * 24 * time.Hour, duration: &lifecycle.StaleAfterDuration},
+			{field: "rotten_after", value: lifecycle.RottenAfter, def: 30 * 24 * time.Hour, duration: &lifecycle.RottenAfterDuration},
+			{field: "close_after", value: lifecycle.CloseAfter, def: 30 * 24 * time.Hour, duration: &lifecycle.CloseAfterDuration},
+		} {
+			if d.value == "" {
+				*d.duration = d.def
+				continue
+			}
+			dur, err := time.ParseDuration(d.value)
+			if err != nil {
+				return fmt.Errorf("failed to compile lifecycle %s duration: %q, error: %v", d.field, d.value, err)
+			}
+			*d.duration = dur
+		}
+	}
 	return nil
 }
 
@@ -1180,6 +1456,18 @@ func (c *Configuration) Validate() error {
 	if err := validateTrigger(c.Triggers); err != nil {
 		return err
 	}
+	if err := validateFlakyTest(c.FlakyTest); err != nil {
+		return err
+	}
+	if err := validateApprove(c.Approve); err != nil {
+		return err
+	}
+	if err := validateOwners(c.Owners); err != nil {
+		return err
+	}
+	if err := validateLifecycle(c.Lifecycle); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"k8s.io/apimachinery/pkg/util/diff"
@@ -28,6 +29,7 @@ import (
 	"sigs.k8s.io/yaml"
 
 	"k8s.io/test-infra/prow/bugzilla"
+	"k8s.io/test-infra/prow/plugins/ownersconfig"
 )
 
 func TestValidateExternalPlugins(t *testing.T) {
@@ -212,6 +214,56 @@ func TestTriggerFor(t *testing.T) {
 	}
 }
 
+func TestFlakyTestFor(t *testing.T) {
+	config := Configuration{
+		FlakyTest: []FlakyTest{
+			{
+				Repos:     []string{"k8s"},
+				MinFlakes: 3,
+			},
+			{
+				Repos:            []string{"k8s/t-i"},
+				Label:            "flake",
+				QuarantineFile:   "hack/quarantine.txt",
+				QuarantineBranch: "main",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		org, repo string
+		expected  FlakyTest
+	}{
+		{
+			name:     "org config",
+			org:      "k8s",
+			repo:     "k8s",
+			expected: FlakyTest{Repos: []string{"k8s"}, Label: "kind/flake", MinFlakes: 3, QuarantineBranch: "master"},
+		},
+		{
+			name:     "repo config",
+			org:      "k8s",
+			repo:     "t-i",
+			expected: FlakyTest{Repos: []string{"k8s/t-i"}, Label: "flake", MinFlakes: 2, QuarantineFile: "hack/quarantine.txt", QuarantineBranch: "main"},
+		},
+		{
+			name:     "default config",
+			org:      "other",
+			repo:     "other",
+			expected: FlakyTest{Label: "kind/flake", MinFlakes: 2, QuarantineBranch: "master"},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(&tc.expected, config.FlakyTestFor(tc.org, tc.repo)); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestSetApproveDefaults(t *testing.T) {
 	c := &Configuration{
 		Approve: []Approve{
@@ -1293,6 +1345,209 @@ func TestStatesMatch(t *testing.T) {
 	}
 }
 
+func TestValidateApprove(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rules       []ApproveRule
+		expectedErr string
+	}{
+		{
+			name:  "valid rules",
+			rules: []ApproveRule{{Name: "api", Paths: []string{"api/**/*"}, Teams: []string{"api-reviewers"}, MinApprovals: 2}},
+		},
+		{
+			name:        "missing name",
+			rules:       []ApproveRule{{Paths: []string{"api/**/*"}, Approvers: []string{"alice"}}},
+			expectedErr: "approve rule #0 for [org] has no name",
+		},
+		{
+			name: "duplicate name",
+			rules: []ApproveRule{
+				{Name: "api", Paths: []string{"api/**/*"}, Approvers: []string{"alice"}},
+				{Name: "api", Paths: []string{"pkg/**/*"}, Approvers: []string{"bob"}},
+			},
+			expectedErr: `approve rule "api" for [org] is defined more than once`,
+		},
+		{
+			name:        "no paths",
+			rules:       []ApproveRule{{Name: "api", Approvers: []string{"alice"}}},
+			expectedErr: `approve rule "api" has no paths configured`,
+		},
+		{
+			name:        "no approvers",
+			rules:       []ApproveRule{{Name: "api", Paths: []string{"api/**/*"}}},
+			expectedErr: `approve rule "api" has neither approvers nor teams configured`,
+		},
+		{
+			name:        "negative min approvals",
+			rules:       []ApproveRule{{Name: "api", Paths: []string{"api/**/*"}, Approvers: []string{"alice"}, MinApprovals: -1}},
+			expectedErr: `approve rule "api" has invalid min_approvals: -1 (needs to be positive)`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errMsg string
+			if err := validateApprove([]Approve{{Repos: []string{"org"}, Rules: tc.rules}}); err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.expectedErr {
+				t.Errorf("expected error %q, got %q", tc.expectedErr, errMsg)
+			}
+		})
+	}
+}
+
+func TestApproveForRuleDefaults(t *testing.T) {
+	config := Configuration{
+		Approve: []Approve{{
+			Repos: []string{"org"},
+			Rules: []ApproveRule{
+				{Name: "api", Paths: []string{"api/**/*"}, Approvers: []string{"alice"}},
+				{Name: "security", Paths: []string{"**/secrets/*"}, Approvers: []string{"bob"}, MinApprovals: 2},
+			},
+		}},
+	}
+	rules := config.ApproveFor("org", "repo").Rules
+	if rules[0].MinApprovals != 1 || rules[1].MinApprovals != 2 {
+		t.Errorf("expected min_approvals to default to 1, got %+v", rules)
+	}
+	if config.Approve[0].Rules[0].MinApprovals != 0 {
+		t.Error("expected defaulting not to modify the configuration")
+	}
+	if diff := cmp.Diff([]string{"api/v1/types.go"}, rules[0].Matches([]string{"api/v1/types.go", "pkg/api/types.go"})); diff != "" {
+		t.Errorf("unexpected matched files (-want +got):\n%s", diff)
+	}
+}
+
+func TestCodeOwnersPrecedence(t *testing.T) {
+	config := Configuration{
+		Owners: Owners{
+			CodeOwners: map[string]ownersconfig.CodeOwnersPrecedence{
+				"org":            ownersconfig.CodeOwnersFallback,
+				"org/override":   ownersconfig.CodeOwnersOverride,
+				"other/codeless": ownersconfig.CodeOwnersMerge,
+			},
+		},
+	}
+	testCases := []struct {
+		org, repo string
+		expected  ownersconfig.CodeOwnersPrecedence
+	}{
+		{org: "org", repo: "repo", expected: ownersconfig.CodeOwnersFallback},
+		{org: "org", repo: "override", expected: ownersconfig.CodeOwnersOverride},
+		{org: "other", repo: "codeless", expected: ownersconfig.CodeOwnersMerge},
+		{org: "other", repo: "repo", expected: ownersconfig.CodeOwnersIgnored},
+	}
+	for _, tc := range testCases {
+		if got := config.CodeOwnersPrecedence(tc.org, tc.repo); got != tc.expected {
+			t.Errorf("%s/%s: expected precedence %q, got %q", tc.org, tc.repo, tc.expected, got)
+		}
+	}
+
+	config.Owners.CodeOwners["org/invalid"] = "first"
+	expected := `invalid owners.codeowners config for org/invalid: unknown CODEOWNERS precedence "first", must be one of "fallback", "merge" or "override"`
+	if err := validateOwners(config.Owners); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	testCases := []struct {
+		name        string
+		lifecycle   []Lifecycle
+		expected    []Lifecycle
+		expectedErr string
+	}{
+		{
+			name:      "defaults",
+			lifecycle: []Lifecycle{{Repos: []string{"org"}}},
+			expected: []Lifecycle{{
+				Repos:               []string{"org"},
+				StaleAfterDuration:  90 * 24 * time.Hour,
+				RottenAfterDuration: 30 * 24 * time.Hour,
+				CloseAfterDuration:  30 * 24 * time.Hour,
+			}},
+		},
+		{
+			name:      "durations",
+			lifecycle: []Lifecycle{{Repos: []string{"org"}, StaleAfter: "24h", RottenAfter: "48h", CloseAfter: "1h"}},
+			expected: []Lifecycle{{
+				Repos:               []string{"org"},
+				StaleAfter:          "24h",
+				StaleAfterDuration:  24 * time.Hour,
+				RottenAfter:         "48h",
+				RottenAfterDuration: 48 * time.Hour,
+				CloseAfter:          "1h",
+				CloseAfterDuration:  time.Hour,
+			}},
+		},
+		{
+			name:        "invalid duration",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, StaleAfter: "90d"}},
+			expectedErr: `failed to compile lifecycle stale_after duration: "90d", error: time: unknown unit "d" in duration "90d"`,
+		},
+		{
+			name:        "negative duration",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, CloseAfter: "-1h"}},
+			expectedErr: "lifecycle config #0 has invalid close_after: -1h0m0s (needs to be positive)",
+		},
+		{
+			name:        "no repos",
+			lifecycle:   []Lifecycle{{}},
+			expectedErr: "lifecycle config #0 has no repos configured",
+		},
+		{
+			name:        "repo configured twice",
+			lifecycle:   []Lifecycle{{Repos: []string{"org", "org/repo"}}, {Repos: []string{"org/repo"}}},
+			expectedErr: "lifecycle is configured more than once for org/repo",
+		},
+		{
+			name:        "nothing to age",
+			lifecycle:   []Lifecycle{{Repos: []string{"org"}, SkipIssues: true, SkipPullRequests: true}},
+			expectedErr: "lifecycle config #0 skips both issues and pull requests",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Configuration{Lifecycle: tc.lifecycle}
+			err := compileRegexpsAndDurations(config)
+			if err == nil {
+				err = validateLifecycle(config.Lifecycle)
+			}
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.expectedErr {
+				t.Fatalf("expected error %q, got %q", tc.expectedErr, errMsg)
+			}
+			if tc.expected != nil {
+				if diff := cmp.Diff(tc.expected, config.Lifecycle); diff != "" {
+					t.Errorf("unexpected lifecycle config (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestLifecycleFor(t *testing.T) {
+	config := &Configuration{
+		Lifecycle: []Lifecycle{
+			{Repos: []string{"org"}, StaleAfter: "1h"},
+			{Repos: []string{"org/repo"}, StaleAfter: "2h"},
+		},
+	}
+	if got := config.LifecycleFor("org", "repo"); got == nil || got.StaleAfter != "2h" {
+		t.Errorf("expected the repo config for org/repo, got %+v", got)
+	}
+	if got := config.LifecycleFor("org", "other"); got == nil || got.StaleAfter != "1h" {
+		t.Errorf("expected the org config for org/other, got %+v", got)
+	}
+	if got := config.LifecycleFor("other", "repo"); got != nil {
+		t.Errorf("expected no config for other/repo, got %+v", got)
+	}
+}
+
 func TestValidateConfigUpdater(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -1437,3 +1692,14 @@ func TestConfigUpdaterResolve(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatDays(t *testing.T) {
+	for duration, expected := range map[time.Duration]string{
+		90 * 24 * time.Hour: "90 days",
+		36 * time.Hour:      "36h0m0s",
+	} {
+		if got := FormatDays(duration); got != expected {
+			t.Errorf("expected %s to be formatted as %q, got %q", duration, expected, got)
+		}
+	}
+}
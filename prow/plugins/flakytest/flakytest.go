@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flakytest contains a plugin which points contributors that
+// /retest a pull request at the issues tracking known flaky tests of the
+// jobs that failed. The issues are filed by the flakytest-controller.
+package flakytest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/flakytest"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/pjutil"
+	"k8s.io/test-infra/prow/pluginhelp"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+const (
+	// PluginName defines this plugin's registered name.
+	PluginName = "flakytest"
+)
+
+func init() {
+	plugins.RegisterGenericCommentHandler(PluginName, handleGenericComment, helpProvider)
+}
+
+func helpProvider(config *plugins.Configuration, enabledRepos []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+	configInfo := map[string]string{}
+	for _, repo := range enabledRepos {
+		opts := config.FlakyTestFor(repo.Org, repo.Repo)
+		msg := fmt.Sprintf("Flaky tests are tracked in issues labeled %q once they flake on %d revisions.", opts.Label, opts.MinFlakes)
+		if opts.QuarantineFile != "" {
+			msg += fmt.Sprintf(" Pull requests adding them to %s on the %s branch are opened automatically.", opts.QuarantineFile, opts.QuarantineBranch)
+		}
+		configInfo[repo.String()] = msg
+	}
+	yamlSnippet, err := plugins.CommentMap.GenYaml(&plugins.Configuration{
+		FlakyTest: []plugins.FlakyTest{
+			{
+				Repos:            []string{"org/repo"},
+				Label:            "kind/flake",
+				MinFlakes:        2,
+				QuarantineFile:   "hack/quarantined-tests.txt",
+				QuarantineBranch: "master",
+			},
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("cannot generate comments for %s plugin", PluginName)
+	}
+	return &pluginhelp.PluginHelp{
+		Description: "The flakytest plugin comments on pull requests that are retested after a job with known flaky tests failed, linking the issues that track those tests. The issues are filed and kept up to date by the flakytest-controller.",
+		Config:      configInfo,
+		Snippet:     yamlSnippet,
+	}, nil
+}
+
+type githubClient interface {
+	BotUserChecker() (func(candidate string) bool, error)
+	CreateComment(owner, repo string, number int, comment string) error
+	FindAllIssues(query, sort string, asc bool) ([]github.Issue, error)
+	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+}
+
+func handleGenericComment(pc plugins.Agent, e github.GenericCommentEvent) error {
+	org, repo := e.Repo.Owner.Login, e.Repo.Name
+	presubmits := pc.Config.PresubmitsStatic[org+"/"+repo]
+	return handle(pc.GitHubClient, pc.Logger, pc.PluginConfig.FlakyTestFor(org, repo), presubmits, &e)
+}
+
+// trackingIssue is an open issue filed for a flaky test.
+type trackingIssue struct {
+	number int
+	test   string
+}
+
+func handle(gc githubClient, log *logrus.Entry, opts *plugins.FlakyTest, presubmits []config.Presubmit, e *github.GenericCommentEvent) error {
+	if !e.IsPR || e.Action != github.GenericCommentActionCreated || e.IssueState != "open" {
+		return nil
+	}
+	if !pjutil.RetestRe.MatchString(e.Body) {
+		return nil
+	}
+	org, repo, number := e.Repo.Owner.Login, e.Repo.Name, e.Number
+
+	pr, err := gc.GetPullRequest(org, repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request %s/%s#%d: %v", org, repo, number, err)
+	}
+	status, err := gc.GetCombinedStatus(org, repo, pr.Head.SHA)
+	if err != nil {
+		return fmt.Errorf("failed to get statuses of %s: %v", pr.Head.SHA, err)
+	}
+	failedContexts := sets.NewString()
+	for _, s := range status.Statuses {
+		if s.State == github.StatusError || s.State == github.StatusFailure {
+			failedContexts.Insert(s.Context)
+		}
+	}
+	failedJobs := sets.NewString()
+	for _, ps := range presubmits {
+		if failedContexts.Has(ps.Context) {
+			failedJobs.Insert(ps.Name)
+		}
+	}
+	if failedJobs.Len() == 0 {
+		return nil
+	}
+
+	issues, err := gc.FindAllIssues(flakytest.IssueQuery(org, repo, opts.Label), "", false)
+	if err != nil {
+		return fmt.Errorf("failed to search for flaky test issues: %v", err)
+	}
+	tracked := map[string][]trackingIssue{}
+	for _, issue := range issues {
+		job, test, ok := flakytest.ParseMarker(issue.Body)
+		if !ok || !failedJobs.Has(job) {
+			continue
+		}
+		tracked[job] = append(tracked[job], trackingIssue{number: issue.Number, test: test})
+	}
+	if len(tracked) == 0 {
+		return nil
+	}
+
+	// Only point at the same issues once per commit, no matter how often
+	// the pull request is retested.
+	marker := commentMarker(pr.Head.SHA, tracked)
+	comments, err := gc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to list comments on %s/%s#%d: %v", org, repo, number, err)
+	}
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if botUserChecker(comment.User.Login) && strings.Contains(comment.Body, marker) {
+			return nil
+		}
+	}
+
+	log.Infof("Linking flaky test issues for %d failed jobs on %s/%s#%d.", len(tracked), org, repo, number)
+	resp := fmt.Sprintf("%s\n%s", marker, formatIssues(tracked))
+	return gc.CreateComment(org, repo, number, plugins.FormatResponseRaw(e.Body, e.HTMLURL, e.User.Login, resp))
+}
+
+func sortedJobs(tracked map[string][]trackingIssue) []string {
+	var jobs []string
+	for job, issues := range tracked {
+		jobs = append(jobs, job)
+		sort.Slice(issues, func(i, j int) bool { return issues[i].number < issues[j].number })
+	}
+	sort.Strings(jobs)
+	return jobs
+}
+
+func commentMarker(sha string, tracked map[string][]trackingIssue) string {
+	var numbers []string
+	for _, job := range sortedJobs(tracked) {
+		for _, issue := range tracked[job] {
+			numbers = append(numbers, fmt.Sprintf("%d", issue.number))
+		}
+	}
+	return fmt.Sprintf("<!-- flakytest sha=%s issues=%s -->", sha, strings.Join(numbers, ","))
+}
+
+func formatIssues(tracked map[string][]trackingIssue) string {
+	var b strings.Builder
+	b.WriteString("Some of the jobs that failed have known flaky tests:\n")
+	for _, job := range sortedJobs(tracked) {
+		var links []string
+		for _, issue := range tracked[job] {
+			links = append(links, fmt.Sprintf("#%d (`%s`)", issue.number, issue.test))
+		}
+		fmt.Fprintf(&b, "- `%s`: %s\n", job, strings.Join(links, ", "))
+	}
+	b.WriteString("\nIf one of these tests is what failed, please mention this pull request on its issue to help get it fixed.")
+	return b.String()
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flakytest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/flakytest"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestHandle(t *testing.T) {
+	presubmits := []config.Presubmit{
+		{JobBase: config.JobBase{Name: "pull-unit"}, Reporter: config.Reporter{Context: "unit"}},
+		{JobBase: config.JobBase{Name: "pull-e2e"}, Reporter: config.Reporter{Context: "e2e"}},
+	}
+	trackingIssues := map[int]*github.Issue{
+		5: {Number: 5, Body: flakytest.Marker("pull-unit", "TestA")},
+		6: {Number: 6, Body: flakytest.Marker("pull-e2e", "TestB")},
+		7: {Number: 7, Body: "not a tracking issue"},
+	}
+
+	testCases := []struct {
+		name             string
+		body             string
+		state            string
+		statuses         []github.Status
+		existingComments []github.IssueComment
+		expectComment    bool
+		expectContains   []string
+		expectMissing    []string
+	}{
+		{
+			name:     "not a retest",
+			body:     "/lgtm",
+			statuses: []github.Status{{Context: "unit", State: github.StatusFailure}},
+		},
+		{
+			name:     "closed PR",
+			body:     "/retest",
+			state:    "closed",
+			statuses: []github.Status{{Context: "unit", State: github.StatusFailure}},
+		},
+		{
+			name:     "no failed jobs",
+			body:     "/retest",
+			statuses: []github.Status{{Context: "unit", State: github.StatusSuccess}},
+		},
+		{
+			name:     "failed job without tracked flakes",
+			body:     "/retest",
+			statuses: []github.Status{{Context: "unknown", State: github.StatusFailure}},
+		},
+		{
+			name:           "failed job with tracked flake",
+			body:           "/retest",
+			statuses:       []github.Status{{Context: "unit", State: github.StatusFailure}, {Context: "e2e", State: github.StatusSuccess}},
+			expectComment:  true,
+			expectContains: []string{"`pull-unit`: #5 (`TestA`)"},
+			expectMissing:  []string{"#6"},
+		},
+		{
+			name:           "errored jobs count as failed",
+			body:           "/retest",
+			statuses:       []github.Status{{Context: "unit", State: github.StatusError}, {Context: "e2e", State: github.StatusFailure}},
+			expectComment:  true,
+			expectContains: []string{"`pull-unit`: #5 (`TestA`)", "`pull-e2e`: #6 (`TestB`)"},
+		},
+		{
+			name:     "already linked for this commit",
+			body:     "/retest",
+			statuses: []github.Status{{Context: "unit", State: github.StatusFailure}},
+			existingComments: []github.IssueComment{{
+				User: github.User{Login: fakegithub.Bot},
+				Body: "<!-- flakytest sha=head issues=5 -->",
+			}},
+		},
+		{
+			name:     "linked before for other issues",
+			body:     "/retest",
+			statuses: []github.Status{{Context: "unit", State: github.StatusFailure}, {Context: "e2e", State: github.StatusFailure}},
+			existingComments: []github.IssueComment{{
+				User: github.User{Login: fakegithub.Bot},
+				Body: "<!-- flakytest sha=head issues=5 -->",
+			}},
+			expectComment:  true,
+			expectContains: []string{"issues=6,5 -->"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakegithub.FakeClient{
+				Issues:        trackingIssues,
+				IssueComments: map[int][]github.IssueComment{1: tc.existingComments},
+				PullRequests: map[int]*github.PullRequest{
+					1: {Number: 1, Head: github.PullRequestBranch{SHA: "head"}},
+				},
+				CombinedStatuses: map[string]*github.CombinedStatus{
+					"head": {Statuses: tc.statuses},
+				},
+			}
+			state := tc.state
+			if state == "" {
+				state = "open"
+			}
+			e := &github.GenericCommentEvent{
+				Action:     github.GenericCommentActionCreated,
+				IsPR:       true,
+				IssueState: state,
+				Body:       tc.body,
+				Number:     1,
+				Repo:       github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+				User:       github.User{Login: "author"},
+			}
+			opts := (&plugins.Configuration{}).FlakyTestFor("org", "repo")
+			if err := handle(fc, logrus.WithField("plugin", PluginName), opts, presubmits, e); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !tc.expectComment {
+				if len(fc.IssueCommentsAdded) != 0 {
+					t.Errorf("expected no comment, got %v", fc.IssueCommentsAdded)
+				}
+				return
+			}
+			if len(fc.IssueCommentsAdded) != 1 {
+				t.Fatalf("expected one comment, got %v", fc.IssueCommentsAdded)
+			}
+			comment := fc.IssueCommentsAdded[0]
+			for _, s := range tc.expectContains {
+				if !strings.Contains(comment, s) {
+					t.Errorf("expected comment to contain %q, got %q", s, comment)
+				}
+			}
+			for _, s := range tc.expectMissing {
+				if strings.Contains(comment, s) {
+					t.Errorf("expected comment not to contain %q, got %q", s, comment)
+				}
+			}
+		})
+	}
+}
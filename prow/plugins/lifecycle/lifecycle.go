@@ -17,6 +17,7 @@ limitations under the License.
 package lifecycle
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/sirupsen/logrus"
@@ -37,9 +38,17 @@ func init() {
 	plugins.RegisterGenericCommentHandler("lifecycle", lifecycleHandleGenericComment, help)
 }
 
-func help(config *plugins.Configuration, _ []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+func help(config *plugins.Configuration, enabledRepos []config.OrgRepo) (*pluginhelp.PluginHelp, error) {
+	configInfo := map[string]string{}
+	for _, repo := range enabledRepos {
+		if l := config.LifecycleFor(repo.Org, repo.Repo); l != nil {
+			configInfo[repo.String()] = fmt.Sprintf("Inactive issues and PRs are marked %s after %s, marked %s after %s more and closed after another %s of inactivity. Use `/lifecycle frozen` to exempt them.",
+				labels.LifecycleStale, plugins.FormatDays(l.StaleAfterDuration), labels.LifecycleRotten, plugins.FormatDays(l.RottenAfterDuration), plugins.FormatDays(l.CloseAfterDuration))
+		}
+	}
 	pluginHelp := &pluginhelp.PluginHelp{
 		Description: "Close, reopen, flag and/or unflag an issue or PR as frozen/stale/rotten",
+		Config:      configInfo,
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
 		Usage:       "/close",
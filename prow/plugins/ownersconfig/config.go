@@ -16,6 +16,8 @@ limitations under the License.
 
 package ownersconfig
 
+import "fmt"
+
 // Filenames configures which file names should be used for the OWNERS and OWNERS_ALIASES
 // concepts for a repo, if it's not the default set.
 type Filenames struct {
@@ -43,3 +45,42 @@ var FakeFilenames = Filenames{
 	Owners:        DefaultOwnersFile,
 	OwnersAliases: DefaultOwnersAliasesFile,
 }
+
+// CodeOwnersPrecedence configures whether GitHub CODEOWNERS files are used as a
+// source of approvers and reviewers for a repo, and how they are combined with
+// OWNERS files.
+type CodeOwnersPrecedence string
+
+const (
+	// CodeOwnersIgnored ignores CODEOWNERS files. This is the default.
+	CodeOwnersIgnored CodeOwnersPrecedence = ""
+	// CodeOwnersFallback uses the CODEOWNERS file only if the repo has no OWNERS files.
+	CodeOwnersFallback CodeOwnersPrecedence = "fallback"
+	// CodeOwnersMerge adds the owners from the CODEOWNERS file to the ones from OWNERS files.
+	CodeOwnersMerge CodeOwnersPrecedence = "merge"
+	// CodeOwnersOverride uses the CODEOWNERS file and ignores OWNERS files.
+	CodeOwnersOverride CodeOwnersPrecedence = "override"
+)
+
+// CodeOwnersFiles are the paths GitHub looks for a CODEOWNERS file at, in order.
+// Only the first one found is used.
+var CodeOwnersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Validate returns an error if the precedence is unknown.
+func (p CodeOwnersPrecedence) Validate() error {
+	switch p {
+	case CodeOwnersIgnored, CodeOwnersFallback, CodeOwnersMerge, CodeOwnersOverride:
+		return nil
+	}
+	return fmt.Errorf("unknown CODEOWNERS precedence %q, must be one of %q, %q or %q", p, CodeOwnersFallback, CodeOwnersMerge, CodeOwnersOverride)
+}
+
+// CodeOwnersResolver returns whether and how the CODEOWNERS file of a repo is
+// used for its owners.
+type CodeOwnersResolver func(org, repo string) CodeOwnersPrecedence
+
+// FakeCodeOwnersResolver fills in for tests that use a CODEOWNERS resolver but
+// aren't testing it. It ignores CODEOWNERS files for every repo.
+func FakeCodeOwnersResolver(_, _ string) CodeOwnersPrecedence {
+	return CodeOwnersIgnored
+}
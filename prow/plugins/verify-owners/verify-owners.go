@@ -59,6 +59,13 @@ var (
 	verifyOwnersRe = regexp.MustCompile(`(?mi)^/verify-owners\s*$`)
 )
 
+const (
+	// ownersNewOwnerFormat matches an owner added to an OWNERS or OWNERS_ALIASES file by a patch.
+	ownersNewOwnerFormat = `\+\s*-\s*\b%s\b`
+	// codeOwnersNewOwnerFormat matches an owner added to a CODEOWNERS file by a patch.
+	codeOwnersNewOwnerFormat = `(?mi)^\+.*\s@%s(\s|$)`
+)
+
 func init() {
 	plugins.RegisterPullRequestHandler(PluginName, handlePullRequest, helpProvider)
 	plugins.RegisterGenericCommentHandler(PluginName, handleGenericCommentEvent, helpProvider)
@@ -70,8 +77,11 @@ func helpProvider(c *plugins.Configuration, orgRepo []config.OrgRepo) (*pluginhe
 		Config:      map[string]string{},
 	}
 	defaultFilenames := c.OwnersFilenames("", "")
-	descriptionFor := func(filenames ownersconfig.Filenames) string {
+	descriptionFor := func(filenames ownersconfig.Filenames, codeOwners ownersconfig.CodeOwnersPrecedence) string {
 		description := fmt.Sprintf("%s and %s files are validated.", filenames.Owners, filenames.OwnersAliases)
+		if codeOwners != ownersconfig.CodeOwnersIgnored {
+			description = fmt.Sprintf("%s CODEOWNERS files are validated as well.", description)
+		}
 		if c.Owners.LabelsBlackList != nil {
 			description = fmt.Sprintf(`%s The verify-owners plugin will complain if %s files contain any of the following blacklisted labels: %s.`,
 				description,
@@ -80,11 +90,12 @@ func helpProvider(c *plugins.Configuration, orgRepo []config.OrgRepo) (*pluginhe
 		}
 		return description
 	}
-	pluginHelp.Config["default"] = descriptionFor(defaultFilenames)
+	pluginHelp.Config["default"] = descriptionFor(defaultFilenames, ownersconfig.CodeOwnersIgnored)
 	for _, item := range orgRepo {
 		filenames := c.OwnersFilenames(item.Org, item.Repo)
-		if !reflect.DeepEqual(filenames, defaultFilenames) {
-			pluginHelp.Config[item.String()] = descriptionFor(filenames)
+		codeOwners := c.CodeOwnersPrecedence(item.Org, item.Repo)
+		if !reflect.DeepEqual(filenames, defaultFilenames) || codeOwners != ownersconfig.CodeOwnersIgnored {
+			pluginHelp.Config[item.String()] = descriptionFor(filenames, codeOwners)
 		}
 	}
 	pluginHelp.AddCommand(pluginhelp.Command{
@@ -154,7 +165,7 @@ func handlePullRequest(pc plugins.Agent, pre github.PullRequestEvent) error {
 		number:       pre.Number,
 	}
 
-	return handle(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &pre.PullRequest, prInfo, pc.PluginConfig.Owners.LabelsBlackList, pc.PluginConfig.TriggerFor(pre.Repo.Owner.Login, pre.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames)
+	return handle(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &pre.PullRequest, prInfo, pc.PluginConfig.Owners.LabelsBlackList, pc.PluginConfig.TriggerFor(pre.Repo.Owner.Login, pre.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames, pc.PluginConfig.CodeOwnersPrecedence)
 }
 
 func handleGenericCommentEvent(pc plugins.Agent, e github.GenericCommentEvent) error {
@@ -171,10 +182,10 @@ func handleGenericCommentEvent(pc plugins.Agent, e github.GenericCommentEvent) e
 		}
 	}
 
-	return handleGenericComment(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &e, pc.PluginConfig.Owners.LabelsBlackList, pc.PluginConfig.TriggerFor(e.Repo.Owner.Login, e.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames)
+	return handleGenericComment(pc.GitHubClient, pc.GitClient, pc.OwnersClient, pc.Logger, &e, pc.PluginConfig.Owners.LabelsBlackList, pc.PluginConfig.TriggerFor(e.Repo.Owner.Login, e.Repo.Name), skipTrustedUserCheck, cp, pc.PluginConfig.OwnersFilenames, pc.PluginConfig.CodeOwnersPrecedence)
 }
 
-func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, ce *github.GenericCommentEvent, labelsBlackList []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver) error {
+func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, ce *github.GenericCommentEvent, labelsBlackList []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver, codeOwners ownersconfig.CodeOwnersResolver) error {
 	// Only consider open PRs and new comments.
 	if ce.IssueState != "open" || !ce.IsPR || ce.Action != github.GenericCommentActionCreated {
 		return nil
@@ -196,7 +207,7 @@ func handleGenericComment(ghc githubClient, gc git.ClientFactory, roc repoowners
 		return err
 	}
 
-	return handle(ghc, gc, roc, log, pr, prInfo, labelsBlackList, triggerConfig, skipTrustedUserCheck, cp, resolver)
+	return handle(ghc, gc, roc, log, pr, prInfo, labelsBlackList, triggerConfig, skipTrustedUserCheck, cp, resolver, codeOwners)
 }
 
 type messageWithLine struct {
@@ -204,7 +215,7 @@ type messageWithLine struct {
 	message string
 }
 
-func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, pr *github.PullRequest, info info, labelsBlackList []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver) error {
+func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *logrus.Entry, pr *github.PullRequest, info info, labelsBlackList []string, triggerConfig plugins.Trigger, skipTrustedUserCheck bool, cp commentPruner, resolver ownersconfig.Resolver, codeOwners ownersconfig.CodeOwnersResolver) error {
 	org := info.org
 	repo := info.repo
 	number := info.number
@@ -217,11 +228,20 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 		return fmt.Errorf("error getting PR changes: %v", err)
 	}
 
-	// List modified OWNERS files.
-	var modifiedOwnersFiles []github.PullRequestChange
+	// List modified OWNERS files, and CODEOWNERS files if the repo uses them.
+	var modifiedOwnersFiles, modifiedCodeOwnersFiles []github.PullRequestChange
+	codeOwnersFiles := sets.NewString()
+	if codeOwners(org, repo) != ownersconfig.CodeOwnersIgnored {
+		codeOwnersFiles.Insert(ownersconfig.CodeOwnersFiles...)
+	}
 	for _, change := range changes {
-		if filepath.Base(change.Filename) == filenames.Owners && change.Status != github.PullRequestFileRemoved {
+		if change.Status == github.PullRequestFileRemoved {
+			continue
+		}
+		if filepath.Base(change.Filename) == filenames.Owners {
 			modifiedOwnersFiles = append(modifiedOwnersFiles, change)
+		} else if codeOwnersFiles.Has(change.Filename) {
+			modifiedCodeOwnersFiles = append(modifiedCodeOwnersFiles, change)
 		}
 	}
 
@@ -242,7 +262,7 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 	}
 	hasInvalidOwnersLabel := github.HasLabel(labels.InvalidOwners, issueLabels)
 
-	if len(modifiedOwnersFiles) == 0 && !ownerAliasesModified && !hasInvalidOwnersLabel {
+	if len(modifiedOwnersFiles) == 0 && len(modifiedCodeOwnersFiles) == 0 && !ownerAliasesModified && !hasInvalidOwnersLabel {
 		return nil
 	}
 
@@ -291,7 +311,23 @@ func handle(ghc githubClient, gc git.ClientFactory, roc repoownersClient, log *l
 		}
 
 		if !skipTrustedUserCheck {
-			nonTrustedUsers, err = nonTrustedUsersInOwners(ghc, log, triggerConfig, org, repo, c.Patch, c.Filename, owners, nonTrustedUsers, trustedUsers, repoAliases)
+			nonTrustedUsers, err = nonTrustedUsersInOwners(ghc, log, triggerConfig, org, repo, c.Patch, ownersNewOwnerFormat, c.Filename, owners, nonTrustedUsers, trustedUsers, repoAliases)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range modifiedCodeOwnersFiles {
+		path := filepath.Join(r.Directory(), c.Filename)
+		msg, owners := parseCodeOwnersFile(path, c, log)
+		if msg != nil {
+			wrongOwnersFiles[c.Filename] = *msg
+			continue
+		}
+
+		if !skipTrustedUserCheck {
+			nonTrustedUsers, err = nonTrustedUsersInOwners(ghc, log, triggerConfig, org, repo, c.Patch, codeOwnersNewOwnerFormat, c.Filename, owners, nonTrustedUsers, trustedUsers, nil)
 			if err != nil {
 				return err
 			}
@@ -380,22 +416,8 @@ func parseOwnersFile(oc ownersClient, path string, c github.PullRequestChange, l
 			return nil, nil
 		}
 		if err != nil {
-			lineNumberRe, _ := regexp.Compile(`line (\d+)`)
-			lineNumberMatches := lineNumberRe.FindStringSubmatch(err.Error())
-			// try to find a line number for the error
-			if len(lineNumberMatches) > 1 {
-				// we're sure it will convert as it passed the regexp already
-				absoluteLineNumber, _ := strconv.Atoi(lineNumberMatches[1])
-				// we need to convert it to a line number relative to the patch
-				al, err := golint.AddedLines(c.Patch)
-				if err != nil {
-					log.WithError(err).Errorf("Failed to compute added lines in %s: %v", c.Filename, err)
-				} else if val, ok := al[absoluteLineNumber]; ok {
-					lineNumber = val
-				}
-			}
 			return &messageWithLine{
-				lineNumber,
+				patchLine(err, c, log),
 				fmt.Sprintf("Cannot parse file: %v.", err),
 			}, nil
 		}
@@ -429,6 +451,52 @@ func parseOwnersFile(oc ownersClient, path string, c github.PullRequestChange, l
 	return nil, owners
 }
 
+// parseCodeOwnersFile parses the CODEOWNERS file at the path and returns the
+// users it mentions. Teams are not returned.
+func parseCodeOwnersFile(path string, c github.PullRequestChange, log *logrus.Entry) (*messageWithLine, []string) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		var rules []repoowners.CodeOwnersRule
+		if rules, err = repoowners.ParseCodeOwners(b); err == nil {
+			var owners []string
+			for _, rule := range rules {
+				for _, owner := range rule.Owners {
+					if !strings.Contains(owner, "/") {
+						owners = append(owners, owner)
+					}
+				}
+			}
+			return nil, owners
+		}
+	}
+	return &messageWithLine{
+		patchLine(err, c, log),
+		fmt.Sprintf("Cannot parse file: %v.", err),
+	}, nil
+}
+
+// patchLine returns the line of the patch an error about the changed file
+// refers to, or 1 if the error doesn't mention a line the patch added.
+func patchLine(err error, c github.PullRequestChange, log *logrus.Entry) int {
+	// by default we bind errors to line 1
+	lineNumber := 1
+	lineNumberRe, _ := regexp.Compile(`line (\d+)`)
+	lineNumberMatches := lineNumberRe.FindStringSubmatch(err.Error())
+	// try to find a line number for the error
+	if len(lineNumberMatches) > 1 {
+		// we're sure it will convert as it passed the regexp already
+		absoluteLineNumber, _ := strconv.Atoi(lineNumberMatches[1])
+		// we need to convert it to a line number relative to the patch
+		al, err := golint.AddedLines(c.Patch)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to compute added lines in %s: %v", c.Filename, err)
+		} else if val, ok := al[absoluteLineNumber]; ok {
+			lineNumber = val
+		}
+	}
+	return lineNumber
+}
+
 func markdownFriendlyComment(org, joinOrgURL string, nonTrustedUsers map[string]nonTrustedReasons, filenames ownersconfig.Filenames) string {
 	var commentLines []string
 	commentLines = append(commentLines, fmt.Sprintf(untrustedResponseFormat, filenames.Owners, joinOrgURL, org))
@@ -467,7 +535,7 @@ func nonTrustedUsersInOwnersAliases(ghc githubClient, log *logrus.Entry, trigger
 	if ownerAliasesModified && !skipTrustedUserCheck {
 		allOwners := repoAliases.ExpandAllAliases().List()
 		for _, owner := range allOwners {
-			nonTrustedUsers, err = checkIfTrustedUser(ghc, log, triggerConfig, owner, patch, filenames.OwnersAliases, org, repo, nonTrustedUsers, trustedUsers, repoAliases)
+			nonTrustedUsers, err = checkIfTrustedUser(ghc, log, triggerConfig, owner, patch, ownersNewOwnerFormat, filenames.OwnersAliases, org, repo, nonTrustedUsers, trustedUsers, repoAliases)
 			if err != nil {
 				return nonTrustedUsers, trustedUsers, repoAliases, err
 			}
@@ -477,7 +545,7 @@ func nonTrustedUsersInOwnersAliases(ghc githubClient, log *logrus.Entry, trigger
 	return nonTrustedUsers, trustedUsers, repoAliases, nil
 }
 
-func nonTrustedUsersInOwners(ghc githubClient, log *logrus.Entry, triggerConfig plugins.Trigger, org, repo, patch, fileName string, owners []string, nonTrustedUsers map[string]nonTrustedReasons, trustedUsers sets.String, repoAliases repoowners.RepoAliases) (map[string]nonTrustedReasons, error) {
+func nonTrustedUsersInOwners(ghc githubClient, log *logrus.Entry, triggerConfig plugins.Trigger, org, repo, patch, newOwnerFormat, fileName string, owners []string, nonTrustedUsers map[string]nonTrustedReasons, trustedUsers sets.String, repoAliases repoowners.RepoAliases) (map[string]nonTrustedReasons, error) {
 	var err error
 	for _, owner := range owners {
 		// ignore if owner is an alias
@@ -485,7 +553,7 @@ func nonTrustedUsersInOwners(ghc githubClient, log *logrus.Entry, triggerConfig
 			continue
 		}
 
-		nonTrustedUsers, err = checkIfTrustedUser(ghc, log, triggerConfig, owner, patch, fileName, org, repo, nonTrustedUsers, trustedUsers, repoAliases)
+		nonTrustedUsers, err = checkIfTrustedUser(ghc, log, triggerConfig, owner, patch, newOwnerFormat, fileName, org, repo, nonTrustedUsers, trustedUsers, repoAliases)
 		if err != nil {
 			return nonTrustedUsers, err
 		}
@@ -496,13 +564,13 @@ func nonTrustedUsersInOwners(ghc githubClient, log *logrus.Entry, triggerConfig
 // checkIfTrustedUser looks for newly addded owners by checking if they are in the patch
 // and then checks if the owner is a trusted user.
 // returns a map from user to reasons for not being trusted
-func checkIfTrustedUser(ghc githubClient, log *logrus.Entry, triggerConfig plugins.Trigger, owner, patch, fileName, org, repo string, nonTrustedUsers map[string]nonTrustedReasons, trustedUsers sets.String, repoAliases repoowners.RepoAliases) (map[string]nonTrustedReasons, error) {
+func checkIfTrustedUser(ghc githubClient, log *logrus.Entry, triggerConfig plugins.Trigger, owner, patch, newOwnerFormat, fileName, org, repo string, nonTrustedUsers map[string]nonTrustedReasons, trustedUsers sets.String, repoAliases repoowners.RepoAliases) (map[string]nonTrustedReasons, error) {
 	// cap the number of checks to avoid exhausting tokens in case of large OWNERS refactors.
 	if len(nonTrustedUsers)+trustedUsers.Len() > 50 {
 		return nonTrustedUsers, nil
 	}
 	// only consider owners in the current patch
-	newOwnerRe, _ := regexp.Compile(fmt.Sprintf(`\+\s*-\s*\b%s\b`, owner))
+	newOwnerRe, _ := regexp.Compile(fmt.Sprintf(newOwnerFormat, owner))
 	if !newOwnerRe.MatchString(patch) {
 		return nonTrustedUsers, nil
 	}
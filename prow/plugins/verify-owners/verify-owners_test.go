@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -130,6 +131,12 @@ labels:
 `),
 	"referencesToBeAddedAlias": []byte(`approvers:
 - not-yet-existing-alias
+`),
+	"validCodeOwners": []byte(`*       @jdoe
+/docs/  @alice @org/docs-team
+`),
+	"invalidCodeOwners": []byte(`*       @jdoe
+/docs/  alice
 `),
 }
 
@@ -331,6 +338,7 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 		ownersFile          string
 		filesChangedAfterPR []string
 		addedContent        string
+		codeOwners          ownersconfig.CodeOwnersPrecedence
 		shouldLabel         bool
 	}{
 		{
@@ -437,6 +445,26 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 			addedContent:        "toBeAddedAlias",
 			shouldLabel:         false,
 		},
+		{
+			name:         "good CODEOWNERS file",
+			filesChanged: []string{".github/CODEOWNERS", "b.go"},
+			ownersFile:   "validCodeOwners",
+			codeOwners:   ownersconfig.CodeOwnersMerge,
+			shouldLabel:  false,
+		},
+		{
+			name:         "invalid CODEOWNERS file",
+			filesChanged: []string{".github/CODEOWNERS", "b.go"},
+			ownersFile:   "invalidCodeOwners",
+			codeOwners:   ownersconfig.CodeOwnersMerge,
+			shouldLabel:  true,
+		},
+		{
+			name:         "invalid CODEOWNERS file in a repo not using CODEOWNERS",
+			filesChanged: []string{".github/CODEOWNERS", "b.go"},
+			ownersFile:   "invalidCodeOwners",
+			shouldLabel:  false,
+		},
 	}
 	lg, c, err := clients()
 	if err != nil {
@@ -520,7 +548,10 @@ func testHandle(clients localgit.Clients, t *testing.T) {
 				number:       pr,
 			}
 
-			if err := handle(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			codeOwners := func(org, repo string) ownersconfig.CodeOwnersPrecedence {
+				return test.codeOwners
+			}
+			if err := handle(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver, codeOwners); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -665,6 +696,67 @@ func testParseOwnersFile(clients localgit.Clients, t *testing.T) {
 	}
 }
 
+func TestParseCodeOwnersFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify-owners")
+	if err != nil {
+		t.Fatalf("Creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name           string
+		ownersFile     string
+		expectedOwners []string
+		expectedLine   int
+	}{
+		{
+			name:           "valid",
+			ownersFile:     "validCodeOwners",
+			expectedOwners: []string{"jdoe", "alice"},
+		},
+		{
+			name:         "invalid owner",
+			ownersFile:   "invalidCodeOwners",
+			expectedLine: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.ownersFile)
+			if err := ioutil.WriteFile(path, ownerFiles[tc.ownersFile], 0644); err != nil {
+				t.Fatalf("Writing CODEOWNERS file: %v", err)
+			}
+			change := github.PullRequestChange{Filename: "CODEOWNERS", Patch: makePatch(ownerFiles[tc.ownersFile])}
+			msg, owners := parseCodeOwnersFile(path, change, logrus.WithField("plugin", PluginName))
+			if tc.expectedLine == 0 {
+				if msg != nil {
+					t.Fatalf("Unexpected error: %s", msg.message)
+				}
+				if diff := cmp.Diff(tc.expectedOwners, owners); diff != "" {
+					t.Errorf("Unexpected owners (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if msg.line != tc.expectedLine {
+				t.Errorf("Expected error on line %d, got %d: %s", tc.expectedLine, msg.line, msg.message)
+			}
+		})
+	}
+}
+
+func TestNewCodeOwner(t *testing.T) {
+	patch := "@@ -1,1 +1,2 @@\n *       @jdoe\n+/docs/  @Alice @bob-bot\n"
+	for owner, expected := range map[string]bool{"alice": true, "bob-bot": true, "bob": false, "jdoe": false} {
+		re := regexp.MustCompile(fmt.Sprintf(codeOwnersNewOwnerFormat, owner))
+		if got := re.MatchString(patch); got != expected {
+			t.Errorf("Expected %s to be added: %t, got %t", owner, expected, got)
+		}
+	}
+}
+
 func makePatch(b []byte) string {
 	p := bytes.Replace(b, []byte{'\n'}, []byte{'\n', '+'}, -1)
 	nbLines := bytes.Count(p, []byte{'+'}) + 1
@@ -1109,7 +1201,7 @@ func testNonCollaborators(clients localgit.Clients, t *testing.T) {
 				number:       pr,
 			}
 
-			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, test.skipTrustedUserCheck, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, test.skipTrustedUserCheck, &fakePruner{}, ownersconfig.FakeResolver, ownersconfig.FakeCodeOwnersResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -1284,7 +1376,7 @@ func testHandleGenericComment(clients localgit.Clients, t *testing.T) {
 				},
 			}
 
-			if err := handleGenericComment(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &test.commentEvent, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handleGenericComment(fghc, c, makeFakeRepoOwnersClient(), logrus.WithField("plugin", PluginName), &test.commentEvent, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver, ownersconfig.FakeCodeOwnersResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if !test.shouldLabel && IssueLabelsContain(fghc.IssueLabelsAdded, labels.InvalidOwners) {
@@ -1417,7 +1509,7 @@ func testOwnersRemoval(clients localgit.Clients, t *testing.T) {
 
 			froc := makeFakeRepoOwnersClient()
 
-			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver); err != nil {
+			if err := handle(fghc, c, froc, logrus.WithField("plugin", PluginName), &pre.PullRequest, prInfo, []string{labels.Approved, labels.LGTM}, plugins.Trigger{}, false, &fakePruner{}, ownersconfig.FakeResolver, ownersconfig.FakeCodeOwnersResolver); err != nil {
 				t.Fatalf("Handle PR: %v", err)
 			}
 			if test.shouldRemoveLabel && !IssueLabelsContain(fghc.IssueLabelsRemoved, labels.InvalidOwners) {
@@ -0,0 +1,323 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repoowners
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins/ownersconfig"
+)
+
+// CodeOwnersRule is a single rule of a GitHub CODEOWNERS file.
+type CodeOwnersRule struct {
+	// Pattern is the gitignore style pattern of the files the rule applies to.
+	Pattern string
+	// Owners are the normalized logins and "org/team" slugs owning the files.
+	Owners []string
+	// Line is the line of the rule in the CODEOWNERS file.
+	Line int
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file. Owners given by
+// email address are skipped as they cannot be mapped to GitHub logins.
+// Errors mention the offending line as "line N".
+func ParseCodeOwners(b []byte) ([]CodeOwnersRule, error) {
+	var rules []CodeOwnersRule
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		rule := CodeOwnersRule{Pattern: fields[0], Line: line}
+		if strings.HasPrefix(rule.Pattern, "!") || strings.ContainsAny(rule.Pattern, "[]") || strings.HasPrefix(rule.Pattern, `\`) {
+			return nil, fmt.Errorf("line %d: pattern %q uses syntax that is not supported in CODEOWNERS files", line, rule.Pattern)
+		}
+		for _, owner := range fields[1:] {
+			switch {
+			case strings.HasPrefix(owner, "@") && len(owner) > 1:
+				rule.Owners = append(rule.Owners, github.NormLogin(owner))
+			case strings.Contains(owner, "@"):
+				// An email address.
+			default:
+				return nil, fmt.Errorf("line %d: owner %q must be a @username, an @org/team-name or an email address", line, owner)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// isCodeOwnersTeam returns true if the owner is a team rather than a user.
+func isCodeOwnersTeam(owner string) bool {
+	return strings.Contains(owner, "/")
+}
+
+// codeOwnersMatcher converts a CODEOWNERS pattern into the directory it is
+// anchored at and a regexp matching the paths relative to that directory,
+// like the filters of an OWNERS file. A nil regexp matches everything under
+// the directory. isDir reports if a path of the repo is a directory.
+func codeOwnersMatcher(pattern string, isDir func(string) bool) (string, *regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	trimmed := strings.Trim(pattern, "/")
+	if trimmed == "" || trimmed == "*" || trimmed == "**" {
+		return baseDirConvention, nil, nil
+	}
+	// Patterns without a slash other than a trailing one match at any depth.
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	segments := strings.Split(trimmed, "/")
+
+	var dir []string
+	if anchored {
+		for len(segments) > 0 && !strings.ContainsAny(segments[0], "*?") {
+			dir, segments = append(dir, segments[0]), segments[1:]
+		}
+	}
+	if len(segments) == 0 {
+		if dirOnly || isDir(strings.Join(dir, "/")) {
+			return strings.Join(dir, "/"), nil, nil
+		}
+		// A single file, owned from its directory.
+		segments, dir = dir[len(dir)-1:], dir[:len(dir)-1]
+	}
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("(^|/)")
+	}
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("(.*/)?")
+			}
+			continue
+		}
+		for _, r := range segment {
+			switch r {
+			case '*':
+				expr.WriteString("[^/]*")
+			case '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		if !last {
+			expr.WriteString("/")
+		}
+	}
+	if dirOnly {
+		expr.WriteString("/")
+	} else {
+		// A pattern matching a directory matches everything in it.
+		expr.WriteString("(/|$)")
+	}
+	re, err := regexp.Compile(expr.String())
+	return canonicalize(strings.Join(dir, "/")), re, err
+}
+
+// findCodeOwnersFile returns the path of the CODEOWNERS file GitHub uses for
+// the repo, or an empty string if there is none.
+func findCodeOwnersFile(baseDir string) string {
+	for _, name := range ownersconfig.CodeOwnersFiles {
+		path := filepath.Join(baseDir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// codeOwnersMatch is where a rule of a CODEOWNERS file is anchored and the
+// regexp matching the paths relative to that directory.
+type codeOwnersMatch struct {
+	dir string
+	re  *regexp.Regexp
+}
+
+// matches returns true if the rule applies to the path, which is relative to
+// the root of the repo.
+func (m codeOwnersMatch) matches(path string) bool {
+	if m.dir != baseDirConvention && path != m.dir && !strings.HasPrefix(path, m.dir+"/") {
+		return false
+	}
+	relative, err := filepath.Rel(m.dir, path)
+	if err != nil {
+		return false
+	}
+	return m.re.MatchString(relative)
+}
+
+// applyCodeOwners adds the owners from the CODEOWNERS file of the repo as
+// approvers and reviewers. Rules are anchored at the directory of their
+// pattern like OWNERS files, but as on GitHub only the last rule matching a
+// file applies to it: the rules a later rule overrides are skipped when
+// looking up the owners of a path it matches.
+func (o *RepoOwners) applyCodeOwners(log *logrus.Entry) {
+	path := findCodeOwnersFile(o.baseDir)
+	if path == "" {
+		log.Info("No CODEOWNERS file found.")
+		return
+	}
+	log = log.WithField("path", path)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read CODEOWNERS file.")
+		return
+	}
+	rules, err := ParseCodeOwners(b)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse CODEOWNERS file.")
+		return
+	}
+
+	isDir := func(relPath string) bool {
+		info, err := os.Stat(filepath.Join(o.baseDir, relPath))
+		return err == nil && info.IsDir()
+	}
+	for _, rule := range rules {
+		dir, re, err := codeOwnersMatcher(rule.Pattern, isDir)
+		if err != nil {
+			log.WithError(err).Debugf("Invalid CODEOWNERS pattern %q on line %d.", rule.Pattern, rule.Line)
+			continue
+		}
+		if re == nil {
+			// Every rule needs a regexp of its own to be told apart from the
+			// others, so the rules for whole directories match everything.
+			re = regexp.MustCompile("")
+			// Unless merged with OWNERS files, the rules for a directory
+			// replace the ones for its parents, like they do on GitHub.
+			if o.codeOwners != ownersconfig.CodeOwnersMerge && dir != baseDirConvention {
+				o.codeOwnersDirs.Insert(dir)
+			}
+		}
+		// Rules without owners still override earlier rules, leaving the
+		// files they match without owners from the CODEOWNERS file.
+		o.codeOwnersRules[re] = len(o.codeOwnersMatches)
+		o.codeOwnersMatches = append(o.codeOwnersMatches, codeOwnersMatch{dir: dir, re: re})
+		if len(rule.Owners) == 0 {
+			continue
+		}
+
+		logins := NormLogins(rule.Owners)
+		for _, ownerMap := range []map[string]map[*regexp.Regexp]sets.String{o.approvers, o.reviewers} {
+			if ownerMap[dir] == nil {
+				ownerMap[dir] = make(map[*regexp.Regexp]sets.String)
+			}
+			ownerMap[dir][re] = logins
+		}
+		for _, login := range rule.Owners {
+			if isCodeOwnersTeam(login) {
+				o.hasTeams = true
+			}
+		}
+	}
+	log.Infof("Loaded %d rules from CODEOWNERS file.", len(rules))
+}
+
+// overridden returns true if re belongs to a rule of the CODEOWNERS file and
+// a later rule of the file matches the path.
+func (o *RepoOwners) overridden(re *regexp.Regexp, path string) bool {
+	i, ok := o.codeOwnersRules[re]
+	if !ok {
+		return false
+	}
+	for _, later := range o.codeOwnersMatches[i+1:] {
+		if later.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTeams replaces the teams from the CODEOWNERS file with their members.
+// Teams that cannot be resolved are dropped.
+func (o *RepoOwners) expandTeams(ghc githubClient, org string) *RepoOwners {
+	members := map[string]sets.String{}
+	membersOf := func(team string) sets.String {
+		if m, ok := members[team]; ok {
+			return m
+		}
+		members[team] = sets.NewString()
+		parts := strings.SplitN(team, "/", 2)
+		if parts[0] != strings.ToLower(org) {
+			o.log.Warnf("Ignoring team %q of another org in CODEOWNERS file.", team)
+			return members[team]
+		}
+		t, err := ghc.GetTeamBySlug(parts[1], org)
+		if err != nil {
+			o.log.WithError(err).Warnf("Failed to get team %q from CODEOWNERS file.", team)
+			return members[team]
+		}
+		teamMembers, err := ghc.ListTeamMembers(org, t.ID, github.RoleAll)
+		if err != nil {
+			o.log.WithError(err).Warnf("Failed to list members of team %q from CODEOWNERS file.", team)
+			return members[team]
+		}
+		for _, member := range teamMembers {
+			members[team].Insert(github.NormLogin(member.Login))
+		}
+		return members[team]
+	}
+
+	expand := func(ownerMap map[string]map[*regexp.Regexp]sets.String) map[string]map[*regexp.Regexp]sets.String {
+		expanded := make(map[string]map[*regexp.Regexp]sets.String)
+		for path, reMap := range ownerMap {
+			expanded[path] = make(map[*regexp.Regexp]sets.String)
+			for re, owners := range reMap {
+				logins := sets.NewString()
+				for _, owner := range owners.UnsortedList() {
+					if isCodeOwnersTeam(owner) {
+						logins.Insert(membersOf(owner).UnsortedList()...)
+					} else {
+						logins.Insert(owner)
+					}
+				}
+				expanded[path][re] = logins
+			}
+		}
+		return expanded
+	}
+
+	result := *o
+	result.approvers = expand(o.approvers)
+	result.reviewers = expand(o.reviewers)
+	return &result
+}
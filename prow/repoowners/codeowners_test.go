@@ -0,0 +1,366 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repoowners
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/plugins/ownersconfig"
+)
+
+func TestParseCodeOwners(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expected    []CodeOwnersRule
+		expectedErr string
+	}{
+		{
+			name: "users, teams and emails",
+			content: `# Default owners.
+*       @Alice @org/Team-A
+
+/docs/  dev@example.com @bob # docs team
+*.go
+`,
+			expected: []CodeOwnersRule{
+				{Pattern: "*", Owners: []string{"alice", "org/team-a"}, Line: 2},
+				{Pattern: "/docs/", Owners: []string{"bob"}, Line: 4},
+				{Pattern: "*.go", Line: 5},
+			},
+		},
+		{
+			name:        "owner without @",
+			content:     "*  @alice\n/docs/ bob\n",
+			expectedErr: `line 2: owner "bob" must be a @username, an @org/team-name or an email address`,
+		},
+		{
+			name:        "negated pattern",
+			content:     "!vendor/ @alice\n",
+			expectedErr: `line 1: pattern "!vendor/" uses syntax that is not supported in CODEOWNERS files`,
+		},
+		{
+			name:        "character range",
+			content:     "*.[ch] @alice\n",
+			expectedErr: `line 1: pattern "*.[ch]" uses syntax that is not supported in CODEOWNERS files`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseCodeOwners([]byte(tc.content))
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.expectedErr {
+				t.Fatalf("expected error %q, got %q", tc.expectedErr, errMsg)
+			}
+			if !reflect.DeepEqual(rules, tc.expected) {
+				t.Errorf("expected rules %+v, got %+v", tc.expected, rules)
+			}
+		})
+	}
+}
+
+func TestCodeOwnersMatcher(t *testing.T) {
+	isDir := func(path string) bool {
+		return path == "docs" || path == "src/dir"
+	}
+	testCases := []struct {
+		pattern     string
+		expectedDir string
+		match       []string
+		noMatch     []string
+	}{
+		{pattern: "*", expectedDir: ""},
+		{pattern: "/docs/", expectedDir: "docs"},
+		{pattern: "/src/dir", expectedDir: "src/dir"},
+		{
+			pattern:     "/src/Makefile",
+			expectedDir: "src",
+			match:       []string{"Makefile"},
+			noMatch:     []string{"Makefile.old", "sub/Makefile"},
+		},
+		{
+			pattern:     "*.go",
+			expectedDir: "",
+			match:       []string{"main.go", "pkg/util/util.go"},
+			noMatch:     []string{"main.go.txt", "README.md"},
+		},
+		{
+			pattern:     "build/",
+			expectedDir: "",
+			match:       []string{"build/Makefile", "hack/build/run.sh"},
+			noMatch:     []string{"build", "rebuild/Makefile"},
+		},
+		{
+			pattern:     "/src/*/BUILD",
+			expectedDir: "src",
+			match:       []string{"dir/BUILD"},
+			noMatch:     []string{"BUILD", "dir/subdir/BUILD"},
+		},
+		{
+			pattern:     "/src/**/test?.go",
+			expectedDir: "src",
+			match:       []string{"test1.go", "dir/subdir/testa.go"},
+			noMatch:     []string{"test10.go"},
+		},
+		{
+			pattern:     "docs/**",
+			expectedDir: "docs",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			dir, re, err := codeOwnersMatcher(tc.pattern, isDir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dir != tc.expectedDir {
+				t.Errorf("expected directory %q, got %q", tc.expectedDir, dir)
+			}
+			if re == nil {
+				if len(tc.match) > 0 || len(tc.noMatch) > 0 {
+					t.Fatalf("expected a regexp, got everything under %q", dir)
+				}
+				return
+			}
+			for _, path := range tc.match {
+				if !re.MatchString(path) {
+					t.Errorf("expected %q to match %q", re, path)
+				}
+			}
+			for _, path := range tc.noMatch {
+				if re.MatchString(path) {
+					t.Errorf("expected %q not to match %q", re, path)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRepoOwnersCodeOwners(t *testing.T) {
+	files := map[string][]byte{
+		".github/CODEOWNERS": []byte(`*              @cjwagner
+*.md           @alice
+/src/dir/      @mml
+/src/dir/*.go  @org/go-team
+/docs/         @bob
+/docs/         @carl
+`),
+	}
+	for path, content := range testFiles {
+		files[path] = content
+	}
+	withoutOwners := map[string][]byte{
+		".github/CODEOWNERS": files[".github/CODEOWNERS"],
+		"src/dir/main.go":    []byte("package main"),
+	}
+
+	testCases := []struct {
+		name       string
+		files      map[string][]byte
+		precedence ownersconfig.CodeOwnersPrecedence
+		approvers  map[string]sets.String
+		leaf       map[string]sets.String
+	}{
+		{
+			name:       "ignored",
+			files:      files,
+			precedence: ownersconfig.CodeOwnersIgnored,
+			leaf: map[string]sets.String{
+				"src/dir/main.go": sets.NewString("bob"),
+				"docs/file.md":    sets.NewString("cjwagner"),
+			},
+		},
+		{
+			name:       "fallback with OWNERS files",
+			files:      files,
+			precedence: ownersconfig.CodeOwnersFallback,
+			leaf: map[string]sets.String{
+				"src/dir/main.go": sets.NewString("bob"),
+			},
+		},
+		{
+			name:       "fallback without OWNERS files",
+			files:      withoutOwners,
+			precedence: ownersconfig.CodeOwnersFallback,
+			approvers: map[string]sets.String{
+				"src/dir/main.go":   sets.NewString("maggie"),
+				"src/dir/README.md": sets.NewString("mml"),
+				"src/file.go":       sets.NewString("cjwagner"),
+			},
+		},
+		{
+			name:       "merge",
+			files:      files,
+			precedence: ownersconfig.CodeOwnersMerge,
+			leaf: map[string]sets.String{
+				"src/dir/main.go": sets.NewString("bob", "maggie"),
+			},
+			approvers: map[string]sets.String{
+				"docs/file.md": sets.NewString("cjwagner", "carl"),
+			},
+		},
+		{
+			name:       "override",
+			files:      files,
+			precedence: ownersconfig.CodeOwnersOverride,
+			approvers: map[string]sets.String{
+				"src/dir/main.go":   sets.NewString("maggie"),
+				"src/dir/README.md": sets.NewString("mml"),
+				"src/file.go":       sets.NewString("cjwagner"),
+				"docs/file.md":      sets.NewString("carl"),
+				"README.md":         sets.NewString("alice"),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, cleanup, err := getTestClient(tc.files, false, false, false, false, nil, nil, nil, nil, localgit.NewV2)
+			if err != nil {
+				t.Fatalf("Error creating test client: %v.", err)
+			}
+			defer cleanup()
+			client.ghc.(*fakeGitHubClient).teams = map[string][]string{
+				"go-team": {"maggie", "not-a-collaborator"},
+			}
+			// The cached owners must be reloaded once the precedence changes.
+			if _, err := client.LoadRepoOwners("org", "repo", "master"); err != nil {
+				t.Fatalf("Unexpected error loading RepoOwners: %v.", err)
+			}
+			client.codeOwners = func(org, repo string) ownersconfig.CodeOwnersPrecedence {
+				return tc.precedence
+			}
+			ro, err := client.LoadRepoOwners("org", "repo", "master")
+			if err != nil {
+				t.Fatalf("Unexpected error loading RepoOwners: %v.", err)
+			}
+
+			for path, expected := range tc.approvers {
+				if got := ro.Approvers(path).Set(); !got.Equal(expected) {
+					t.Errorf("expected approvers %v for %s, got %v", expected.List(), path, got.List())
+				}
+				// CODEOWNERS owners are reviewers as well, but OWNERS files
+				// may have other reviewers.
+				if tc.precedence == ownersconfig.CodeOwnersMerge {
+					continue
+				}
+				if got := ro.Reviewers(path).Set(); !got.Equal(expected) {
+					t.Errorf("expected reviewers %v for %s, got %v", expected.List(), path, got.List())
+				}
+			}
+			for path, expected := range tc.leaf {
+				if got := ro.LeafApprovers(path); !got.Equal(expected) {
+					t.Errorf("expected leaf approvers %v for %s, got %v", expected.List(), path, got.List())
+				}
+			}
+		})
+	}
+}
+
+func TestCodeOwnersLastMatchWins(t *testing.T) {
+	files := map[string][]byte{
+		"CODEOWNERS": []byte(`*                 @cjwagner
+/src/             @alice
+*.md              @bob
+/src/gen/         @carl
+/src/gen/*.pb.go
+/docs/            @mml
+/docs/**/*.png    @maggie
+`),
+		"src/main.go":         []byte("package main"),
+		"src/README.md":       []byte("# src"),
+		"src/gen/types.go":    []byte("package gen"),
+		"src/gen/types.pb.go": []byte("package gen"),
+		"docs/img/logo.png":   []byte("png"),
+	}
+	client, cleanup, err := getTestClient(files, false, false, false, false, nil, nil, nil, nil, localgit.NewV2)
+	if err != nil {
+		t.Fatalf("Error creating test client: %v.", err)
+	}
+	defer cleanup()
+	client.codeOwners = func(org, repo string) ownersconfig.CodeOwnersPrecedence {
+		return ownersconfig.CodeOwnersOverride
+	}
+	ro, err := client.LoadRepoOwners("org", "repo", "master")
+	if err != nil {
+		t.Fatalf("Unexpected error loading RepoOwners: %v.", err)
+	}
+
+	testCases := []struct {
+		path      string
+		approvers sets.String
+		ownersDir string
+	}{
+		{path: "main.go", approvers: sets.NewString("cjwagner"), ownersDir: ""},
+		{path: "src/main.go", approvers: sets.NewString("alice"), ownersDir: "src"},
+		// A later rule for any directory overrides the rule for src/.
+		{path: "src/README.md", approvers: sets.NewString("bob"), ownersDir: ""},
+		{path: "src/gen/README.md", approvers: sets.NewString("carl"), ownersDir: "src/gen"},
+		{path: "src/gen/types.go", approvers: sets.NewString("carl"), ownersDir: "src/gen"},
+		// A later rule without owners leaves the files it matches unowned.
+		{path: "src/gen/types.pb.go", approvers: sets.NewString(), ownersDir: ""},
+		{path: "docs/guide.md", approvers: sets.NewString("mml"), ownersDir: "docs"},
+		{path: "docs/img/logo.png", approvers: sets.NewString("maggie"), ownersDir: "docs"},
+	}
+	for _, tc := range testCases {
+		if got := ro.Approvers(tc.path).Set(); !got.Equal(tc.approvers) {
+			t.Errorf("expected approvers %v for %s, got %v", tc.approvers.List(), tc.path, got.List())
+		}
+		if got := ro.LeafApprovers(tc.path); !got.Equal(tc.approvers) {
+			t.Errorf("expected leaf approvers %v for %s, got %v", tc.approvers.List(), tc.path, got.List())
+		}
+		if got := ro.FindApproverOwnersForFile(tc.path); got != tc.ownersDir {
+			t.Errorf("expected approvers of %s from %q, got %q", tc.path, tc.ownersDir, got)
+		}
+	}
+}
+
+func TestCodeOwnersTeamsAreCached(t *testing.T) {
+	files := map[string][]byte{
+		"CODEOWNERS":  []byte("* @org/go-team\n"),
+		"src/main.go": []byte("package main"),
+	}
+	client, cleanup, err := getTestClient(files, false, true, false, false, nil, nil, nil, nil, localgit.NewV2)
+	if err != nil {
+		t.Fatalf("Error creating test client: %v.", err)
+	}
+	defer cleanup()
+	ghc := client.ghc.(*fakeGitHubClient)
+	ghc.teams = map[string][]string{"go-team": {"maggie"}}
+	client.codeOwners = func(org, repo string) ownersconfig.CodeOwnersPrecedence {
+		return ownersconfig.CodeOwnersOverride
+	}
+
+	for i := 0; i < 2; i++ {
+		ro, err := client.LoadRepoOwners("org", "repo", "master")
+		if err != nil {
+			t.Fatalf("Unexpected error loading RepoOwners: %v.", err)
+		}
+		if got := ro.Approvers("src/main.go").Set(); !got.Equal(sets.NewString("maggie")) {
+			t.Errorf("expected approvers [maggie], got %v", got.List())
+		}
+	}
+	if ghc.teamListings != 1 {
+		t.Errorf("expected the team members to be listed once, were listed %d times", ghc.teamListings)
+	}
+}
@@ -42,6 +42,10 @@ import (
 const (
 	// GitHub's api uses "" (empty) string as basedir by convention but it's clearer to use "/"
 	baseDirConvention = ""
+
+	// teamsTTL is how long the members of the teams from a CODEOWNERS file
+	// are cached before they are listed again.
+	teamsTTL = 10 * time.Minute
 )
 
 type dirOptions struct {
@@ -76,6 +80,8 @@ type FullConfig struct {
 type githubClient interface {
 	ListCollaborators(org, repo string) ([]github.User, error)
 	GetRef(org, repo, ref string) (string, error)
+	GetTeamBySlug(slug string, org string) (*github.Team, error)
+	ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error)
 }
 
 func newCache() *cache {
@@ -127,12 +133,20 @@ type cacheEntry struct {
 	sha     string
 	aliases RepoAliases
 	owners  *RepoOwners
+	// expandedOwners are the owners with the teams from a CODEOWNERS file
+	// replaced by their members, which are listed again after teamsTTL.
+	expandedOwners *RepoOwners
+	teamsExpanded  time.Time
 }
 
 func (entry cacheEntry) matchesMDYAML(mdYAML bool) bool {
 	return entry.owners.enableMDYAML == mdYAML
 }
 
+func (entry cacheEntry) matchesCodeOwners(precedence ownersconfig.CodeOwnersPrecedence) bool {
+	return entry.owners.codeOwners == precedence
+}
+
 func (entry cacheEntry) fullyLoaded() bool {
 	return entry.sha != "" && entry.aliases != nil && entry.owners != nil
 }
@@ -163,6 +177,7 @@ type delegate struct {
 	skipCollaborators  func(org, repo string) bool
 	ownersDirBlacklist func() prowConf.OwnersDirBlacklist
 	filenames          ownersconfig.Resolver
+	codeOwners         ownersconfig.CodeOwnersResolver
 
 	cache *cache
 }
@@ -194,6 +209,7 @@ func NewClient(
 	skipCollaborators func(org, repo string) bool,
 	ownersDirBlacklist func() prowConf.OwnersDirBlacklist,
 	filenames ownersconfig.Resolver,
+	codeOwners ownersconfig.CodeOwnersResolver,
 ) *Client {
 	return &Client{
 		logger: logrus.WithField("client", "repoowners"),
@@ -206,6 +222,7 @@ func NewClient(
 			skipCollaborators:  skipCollaborators,
 			ownersDirBlacklist: ownersDirBlacklist,
 			filenames:          filenames,
+			codeOwners:         codeOwners,
 		},
 	}
 }
@@ -246,6 +263,17 @@ type RepoOwners struct {
 	enableMDYAML bool
 	dirBlacklist []*regexp.Regexp
 	filenames    ownersconfig.Filenames
+	codeOwners   ownersconfig.CodeOwnersPrecedence
+	// hasTeams is set if the owners include teams from a CODEOWNERS file.
+	hasTeams bool
+	// codeOwnersMatches are the rules of the CODEOWNERS file in order, and
+	// codeOwnersRules maps the regexps of the owners from the file to the
+	// index of their rule.
+	codeOwnersMatches []codeOwnersMatch
+	codeOwnersRules   map[*regexp.Regexp]int
+	// codeOwnersDirs are the directories whose owners from the CODEOWNERS
+	// file replace those of their parents.
+	codeOwnersDirs sets.String
 
 	log *logrus.Entry
 }
@@ -307,15 +335,19 @@ func (c *Client) LoadRepoOwners(org, repo, base string) (RepoOwner, error) {
 		return nil, err
 	}
 
+	owners := entry.owners
+	if owners.hasTeams {
+		owners = entry.expandedOwners
+	}
+
 	start = time.Now()
 	if c.skipCollaborators(org, repo) {
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed c.skipCollaborators(%s, %s)", org, repo)
 		log.Debugf("Skipping collaborator checks for %s/%s", org, repo)
-		return entry.owners, nil
+		return owners, nil
 	}
 	log.WithField("duration", time.Since(start).String()).Debugf("Completed c.skipCollaborators(%s, %s)", org, repo)
 
-	var owners *RepoOwners
 	// Filter collaborators. We must filter the RepoOwners struct even if it came from the cache
 	// because the list of collaborators could have changed without the git SHA changing.
 	start = time.Now()
@@ -323,10 +355,9 @@ func (c *Client) LoadRepoOwners(org, repo, base string) (RepoOwner, error) {
 	log.WithField("duration", time.Since(start).String()).Debugf("Completed ghc.ListCollaborators(%s, %s)", org, repo)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to list collaborators while loading RepoOwners. Skipping collaborator filtering.")
-		owners = entry.owners
 	} else {
 		start = time.Now()
-		owners = entry.owners.filterCollaborators(collaborators)
+		owners = owners.filterCollaborators(collaborators)
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed owners.filterCollaborators(collaborators)")
 	}
 	return owners, nil
@@ -341,7 +372,8 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 	entry, ok, entryLock := c.cache.getEntry(fullName)
 	defer entryLock.Unlock()
 	filenames := c.filenames(org, repo)
-	if !ok || entry.sha != sha || entry.owners == nil || !entry.matchesMDYAML(mdYaml) {
+	codeOwners := c.codeOwners(org, repo)
+	if !ok || entry.sha != sha || entry.owners == nil || !entry.matchesMDYAML(mdYaml) || !entry.matchesCodeOwners(codeOwners) {
 		start := time.Now()
 		gitRepo, err := c.git.ClientFor(org, repo)
 		if err != nil {
@@ -350,7 +382,7 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 		log.WithField("duration", time.Since(start).String()).Debugf("Completed git.ClientFor(%s, %s)", org, repo)
 		defer gitRepo.Clean()
 
-		reusable := entry.fullyLoaded() && entry.matchesMDYAML(mdYaml)
+		reusable := entry.fullyLoaded() && entry.matchesMDYAML(mdYaml) && entry.matchesCodeOwners(codeOwners)
 		// In most sha changed cases, the files associated with the owners are unchanged.
 		// The cached entry can continue to be used, so need do git diff
 		if reusable {
@@ -364,7 +396,8 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 			for _, change := range changes {
 				if mdYaml && strings.HasSuffix(change, ".md") ||
 					strings.HasSuffix(change, filenames.OwnersAliases) ||
-					strings.HasSuffix(change, filenames.Owners) {
+					strings.HasSuffix(change, filenames.Owners) ||
+					codeOwners != ownersconfig.CodeOwnersIgnored && sets.NewString(ownersconfig.CodeOwnersFiles...).Has(change) {
 					reusable = false
 					log.WithField("duration", time.Since(start).String()).Debugf("Completed owners change verification loop")
 					break
@@ -402,15 +435,24 @@ func (c *Client) cacheEntryFor(org, repo, base, cloneRef, fullName, sha string,
 			log.WithField("duration", time.Since(start).String()).Debugf("Completed dirBlacklist loading")
 
 			start = time.Now()
-			entry.owners, err = loadOwnersFrom(gitRepo.Directory(), mdYaml, entry.aliases, dirBlacklist, filenames, log)
+			entry.owners, err = loadOwnersFrom(gitRepo.Directory(), mdYaml, entry.aliases, dirBlacklist, filenames, codeOwners, log)
 			if err != nil {
 				return cacheEntry{}, fmt.Errorf("failed to load RepoOwners for %s: %v", fullName, err)
 			}
-			log.WithField("duration", time.Since(start).String()).Debugf("Completed loadOwnersFrom(%s, %t, entry.aliases, dirBlacklist, log)", gitRepo.Directory(), mdYaml)
+			entry.expandedOwners = nil
+			log.WithField("duration", time.Since(start).String()).Debugf("Completed loadOwnersFrom(%s, %t, entry.aliases, dirBlacklist, %q, log)", gitRepo.Directory(), mdYaml, codeOwners)
 			entry.sha = sha
 			c.cache.setEntry(fullName, entry)
 		}
 	}
+
+	if entry.owners.hasTeams && (entry.expandedOwners == nil || time.Since(entry.teamsExpanded) > teamsTTL) {
+		start := time.Now()
+		entry.expandedOwners = entry.owners.expandTeams(c.ghc, org)
+		entry.teamsExpanded = time.Now()
+		c.cache.setEntry(fullName, entry)
+		log.WithField("duration", time.Since(start).String()).Debugf("Completed owners.expandTeams(ghc, %s)", org)
+	}
 	return entry, nil
 }
 
@@ -470,12 +512,13 @@ func loadAliasesFrom(baseDir, filename string, log *logrus.Entry) RepoAliases {
 	return result
 }
 
-func loadOwnersFrom(baseDir string, mdYaml bool, aliases RepoAliases, dirBlacklist []*regexp.Regexp, filenames ownersconfig.Filenames, log *logrus.Entry) (*RepoOwners, error) {
+func loadOwnersFrom(baseDir string, mdYaml bool, aliases RepoAliases, dirBlacklist []*regexp.Regexp, filenames ownersconfig.Filenames, codeOwners ownersconfig.CodeOwnersPrecedence, log *logrus.Entry) (*RepoOwners, error) {
 	o := &RepoOwners{
 		RepoAliases:  aliases,
 		baseDir:      baseDir,
 		enableMDYAML: mdYaml,
 		filenames:    filenames,
+		codeOwners:   codeOwners,
 		log:          log,
 
 		approvers:         make(map[string]map[*regexp.Regexp]sets.String),
@@ -483,11 +526,26 @@ func loadOwnersFrom(baseDir string, mdYaml bool, aliases RepoAliases, dirBlackli
 		requiredReviewers: make(map[string]map[*regexp.Regexp]sets.String),
 		labels:            make(map[string]map[*regexp.Regexp]sets.String),
 		options:           make(map[string]dirOptions),
+		codeOwnersRules:   make(map[*regexp.Regexp]int),
+		codeOwnersDirs:    sets.NewString(),
 
 		dirBlacklist: dirBlacklist,
 	}
 
-	return o, filepath.Walk(o.baseDir, o.walkFunc)
+	if codeOwners != ownersconfig.CodeOwnersOverride {
+		if err := filepath.Walk(o.baseDir, o.walkFunc); err != nil {
+			return o, err
+		}
+	}
+	switch codeOwners {
+	case ownersconfig.CodeOwnersFallback:
+		if len(o.approvers) == 0 && len(o.reviewers) == 0 {
+			o.applyCodeOwners(log)
+		}
+	case ownersconfig.CodeOwnersMerge, ownersconfig.CodeOwnersOverride:
+		o.applyCodeOwners(log)
+	}
+	return o, nil
 }
 
 // by default, github's api doesn't root the project directory at "/" and instead uses the empty string for the base dir
@@ -751,8 +809,8 @@ func (o *RepoOwners) filterCollaborators(toKeep []github.User) *RepoOwners {
 }
 
 // findOwnersForFile returns the OWNERS file path furthest down the tree for a specified file
-// using ownerMap to check for entries
-func findOwnersForFile(log *logrus.Entry, path string, ownerMap map[string]map[*regexp.Regexp]sets.String) string {
+// using ownerMap to check for entries, skipping those overridden for the file.
+func findOwnersForFile(log *logrus.Entry, path string, ownerMap map[string]map[*regexp.Regexp]sets.String, overridden func(*regexp.Regexp, string) bool) string {
 	d := path
 
 	for ; d != baseDirConvention; d = canonicalize(filepath.Dir(d)) {
@@ -762,7 +820,7 @@ func findOwnersForFile(log *logrus.Entry, path string, ownerMap map[string]map[*
 			return ""
 		}
 		for re, n := range ownerMap[d] {
-			if re != nil && !re.MatchString(relative) {
+			if re != nil && !re.MatchString(relative) || overridden(re, path) {
 				continue
 			}
 			if len(n) != 0 {
@@ -776,13 +834,13 @@ func findOwnersForFile(log *logrus.Entry, path string, ownerMap map[string]map[*
 // FindApproverOwnersForFile returns the OWNERS file path furthest down the tree for a specified file
 // that contains an approvers section
 func (o *RepoOwners) FindApproverOwnersForFile(path string) string {
-	return findOwnersForFile(o.log, path, o.approvers)
+	return findOwnersForFile(o.log, path, o.approvers, o.overridden)
 }
 
 // FindReviewersOwnersForFile returns the OWNERS file path furthest down the tree for a specified file
 // that contains a reviewers section
 func (o *RepoOwners) FindReviewersOwnersForFile(path string) string {
-	return findOwnersForFile(o.log, path, o.reviewers)
+	return findOwnersForFile(o.log, path, o.reviewers, o.overridden)
 }
 
 // FindLabelsForFile returns a set of labels which should be applied to PRs
@@ -791,9 +849,10 @@ func (o *RepoOwners) FindLabelsForFile(path string) sets.String {
 	return o.entriesForFile(path, o.labels, false).Set()
 }
 
-// IsNoParentOwners checks if an OWNERS file path refers to an OWNERS file with NoParentOwners enabled.
+// IsNoParentOwners checks if an OWNERS file path refers to an OWNERS file with NoParentOwners enabled,
+// or to a directory whose owners from the CODEOWNERS file replace those of its parents.
 func (o *RepoOwners) IsNoParentOwners(path string) bool {
-	return o.options[path].NoParentOwners
+	return o.options[path].NoParentOwners || o.codeOwnersDirs.Has(path)
 }
 
 // entriesForFile returns a set of users who are assignees to the
@@ -816,7 +875,7 @@ func (o *RepoOwners) entriesForFile(path string, people map[string]map[*regexp.R
 			return nil
 		}
 		for re, s := range people[d] {
-			if re == nil || re.MatchString(relative) {
+			if (re == nil || re.MatchString(relative)) && !o.overridden(re, path) {
 				out.Insert(layerID, s.List()...)
 			}
 		}
@@ -127,6 +127,9 @@ type cacheOptions struct {
 type fakeGitHubClient struct {
 	Collaborators []string
 	ref           string
+	teams         map[string][]string
+	// teamListings counts the calls to ListTeamMembers.
+	teamListings int
 }
 
 func (f *fakeGitHubClient) ListCollaborators(org, repo string) ([]github.User, error) {
@@ -141,6 +144,37 @@ func (f *fakeGitHubClient) GetRef(org, repo, ref string) (string, error) {
 	return f.ref, nil
 }
 
+// teamSlugs returns the slugs of the teams, the ID of a team is its index.
+func (f *fakeGitHubClient) teamSlugs() []string {
+	slugs := sets.NewString()
+	for slug := range f.teams {
+		slugs.Insert(slug)
+	}
+	return slugs.List()
+}
+
+func (f *fakeGitHubClient) GetTeamBySlug(slug string, org string) (*github.Team, error) {
+	for id, team := range f.teamSlugs() {
+		if team == slug {
+			return &github.Team{ID: id, Slug: slug}, nil
+		}
+	}
+	return nil, fmt.Errorf("team %s/%s not found", org, slug)
+}
+
+func (f *fakeGitHubClient) ListTeamMembers(org string, id int, role string) ([]github.TeamMember, error) {
+	f.teamListings++
+	slugs := f.teamSlugs()
+	if id >= len(slugs) {
+		return nil, fmt.Errorf("team %d not found", id)
+	}
+	var members []github.TeamMember
+	for _, login := range f.teams[slugs[id]] {
+		members = append(members, github.TeamMember{Login: login})
+	}
+	return members, nil
+}
+
 func getTestClient(
 	files map[string][]byte,
 	enableMdYaml,
@@ -275,7 +309,8 @@ labels:
 						IgnorePreconfiguredDefaults: ignorePreconfiguredDefaults,
 					}
 				},
-				filenames: ownersconfig.FakeResolver,
+				filenames:  ownersconfig.FakeResolver,
+				codeOwners: ownersconfig.FakeCodeOwnersResolver,
 			},
 		},
 		// Clean up function
@@ -20,8 +20,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov/patch"
 	"k8s.io/test-infra/gopherage/pkg/util"
 	"k8s.io/test-infra/robots/coverage/diff"
 )
@@ -30,6 +33,8 @@ type flags struct {
 	outputFile string
 	threshold  float32
 	jobName    string
+	patchFile  string
+	modulePath string
 }
 
 // MakeCommand returns a `diff` command.
@@ -47,6 +52,8 @@ func MakeCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&flags.outputFile, "output", "o", "-", "output file")
 	cmd.Flags().StringVarP(&flags.jobName, "jobname", "j", "", "prow job name")
 	cmd.Flags().Float32VarP(&flags.threshold, "threshold", "t", .8, "code coverage threshold")
+	cmd.Flags().StringVar(&flags.patchFile, "patch", "", "unified diff of the PR, to also report the coverage of the changed lines")
+	cmd.Flags().StringVar(&flags.modulePath, "module", "", "module path to strip from the file names in the profiles to match the paths in --patch, by default the one in ./go.mod")
 	return cmd
 }
 
@@ -79,6 +86,18 @@ func run(flags *flags, cmd *cobra.Command, args []string) {
 
 	postContent, isCoverageLow := diff.ContentForGitHubPost(baseProfiles, newProfiles, flags.jobName, flags.threshold)
 
+	if flags.patchFile != "" {
+		patchContent, isPatchCoverageLow, err := patchContent(flags, newProfiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to calculate patch coverage: %v.\n", err)
+			os.Exit(1)
+		}
+		if patchContent != "" {
+			postContent = strings.TrimSuffix(postContent+"\n"+patchContent, "\n") + "\n"
+		}
+		isCoverageLow = isCoverageLow || isPatchCoverageLow
+	}
+
 	var file io.WriteCloser
 	if flags.outputFile == "-" {
 		file = os.Stdout
@@ -104,3 +123,22 @@ func run(flags *flags, cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 }
+
+// patchContent calculates the coverage of the lines changed by the patch file
+func patchContent(flags *flags, profiles []*cover.Profile) (string, bool, error) {
+	f, err := os.Open(flags.patchFile)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	changes, err := patch.ParseDiff(f)
+	if err != nil {
+		return "", false, err
+	}
+	modulePath := flags.modulePath
+	if modulePath == "" {
+		modulePath = util.ModulePath("go.mod")
+	}
+	content, isCoverageLow := diff.PatchContentForGitHubPost(patch.Calculate(profiles, changes, modulePath), flags.threshold)
+	return content, isCoverageLow, nil
+}
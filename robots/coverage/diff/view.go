@@ -22,6 +22,7 @@ import (
 
 	"golang.org/x/tools/cover"
 	"k8s.io/test-infra/gopherage/pkg/cov/junit/calculation"
+	"k8s.io/test-infra/gopherage/pkg/cov/patch"
 )
 
 // formatPercentage converts a coverage ratio into a string value to be displayed by coverage robot
@@ -83,3 +84,19 @@ func ContentForGitHubPost(baseProfiles, newProfiles []*cover.Profile, jobName st
 
 	return strings.Join(rows, "\n"), isCoverageLow
 }
+
+// PatchContentForGitHubPost constructs the patch coverage section of the message covbot posts,
+// which covers only the lines changed by the PR. It also reports whether the patch coverage
+// fell below the given threshold.
+func PatchContentForGitHubPost(report *patch.Report, coverageThreshold float32) (string, bool) {
+	table := report.Markdown()
+	if table == "" {
+		return "", false
+	}
+	rows := []string{
+		"The following is the coverage of the lines changed by this PR",
+		"",
+		table,
+	}
+	return strings.Join(rows, "\n"), report.Ratio() < coverageThreshold
+}
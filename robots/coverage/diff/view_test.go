@@ -17,9 +17,11 @@ limitations under the License.
 package diff
 
 import (
+	"strings"
 	"testing"
 
 	"k8s.io/test-infra/gopherage/pkg/cov/junit/calculation"
+	"k8s.io/test-infra/gopherage/pkg/cov/patch"
 )
 
 func TestMakeTable(t *testing.T) {
@@ -75,3 +77,23 @@ func TestMakeTable(t *testing.T) {
 		})
 	}
 }
+
+func TestPatchContentForGitHubPost(t *testing.T) {
+	report := &patch.Report{
+		Files: []patch.FileCoverage{
+			{Name: "foo/foo.go", Covered: 3, Total: 4, Uncovered: []patch.LineRange{{Start: 12, End: 14}}},
+		},
+	}
+	content, isCoverageLow := PatchContentForGitHubPost(report, .8)
+	if !strings.Contains(content, "foo/foo.go | 75.0% (3/4) | 12-14") {
+		t.Errorf("expected the file in the post content, got:\n%s", content)
+	}
+	if !isCoverageLow {
+		t.Error("expected patch coverage of 75% to be below the threshold of 80%")
+	}
+
+	content, isCoverageLow = PatchContentForGitHubPost(&patch.Report{}, .8)
+	if content != "" || isCoverageLow {
+		t.Errorf("expected no content for a patch without statements, got %q, low %v", content, isCoverageLow)
+	}
+}
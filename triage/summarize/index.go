@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Contains functions that keep a persistent index of global clusters, so that failures are assigned to
+the clusters of earlier runs and each cluster keeps the ID it was first given.
+*/
+
+package summarize
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+/*
+clusterIndex is the persistent record of the global clusters seen by previous runs.
+
+	clusters: every cluster seen within the retention period
+	last_run: the metrics of the run that last wrote the index
+*/
+type clusterIndex struct {
+	Clusters []indexedCluster `json:"clusters"`
+	LastRun  indexMetrics     `json:"last_run"`
+}
+
+/*
+indexedCluster is a global cluster as it is kept in the index.
+
+	id:         the ID the cluster was first given, which is never changed
+	key:        the cluster text, which new failures are matched against
+	first_seen: when the cluster first appeared, in seconds since the epoch
+	last_seen:  when the cluster last appeared, in seconds since the epoch
+	failures:   the number of failures in the cluster when it last appeared
+*/
+type indexedCluster struct {
+	ID        string `json:"id"`
+	Key       string `json:"key"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+	Failures  int    `json:"failures"`
+}
+
+/*
+indexMetrics describes how the clusters of a run relate to those of previous runs.
+
+	clusters:     the number of clusters in the run
+	new:          clusters which were not in the index
+	growing:      clusters with more failures than when they last appeared
+	new_failures: the number of failures in new clusters
+	expired:      clusters removed from the index for not appearing within the retention period
+*/
+type indexMetrics struct {
+	Clusters    int `json:"clusters"`
+	New         int `json:"new"`
+	Growing     int `json:"growing"`
+	NewFailures int `json:"new_failures"`
+	Expired     int `json:"expired"`
+}
+
+// loadIndex loads a cluster index. A missing file is an empty index, as there is one the first time
+// the index is used.
+func loadIndex(filepath string) (*clusterIndex, error) {
+	var index clusterIndex
+
+	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+		klog.V(2).Infof("No cluster index at %s, starting a new one", filepath)
+		return &index, nil
+	}
+
+	err := getJSON(filepath, &index)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get cluster index JSON: %s", err)
+	}
+
+	return &index, nil
+}
+
+// writeIndex writes the cluster index to a file.
+func writeIndex(filepath string, index *clusterIndex) error {
+	err := writeJSON(filepath, index)
+	if err != nil {
+		return fmt.Errorf("Could not write cluster index to disk: %s", err)
+	}
+	return nil
+}
+
+/*
+seeds returns the indexed clusters in the form clusterGlobal seeds clusters from, so failures are
+matched against the clusters of earlier runs first. Every seed is compared with every new cluster
+that matches no other, so at most max of the most recently seen clusters are returned, or all of
+them if max is 0.
+*/
+func (ci *clusterIndex) seeds(max int) []jsonCluster {
+	clusters := append([]indexedCluster(nil), ci.Clusters...)
+	if max > 0 && len(clusters) > max {
+		sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].LastSeen > clusters[j].LastSeen })
+		clusters = clusters[:max]
+	}
+	seeds := make([]jsonCluster, len(clusters))
+	for i, cluster := range clusters {
+		seeds[i] = jsonCluster{Key: cluster.Key, ID: cluster.ID}
+	}
+	return seeds
+}
+
+/*
+update records the global clusters of a run in the index, and returns how they relate to those of
+previous runs. Clusters new to the index are given the ID render would give them. Clusters which have
+not appeared since now-retention are removed from the index.
+*/
+func (ci *clusterIndex) update(clustered nestedFailuresGroups, now time.Time, retention time.Duration) indexMetrics {
+	metrics := indexMetrics{Clusters: len(clustered)}
+
+	indexed := make(map[string]*indexedCluster, len(ci.Clusters))
+	for i := range ci.Clusters {
+		indexed[ci.Clusters[i].Key] = &ci.Clusters[i]
+	}
+
+	var added []indexedCluster
+	for key, tests := range clustered {
+		numFailures := 0
+		for _, failures := range tests {
+			numFailures += len(failures)
+		}
+
+		cluster, ok := indexed[key]
+		if !ok {
+			metrics.New++
+			metrics.NewFailures += numFailures
+			added = append(added, indexedCluster{
+				ID:        makeNgramCountsDigest(key),
+				Key:       key,
+				FirstSeen: now.Unix(),
+				LastSeen:  now.Unix(),
+				Failures:  numFailures,
+			})
+			continue
+		}
+
+		if numFailures > cluster.Failures {
+			metrics.Growing++
+		}
+		cluster.LastSeen = now.Unix()
+		cluster.Failures = numFailures
+	}
+
+	// Drop the clusters that have not appeared within the retention period
+	cutoff := now.Add(-retention).Unix()
+	kept := make([]indexedCluster, 0, len(ci.Clusters)+len(added))
+	for _, cluster := range append(ci.Clusters, added...) {
+		if retention > 0 && cluster.LastSeen < cutoff {
+			metrics.Expired++
+			continue
+		}
+		kept = append(kept, cluster)
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].ID < kept[j].ID })
+
+	ci.Clusters = kept
+	ci.LastRun = metrics
+	return metrics
+}
+
+// assignIDs sets the ID of each rendered cluster to the ID it has in the index. It must be called
+// after update, so that every rendered cluster is in the index.
+func (ci *clusterIndex) assignIDs(data *jsonOutput) {
+	ids := make(map[string]string, len(ci.Clusters))
+	for _, cluster := range ci.Clusters {
+		ids[cluster.Key] = cluster.ID
+	}
+
+	for i := range data.Clustered {
+		if id, ok := ids[data.Clustered[i].Key]; ok {
+			data.Clustered[i].ID = id
+		}
+	}
+}
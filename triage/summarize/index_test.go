@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package summarize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexUpdate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	day := int64(24 * 60 * 60)
+
+	index := clusterIndex{Clusters: []indexedCluster{
+		{ID: "a", Key: "growing", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix() - day, Failures: 1},
+		{ID: "b", Key: "steady", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix() - day, Failures: 2},
+		{ID: "c", Key: "dormant", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix() - 2*day, Failures: 5},
+		{ID: "d", Key: "expired", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix() - 4*day, Failures: 5},
+	}}
+	f := failure{FailureText: "irrelevant"}
+	clustered := nestedFailuresGroups{
+		"growing": failuresGroup{"test a": []failure{f}, "test b": []failure{f, f}},
+		"steady":  failuresGroup{"test a": []failure{f, f}},
+		"new":     failuresGroup{"test a": []failure{f, f, f}},
+	}
+
+	metrics := index.update(clustered, now, 3*24*time.Hour)
+
+	wantMetrics := indexMetrics{Clusters: 3, New: 1, Growing: 1, NewFailures: 3, Expired: 1}
+	if metrics != wantMetrics {
+		t.Errorf("update() = %+v, wanted %+v", metrics, wantMetrics)
+	}
+	if index.LastRun != wantMetrics {
+		t.Errorf("LastRun = %+v, wanted %+v", index.LastRun, wantMetrics)
+	}
+
+	// Clusters are sorted by ID, and the digest of "new" sorts before the fixture IDs
+	newID := makeNgramCountsDigest("new")
+	want := []indexedCluster{
+		{ID: newID, Key: "new", FirstSeen: now.Unix(), LastSeen: now.Unix(), Failures: 3},
+		{ID: "a", Key: "growing", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix(), Failures: 3},
+		{ID: "b", Key: "steady", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix(), Failures: 2},
+		{ID: "c", Key: "dormant", FirstSeen: now.Unix() - 10*day, LastSeen: now.Unix() - 2*day, Failures: 5},
+	}
+	if !reflect.DeepEqual(index.Clusters, want) {
+		t.Errorf("Clusters = %#v, wanted %#v", index.Clusters, want)
+	}
+}
+
+// Make sure a cluster keeps its ID when failures matching it arrive with a different text
+func TestIndexStableIDs(t *testing.T) {
+	textOld := "some long failure message that changes occasionally foo"
+	textNew := strings.Replace(textOld, "foo", "bar", -1)
+	f1 := failure{Build: "b1", FailureText: textNew}
+	f2 := failure{Build: "b2", FailureText: textNew}
+
+	index := clusterIndex{Clusters: []indexedCluster{{ID: "stable", Key: textOld, Failures: 1}}}
+	argument := nestedFailuresGroups{"test a": failuresGroup{textNew: []failure{f1, f2}}}
+
+	clustered := clusterGlobal(argument, index.seeds(0), false)
+	want := nestedFailuresGroups{textOld: failuresGroup{"test a": []failure{f1, f2}}}
+	if !want.equal(&clustered) {
+		t.Fatalf("clusterGlobal(%#v) = %#v, wanted %#v", argument, clustered, want)
+	}
+
+	metrics := index.update(clustered, time.Unix(1600000000, 0), 0)
+	if metrics.New != 0 || metrics.Growing != 1 {
+		t.Errorf("update() = %+v, wanted no new clusters and one growing", metrics)
+	}
+
+	data := render(map[string]build{"b1": {Path: "b1", Job: "job"}, "b2": {Path: "b2", Job: "job"}}, clustered)
+	index.assignIDs(&data)
+	if len(data.Clustered) != 1 || data.Clustered[0].ID != "stable" {
+		t.Errorf("rendered clusters %#v, wanted one with ID %q", data.Clustered, "stable")
+	}
+}
+
+func TestIndexSeeds(t *testing.T) {
+	index := clusterIndex{Clusters: []indexedCluster{
+		{ID: "a", Key: "old", LastSeen: 1},
+		{ID: "b", Key: "recent", LastSeen: 3},
+		{ID: "c", Key: "older", LastSeen: 0},
+		{ID: "d", Key: "newer", LastSeen: 2},
+	}}
+
+	want := []jsonCluster{{ID: "b", Key: "recent"}, {ID: "d", Key: "newer"}}
+	if got := index.seeds(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("seeds(2) = %#v, wanted %#v", got, want)
+	}
+	if got := index.seeds(0); len(got) != 4 {
+		t.Errorf("seeds(0) = %#v, wanted all 4 clusters", got)
+	}
+	if index.Clusters[0].ID != "a" {
+		t.Errorf("seeds() reordered the index: %#v", index.Clusters)
+	}
+}
+
+func TestLoadIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.json")
+
+	index, err := loadIndex(path)
+	if err != nil {
+		t.Fatalf("loadIndex() of a missing file returned error: %s", err)
+	}
+	if len(index.Clusters) != 0 {
+		t.Errorf("loadIndex() of a missing file = %#v, wanted an empty index", index)
+	}
+
+	index.Clusters = []indexedCluster{{ID: "a", Key: "text", FirstSeen: 1, LastSeen: 2, Failures: 3}}
+	index.LastRun = indexMetrics{Clusters: 1, New: 1, NewFailures: 3}
+	if err := writeIndex(path, index); err != nil {
+		t.Fatalf("writeIndex() returned error: %s", err)
+	}
+
+	got, err := loadIndex(path)
+	if err != nil {
+		t.Fatalf("loadIndex() returned error: %s", err)
+	}
+	if !reflect.DeepEqual(got, index) {
+		t.Errorf("loadIndex() = %#v, wanted %#v", got, index)
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Contains functions that load builds and test failures straight from the artifacts jobs upload to
+GCS or S3, as an alternative to the files exported from BigQuery.
+*/
+
+package summarize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
+	"k8s.io/klog/v2"
+
+	pkgio "k8s.io/test-infra/prow/io"
+	"k8s.io/test-infra/prow/io/providers"
+	"k8s.io/test-infra/prow/pod-utils/gcs"
+)
+
+var (
+	// aliasRE matches the files in pr-logs/directory that point to the builds of presubmits.
+	aliasRE = regexp.MustCompile(`/([0-9]+)\.txt$`)
+	// junitRE matches the names of JUnit files.
+	junitRE = regexp.MustCompile(`^junit.*\.xml$`)
+)
+
+/*
+artifactSource describes where to read builds from, assuming the layout written by the pod utilities:
+builds of periodics and postsubmits in logs/<job>/<build>, and builds of presubmits in
+pr-logs/pull/<repo>/<pr>/<job>/<build>, linked to from pr-logs/directory/<job>/<build>.txt.
+
+	bucket:     the storage root holding the logs and pr-logs trees, e.g. gs://kubernetes-jenkins
+	jobs:       the names of the jobs to read builds of
+	since:      builds that started before since are ignored
+	numWorkers: the number of jobs to read concurrently
+*/
+type artifactSource struct {
+	opener     pkgio.Opener
+	bucket     string
+	jobs       []string
+	since      time.Time
+	numWorkers int
+
+	// root is the scheme and bucket of the storage path, e.g. gs://kubernetes-jenkins/, which
+	// the names of listed objects are relative to
+	root string
+}
+
+// loadArtifacts reads the finished builds of the source's jobs, along with the failures in their
+// JUnit files. Like loadFailures, it maps build paths to builds and groups test failures by test name.
+func loadArtifacts(ctx context.Context, src artifactSource) (map[string]build, map[string][]failure, error) {
+	builds := make(map[string]build)
+	tests := make(map[string][]failure)
+	var errs []string
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	if src.numWorkers <= 0 {
+		src.numWorkers = 1
+	}
+	src.bucket = strings.TrimSuffix(src.bucket, "/")
+	scheme, bucket, _, err := providers.ParseStoragePath(src.bucket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not parse bucket '%s': %s", src.bucket, err)
+	}
+	src.root = fmt.Sprintf("%s://%s/", scheme, bucket)
+	start := time.Now()
+
+	jobs := make(chan string, len(src.jobs))
+	for _, job := range src.jobs {
+		jobs <- job
+	}
+	close(jobs)
+
+	for i := 0; i < src.numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				jobBuilds, jobFailures, err := src.loadJob(ctx, job)
+
+				lock.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", job, err))
+				}
+				for _, bld := range jobBuilds {
+					builds[bld.Path] = bld
+				}
+				for _, flr := range jobFailures {
+					tests[flr.Name] = append(tests[flr.Name], flr)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, nil, fmt.Errorf("Could not read builds of %d jobs: %s", len(errs), strings.Join(errs, "; "))
+	}
+
+	// Sort the failures within each test by build, as loadTests does
+	for _, testSlice := range tests {
+		sort.Slice(testSlice, func(i, j int) bool { return testSlice[i].Build < testSlice[j].Build })
+	}
+
+	klog.V(2).Infof("Read %d builds and %d failed tests of %d jobs from %s in %s",
+		len(builds), len(tests), len(src.jobs), src.bucket, time.Since(start).String())
+	return builds, tests, nil
+}
+
+// loadJob reads the finished builds of a job that started after src.since, and their failures.
+func (src *artifactSource) loadJob(ctx context.Context, job string) ([]build, []failure, error) {
+	dirs, err := src.buildDirs(ctx, job)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var builds []build
+	var failures []failure
+	for _, dir := range dirs {
+		if dir.link != "" {
+			// Only the links of builds that may be recent enough are read
+			target, err := src.read(ctx, dir.link)
+			if err != nil {
+				klog.Warningf("Could not read link %s, skipping it: %s", dir.link, err)
+				continue
+			}
+			dir.path = strings.TrimSuffix(strings.TrimSpace(string(target)), "/")
+		}
+		bld, buildFailures, finished, err := src.loadBuild(ctx, job, dir)
+		if err != nil {
+			klog.Warningf("Could not read build %s, skipping it: %s", dir.path, err)
+			continue
+		}
+		// Build numbers increase over time, so every remaining build is older still
+		if bld.Started < int(src.since.Unix()) {
+			break
+		}
+		if !finished {
+			continue
+		}
+		builds = append(builds, bld)
+		failures = append(failures, buildFailures...)
+	}
+	return builds, failures, nil
+}
+
+// buildDir is the directory holding the artifacts of a build. The directories of presubmit builds
+// are only known once their link is read.
+type buildDir struct {
+	path   string
+	link   string
+	number int
+}
+
+// buildDirs lists the builds of a job, both in the logs tree and in the pr-logs tree, most recent first.
+// The links to presubmit builds are not read, their build number is taken from the link's name.
+func (src *artifactSource) buildDirs(ctx context.Context, job string) ([]buildDir, error) {
+	var dirs []buildDir
+
+	// Periodics and postsubmits have a directory per build
+	err := src.list(ctx, src.bucket+"/"+path.Join(gcs.NonPRLogs, job)+"/", "/", func(attrs pkgio.ObjectAttributes) error {
+		if !attrs.IsDir {
+			return nil
+		}
+		number, err := strconv.Atoi(path.Base(attrs.Name))
+		if err != nil {
+			return nil
+		}
+		dirs = append(dirs, buildDir{path: src.root + strings.TrimSuffix(attrs.Name, "/"), number: number})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Presubmits have a file per build pointing to its directory
+	err = src.list(ctx, src.bucket+"/"+path.Join(gcs.PRLogs, "directory", job)+"/", "", func(attrs pkgio.ObjectAttributes) error {
+		matches := aliasRE.FindStringSubmatch(attrs.Name)
+		if len(matches) != 2 {
+			return nil
+		}
+		number, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil
+		}
+		dirs = append(dirs, buildDir{link: src.root + attrs.Name, number: number})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].number > dirs[j].number })
+	return dirs, nil
+}
+
+// loadBuild reads a build and its failures. The returned bool is false if the build has not finished.
+func (src *artifactSource) loadBuild(ctx context.Context, job string, dir buildDir) (build, []failure, bool, error) {
+	bld := build{
+		Path:   dir.path,
+		Job:    job,
+		Number: dir.number,
+	}
+
+	var started gcs.Started
+	if err := src.readJSON(ctx, dir.path+"/started.json", &started); err != nil {
+		return bld, nil, false, err
+	}
+	bld.Started = int(started.Timestamp)
+	bld.Executor = started.Node
+	bld.PR = started.Pull
+	if started.Timestamp < src.since.Unix() {
+		return bld, nil, false, nil
+	}
+
+	var finished gcs.Finished
+	if err := src.readJSON(ctx, dir.path+"/finished.json", &finished); err != nil {
+		if pkgio.IsNotExist(err) {
+			return bld, nil, false, nil
+		}
+		return bld, nil, false, err
+	}
+	if finished.Timestamp == nil {
+		return bld, nil, false, nil
+	}
+	bld.Elapsed = int(*finished.Timestamp - started.Timestamp)
+	bld.Result = finished.Result
+	if bld.Result == "" {
+		bld.Result = "FAILURE"
+		if finished.Passed != nil && *finished.Passed {
+			bld.Result = "SUCCESS"
+		}
+	}
+
+	var failures []failure
+	err := src.list(ctx, dir.path+"/artifacts/", "", func(attrs pkgio.ObjectAttributes) error {
+		if attrs.IsDir || !junitRE.MatchString(attrs.ObjName) {
+			return nil
+		}
+		data, err := src.read(ctx, src.root+attrs.Name)
+		if err != nil {
+			return err
+		}
+		suites, err := junit.Parse(data)
+		if err != nil {
+			klog.V(2).Infof("Could not parse JUnit file %s, skipping it: %s", attrs.Name, err)
+			return nil
+		}
+		for _, suite := range suites.Suites {
+			failures = recordResults(&bld, suite, failures)
+		}
+		return nil
+	})
+	if err != nil {
+		return bld, nil, false, err
+	}
+
+	for i := range failures {
+		failures[i].Started = bld.Started
+		failures[i].Build = bld.Path
+	}
+	return bld, failures, true, nil
+}
+
+// recordResults counts the tests of a suite and its nested suites in bld, and appends their failures.
+func recordResults(bld *build, suite junit.Suite, failures []failure) []failure {
+	for _, sub := range suite.Suites {
+		failures = recordResults(bld, sub, failures)
+	}
+	for _, result := range suite.Results {
+		if result.Skipped != nil {
+			continue
+		}
+		bld.TestsRun++
+		if result.Failure == nil {
+			continue
+		}
+		bld.TestsFailed++
+		failures = append(failures, failure{Name: result.Name, FailureText: *result.Failure})
+	}
+	return failures
+}
+
+// list calls f with each object below prefix.
+func (src *artifactSource) list(ctx context.Context, prefix, delimiter string, f func(pkgio.ObjectAttributes) error) error {
+	it, err := src.opener.Iterator(ctx, prefix, delimiter)
+	if err != nil {
+		return fmt.Errorf("Could not list '%s': %s", prefix, err)
+	}
+	for {
+		attrs, err := it.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Could not list '%s': %s", prefix, err)
+		}
+		if err := f(attrs); err != nil {
+			return err
+		}
+	}
+}
+
+func (src *artifactSource) read(ctx context.Context, filepath string) ([]byte, error) {
+	r, err := src.opener.Reader(ctx, filepath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open '%s': %w", filepath, err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (src *artifactSource) readJSON(ctx context.Context, filepath string, v interface{}) error {
+	contents, err := src.read(ctx, filepath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		return fmt.Errorf("Could not unmarshal '%s': %s", filepath, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package summarize
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+const (
+	passingJUnit = `<testsuite><testcase name="TestA"/><testcase name="TestB"><skipped/></testcase></testsuite>`
+	failingJUnit = `<testsuites><testsuite><testcase name="TestA"><failure>timed out</failure></testcase><testcase name="TestB"/></testsuite></testsuites>`
+)
+
+// writeObjects writes the objects, keyed by their storage paths, with the opener.
+func writeObjects(t *testing.T, opener pkgio.Opener, objects map[string]string) {
+	ctx := context.Background()
+	for path, content := range objects {
+		w, err := opener.Writer(ctx, path)
+		if err != nil {
+			t.Fatalf("Could not open '%s' for writing: %s", path, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("Could not write '%s': %s", path, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Could not close '%s': %s", path, err)
+		}
+	}
+}
+
+func TestLoadArtifacts(t *testing.T) {
+	ctx := context.Background()
+	// The in-memory provider keeps objects for as long as the opener caches the bucket
+	opener, err := pkgio.NewOpener(ctx, "", "")
+	if err != nil {
+		t.Fatalf("Could not create opener: %s", err)
+	}
+
+	pr := "mem://bucket/pr-logs/pull/org_repo/12/pull-unit/"
+	writeObjects(t, opener, map[string]string{
+		// A periodic that failed, one that passed and one that is older than the window
+		"mem://bucket/logs/ci-unit/100/started.json":              `{"timestamp": 1000, "node": "node-a"}`,
+		"mem://bucket/logs/ci-unit/100/finished.json":             `{"timestamp": 1100, "passed": false, "result": "FAILURE"}`,
+		"mem://bucket/logs/ci-unit/100/artifacts/junit_01.xml":    failingJUnit,
+		"mem://bucket/logs/ci-unit/100/artifacts/build-log.txt":   "not junit",
+		"mem://bucket/logs/ci-unit/101/started.json":              `{"timestamp": 2000}`,
+		"mem://bucket/logs/ci-unit/101/finished.json":             `{"timestamp": 2050, "passed": true}`,
+		"mem://bucket/logs/ci-unit/101/artifacts/e2e/junit_a.xml": passingJUnit,
+		"mem://bucket/logs/ci-unit/99/started.json":               `{"timestamp": 10}`,
+		"mem://bucket/logs/ci-unit/99/finished.json":              `{"timestamp": 20, "passed": false}`,
+		"mem://bucket/logs/ci-unit/99/artifacts/junit_01.xml":     failingJUnit,
+		"mem://bucket/logs/ci-unit/latest-build.txt":              "101",
+		// A presubmit that failed, and one that is still running
+		"mem://bucket/pr-logs/directory/pull-unit/7.txt":  pr + "7\n",
+		pr + "7/started.json":                             `{"timestamp": 3000, "pull": "12"}`,
+		pr + "7/finished.json":                            `{"timestamp": 3010, "passed": false}`,
+		pr + "7/artifacts/junit_unit.xml":                 failingJUnit,
+		"mem://bucket/pr-logs/directory/pull-unit/8.txt":  pr + "8\n",
+		pr + "8/started.json":                             `{"timestamp": 4000, "pull": "12"}`,
+		"mem://bucket/pr-logs/directory/pull-unit/latest": "8",
+		// A job that was not asked for
+		"mem://bucket/logs/ci-other/1/started.json":  `{"timestamp": 1000}`,
+		"mem://bucket/logs/ci-other/1/finished.json": `{"timestamp": 1100, "passed": false}`,
+	})
+
+	builds, tests, err := loadArtifacts(ctx, artifactSource{
+		opener:     opener,
+		bucket:     "mem://bucket/",
+		jobs:       []string{"ci-unit", "pull-unit"},
+		since:      time.Unix(500, 0),
+		numWorkers: 2,
+	})
+	if err != nil {
+		t.Fatalf("loadArtifacts() returned error: %s", err)
+	}
+
+	wantBuilds := map[string]build{
+		"mem://bucket/logs/ci-unit/100": {
+			Path: "mem://bucket/logs/ci-unit/100", Started: 1000, Elapsed: 100, TestsRun: 2, TestsFailed: 1,
+			Result: "FAILURE", Executor: "node-a", Job: "ci-unit", Number: 100,
+		},
+		"mem://bucket/logs/ci-unit/101": {
+			Path: "mem://bucket/logs/ci-unit/101", Started: 2000, Elapsed: 50, TestsRun: 1,
+			Result: "SUCCESS", Job: "ci-unit", Number: 101,
+		},
+		pr + "7": {
+			Path: pr + "7", Started: 3000, Elapsed: 10, TestsRun: 2, TestsFailed: 1,
+			Result: "FAILURE", Job: "pull-unit", Number: 7, PR: "12",
+		},
+	}
+	if !reflect.DeepEqual(builds, wantBuilds) {
+		t.Errorf("loadArtifacts() builds = %#v, wanted %#v", builds, wantBuilds)
+	}
+
+	wantTests := map[string][]failure{
+		"TestA": {
+			{Started: 1000, Build: "mem://bucket/logs/ci-unit/100", Name: "TestA", FailureText: "timed out"},
+			{Started: 3000, Build: pr + "7", Name: "TestA", FailureText: "timed out"},
+		},
+	}
+	if !reflect.DeepEqual(tests, wantTests) {
+		t.Errorf("loadArtifacts() tests = %#v, wanted %#v", tests, wantTests)
+	}
+}
+
+// readRecordingOpener records the paths it opens for reading.
+type readRecordingOpener struct {
+	pkgio.Opener
+	lock  sync.Mutex
+	reads []string
+}
+
+func (o *readRecordingOpener) Reader(ctx context.Context, path string) (io.ReadCloser, error) {
+	o.lock.Lock()
+	o.reads = append(o.reads, path)
+	o.lock.Unlock()
+	return o.Opener.Reader(ctx, path)
+}
+
+func TestLoadJobReadsLinksOfRecentBuildsOnly(t *testing.T) {
+	ctx := context.Background()
+	opener, err := pkgio.NewOpener(ctx, "", "")
+	if err != nil {
+		t.Fatalf("Could not create opener: %s", err)
+	}
+
+	pr := "mem://lazy-bucket/pr-logs/pull/org_repo/12/pull-lazy/"
+	writeObjects(t, opener, map[string]string{
+		// Listed before 9.txt, but the most recent build
+		"mem://lazy-bucket/pr-logs/directory/pull-lazy/10.txt": pr + "10\n",
+		pr + "10/started.json":                                 `{"timestamp": 3000}`,
+		pr + "10/finished.json":                                `{"timestamp": 3010, "passed": true}`,
+		"mem://lazy-bucket/pr-logs/directory/pull-lazy/9.txt":  pr + "9\n",
+		pr + "9/started.json":                                  `{"timestamp": 10}`,
+		"mem://lazy-bucket/pr-logs/directory/pull-lazy/2.txt":  pr + "2\n",
+		pr + "2/started.json":                                  `{"timestamp": 5}`,
+	})
+
+	recorder := &readRecordingOpener{Opener: opener}
+	src := artifactSource{
+		opener: recorder,
+		bucket: "mem://lazy-bucket",
+		since:  time.Unix(500, 0),
+		root:   "mem://lazy-bucket/",
+	}
+	builds, _, err := src.loadJob(ctx, "pull-lazy")
+	if err != nil {
+		t.Fatalf("loadJob() returned error: %s", err)
+	}
+	if len(builds) != 1 || builds[0].Number != 10 {
+		t.Errorf("loadJob() builds = %#v, wanted build 10 only", builds)
+	}
+	for _, read := range recorder.reads {
+		if read == "mem://lazy-bucket/pr-logs/directory/pull-lazy/2.txt" {
+			t.Errorf("loadJob() read the link of a build older than the first one out of the window")
+		}
+	}
+}
@@ -19,6 +19,7 @@ limitations under the License.
 package summarize
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"runtime"
@@ -26,6 +27,8 @@ import (
 	"time"
 
 	"k8s.io/klog/v2"
+
+	pkgio "k8s.io/test-infra/prow/io"
 )
 
 const longOutputLen = 10000
@@ -42,6 +45,16 @@ type summarizeFlags struct {
 	outputSlices string
 	numWorkers   int
 	memoize      bool
+
+	index          string
+	indexRetention time.Duration
+	indexMaxSeeds  int
+
+	artifacts          string
+	jobs               string
+	window             time.Duration
+	gcsCredentialsFile string
+	s3CredentialsFile  string
 }
 
 // parseFlags parses command-line arguments and returns them as a summarizeFlags object.
@@ -54,6 +67,14 @@ func parseFlags() summarizeFlags {
 	flag.StringVar(&flags.output, "output", "failure_data.json", "output path")
 	flag.StringVar(&flags.outputSlices, "output_slices", "", "path to slices output (must include PREFIX in template)")
 	flag.IntVar(&flags.numWorkers, "num_workers", 2*runtime.NumCPU()-1, "number of worker goroutines to spawn for parallelized functions") // This has shown to be a sensible number of workers
+	flag.StringVar(&flags.index, "index", "", "path to a cluster index that keeps cluster IDs stable across runs (created if missing, and rewritten)")
+	flag.DurationVar(&flags.indexRetention, "index_retention", 30*24*time.Hour, "how long clusters stay in the index after they last appeared (0 to keep them forever)")
+	flag.IntVar(&flags.indexMaxSeeds, "index_max_seeds", 5000, "how many of the most recently seen indexed clusters new failures are matched against; each one adds to the clustering time of every unmatched failure (0 for all of them)")
+	flag.StringVar(&flags.artifacts, "artifacts", "", "storage path holding job artifacts to read builds and failures from instead of --builds and tests files, e.g. gs://kubernetes-jenkins or s3://prow-logs")
+	flag.StringVar(&flags.jobs, "jobs", "", "comma-separated names of the jobs to read from --artifacts")
+	flag.DurationVar(&flags.window, "window", 14*24*time.Hour, "how far back to read builds from --artifacts")
+	flag.StringVar(&flags.gcsCredentialsFile, "gcs_credentials_file", "", "path to the GCS credentials file used to read --artifacts")
+	flag.StringVar(&flags.s3CredentialsFile, "s3_credentials_file", "", "path to the S3 credentials file used to read --artifacts")
 	flag.BoolVar(&flags.memoize, "memoize", false, "whether to memoize certain function results to JSON (and use previously memoized results if they exist)")
 
 	flag.Parse()
@@ -64,6 +85,9 @@ func parseFlags() summarizeFlags {
 	if !(strings.Contains(flags.outputSlices, "PREFIX")) {
 		klog.Fatalf("'PREFIX' not in output_slices flag")
 	}
+	if flags.artifacts != "" && flags.jobs == "" {
+		klog.Fatalf("--jobs is required with --artifacts")
+	}
 
 	return flags
 }
@@ -92,7 +116,14 @@ func summarize(flags summarizeFlags) {
 	// Log flag info
 	klog.V(1).Infof("Running with %d workers (%d detected CPUs)", flags.numWorkers, runtime.NumCPU())
 
-	builds, failedTests, err := loadFailures(flags.builds, flags.tests, flags.memoize)
+	var builds map[string]build
+	var failedTests map[string][]failure
+	var err error
+	if flags.artifacts != "" {
+		builds, failedTests, err = loadFailuresFromArtifacts(flags)
+	} else {
+		builds, failedTests, err = loadFailures(flags.builds, flags.tests, flags.memoize)
+	}
 	if err != nil {
 		klog.Fatalf("Could not load failures: %s", err)
 	}
@@ -106,14 +137,33 @@ func summarize(flags summarizeFlags) {
 		}
 	}
 
+	var index *clusterIndex
+	if flags.index != "" {
+		klog.V(2).Infof("Loading cluster index")
+		index, err = loadIndex(flags.index)
+		if err != nil {
+			klog.Fatalf("Could not load cluster index: %s", err)
+		}
+		previousClustered = append(index.seeds(flags.indexMaxSeeds), previousClustered...)
+	}
+
 	clusteredLocal := clusterLocal(failedTests, flags.numWorkers, flags.memoize)
 
 	clustered := clusterGlobal(clusteredLocal, previousClustered, flags.memoize)
 
+	if index != nil {
+		metrics := index.update(clustered, time.Now(), flags.indexRetention)
+		klog.V(0).Infof("Cluster index: %d clusters, %d new (%d failures), %d growing, %d expired",
+			metrics.Clusters, metrics.New, metrics.NewFailures, metrics.Growing, metrics.Expired)
+	}
+
 	klog.V(2).Infof("Rendering results...")
 	start := time.Now()
 
 	data := render(builds, clustered)
+	if index != nil {
+		index.assignIDs(&data)
+	}
 
 	// Load the owners from the file, if given
 	var owners map[string][]string
@@ -133,6 +183,13 @@ func summarize(flags summarizeFlags) {
 		klog.Warningf("Could not write results to file: %s", err)
 	}
 
+	if index != nil {
+		err = writeIndex(flags.index, index)
+		if err != nil {
+			klog.Warningf("Could not write cluster index to file: %s", err)
+		}
+	}
+
 	if flags.outputSlices != "" {
 		for subset := 0; subset < 256; subset++ {
 			idPrefix := fmt.Sprintf("%02x", subset)
@@ -162,6 +219,30 @@ func summarize(flags summarizeFlags) {
 	klog.V(0).Infof("Finished rendering results in %s", time.Since(start).String())
 }
 
+// loadFailuresFromArtifacts reads the builds and failures of the jobs given by flags from their artifacts.
+func loadFailuresFromArtifacts(flags summarizeFlags) (map[string]build, map[string][]failure, error) {
+	ctx := context.Background()
+	opener, err := pkgio.NewOpener(ctx, flags.gcsCredentialsFile, flags.s3CredentialsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not create opener: %s", err)
+	}
+
+	var jobs []string
+	for _, job := range strings.Split(flags.jobs, ",") {
+		if job = strings.TrimSpace(job); job != "" {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return loadArtifacts(ctx, artifactSource{
+		opener:     opener,
+		bucket:     flags.artifacts,
+		jobs:       jobs,
+		since:      time.Now().Add(-flags.window),
+		numWorkers: flags.numWorkers,
+	})
+}
+
 func Main() {
 	summarize(parseFlags())
 }